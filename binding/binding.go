@@ -0,0 +1,354 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package binding
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/xfali/restclient/v2"
+	"github.com/xfali/restclient/v2/request"
+	"github.com/xfali/restclient/v2/restutil"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+)
+
+const (
+	// 请求方法tag，如method:"GET"
+	TagMethod = "method"
+	// 路径模板tag，path参数使用{name}占位，如path:"/users/{id}"
+	TagPath = "path"
+	// 参数绑定tag，按顺序对应函数的参数（context.Context及request.Opt参数除外），以逗号分隔：
+	// path:name 替换路径中的{name}
+	// query:name 添加query参数，参数为slice时添加多个值，为nil指针时忽略
+	// header:name 添加请求header，参数为slice时添加多个值，为nil指针时忽略
+	// body 作为请求body，使用client的转换器序列化
+	TagArgs = "args"
+)
+
+var (
+	contextType  = reflect.TypeOf((*context.Context)(nil)).Elem()
+	optType      = reflect.TypeOf(request.Opt(nil))
+	errorType    = reflect.TypeOf((*error)(nil)).Elem()
+	responseType = reflect.TypeOf((*http.Response)(nil))
+)
+
+// Binder 根据struct中函数类型字段的tag生成请求实现，类似Retrofit、Feign：
+//
+//	type UserApi struct {
+//		Get    func(ctx context.Context, id int) (*User, error)          `method:"GET" path:"/users/{id}" args:"path:id"`
+//		List   func(page int, opts ...request.Opt) ([]User, error)       `method:"GET" path:"/users" args:"query:page"`
+//		Create func(token string, user *User) (*User, *http.Response, error) `method:"POST" path:"/users" args:"header:X-Token,body"`
+//		Delete func(id int) error                                        `method:"DELETE" path:"/users/{id}" args:"path:id"`
+//	}
+//
+// 函数的返回值支持：error；(T, error)；(T, *http.Response, error)，T为应答body反序列化的结果
+// 函数参数中的context.Context作为请求的context，request.Opt（包括可变参数）作为请求的额外配置
+type Binder struct {
+	client  restclient.RestClient
+	baseUrl string
+	opts    []request.Opt
+}
+
+type Opt func(*Binder)
+
+// New 创建Binder，baseUrl为所有路径的前缀，如http://localhost:8080/api
+func New(client restclient.RestClient, baseUrl string, opts ...Opt) *Binder {
+	ret := &Binder{
+		client:  client,
+		baseUrl: strings.TrimSuffix(baseUrl, "/"),
+	}
+	for _, opt := range opts {
+		opt(ret)
+	}
+	return ret
+}
+
+// OptSetRequestOpts 配置所有请求的默认配置，如认证filter、超时
+func OptSetRequestOpts(opts ...request.Opt) Opt {
+	return func(b *Binder) {
+		b.opts = append(b.opts, opts...)
+	}
+}
+
+// Bind 为api（struct指针）中带method tag的函数字段生成实现，tag配置错误时返回error
+func (b *Binder) Bind(api interface{}) error {
+	v := reflect.ValueOf(api)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return errors.New("binding: api must be a pointer to struct")
+	}
+	v = v.Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		method, ok := field.Tag.Lookup(TagMethod)
+		if !ok {
+			continue
+		}
+		if field.Type.Kind() != reflect.Func {
+			return fmt.Errorf("binding: field %s must be func", field.Name)
+		}
+		if !v.Field(i).CanSet() {
+			return fmt.Errorf("binding: field %s must be exported", field.Name)
+		}
+		e, err := b.parse(field, method)
+		if err != nil {
+			return err
+		}
+		v.Field(i).Set(reflect.MakeFunc(field.Type, e.call))
+	}
+	return nil
+}
+
+// Bind 使用client及baseUrl为api生成实现，见Binder
+func Bind(client restclient.RestClient, baseUrl string, api interface{}, opts ...Opt) error {
+	return New(client, baseUrl, opts...).Bind(api)
+}
+
+type argKind int
+
+const (
+	argContext argKind = iota
+	argOpt
+	argOpts
+	argPath
+	argQuery
+	argHeader
+	argBody
+)
+
+type arg struct {
+	kind argKind
+	name string
+}
+
+type endpoint struct {
+	binder   *Binder
+	name     string
+	method   string
+	path     string
+	args     []arg
+	funcType reflect.Type
+	// 返回值中result及response的位置，不存在时为-1
+	result   int
+	response int
+}
+
+func (b *Binder) parse(field reflect.StructField, method string) (*endpoint, error) {
+	ft := field.Type
+	e := &endpoint{
+		binder:   b,
+		name:     field.Name,
+		method:   strings.ToUpper(method),
+		path:     field.Tag.Get(TagPath),
+		funcType: ft,
+		result:   -1,
+		response: -1,
+	}
+	fail := func(format string, args ...interface{}) error {
+		return fmt.Errorf("binding: field %s: %s", field.Name, fmt.Sprintf(format, args...))
+	}
+
+	var tags []string
+	if s := strings.TrimSpace(field.Tag.Get(TagArgs)); s != "" {
+		tags = strings.Split(s, ",")
+	}
+	for i := 0; i < ft.NumIn(); i++ {
+		in := ft.In(i)
+		switch {
+		case ft.IsVariadic() && i == ft.NumIn()-1 && in.Elem() == optType:
+			e.args = append(e.args, arg{kind: argOpts})
+			continue
+		case in == optType:
+			e.args = append(e.args, arg{kind: argOpt})
+			continue
+		case in.Implements(contextType) && in.Kind() == reflect.Interface:
+			e.args = append(e.args, arg{kind: argContext})
+			continue
+		}
+		if len(tags) == 0 {
+			return nil, fail("missing %s tag for parameter %d", TagArgs, i)
+		}
+		tag := strings.TrimSpace(tags[0])
+		tags = tags[1:]
+		kind, name := tag, ""
+		if j := strings.Index(tag, ":"); j != -1 {
+			kind, name = strings.TrimSpace(tag[:j]), strings.TrimSpace(tag[j+1:])
+		}
+		switch kind {
+		case "path":
+			if !strings.Contains(e.path, "{"+name+"}") {
+				return nil, fail("path variable {%s} not found in %s", name, e.path)
+			}
+			e.args = append(e.args, arg{kind: argPath, name: name})
+		case "query":
+			e.args = append(e.args, arg{kind: argQuery, name: name})
+		case "header":
+			e.args = append(e.args, arg{kind: argHeader, name: name})
+		case "body":
+			e.args = append(e.args, arg{kind: argBody})
+		default:
+			return nil, fail("unknown binding %q", tag)
+		}
+		if kind != "body" && name == "" {
+			return nil, fail("binding %q missing name", tag)
+		}
+	}
+	if len(tags) > 0 {
+		return nil, fail("%s tag has more bindings than parameters", TagArgs)
+	}
+
+	n := ft.NumOut()
+	if n == 0 || n > 3 || ft.Out(n-1) != errorType {
+		return nil, fail("must return error as the last value")
+	}
+	switch n {
+	case 2:
+		e.result = 0
+	case 3:
+		if ft.Out(1) != responseType {
+			return nil, fail("the second return value must be *http.Response")
+		}
+		e.result, e.response = 0, 1
+	}
+	return e, nil
+}
+
+func (e *endpoint) call(in []reflect.Value) []reflect.Value {
+	builder := restutil.NewUrlBuilder(e.binder.baseUrl+e.path).Delims("{", "}")
+	query := url.Values{}
+	opts := make([]request.Opt, 0, len(e.binder.opts)+len(in)+4)
+	opts = append(opts, request.WithMethod(e.method), request.WithRoute(e.path))
+	opts = append(opts, e.binder.opts...)
+
+	for i, a := range e.args {
+		v := in[i]
+		switch a.kind {
+		case argContext:
+			if !v.IsNil() {
+				opts = append(opts, request.WithRequestContext(v.Interface().(context.Context)))
+			}
+		case argOpt:
+			if !v.IsNil() {
+				opts = append(opts, v.Interface().(request.Opt))
+			}
+		case argOpts:
+			for j := 0; j < v.Len(); j++ {
+				if o := v.Index(j); !o.IsNil() {
+					opts = append(opts, o.Interface().(request.Opt))
+				}
+			}
+		case argPath:
+			builder.PathVariable(a.name, indirect(v).Interface())
+		case argQuery:
+			for _, s := range values(v) {
+				query.Add(a.name, s)
+			}
+		case argHeader:
+			for _, s := range values(v) {
+				opts = append(opts, request.AddRequestHeader(a.name, s))
+			}
+		case argBody:
+			if !isNil(v) {
+				opts = append(opts, request.WithRequestBody(v.Interface()))
+			}
+		}
+	}
+
+	u := builder.Build()
+	if len(query) > 0 {
+		if strings.Contains(u, "?") {
+			u += "&" + query.Encode()
+		} else {
+			u += "?" + query.Encode()
+		}
+	}
+
+	var result reflect.Value
+	if e.result != -1 {
+		rt := e.funcType.Out(e.result)
+		if rt.Kind() == reflect.Ptr {
+			result = reflect.New(rt.Elem())
+		} else {
+			result = reflect.New(rt)
+		}
+		opts = append(opts, request.WithResult(result.Interface()))
+	}
+	var resp *http.Response
+	if e.response != -1 {
+		resp = &http.Response{}
+		opts = append(opts, request.WithResponse(resp, false))
+	}
+
+	err := e.binder.client.Exchange(u, opts...)
+	out := make([]reflect.Value, e.funcType.NumOut())
+	if e.result != -1 {
+		if e.funcType.Out(e.result).Kind() == reflect.Ptr {
+			out[e.result] = result
+		} else {
+			out[e.result] = result.Elem()
+		}
+		if err != nil {
+			out[e.result] = reflect.Zero(e.funcType.Out(e.result))
+		}
+	}
+	if e.response != -1 {
+		out[e.response] = reflect.ValueOf(resp)
+	}
+	if err != nil {
+		out[len(out)-1] = reflect.ValueOf(error(err))
+	} else {
+		out[len(out)-1] = reflect.Zero(errorType)
+	}
+	return out
+}
+
+func isNil(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice:
+		return v.IsNil()
+	}
+	return false
+}
+
+func indirect(v reflect.Value) reflect.Value {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return v
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+// values 获得query、header参数的字符串值，nil指针返回空，slice返回每个元素的值
+func values(v reflect.Value) []string {
+	if isNil(v) && v.Kind() != reflect.Slice {
+		return nil
+	}
+	v = indirect(v)
+	if v.Kind() == reflect.Slice || v.Kind() == reflect.Array {
+		ret := make([]string, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			ret = append(ret, fmt.Sprint(indirect(v.Index(i)).Interface()))
+		}
+		return ret
+	}
+	return []string{fmt.Sprint(v.Interface())}
+}
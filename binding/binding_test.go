@@ -0,0 +1,113 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package binding
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/xfali/restclient/v2"
+	"github.com/xfali/restclient/v2/request"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type user struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type userApi struct {
+	Get    func(ctx context.Context, id int) (*user, error)                   `method:"GET" path:"/users/{id}" args:"path:id"`
+	List   func(page int, tags []string, opts ...request.Opt) ([]user, error) `method:"GET" path:"/users" args:"query:page,query:tag"`
+	Create func(token string, u *user) (user, *http.Response, error)          `method:"POST" path:"/users" args:"header:X-Token,body"`
+	Delete func(id string) error                                              `method:"DELETE" path:"/users/{id}" args:"path:id"`
+	Other  func() error
+}
+
+func TestBind(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		writer.Header().Set("Content-Type", "application/json")
+		switch {
+		case req.Method == http.MethodGet && req.URL.Path == "/api/users":
+			q := req.URL.Query()
+			_ = json.NewEncoder(writer).Encode([]user{{ID: q.Get("page"), Name: strings.Join(q["tag"], "|") + req.Header.Get("X-Extra")}})
+		case req.Method == http.MethodGet:
+			_ = json.NewEncoder(writer).Encode(user{ID: strings.TrimPrefix(req.URL.Path, "/api/users/"), Name: "get"})
+		case req.Method == http.MethodPost:
+			u := user{}
+			_ = json.NewDecoder(req.Body).Decode(&u)
+			u.ID = req.Header.Get("X-Token")
+			writer.WriteHeader(http.StatusCreated)
+			_ = json.NewEncoder(writer).Encode(u)
+		case req.Method == http.MethodDelete:
+			writer.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	api := &userApi{}
+	if err := Bind(restclient.New(), server.URL+"/api/", api); err != nil {
+		t.Fatal(err)
+	}
+	if api.Other != nil {
+		t.Fatal("expect untagged field not bound")
+	}
+
+	u, err := api.Get(context.Background(), 1)
+	if err != nil || u.ID != "1" || u.Name != "get" {
+		t.Fatal(u, err)
+	}
+	list, err := api.List(2, []string{"a", "b"}, request.AddRequestHeader("X-Extra", "!"))
+	if err != nil || len(list) != 1 || list[0].ID != "2" || list[0].Name != "a|b!" {
+		t.Fatal(list, err)
+	}
+	created, resp, err := api.Create("token", &user{Name: "new"})
+	if err != nil || created.ID != "token" || created.Name != "new" || resp.StatusCode != http.StatusCreated {
+		t.Fatal(created, err)
+	}
+	err = api.Delete("1")
+	if e, ok := err.(restclient.Error); !ok || e.StatusCode() != http.StatusNotFound {
+		t.Fatal(err)
+	}
+}
+
+func TestBindError(t *testing.T) {
+	cases := []interface{}{
+		userApi{},
+		&struct {
+			F func(id int) error `method:"GET" path:"/users/{id}"`
+		}{},
+		&struct {
+			F func(id int) error `method:"GET" path:"/users" args:"path:id"`
+		}{},
+		&struct {
+			F func(id int) (string, string) `method:"GET" path:"/users/{id}" args:"path:id"`
+		}{},
+		&struct {
+			F func() error `method:"GET" path:"/users" args:"body"`
+		}{},
+	}
+	for i, v := range cases {
+		if err := Bind(restclient.New(), "http://localhost", v); err == nil {
+			t.Fatal("expect error ", i)
+		} else {
+			t.Log(err)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package buffer
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// Capture 记录body的前limit个字节及总长度，用于日志、HAR等记录body的filter
+// 请求body由Transport在其他goroutine中发送，因此需要加锁
+type Capture struct {
+	limit int
+	lock  sync.Mutex
+	buf   bytes.Buffer
+	size  int64
+}
+
+// NewCapture 创建Capture，limit小于等于0时只记录总长度
+func NewCapture(limit int) *Capture {
+	return &Capture{
+		limit: limit,
+	}
+}
+
+func (c *Capture) Write(p []byte) (int, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.size += int64(len(p))
+	if remain := c.limit - c.buf.Len(); remain > 0 {
+		if len(p) > remain {
+			c.buf.Write(p[:remain])
+		} else {
+			c.buf.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
+// Snapshot 获得已记录内容的副本及body的总长度
+func (c *Capture) Snapshot() ([]byte, int64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return append([]byte(nil), c.buf.Bytes()...), c.size
+}
+
+// CaptureBody 包装body，读取时记录到capture
+// 读取结束或关闭时调用一次done，读取出错时err为该错误，否则为nil，done可以为nil
+// body实现了ContentLength接口时返回值同样实现
+func CaptureBody(body io.ReadCloser, capture *Capture, done func(err error)) io.ReadCloser {
+	ret := &captureBody{ReadCloser: body, capture: capture, done: done}
+	if cl, ok := body.(ContentLength); ok {
+		// 保留ContentLength接口，以便后续ContentLengthFilter使用
+		return &captureBodyWithLength{captureBody: ret, cl: cl}
+	}
+	return ret
+}
+
+// CaptureRequest 记录请求body，请求没有body时返回nil
+// body实现了Bytes方法（如ReadWriteCloser）时直接读取，否则替换body，在发送时记录
+func CaptureRequest(request *http.Request, limit int) *Capture {
+	if request.Body == nil || request.Body == http.NoBody {
+		return nil
+	}
+	capture := NewCapture(limit)
+	if b, ok := request.Body.(interface{ Bytes() []byte }); ok {
+		_, _ = capture.Write(b.Bytes())
+		return capture
+	}
+	request.Body = CaptureBody(request.Body, capture, nil)
+	return capture
+}
+
+type captureBody struct {
+	io.ReadCloser
+	capture *Capture
+	once    sync.Once
+	done    func(err error)
+}
+
+func (b *captureBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	_, _ = b.capture.Write(p[:n])
+	if err != nil {
+		if err == io.EOF {
+			b.finish(nil)
+		} else {
+			b.finish(err)
+		}
+	}
+	return n, err
+}
+
+func (b *captureBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.finish(nil)
+	return err
+}
+
+func (b *captureBody) finish(err error) {
+	if b.done != nil {
+		b.once.Do(func() {
+			b.done(err)
+		})
+	}
+}
+
+type captureBodyWithLength struct {
+	*captureBody
+	cl ContentLength
+}
+
+func (b *captureBodyWithLength) ContentLength() int64 {
+	return b.cl.ContentLength()
+}
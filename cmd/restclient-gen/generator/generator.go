@@ -0,0 +1,390 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// 默认生成的客户端类型名称
+	DefaultClientName = "Client"
+)
+
+// Config 代码生成配置
+type Config struct {
+	// 生成代码的包名
+	Package string
+	// 客户端类型名称，默认为DefaultClientName
+	ClientName string
+}
+
+type generator struct {
+	spec *Spec
+	cfg  Config
+
+	models  bytes.Buffer
+	methods bytes.Buffer
+	// 已使用的类型名称
+	names map[string]bool
+	// components.schemas名称到Go类型名称
+	schemaNames map[string]string
+	// struct类型，作为结果时返回指针
+	structs map[string]bool
+	// 命名类型的底层类型
+	underlying map[string]string
+	needTime   bool
+}
+
+// Generate 根据OpenAPI文档生成模型及客户端代码
+func Generate(spec *Spec, cfg Config) ([]byte, error) {
+	if cfg.Package == "" {
+		return nil, fmt.Errorf("package name is required")
+	}
+	if cfg.ClientName == "" {
+		cfg.ClientName = DefaultClientName
+	}
+	g := &generator{
+		spec:        spec,
+		cfg:         cfg,
+		names:       map[string]bool{},
+		schemaNames: map[string]string{},
+		structs:     map[string]bool{},
+		underlying:  map[string]string{},
+	}
+	for _, v := range []string{cfg.ClientName, "New" + cfg.ClientName, "ApiError", "DefaultBaseUrl"} {
+		g.names[v] = true
+	}
+	if err := g.generate(); err != nil {
+		return nil, err
+	}
+	src := g.source()
+	ret, err := format.Source(src)
+	if err != nil {
+		return src, fmt.Errorf("format generated code failed: %v", err)
+	}
+	return ret, nil
+}
+
+func (g *generator) generate() error {
+	schemas := sortedKeys(g.spec.Components.Schemas)
+	// 先为所有schema分配名称，以便相互引用
+	for _, name := range schemas {
+		g.schemaNames[name] = g.newName(exportedName(name), "Model")
+	}
+	for _, name := range schemas {
+		if err := g.defineSchema(g.schemaNames[name], g.spec.Components.Schemas[name]); err != nil {
+			return fmt.Errorf("schema %s: %v", name, err)
+		}
+	}
+
+	paths := sortedKeys(g.spec.Paths)
+	count := 0
+	for _, path := range paths {
+		item := g.spec.Paths[path]
+		for _, v := range item.operations() {
+			if err := g.operation(path, v.method, item, v.op); err != nil {
+				return fmt.Errorf("%s %s: %v", v.method, path, err)
+			}
+			count++
+		}
+	}
+	if count == 0 {
+		return fmt.Errorf("no operations found")
+	}
+	return nil
+}
+
+// newName 获得未使用的类型名称，冲突时添加后缀
+func (g *generator) newName(name, suffix string) string {
+	ret := name
+	for i := 2; g.names[ret]; i++ {
+		ret = name + suffix
+		if i > 2 {
+			ret += strconv.Itoa(i - 1)
+		}
+	}
+	g.names[ret] = true
+	return ret
+}
+
+func (g *generator) defineSchema(name string, s *Schema) error {
+	switch {
+	case s.Ref != "":
+		t, err := g.goType(s, name)
+		if err != nil {
+			return err
+		}
+		g.underlying[name] = t
+		g.comment(&g.models, name, s.Description)
+		fmt.Fprintf(&g.models, "type %s = %s\n\n", name, t)
+	case isObject(s) && (len(s.Properties) > 0 || len(s.AllOf) > 0):
+		return g.defineStruct(name, s)
+	case s.Type == "string" && len(s.Enum) > 0:
+		g.underlying[name] = "string"
+		g.defineEnum(name, s)
+	default:
+		t, err := g.goType(s, name+"Item")
+		if err != nil {
+			return err
+		}
+		g.underlying[name] = t
+		g.comment(&g.models, name, s.Description)
+		fmt.Fprintf(&g.models, "type %s %s\n\n", name, t)
+	}
+	return nil
+}
+
+func isObject(s *Schema) bool {
+	return s.Type == "object" || (s.Type == "" && (len(s.Properties) > 0 || len(s.AllOf) > 0))
+}
+
+// properties 获得schema（包括allOf）的所有属性及必需属性
+func (g *generator) properties(s *Schema, props map[string]*Schema, required map[string]bool) error {
+	for _, v := range s.AllOf {
+		if v.Ref != "" {
+			name, err := refName(v.Ref, "schemas")
+			if err != nil {
+				return err
+			}
+			ref, ok := g.spec.Components.Schemas[name]
+			if !ok {
+				return fmt.Errorf("schema %q not found", v.Ref)
+			}
+			v = ref
+		}
+		if err := g.properties(v, props, required); err != nil {
+			return err
+		}
+	}
+	for k, v := range s.Properties {
+		props[k] = v
+	}
+	for _, v := range s.Required {
+		required[v] = true
+	}
+	return nil
+}
+
+func (g *generator) defineStruct(name string, s *Schema) error {
+	g.structs[name] = true
+	start := g.models.Len()
+	props := map[string]*Schema{}
+	required := map[string]bool{}
+	if err := g.properties(s, props, required); err != nil {
+		return err
+	}
+	// 先生成字段类型，内嵌类型定义在当前类型之后
+	type field struct {
+		name, typ, tag, desc string
+	}
+	var fields []field
+	used := map[string]bool{}
+	for _, p := range sortedKeys(props) {
+		ps := props[p]
+		t, err := g.goType(ps, name+exportedName(p))
+		if err != nil {
+			return fmt.Errorf("property %s: %v", p, err)
+		}
+		tag := p
+		if !required[p] {
+			t = optional(t)
+			tag += ",omitempty"
+		}
+		fieldName := exportedName(p)
+		for used[fieldName] {
+			fieldName += "_"
+		}
+		used[fieldName] = true
+		fields = append(fields, field{fieldName, t, tag, ps.Description})
+	}
+
+	buf := bytes.Buffer{}
+	g.comment(&buf, name, s.Description)
+	fmt.Fprintf(&buf, "type %s struct {\n", name)
+	for _, f := range fields {
+		if f.desc != "" {
+			for _, line := range strings.Split(strings.TrimSpace(f.desc), "\n") {
+				fmt.Fprintf(&buf, "\t// %s\n", line)
+			}
+		}
+		fmt.Fprintf(&buf, "\t%s %s `json:\"%s\"`\n", f.name, f.typ, f.tag)
+	}
+	buf.WriteString("}\n\n")
+	// 插入到内嵌类型之前
+	nested := append([]byte(nil), g.models.Bytes()[start:]...)
+	g.models.Truncate(start)
+	g.models.Write(buf.Bytes())
+	g.models.Write(nested)
+	return nil
+}
+
+func (g *generator) defineEnum(name string, s *Schema) {
+	g.comment(&g.models, name, s.Description)
+	fmt.Fprintf(&g.models, "type %s string\n\n", name)
+	g.models.WriteString("const (\n")
+	used := map[string]bool{}
+	for _, v := range s.Enum {
+		value := fmt.Sprint(v)
+		constName := name + exportedName(value)
+		for used[constName] || g.names[constName] {
+			constName += "_"
+		}
+		used[constName] = true
+		fmt.Fprintf(&g.models, "\t%s %s = %s\n", constName, name, strconv.Quote(value))
+	}
+	g.models.WriteString(")\n\n")
+}
+
+// optional 非必需的字段，基础类型及struct使用指针
+func optional(t string) string {
+	if strings.HasPrefix(t, "[]") || strings.HasPrefix(t, "map[") || strings.HasPrefix(t, "*") ||
+		t == "interface{}" {
+		return t
+	}
+	return "*" + t
+}
+
+// goType 获得schema对应的Go类型，hint为需要定义新类型时使用的名称
+func (g *generator) goType(s *Schema, hint string) (string, error) {
+	if s == nil {
+		return "interface{}", nil
+	}
+	if s.Ref != "" {
+		name, err := refName(s.Ref, "schemas")
+		if err != nil {
+			return "", err
+		}
+		t, ok := g.schemaNames[name]
+		if !ok {
+			return "", fmt.Errorf("schema %q not found", s.Ref)
+		}
+		return t, nil
+	}
+	if len(s.AllOf) == 1 && len(s.Properties) == 0 {
+		return g.goType(s.AllOf[0], hint)
+	}
+	if len(s.OneOf) > 0 || len(s.AnyOf) > 0 {
+		return "interface{}", nil
+	}
+	switch s.Type {
+	case "string":
+		switch s.Format {
+		case "date-time":
+			g.needTime = true
+			return "time.Time", nil
+		case "byte", "binary":
+			return "[]byte", nil
+		}
+		if len(s.Enum) > 0 {
+			name := g.newName(hint, "Enum")
+			g.defineEnum(name, s)
+			return name, nil
+		}
+		return "string", nil
+	case "integer":
+		if s.Format == "int32" {
+			return "int32", nil
+		}
+		return "int64", nil
+	case "number":
+		if s.Format == "float" {
+			return "float32", nil
+		}
+		return "float64", nil
+	case "boolean":
+		return "bool", nil
+	case "array":
+		t, err := g.goType(s.Items, hint+"Item")
+		if err != nil {
+			return "", err
+		}
+		return "[]" + t, nil
+	}
+	if isObject(s) {
+		if len(s.Properties) > 0 || len(s.AllOf) > 0 {
+			name := g.newName(hint, "Object")
+			return name, g.defineStruct(name, s)
+		}
+		if s.AdditionalProperties != nil && s.AdditionalProperties.Schema != nil {
+			t, err := g.goType(s.AdditionalProperties.Schema, hint+"Value")
+			if err != nil {
+				return "", err
+			}
+			return "map[string]" + t, nil
+		}
+		return "map[string]interface{}", nil
+	}
+	return "interface{}", nil
+}
+
+func (g *generator) comment(buf *bytes.Buffer, name, desc string) {
+	desc = strings.TrimSpace(desc)
+	if desc == "" {
+		return
+	}
+	for i, line := range strings.Split(desc, "\n") {
+		if i == 0 {
+			fmt.Fprintf(buf, "// %s %s\n", name, line)
+		} else {
+			fmt.Fprintf(buf, "// %s\n", line)
+		}
+	}
+}
+
+// content 选择媒体类型，优先使用json
+func content(m map[string]*MediaType) (string, *MediaType) {
+	keys := sortedKeys(m)
+	for _, k := range keys {
+		if k == "application/json" || strings.HasSuffix(k, "+json") {
+			return k, m[k]
+		}
+	}
+	if len(keys) > 0 {
+		return keys[0], m[keys[0]]
+	}
+	return "", nil
+}
+
+func sortedKeys(m interface{}) []string {
+	var ret []string
+	switch v := m.(type) {
+	case map[string]*Schema:
+		for k := range v {
+			ret = append(ret, k)
+		}
+	case map[string]*PathItem:
+		for k := range v {
+			ret = append(ret, k)
+		}
+	case map[string]*MediaType:
+		for k := range v {
+			ret = append(ret, k)
+		}
+	case map[string]*Response:
+		for k := range v {
+			ret = append(ret, k)
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
@@ -0,0 +1,145 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package generator
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+func TestGenerate(t *testing.T) {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", "petstore.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec, err := Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, err := Generate(spec, Config{Package: "petstore"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden := filepath.Join("..", "internal", "petstore", "client.go")
+	if *update {
+		if err := ioutil.WriteFile(golden, src, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expect, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(src, expect) {
+		t.Fatal("generated code differs from golden file, run go test -update to regenerate")
+	}
+}
+
+func TestParseJSON(t *testing.T) {
+	spec, err := Parse([]byte(`{
+  "openapi": "3.1.0",
+  "info": {"title": "demo", "version": "1"},
+  "paths": {
+    "/users/{id}": {
+      "get": {
+        "operationId": "getUser",
+        "parameters": [{"name": "id", "in": "path", "required": true, "schema": {"type": "integer"}}],
+        "responses": {"200": {"description": "ok", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/User"}}}}}
+      }
+    }
+  },
+  "components": {"schemas": {"User": {"type": "object", "properties": {"id": {"type": "integer"}, "url": {"type": "string"}}}}}
+}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, err := Generate(spec, Config{Package: "demo", ClientName: "UserClient"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := string(src)
+	for _, s := range []string{
+		"type UserClient struct",
+		"func (c *UserClient) GetUser(ctx context.Context, id int64, opts ...request.Opt) (*User, error)",
+		"URL *string `json:\"url,omitempty\"`",
+	} {
+		if !strings.Contains(code, s) {
+			t.Fatal("expect ", s, "\n", code)
+		}
+	}
+	if strings.Contains(code, `"time"`) {
+		t.Fatal("unexpected time import")
+	}
+}
+
+func TestInvalid(t *testing.T) {
+	cases := map[string]string{
+		"swagger": "swagger: \"2.0\"\ninfo:\n  title: a\n",
+		"syntax":  "{",
+		"ref": `openapi: 3.0.0
+paths:
+  /a:
+    get:
+      responses:
+        "200":
+          description: ok
+          content:
+            application/json:
+              schema:
+                $ref: "#/components/schemas/Missing"
+`,
+	}
+	for name, doc := range cases {
+		t.Run(name, func(t *testing.T) {
+			spec, err := Parse([]byte(doc))
+			if err == nil {
+				_, err = Generate(spec, Config{Package: "a"})
+			}
+			if err == nil {
+				t.Fatal("expect error")
+			}
+			t.Log(err)
+		})
+	}
+	if _, err := Generate(&Spec{OpenAPI: "3.0.0"}, Config{}); err == nil {
+		t.Fatal("expect package required")
+	}
+}
+
+func TestNames(t *testing.T) {
+	cases := map[string]string{
+		"petId":         "PetID",
+		"X-Request-ID":  "XRequestID",
+		"list_all_pets": "ListAllPets",
+		"2fa":           "N2fa",
+		"api_url":       "APIURL",
+	}
+	for k, v := range cases {
+		if n := exportedName(k); n != v {
+			t.Fatalf("%s expect %s but get %s", k, v, n)
+		}
+	}
+	if n := localName("type"); n != "typeParam" {
+		t.Fatal(n)
+	}
+}
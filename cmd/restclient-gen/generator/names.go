@@ -0,0 +1,102 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package generator
+
+import (
+	"go/token"
+	"strings"
+	"unicode"
+)
+
+// 按golint规则大写的缩写
+var initialisms = map[string]bool{
+	"API": true, "ID": true, "URL": true, "URI": true, "HTTP": true, "HTTPS": true, "JSON": true, "XML": true,
+	"UUID": true, "IP": true, "SQL": true, "TLS": true, "TTL": true, "UID": true, "HTML": true, "CPU": true,
+}
+
+// words 按非字母数字字符及大小写边界拆分单词
+func words(s string) []string {
+	var ret []string
+	var cur []rune
+	flush := func() {
+		if len(cur) > 0 {
+			ret = append(ret, string(cur))
+			cur = cur[:0]
+		}
+	}
+	runes := []rune(s)
+	for i, r := range runes {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			flush()
+			continue
+		}
+		if unicode.IsUpper(r) && len(cur) > 0 {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				flush()
+			}
+		}
+		cur = append(cur, r)
+	}
+	flush()
+	return ret
+}
+
+// exportedName 转换为导出的Go标识符，如pet_id转换为PetID
+func exportedName(s string) string {
+	b := strings.Builder{}
+	for _, w := range words(s) {
+		upper := strings.ToUpper(w)
+		if initialisms[upper] {
+			b.WriteString(upper)
+			continue
+		}
+		r := []rune(strings.ToLower(w))
+		r[0] = unicode.ToUpper(r[0])
+		b.WriteString(string(r))
+	}
+	ret := b.String()
+	if ret == "" {
+		return "X"
+	}
+	if unicode.IsDigit([]rune(ret)[0]) {
+		ret = "N" + ret
+	}
+	return ret
+}
+
+// localName 转换为非导出的Go标识符，如PetID转换为petID
+func localName(s string) string {
+	ws := words(s)
+	if len(ws) == 0 {
+		return "v"
+	}
+	b := strings.Builder{}
+	b.WriteString(strings.ToLower(ws[0]))
+	if len(ws) > 1 {
+		b.WriteString(exportedName(strings.Join(ws[1:], "_")))
+	}
+	ret := b.String()
+	if unicode.IsDigit([]rune(ret)[0]) {
+		ret = "n" + ret
+	}
+	if token.IsKeyword(ret) {
+		ret += "Param"
+	}
+	return ret
+}
@@ -0,0 +1,478 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type param struct {
+	name     string
+	in       string
+	field    string
+	typ      string
+	required bool
+	desc     string
+}
+
+func (p *param) isSlice() bool {
+	return strings.HasPrefix(p.typ, "[]")
+}
+
+// params 合并path及操作的参数，操作的参数覆盖同名参数，返回path参数（按路径中的顺序）及query、header参数
+func (g *generator) params(path, method string, item *PathItem, op *Operation) ([]*param, []*param, error) {
+	var all []*Parameter
+	index := map[string]int{}
+	for _, list := range [][]*Parameter{item.Parameters, op.Parameters} {
+		for _, v := range list {
+			p, err := g.spec.parameter(v)
+			if err != nil {
+				return nil, nil, err
+			}
+			key := p.In + ":" + p.Name
+			if i, ok := index[key]; ok {
+				all[i] = p
+			} else {
+				index[key] = len(all)
+				all = append(all, p)
+			}
+		}
+	}
+
+	var pathParams, others []*param
+	for _, p := range all {
+		v := &param{
+			name:     p.Name,
+			in:       p.In,
+			field:    exportedName(p.Name),
+			required: p.Required || p.In == "path",
+			desc:     p.Description,
+		}
+		t, err := g.goType(p.Schema, exportedName(method+" "+path)+v.field)
+		if err != nil {
+			return nil, nil, fmt.Errorf("parameter %s: %v", p.Name, err)
+		}
+		v.typ = t
+		switch p.In {
+		case "path":
+			if !strings.Contains(path, "{"+p.Name+"}") {
+				return nil, nil, fmt.Errorf("path parameter %s not found in path", p.Name)
+			}
+			pathParams = append(pathParams, v)
+		case "query", "header":
+			if !v.required {
+				v.typ = optional(v.typ)
+			}
+			others = append(others, v)
+		}
+		// cookie参数不支持，可通过request.AddRequestCookies设置
+	}
+	// path参数按在路径中出现的顺序排列
+	for i := 1; i < len(pathParams); i++ {
+		for j := i; j > 0 && strings.Index(path, "{"+pathParams[j].name+"}") < strings.Index(path, "{"+pathParams[j-1].name+"}"); j-- {
+			pathParams[j], pathParams[j-1] = pathParams[j-1], pathParams[j]
+		}
+	}
+	return pathParams, others, nil
+}
+
+func (g *generator) operation(path, method string, item *PathItem, op *Operation) error {
+	name := op.OperationID
+	if name == "" {
+		name = strings.ToLower(method) + " " + path
+	}
+	name = exportedName(name)
+	local := localName(name)
+
+	pathParams, others, err := g.params(path, method, item, op)
+	if err != nil {
+		return err
+	}
+
+	// 请求body
+	var bodyType, contentType string
+	if op.RequestBody != nil {
+		rb, err := g.spec.requestBody(op.RequestBody)
+		if err != nil {
+			return err
+		}
+		ct, mt := content(rb.Content)
+		if mt != nil {
+			contentType = ct
+			bodyType, err = g.goType(mt.Schema, name+"Request")
+			if err != nil {
+				return fmt.Errorf("request body: %v", err)
+			}
+			if g.structs[bodyType] {
+				bodyType = "*" + bodyType
+			}
+		}
+	}
+
+	// 成功的应答及按状态码的错误应答
+	var resultType string
+	var errorModels [][2]string
+	for _, code := range sortedKeys(op.Responses) {
+		resp, err := g.spec.response(op.Responses[code])
+		if err != nil {
+			return err
+		}
+		_, mt := content(resp.Content)
+		if mt == nil || mt.Schema == nil {
+			continue
+		}
+		success := strings.HasPrefix(code, "2")
+		if success && resultType != "" {
+			continue
+		}
+		hint := name + "Response"
+		if !success {
+			hint = name + exportedName(code) + "Error"
+		}
+		t, err := g.goType(mt.Schema, hint)
+		if err != nil {
+			return fmt.Errorf("response %s: %v", code, err)
+		}
+		if success {
+			resultType = t
+		} else {
+			errorModels = append(errorModels, [2]string{strings.ToUpper(code), t})
+		}
+	}
+
+	var paramsType string
+	if len(others) > 0 {
+		paramsType = g.newName(name+"Params", "Type")
+		g.comment(&g.models, paramsType, name+"的query及header参数")
+		fmt.Fprintf(&g.models, "type %s struct {\n", paramsType)
+		for _, p := range others {
+			if p.desc != "" {
+				for _, line := range strings.Split(strings.TrimSpace(p.desc), "\n") {
+					fmt.Fprintf(&g.models, "\t// %s\n", line)
+				}
+			}
+			fmt.Fprintf(&g.models, "\t%s %s\n", p.field, p.typ)
+		}
+		g.models.WriteString("}\n\n")
+	}
+
+	buf := &g.methods
+	errorsVar := "nil"
+	if len(errorModels) > 0 {
+		errorsVar = local + "Errors"
+		fmt.Fprintf(buf, "var %s = map[string]func() interface{}{\n", errorsVar)
+		for _, v := range errorModels {
+			fmt.Fprintf(buf, "\t%s: func() interface{} { return new(%s) },\n", strconv.Quote(v[0]), v[1])
+		}
+		buf.WriteString("}\n\n")
+	}
+
+	// 方法注释及签名
+	summary := strings.TrimSpace(op.Summary)
+	if summary == "" {
+		summary = method + " " + path
+	}
+	fmt.Fprintf(buf, "// %s %s\n", name, summary)
+	if desc := strings.TrimSpace(op.Description); desc != "" {
+		buf.WriteString("//\n")
+		for _, line := range strings.Split(desc, "\n") {
+			fmt.Fprintf(buf, "// %s\n", line)
+		}
+	}
+	if op.Deprecated {
+		buf.WriteString("//\n// Deprecated: the operation is deprecated.\n")
+	}
+	args := []string{"ctx context.Context"}
+	argNames := map[string]bool{"ctx": true, "body": true, "params": true, "opts": true, "builder": true, "query": true, "o": true, "ret": true, "err": true, "c": true}
+	pathArgs := map[*param]string{}
+	for _, p := range pathParams {
+		n := localName(p.name)
+		for argNames[n] {
+			n += "Param"
+		}
+		argNames[n] = true
+		pathArgs[p] = n
+		args = append(args, n+" "+p.typ)
+	}
+	if bodyType != "" {
+		args = append(args, "body "+bodyType)
+	}
+	if paramsType != "" {
+		args = append(args, "params *"+paramsType)
+	}
+	args = append(args, "opts ...request.Opt")
+	returnType := ""
+	if resultType != "" {
+		returnType = resultType
+		if g.structs[resultType] {
+			returnType = "*" + resultType
+		}
+		fmt.Fprintf(buf, "func (c *%s) %s(%s) (%s, error) {\n", g.cfg.ClientName, name, strings.Join(args, ", "), returnType)
+	} else {
+		fmt.Fprintf(buf, "func (c *%s) %s(%s) error {\n", g.cfg.ClientName, name, strings.Join(args, ", "))
+	}
+
+	// 方法实现
+	fmt.Fprintf(buf, "\tbuilder := restutil.NewUrlBuilder(c.baseUrl + %s).Delims(\"{\", \"}\")\n", strconv.Quote(path))
+	for _, p := range pathParams {
+		fmt.Fprintf(buf, "\tbuilder.PathVariable(%s, %s)\n", strconv.Quote(p.name), pathArgs[p])
+	}
+	queryVar := "nil"
+	hasQuery := false
+	for _, p := range others {
+		if p.in == "query" {
+			hasQuery = true
+		}
+	}
+	if hasQuery {
+		queryVar = "query"
+		buf.WriteString("\tquery := url.Values{}\n")
+	}
+	fmt.Fprintf(buf, "\to := []request.Opt{\n\t\trequest.WithRequestContext(ctx),\n\t\trequest.WithMethod(%s),\n\t\trequest.WithRoute(%s),\n\t}\n",
+		strconv.Quote(method), strconv.Quote(path))
+	if paramsType != "" {
+		buf.WriteString("\tif params != nil {\n")
+		for _, p := range others {
+			var add string
+			if p.in == "query" {
+				add = fmt.Sprintf("query.Add(%s, fmt.Sprint(%%s))", strconv.Quote(p.name))
+			} else {
+				add = fmt.Sprintf("o = append(o, request.AddRequestHeader(%s, fmt.Sprint(%%s)))", strconv.Quote(p.name))
+			}
+			switch {
+			case p.isSlice():
+				fmt.Fprintf(buf, "\t\tfor _, v := range params.%s {\n\t\t\t%s\n\t\t}\n", p.field, fmt.Sprintf(add, "v"))
+			case strings.HasPrefix(p.typ, "*"):
+				fmt.Fprintf(buf, "\t\tif params.%s != nil {\n\t\t\t%s\n\t\t}\n", p.field, fmt.Sprintf(add, "*params."+p.field))
+			default:
+				fmt.Fprintf(buf, "\t\t%s\n", fmt.Sprintf(add, "params."+p.field))
+			}
+		}
+		buf.WriteString("\t}\n")
+	}
+	if bodyType != "" {
+		set := fmt.Sprintf("o = append(o, request.AddRequestHeader(\"Content-Type\", %s), request.WithRequestBody(body))", strconv.Quote(contentType))
+		if nilable(bodyType) {
+			fmt.Fprintf(buf, "\tif body != nil {\n\t\t%s\n\t}\n", set)
+		} else {
+			fmt.Fprintf(buf, "\t%s\n", set)
+		}
+	}
+	if resultType != "" {
+		if g.decodable(resultType) {
+			fmt.Fprintf(buf, "\tret := new(%s)\n\to = append(o, request.WithResult(ret))\n", resultType)
+		} else {
+			// restclient的json converter只解析struct、map、slice及interface
+			fmt.Fprintf(buf, "\tret := new(%s)\n\to = append(o, request.WithResult(&jsonValue{ret}))\n", resultType)
+		}
+		fmt.Fprintf(buf, "\tif err := c.exchange(builder, %s, o, opts, %s); err != nil {\n", queryVar, errorsVar)
+		fmt.Fprintf(buf, "\t\treturn %s, err\n\t}\n", zero(returnType))
+		if g.structs[resultType] {
+			buf.WriteString("\treturn ret, nil\n")
+		} else {
+			buf.WriteString("\treturn *ret, nil\n")
+		}
+	} else {
+		fmt.Fprintf(buf, "\treturn c.exchange(builder, %s, o, opts, %s)\n", queryVar, errorsVar)
+	}
+	buf.WriteString("}\n\n")
+	return nil
+}
+
+// decodable 类型是否可以直接作为restclient的解析结果
+func (g *generator) decodable(t string) bool {
+	if g.structs[t] || nilable(t) {
+		return true
+	}
+	if u, ok := g.underlying[t]; ok {
+		return g.decodable(u)
+	}
+	return false
+}
+
+func nilable(t string) bool {
+	return strings.HasPrefix(t, "*") || strings.HasPrefix(t, "[]") || strings.HasPrefix(t, "map[") || t == "interface{}"
+}
+
+func zero(t string) string {
+	if nilable(t) {
+		return "nil"
+	}
+	return "*new(" + t + ")"
+}
+
+func (g *generator) source() []byte {
+	buf := &bytes.Buffer{}
+	buf.WriteString("// Code generated by restclient-gen. DO NOT EDIT.\n\n")
+	if title := strings.TrimSpace(g.spec.Info.Title); title != "" {
+		fmt.Fprintf(buf, "// Package %s %s客户端\n", g.cfg.Package, title)
+	}
+	fmt.Fprintf(buf, "package %s\n\n", g.cfg.Package)
+	imports := []string{
+		"context", "encoding/json", "fmt",
+		"github.com/xfali/restclient/v2", "github.com/xfali/restclient/v2/buffer",
+		"github.com/xfali/restclient/v2/filter", "github.com/xfali/restclient/v2/request",
+		"github.com/xfali/restclient/v2/restutil",
+		"io/ioutil", "net/http", "net/url", "strconv", "strings",
+	}
+	if g.needTime {
+		imports = append(imports, "time")
+	}
+	buf.WriteString("import (\n")
+	for _, v := range imports {
+		fmt.Fprintf(buf, "\t%s\n", strconv.Quote(v))
+	}
+	buf.WriteString(")\n\n")
+
+	baseUrl := ""
+	if len(g.spec.Servers) > 0 {
+		baseUrl = g.spec.Servers[0].URL
+	}
+	fmt.Fprintf(buf, clientTemplate, strconv.Quote(baseUrl), g.cfg.ClientName)
+	buf.Write(g.methods.Bytes())
+	buf.Write(g.models.Bytes())
+	return buf.Bytes()
+}
+
+// clientTemplate 客户端及辅助代码，参数为默认地址、客户端类型名称
+const clientTemplate = `// DefaultBaseUrl 文档中定义的默认服务地址
+const DefaultBaseUrl = %[1]s
+
+// %[2]s 接口客户端
+type %[2]s struct {
+	client  restclient.RestClient
+	baseUrl string
+	opts    []request.Opt
+}
+
+// New%[2]s 创建接口客户端，baseUrl为空时使用DefaultBaseUrl，opts为所有请求的默认配置
+func New%[2]s(client restclient.RestClient, baseUrl string, opts ...request.Opt) *%[2]s {
+	if baseUrl == "" {
+		baseUrl = DefaultBaseUrl
+	}
+	return &%[2]s{
+		client:  client,
+		baseUrl: strings.TrimSuffix(baseUrl, "/"),
+		opts:    opts,
+	}
+}
+
+func (c *%[2]s) exchange(builder *restutil.UrlBuilder, query url.Values, o, opts []request.Opt, models map[string]func() interface{}) error {
+	u := builder.Build()
+	if len(query) > 0 {
+		if strings.Contains(u, "?") {
+			u += "&" + query.Encode()
+		} else {
+			u += "?" + query.Encode()
+		}
+	}
+	capture := &errorCapture{}
+	o = append(o, request.AddFilter(capture.Filter))
+	o = append(o, c.opts...)
+	o = append(o, opts...)
+	if err := c.client.Exchange(u, o...); err != nil {
+		return capture.wrap(err, models)
+	}
+	return nil
+}
+
+// ApiError 接口返回的错误应答，实现了restclient.Error
+// Model为按文档中状态码定义解析的错误内容，未定义或解析失败时为nil
+type ApiError struct {
+	Status int
+	Body   []byte
+	Model  interface{}
+	err    restclient.Error
+}
+
+func (e *ApiError) Error() string {
+	if len(e.Body) > 0 {
+		return fmt.Sprintf("%%s: %%s", e.err.Error(), e.Body)
+	}
+	return e.err.Error()
+}
+
+func (e *ApiError) StatusCode() int {
+	return e.Status
+}
+
+func (e *ApiError) Origin() error {
+	return e.err.Origin()
+}
+
+// jsonValue 以json解析基础类型的结果
+type jsonValue struct {
+	v interface{}
+}
+
+func (j *jsonValue) UnmarshalJSON(data []byte) error {
+	return json.Unmarshal(data, j.v)
+}
+
+// errorCapture 保存错误应答的body，用于按状态码解析错误内容
+type errorCapture struct {
+	status int
+	body   []byte
+}
+
+func (e *errorCapture) Filter(request *http.Request, fc filter.FilterChain) (*http.Response, error) {
+	resp, err := fc.Filter(request)
+	if err != nil || resp == nil || resp.StatusCode < http.StatusBadRequest {
+		return resp, err
+	}
+	e.status = resp.StatusCode
+	if resp.Body != nil {
+		data, rerr := ioutil.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		e.body = data
+		resp.Body = buffer.NewReadCloser(data)
+		if rerr != nil {
+			return resp, rerr
+		}
+	}
+	return resp, err
+}
+
+func (e *errorCapture) wrap(err restclient.Error, models map[string]func() interface{}) error {
+	if e.status == 0 {
+		return err
+	}
+	ret := &ApiError{
+		Status: e.status,
+		Body:   e.body,
+		err:    err,
+	}
+	newModel, ok := models[strconv.Itoa(e.status)]
+	if !ok {
+		newModel, ok = models[strconv.Itoa(e.status/100)+"XX"]
+	}
+	if !ok {
+		newModel, ok = models["DEFAULT"]
+	}
+	if ok && len(e.body) > 0 {
+		model := newModel()
+		if json.Unmarshal(e.body, model) == nil {
+			ret.Model = model
+		}
+	}
+	return ret
+}
+
+`
@@ -0,0 +1,231 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package generator
+
+import (
+	"encoding/json"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"strings"
+)
+
+// Spec OpenAPI 3.x文档，仅包含生成代码需要的部分
+type Spec struct {
+	OpenAPI    string               `json:"openapi" yaml:"openapi"`
+	Info       Info                 `json:"info" yaml:"info"`
+	Servers    []Server             `json:"servers" yaml:"servers"`
+	Paths      map[string]*PathItem `json:"paths" yaml:"paths"`
+	Components Components           `json:"components" yaml:"components"`
+}
+
+type Info struct {
+	Title       string `json:"title" yaml:"title"`
+	Description string `json:"description" yaml:"description"`
+	Version     string `json:"version" yaml:"version"`
+}
+
+type Server struct {
+	URL string `json:"url" yaml:"url"`
+}
+
+type Components struct {
+	Schemas       map[string]*Schema      `json:"schemas" yaml:"schemas"`
+	Parameters    map[string]*Parameter   `json:"parameters" yaml:"parameters"`
+	RequestBodies map[string]*RequestBody `json:"requestBodies" yaml:"requestBodies"`
+	Responses     map[string]*Response    `json:"responses" yaml:"responses"`
+}
+
+type PathItem struct {
+	Parameters []*Parameter `json:"parameters" yaml:"parameters"`
+	Get        *Operation   `json:"get" yaml:"get"`
+	Put        *Operation   `json:"put" yaml:"put"`
+	Post       *Operation   `json:"post" yaml:"post"`
+	Delete     *Operation   `json:"delete" yaml:"delete"`
+	Options    *Operation   `json:"options" yaml:"options"`
+	Head       *Operation   `json:"head" yaml:"head"`
+	Patch      *Operation   `json:"patch" yaml:"patch"`
+}
+
+// operations 按固定顺序获得path下的操作
+func (p *PathItem) operations() []struct {
+	method string
+	op     *Operation
+} {
+	all := []struct {
+		method string
+		op     *Operation
+	}{
+		{"GET", p.Get}, {"PUT", p.Put}, {"POST", p.Post}, {"DELETE", p.Delete},
+		{"OPTIONS", p.Options}, {"HEAD", p.Head}, {"PATCH", p.Patch},
+	}
+	ret := all[:0]
+	for _, v := range all {
+		if v.op != nil {
+			ret = append(ret, v)
+		}
+	}
+	return ret
+}
+
+type Operation struct {
+	OperationID string               `json:"operationId" yaml:"operationId"`
+	Summary     string               `json:"summary" yaml:"summary"`
+	Description string               `json:"description" yaml:"description"`
+	Deprecated  bool                 `json:"deprecated" yaml:"deprecated"`
+	Parameters  []*Parameter         `json:"parameters" yaml:"parameters"`
+	RequestBody *RequestBody         `json:"requestBody" yaml:"requestBody"`
+	Responses   map[string]*Response `json:"responses" yaml:"responses"`
+}
+
+type Parameter struct {
+	Ref         string  `json:"$ref" yaml:"$ref"`
+	Name        string  `json:"name" yaml:"name"`
+	In          string  `json:"in" yaml:"in"`
+	Description string  `json:"description" yaml:"description"`
+	Required    bool    `json:"required" yaml:"required"`
+	Schema      *Schema `json:"schema" yaml:"schema"`
+}
+
+type RequestBody struct {
+	Ref         string                `json:"$ref" yaml:"$ref"`
+	Description string                `json:"description" yaml:"description"`
+	Required    bool                  `json:"required" yaml:"required"`
+	Content     map[string]*MediaType `json:"content" yaml:"content"`
+}
+
+type Response struct {
+	Ref         string                `json:"$ref" yaml:"$ref"`
+	Description string                `json:"description" yaml:"description"`
+	Content     map[string]*MediaType `json:"content" yaml:"content"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema" yaml:"schema"`
+}
+
+type Schema struct {
+	Ref                  string             `json:"$ref" yaml:"$ref"`
+	Type                 string             `json:"type" yaml:"type"`
+	Format               string             `json:"format" yaml:"format"`
+	Description          string             `json:"description" yaml:"description"`
+	Properties           map[string]*Schema `json:"properties" yaml:"properties"`
+	Required             []string           `json:"required" yaml:"required"`
+	Items                *Schema            `json:"items" yaml:"items"`
+	Enum                 []interface{}      `json:"enum" yaml:"enum"`
+	AdditionalProperties *Additional        `json:"additionalProperties" yaml:"additionalProperties"`
+	AllOf                []*Schema          `json:"allOf" yaml:"allOf"`
+	OneOf                []*Schema          `json:"oneOf" yaml:"oneOf"`
+	AnyOf                []*Schema          `json:"anyOf" yaml:"anyOf"`
+	Nullable             bool               `json:"nullable" yaml:"nullable"`
+}
+
+// Additional additionalProperties，可以为bool或Schema
+type Additional struct {
+	Allowed bool
+	Schema  *Schema
+}
+
+func (a *Additional) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var b bool
+	if err := unmarshal(&b); err == nil {
+		a.Allowed = b
+		return nil
+	}
+	a.Allowed = true
+	a.Schema = &Schema{}
+	return unmarshal(a.Schema)
+}
+
+func (a *Additional) UnmarshalJSON(data []byte) error {
+	var b bool
+	if err := json.Unmarshal(data, &b); err == nil {
+		a.Allowed = b
+		return nil
+	}
+	a.Allowed = true
+	a.Schema = &Schema{}
+	return json.Unmarshal(data, a.Schema)
+}
+
+// Parse 解析OpenAPI文档，内容以{开头时按json解析，否则按yaml解析
+func Parse(data []byte) (*Spec, error) {
+	spec := &Spec{}
+	var err error
+	if strings.HasPrefix(strings.TrimSpace(string(data)), "{") {
+		err = json.Unmarshal(data, spec)
+	} else {
+		err = yaml.Unmarshal(data, spec)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(spec.OpenAPI, "3.") {
+		return nil, fmt.Errorf("unsupported openapi version %q, expect 3.x", spec.OpenAPI)
+	}
+	return spec, nil
+}
+
+// refName 获得本地引用的名称，如#/components/schemas/Pet返回Pet
+func refName(ref, kind string) (string, error) {
+	prefix := "#/components/" + kind + "/"
+	if !strings.HasPrefix(ref, prefix) {
+		return "", fmt.Errorf("unsupported reference %q", ref)
+	}
+	return ref[len(prefix):], nil
+}
+
+func (s *Spec) parameter(p *Parameter) (*Parameter, error) {
+	if p.Ref == "" {
+		return p, nil
+	}
+	name, err := refName(p.Ref, "parameters")
+	if err != nil {
+		return nil, err
+	}
+	if v, ok := s.Components.Parameters[name]; ok {
+		return v, nil
+	}
+	return nil, fmt.Errorf("parameter %q not found", p.Ref)
+}
+
+func (s *Spec) requestBody(b *RequestBody) (*RequestBody, error) {
+	if b.Ref == "" {
+		return b, nil
+	}
+	name, err := refName(b.Ref, "requestBodies")
+	if err != nil {
+		return nil, err
+	}
+	if v, ok := s.Components.RequestBodies[name]; ok {
+		return v, nil
+	}
+	return nil, fmt.Errorf("request body %q not found", b.Ref)
+}
+
+func (s *Spec) response(r *Response) (*Response, error) {
+	if r.Ref == "" {
+		return r, nil
+	}
+	name, err := refName(r.Ref, "responses")
+	if err != nil {
+		return nil, err
+	}
+	if v, ok := s.Components.Responses[name]; ok {
+		return v, nil
+	}
+	return nil, fmt.Errorf("response %q not found", r.Ref)
+}
@@ -0,0 +1,132 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package petstore
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/xfali/restclient/v2"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("Content-Type", "application/json")
+		switch {
+		case request.Method == http.MethodGet && request.URL.Path == "/pets":
+			q := request.URL.Query()
+			if q.Get("limit") == "" {
+				writer.WriteHeader(http.StatusInternalServerError)
+				_, _ = writer.Write([]byte(`{"code":500,"message":"limit required"}`))
+				return
+			}
+			if q.Get("limit") != "10" || len(q["tags"]) != 2 || request.Header.Get("X-Request-ID") != "r1" {
+				t.Error(request.URL, request.Header)
+			}
+			_, _ = writer.Write([]byte(`[{"id":1,"name":"cat","status":"sold"}]`))
+		case request.Method == http.MethodPost && request.URL.Path == "/pets":
+			data, _ := ioutil.ReadAll(request.Body)
+			pet := NewPet{}
+			_ = json.Unmarshal(data, &pet)
+			if pet.Name == "" {
+				writer.WriteHeader(http.StatusUnprocessableEntity)
+				_, _ = writer.Write([]byte(`{"fields":{"name":"required"}}`))
+				return
+			}
+			writer.WriteHeader(http.StatusCreated)
+			_, _ = writer.Write([]byte(`{"id":2,"name":"` + pet.Name + `"}`))
+		case request.URL.EscapedPath() == "/pets/a%2Fb":
+			writer.WriteHeader(http.StatusNotFound)
+			_, _ = writer.Write([]byte(`{"code":404,"message":"not found"}`))
+		case request.URL.Path == "/stores/1/pets/2/count":
+			_, _ = writer.Write([]byte(`5`))
+		default:
+			writer.WriteHeader(http.StatusInternalServerError)
+			_, _ = writer.Write([]byte(`{"code":500,"message":"internal"}`))
+		}
+	}))
+}
+
+func TestClient(t *testing.T) {
+	server := newServer(t)
+	defer server.Close()
+
+	client := NewClient(restclient.New(), server.URL)
+	ctx := context.Background()
+
+	limit := int32(10)
+	id := "r1"
+	pets, err := client.ListPets(ctx, &ListPetsParams{Limit: &limit, Tags: []string{"a", "b"}, XRequestID: &id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pets) != 1 || pets[0].ID != 1 || *pets[0].Status != PetStatusSold {
+		t.Fatal(pets)
+	}
+
+	pet, err := client.CreatePets(ctx, &NewPet{Name: "dog"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pet.ID != 2 || pet.Name != "dog" {
+		t.Fatal(pet)
+	}
+
+	n, err := client.CountStorePets(ctx, 1, 2)
+	if err != nil || n != 5 {
+		t.Fatal(n, err)
+	}
+}
+
+func TestApiError(t *testing.T) {
+	server := newServer(t)
+	defer server.Close()
+
+	client := NewClient(restclient.New(), server.URL)
+	ctx := context.Background()
+
+	_, err := client.CreatePets(ctx, &NewPet{})
+	if e, ok := err.(*ApiError); !ok || e.StatusCode() != http.StatusUnprocessableEntity {
+		t.Fatal(err)
+	} else if m, ok := e.Model.(*CreatePetsN422Error); !ok || m.Fields["name"] != "required" {
+		t.Fatal(e.Model)
+	}
+
+	_, err = client.ShowPetByID(ctx, "a/b")
+	if e, ok := err.(*ApiError); !ok || e.Status != http.StatusNotFound {
+		t.Fatal(err)
+	} else if m, ok := e.Model.(*Error); !ok || m.Message != "not found" {
+		t.Fatal(e.Model)
+	}
+
+	// 未定义default的状态码不解析
+	err = client.DeletePetsPetID(ctx, "1")
+	if e, ok := err.(*ApiError); !ok || e.Status != http.StatusInternalServerError || e.Model != nil {
+		t.Fatal(err)
+	}
+
+	// 匹配default
+	_, err = client.ListPets(ctx, nil)
+	if e, ok := err.(*ApiError); !ok {
+		t.Fatal(err)
+	} else if m, ok := e.Model.(*Error); !ok || m.Code != 500 || m.Message != "limit required" {
+		t.Fatal(e.Model)
+	}
+}
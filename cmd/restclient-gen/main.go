@@ -0,0 +1,68 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/xfali/restclient/v2/cmd/restclient-gen/generator"
+	"io/ioutil"
+	"os"
+)
+
+// restclient-gen 根据OpenAPI 3.x文档（yaml或json）生成基于restclient的模型及客户端代码：
+//
+//	restclient-gen -spec petstore.yaml -package petstore -out petstore/client.go
+func main() {
+	spec := flag.String("spec", "", "OpenAPI 3.x document, yaml or json")
+	pkg := flag.String("package", "", "package name of the generated code")
+	out := flag.String("out", "", "output file, default stdout")
+	client := flag.String("client", generator.DefaultClientName, "client type name")
+	flag.Parse()
+
+	if *spec == "" || *pkg == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err := run(*spec, *pkg, *out, *client); err != nil {
+		fmt.Fprintln(os.Stderr, "restclient-gen:", err)
+		os.Exit(1)
+	}
+}
+
+func run(specFile, pkg, out, client string) error {
+	data, err := ioutil.ReadFile(specFile)
+	if err != nil {
+		return err
+	}
+	spec, err := generator.Parse(data)
+	if err != nil {
+		return err
+	}
+	src, err := generator.Generate(spec, generator.Config{
+		Package:    pkg,
+		ClientName: client,
+	})
+	if err != nil {
+		return err
+	}
+	if out == "" {
+		_, err = os.Stdout.Write(src)
+		return err
+	}
+	return ioutil.WriteFile(out, src, 0644)
+}
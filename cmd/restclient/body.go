@@ -0,0 +1,133 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"github.com/xfali/restclient/v2"
+	"gopkg.in/yaml.v2"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	bodyJSON = "json"
+	bodyForm = "form"
+	bodyXML  = "xml"
+	bodyYAML = "yaml"
+)
+
+var contentTypes = map[string]string{
+	bodyJSON: restclient.MediaTypeJson,
+	bodyForm: restclient.MediaTypeFormUrlencoded,
+	bodyXML:  restclient.MediaTypeXml,
+	bodyYAML: restclient.MediaTypeYaml,
+}
+
+var acceptTypes = map[string]string{
+	bodyJSON: restclient.MediaTypeJson + ", */*;q=0.5",
+	bodyXML:  restclient.MediaTypeXml + ", */*;q=0.5",
+	bodyYAML: restclient.MediaTypeYaml + ", */*;q=0.5",
+}
+
+// buildBody 按类型生成请求体，由restclient的converter完成序列化
+func buildBody(kind string, data *fields, xmlRoot string) (interface{}, error) {
+	switch kind {
+	case bodyJSON:
+		return data.values, nil
+	case bodyYAML:
+		ret := yaml.MapSlice{}
+		for _, k := range data.keys {
+			ret = append(ret, yaml.MapItem{Key: k, Value: data.values[k]})
+		}
+		return ret, nil
+	case bodyXML:
+		return &xmlElement{name: xmlRoot, value: data}, nil
+	case bodyForm:
+		if data.raw {
+			return nil, fmt.Errorf("form body does not support json fields (:=)")
+		}
+		// 保持字段顺序，字符串由StringConverter直接写入
+		buf := strings.Builder{}
+		for i, k := range data.keys {
+			if i > 0 {
+				buf.WriteByte('&')
+			}
+			buf.WriteString(url.QueryEscape(k) + "=" + url.QueryEscape(data.values[k].(string)))
+		}
+		return buf.String(), nil
+	}
+	return nil, fmt.Errorf("unknown body type: %s", kind)
+}
+
+// xmlElement 将字段序列化为xml元素，对象为子元素，数组为重复元素
+type xmlElement struct {
+	name  string
+	value interface{}
+}
+
+func (e *xmlElement) MarshalXML(enc *xml.Encoder, start xml.StartElement) error {
+	start = xml.StartElement{Name: xml.Name{Local: e.name}}
+	switch v := e.value.(type) {
+	case *fields:
+		if err := enc.EncodeToken(start); err != nil {
+			return err
+		}
+		for _, k := range v.keys {
+			if err := encodeXMLValue(enc, k, v.values[k]); err != nil {
+				return err
+			}
+		}
+		return enc.EncodeToken(start.End())
+	case map[string]interface{}:
+		if err := enc.EncodeToken(start); err != nil {
+			return err
+		}
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if err := encodeXMLValue(enc, k, v[k]); err != nil {
+				return err
+			}
+		}
+		return enc.EncodeToken(start.End())
+	case nil:
+		return enc.EncodeElement("", start)
+	case float64:
+		return enc.EncodeElement(strconv.FormatFloat(v, 'f', -1, 64), start)
+	default:
+		return enc.EncodeElement(v, start)
+	}
+}
+
+func encodeXMLValue(enc *xml.Encoder, name string, value interface{}) error {
+	if list, ok := value.([]interface{}); ok {
+		for _, v := range list {
+			if err := enc.Encode(&xmlElement{name: name, value: v}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return enc.Encode(&xmlElement{name: name, value: value})
+}
@@ -0,0 +1,114 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// downloader 将应答body保存到文件
+type downloader struct {
+	output string
+	log    io.Writer
+	// 实际保存的文件
+	file string
+}
+
+func (d *downloader) save(response *http.Response) error {
+	name := d.output
+	if name == "" {
+		name = uniqueName(downloadName(response))
+	}
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	d.file = name
+	if response.ContentLength >= 0 {
+		fmt.Fprintf(d.log, "Downloading %s to %q\n", byteSize(response.ContentLength), name)
+	} else {
+		fmt.Fprintf(d.log, "Downloading to %q\n", name)
+	}
+	n, err := io.Copy(f, response.Body)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if response.ContentLength >= 0 && n != response.ContentLength {
+		return fmt.Errorf("incomplete download: %d of %d bytes", n, response.ContentLength)
+	}
+	fmt.Fprintf(d.log, "Done. %s\n", byteSize(n))
+	return nil
+}
+
+// downloadName 获得下载的文件名，优先使用Content-Disposition中的filename，其次为url路径的最后一段
+func downloadName(response *http.Response) string {
+	if cd := response.Header.Get("Content-Disposition"); cd != "" {
+		if _, params, err := mime.ParseMediaType(cd); err == nil {
+			if name := filepath.Base(params["filename"]); validName(name) {
+				return name
+			}
+		}
+	}
+	if response.Request != nil {
+		if name := path.Base(response.Request.URL.Path); validName(name) {
+			return name
+		}
+	}
+	return "index"
+}
+
+func validName(name string) bool {
+	return name != "" && name != "." && name != "/" && name != ".." && !strings.ContainsAny(name, `/\`)
+}
+
+// uniqueName 文件已存在时增加序号，避免覆盖
+func uniqueName(name string) string {
+	if _, err := os.Stat(name); os.IsNotExist(err) {
+		return name
+	}
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for i := 1; ; i++ {
+		ret := fmt.Sprintf("%s-%d%s", base, i, ext)
+		if _, err := os.Stat(ret); os.IsNotExist(err) {
+			return ret
+		}
+	}
+}
+
+func byteSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
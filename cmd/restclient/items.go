@@ -0,0 +1,119 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	sepHeader   = ":"
+	sepQuery    = "=="
+	sepData     = "="
+	sepJSONData = ":="
+)
+
+// 同一位置按长度优先匹配
+var separators = []string{sepJSONData, sepQuery, sepData, sepHeader}
+
+// fields 按参数顺序保存的请求体字段
+type fields struct {
+	keys   []string
+	values map[string]interface{}
+	// 包含:=的非字符串字段
+	raw bool
+}
+
+func (f *fields) set(key string, value interface{}) {
+	if f.values == nil {
+		f.values = map[string]interface{}{}
+	}
+	if _, ok := f.values[key]; !ok {
+		f.keys = append(f.keys, key)
+	}
+	f.values[key] = value
+}
+
+func (f *fields) empty() bool {
+	return len(f.keys) == 0
+}
+
+// items 命令行中的请求项
+type items struct {
+	header http.Header
+	query  url.Values
+	data   fields
+}
+
+// parseItems 解析请求项：
+//
+//	Header:value   请求头
+//	name==value    query参数
+//	name=value     字符串字段
+//	name:=json     json字段（数字、布尔、数组、对象等）
+//
+// 分隔符前的字符可以使用\转义
+func parseItems(args []string) (*items, error) {
+	ret := &items{
+		header: http.Header{},
+		query:  url.Values{},
+	}
+	for _, arg := range args {
+		key, sep, value, ok := splitItem(arg)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid request item: %q", arg)
+		}
+		switch sep {
+		case sepHeader:
+			ret.header.Add(key, value)
+		case sepQuery:
+			ret.query.Add(key, value)
+		case sepData:
+			ret.data.set(key, value)
+		case sepJSONData:
+			var v interface{}
+			if err := json.Unmarshal([]byte(value), &v); err != nil {
+				return nil, fmt.Errorf("invalid json of %q: %v", key, err)
+			}
+			ret.data.set(key, v)
+			ret.data.raw = true
+		}
+	}
+	return ret, nil
+}
+
+func splitItem(arg string) (key, sep, value string, ok bool) {
+	buf := strings.Builder{}
+	for i := 0; i < len(arg); i++ {
+		if arg[i] == '\\' && i+1 < len(arg) {
+			i++
+			buf.WriteByte(arg[i])
+			continue
+		}
+		for _, s := range separators {
+			if strings.HasPrefix(arg[i:], s) {
+				return buf.String(), s, arg[i+len(s):], true
+			}
+		}
+		buf.WriteByte(arg[i])
+	}
+	return "", "", "", false
+}
@@ -0,0 +1,377 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/xfali/restclient/v2"
+	"github.com/xfali/restclient/v2/buffer"
+	"github.com/xfali/restclient/v2/cookie"
+	"github.com/xfali/restclient/v2/filter"
+	"github.com/xfali/restclient/v2/request"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const usage = `restclient 基于restclient的命令行HTTP工具
+
+usage: restclient [flags] [METHOD] URL [ITEM...]
+
+ITEM:
+  Header:value   请求头
+  name==value    query参数
+  name=value     字符串字段
+  name:=json     json字段（数字、布尔、数组、对象等）
+
+example:
+  restclient -auth basic -user admin:123 POST localhost:8080/users name=tom age:=18 X-Token:abc
+  restclient -download example.com/file.zip
+
+flags:`
+
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
+)
+
+type options struct {
+	json, form, xml, yaml bool
+	xmlRoot               string
+	raw                   string
+
+	auth, user, token string
+	session           string
+
+	download bool
+	output   string
+
+	pretty      string
+	print       string
+	verbose     bool
+	timeout     time.Duration
+	checkStatus bool
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	o := &options{}
+	fs := flag.NewFlagSet("restclient", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, usage)
+		fs.PrintDefaults()
+	}
+	fs.BoolVar(&o.json, "json", false, "serialize data items as json (default)")
+	fs.BoolVar(&o.form, "form", false, "serialize data items as application/x-www-form-urlencoded")
+	fs.BoolVar(&o.xml, "xml", false, "serialize data items as xml")
+	fs.BoolVar(&o.yaml, "yaml", false, "serialize data items as yaml")
+	fs.StringVar(&o.xmlRoot, "xml-root", "request", "root element name of xml body")
+	fs.StringVar(&o.raw, "raw", "", "raw request body, @file reads body from file")
+	fs.StringVar(&o.auth, "auth", "", "auth type: basic, digest or bearer")
+	fs.StringVar(&o.user, "user", "", "credentials of basic and digest auth: user:password")
+	fs.StringVar(&o.token, "token", "", "token of bearer auth")
+	fs.StringVar(&o.session, "session", "", "session file, cookies are loaded from and saved to it")
+	fs.BoolVar(&o.download, "download", false, "save response body to file")
+	fs.StringVar(&o.output, "o", "", "output file of download")
+	fs.StringVar(&o.pretty, "pretty", "", "output processing: all, colors, format or none (default all in terminal, otherwise none)")
+	fs.StringVar(&o.print, "print", "hb", "what to print: H request headers, B request body, h response headers, b response body")
+	fs.BoolVar(&o.verbose, "v", false, "print the request as well as the response, same as -print HBhb")
+	fs.DurationVar(&o.timeout, "timeout", 0, "request timeout")
+	fs.BoolVar(&o.checkStatus, "check-status", false, "exit with 3, 4 or 5 when status is 3xx, 4xx or 5xx")
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return exitUsage
+	}
+	code, err := execute(o, fs.Args(), stdout, stderr)
+	if err != nil {
+		fmt.Fprintln(stderr, "restclient:", err)
+	}
+	return code
+}
+
+func execute(o *options, args []string, stdout, stderr io.Writer) (int, error) {
+	kind, err := bodyKind(o)
+	if err != nil {
+		return exitUsage, err
+	}
+	method := ""
+	if len(args) > 1 && isMethod(args[0]) {
+		method, args = args[0], args[1:]
+	}
+	u := normalizeUrl(args[0])
+	it, err := parseItems(args[1:])
+	if err != nil {
+		return exitUsage, err
+	}
+	if len(it.query) > 0 {
+		if strings.Contains(u, "?") {
+			u += "&" + it.query.Encode()
+		} else {
+			u += "?" + it.query.Encode()
+		}
+	}
+
+	var body interface{}
+	switch {
+	case o.raw != "":
+		body, err = rawBody(o.raw)
+	case !it.data.empty():
+		body, err = buildBody(kind, &it.data, o.xmlRoot)
+	}
+	if err != nil {
+		return exitUsage, err
+	}
+	if method == "" {
+		method = http.MethodGet
+		if body != nil {
+			method = http.MethodPost
+		}
+	}
+	if body != nil && it.header.Get("Content-Type") == "" {
+		it.header.Set("Content-Type", contentTypes[kind])
+	}
+	if accept, ok := acceptTypes[kind]; ok && it.header.Get("Accept") == "" {
+		it.header.Set("Accept", accept)
+	}
+
+	show := o.print
+	if o.verbose {
+		show = "HBhb"
+	}
+	out, err := newPrinter(stdout, o.pretty)
+	if err != nil {
+		return exitUsage, err
+	}
+
+	ex := &exchange{readRequestBody: strings.Contains(show, "B")}
+	if o.download {
+		ex.download = &downloader{output: o.output, log: stderr}
+	}
+	clientOpts := []restclient.Opt{
+		restclient.AddConverters(restclient.NewYamlConverter()),
+		restclient.AddFilter(ex.Filter),
+	}
+	if o.timeout > 0 {
+		clientOpts = append(clientOpts, restclient.SetTimeout(o.timeout))
+	}
+	auth, err := authFilter(o)
+	if err != nil {
+		return exitUsage, err
+	}
+	if auth != nil {
+		// 认证filter位于外层，以便输出实际发送的认证头
+		clientOpts = append(clientOpts, restclient.AddFilter(auth))
+	}
+	if o.session != "" {
+		// 会话只用于用户指定的站点，不引入x/net依赖，使用内置的公共后缀列表
+		jar, err := cookie.NewJar(cookie.BuiltinPublicSuffixList, cookie.OptSetStore(cookie.NewFileStore(o.session)), cookie.OptSetKeepSessionCookies(true))
+		if err != nil {
+			return exitError, err
+		}
+		defer func() {
+			if err := jar.Close(); err != nil {
+				fmt.Fprintln(stderr, "restclient: save session failed:", err)
+			}
+		}()
+		clientOpts = append(clientOpts, restclient.CookieJar(jar))
+	}
+
+	opts := []request.Opt{
+		request.WithMethod(method),
+		request.WithRequestHeader(it.header),
+	}
+	if body != nil {
+		opts = append(opts, request.WithRequestBody(body))
+	}
+	client := restclient.New(clientOpts...)
+	xerr := client.Exchange(u, opts...)
+
+	if ex.request != nil {
+		if strings.Contains(show, "H") {
+			out.requestHead(ex.request)
+		}
+		if strings.Contains(show, "B") && len(ex.reqBody) > 0 {
+			out.body(ex.request.Header.Get("Content-Type"), ex.reqBody)
+			fmt.Fprintln(stdout)
+		}
+	}
+	if ex.response == nil {
+		if xerr != nil {
+			return exitError, xerr.Origin()
+		}
+		return exitError, errors.New("no response")
+	}
+	if ex.download != nil {
+		// 下载时应答头输出到stderr，避免与重定向的stdout混在一起
+		errOut, _ := newPrinter(stderr, o.pretty)
+		errOut.responseHead(ex.response)
+	} else {
+		if strings.Contains(show, "h") {
+			out.responseHead(ex.response)
+		}
+		if strings.Contains(show, "b") {
+			out.body(ex.response.Header.Get("Content-Type"), ex.body)
+		}
+	}
+	if ex.err != nil {
+		return exitError, ex.err
+	}
+	if o.checkStatus && ex.response.StatusCode >= http.StatusMultipleChoices {
+		return ex.response.StatusCode / 100, nil
+	}
+	return exitOK, nil
+}
+
+func bodyKind(o *options) (string, error) {
+	kind := ""
+	for k, v := range map[string]bool{bodyJSON: o.json, bodyForm: o.form, bodyXML: o.xml, bodyYAML: o.yaml} {
+		if v {
+			if kind != "" {
+				return "", errors.New("only one of -json, -form, -xml and -yaml can be set")
+			}
+			kind = k
+		}
+	}
+	if kind == "" {
+		kind = bodyJSON
+	}
+	return kind, nil
+}
+
+func isMethod(s string) bool {
+	for _, c := range s {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// normalizeUrl 补全url：省略scheme时使用http，以:开头时使用localhost
+func normalizeUrl(u string) string {
+	if strings.HasPrefix(u, ":") {
+		u = "localhost" + u
+	}
+	if !strings.Contains(u, "://") {
+		u = "http://" + u
+	}
+	return u
+}
+
+func rawBody(raw string) (interface{}, error) {
+	if strings.HasPrefix(raw, "@") {
+		data, err := ioutil.ReadFile(raw[1:])
+		if err != nil {
+			return nil, err
+		}
+		return data, nil
+	}
+	return raw, nil
+}
+
+func authFilter(o *options) (filter.Filter, error) {
+	kind := o.auth
+	if kind == "" {
+		switch {
+		case o.token != "":
+			kind = "bearer"
+		case o.user != "":
+			kind = "basic"
+		default:
+			return nil, nil
+		}
+	}
+	switch kind {
+	case "basic", "digest":
+		if o.user == "" {
+			return nil, fmt.Errorf("-user is required by %s auth", kind)
+		}
+		user, password := o.user, ""
+		if i := strings.Index(o.user, ":"); i >= 0 {
+			user, password = o.user[:i], o.user[i+1:]
+		}
+		if kind == "basic" {
+			return filter.NewBasicAuth(user, password).Filter, nil
+		}
+		return filter.NewDigestAuth(user, password).Filter, nil
+	case "bearer":
+		if o.token == "" {
+			return nil, errors.New("-token is required by bearer auth")
+		}
+		return filter.NewAccessTokenAuth(o.token).Filter, nil
+	}
+	return nil, fmt.Errorf("unknown auth type: %s", kind)
+}
+
+// exchange 记录实际发送的请求及收到的应答，下载时将body写入文件
+type exchange struct {
+	readRequestBody bool
+	download        *downloader
+
+	request  *http.Request
+	reqBody  []byte
+	response *http.Response
+	body     []byte
+	err      error
+}
+
+func (e *exchange) Filter(request *http.Request, fc filter.FilterChain) (*http.Response, error) {
+	e.request = request
+	if e.readRequestBody && request.Body != nil {
+		data, err := ioutil.ReadAll(request.Body)
+		if err != nil {
+			return nil, err
+		}
+		e.reqBody = data
+		request.Body = buffer.NewReadCloser(data)
+	}
+	resp, err := fc.Filter(request)
+	if err != nil || resp == nil || resp.Body == nil {
+		e.response = resp
+		return resp, err
+	}
+	e.response = resp
+	e.body, e.err = nil, nil
+	if e.download != nil && resp.StatusCode < http.StatusMultipleChoices {
+		e.err = e.download.save(resp)
+		_ = resp.Body.Close()
+		resp.Body = http.NoBody
+		return resp, nil
+	}
+	data, rerr := ioutil.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	e.body = data
+	e.err = rerr
+	resp.Body = buffer.NewReadCloser(data)
+	return resp, nil
+}
@@ -0,0 +1,251 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type echo struct {
+	Method string      `json:"method"`
+	Query  string      `json:"query"`
+	Header http.Header `json:"header"`
+	Body   string      `json:"body"`
+}
+
+func newServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		switch request.URL.Path {
+		case "/login":
+			http.SetCookie(writer, &http.Cookie{Name: "session", Value: "s1", Path: "/"})
+			return
+		case "/me":
+			if c, err := request.Cookie("session"); err != nil || c.Value != "s1" {
+				writer.WriteHeader(http.StatusUnauthorized)
+			}
+			return
+		case "/file":
+			writer.Header().Set("Content-Disposition", `attachment; filename="../report.csv"`)
+			_, _ = writer.Write([]byte("a,b\n1,2\n"))
+			return
+		case "/xml":
+			writer.Header().Set("Content-Type", "application/xml")
+			_, _ = writer.Write([]byte(`<a><b>1</b></a>`))
+			return
+		}
+		body, _ := ioutil.ReadAll(request.Body)
+		writer.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(writer).Encode(echo{
+			Method: request.Method,
+			Query:  request.URL.RawQuery,
+			Header: request.Header,
+			Body:   string(body),
+		})
+	}))
+}
+
+func call(t *testing.T, args ...string) (int, string, string) {
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	code := run(args, stdout, stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func callEcho(t *testing.T, args ...string) echo {
+	code, out, errOut := call(t, append([]string{"-print", "b"}, args...)...)
+	if code != exitOK {
+		t.Fatal(code, errOut)
+	}
+	ret := echo{}
+	if err := json.Unmarshal([]byte(out), &ret); err != nil {
+		t.Fatal(err, out)
+	}
+	return ret
+}
+
+func TestItems(t *testing.T) {
+	it, err := parseItems([]string{"X-Token:abc", "page==1", "name=tom", "age:=18", `a\=b=c`, "url=http://x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if it.header.Get("X-Token") != "abc" || it.query.Get("page") != "1" {
+		t.Fatal(it.header, it.query)
+	}
+	if it.data.values["name"] != "tom" || it.data.values["age"] != float64(18) || it.data.values["a=b"] != "c" ||
+		it.data.values["url"] != "http://x" || !it.data.raw {
+		t.Fatal(it.data.values)
+	}
+	if _, err := parseItems([]string{"abc"}); err == nil {
+		t.Fatal("expect invalid item")
+	}
+	if _, err := parseItems([]string{"a:={"}); err == nil {
+		t.Fatal("expect invalid json")
+	}
+}
+
+func TestBody(t *testing.T) {
+	server := newServer()
+	defer server.Close()
+
+	e := callEcho(t, server.URL+"/users", "name=tom", "age:=18", "tags:=[\"a\",\"b\"]", "q==1")
+	if e.Method != http.MethodPost || e.Query != "q=1" || e.Header.Get("Content-Type") != "application/json" ||
+		!strings.HasPrefix(e.Header.Get("Accept"), "application/json") {
+		t.Fatal(e)
+	}
+	m := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(e.Body), &m); err != nil || m["name"] != "tom" || m["age"] != float64(18) {
+		t.Fatal(e.Body)
+	}
+
+	e = callEcho(t, "-form", "PUT", server.URL, "name=tom", "city=a b")
+	if e.Method != http.MethodPut || e.Body != "name=tom&city=a+b" ||
+		e.Header.Get("Content-Type") != "application/x-www-form-urlencoded" {
+		t.Fatal(e)
+	}
+
+	e = callEcho(t, "-xml", server.URL, "name=tom", "age:=18", `tags:=["a","b"]`, `addr:={"city":"x"}`)
+	if e.Body != "<request><name>tom</name><age>18</age><tags>a</tags><tags>b</tags><addr><city>x</city></addr></request>" {
+		t.Fatal(e.Body)
+	}
+
+	e = callEcho(t, "-yaml", server.URL, "name=tom", "age:=18")
+	if e.Body != "name: tom\nage: 18\n" || e.Header.Get("Content-Type") != "application/yaml" {
+		t.Fatal(e.Body)
+	}
+
+	e = callEcho(t, "-raw", "hello", "-form", server.URL)
+	if e.Method != http.MethodPost || e.Body != "hello" {
+		t.Fatal(e)
+	}
+
+	if code, _, _ := call(t, "-form", server.URL, "age:=18"); code != exitUsage {
+		t.Fatal("expect form not support json field")
+	}
+	if code, _, _ := call(t, "-form", "-xml", server.URL); code != exitUsage {
+		t.Fatal("expect conflict")
+	}
+}
+
+func TestAuth(t *testing.T) {
+	server := newServer()
+	defer server.Close()
+
+	e := callEcho(t, "-user", "admin:123", server.URL)
+	if e.Header.Get("Authorization") != "Basic YWRtaW46MTIz" {
+		t.Fatal(e.Header)
+	}
+	e = callEcho(t, "-auth", "bearer", "-token", "t1", server.URL)
+	if !strings.EqualFold(e.Header.Get("Authorization"), "Bearer t1") {
+		t.Fatal(e.Header)
+	}
+	if code, _, _ := call(t, "-auth", "digest", server.URL); code != exitUsage {
+		t.Fatal("expect user required")
+	}
+
+	// 输出实际发送的认证头
+	_, out, _ := call(t, "-v", "-user", "admin:123", server.URL)
+	if !strings.Contains(out, "Authorization: Basic YWRtaW46MTIz") || !strings.Contains(out, "HTTP/1.1 200 OK") {
+		t.Fatal(out)
+	}
+}
+
+func TestSession(t *testing.T) {
+	server := newServer()
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "restclient")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	session := filepath.Join(dir, "session.json")
+
+	if code, _, _ := call(t, "-check-status", server.URL+"/me"); code != 4 {
+		t.Fatal("expect 4xx but get ", code)
+	}
+	if code, _, errOut := call(t, "-session", session, server.URL+"/login"); code != exitOK {
+		t.Fatal(errOut)
+	}
+	if code, _, errOut := call(t, "-check-status", "-session", session, server.URL+"/me"); code != exitOK {
+		t.Fatal(code, errOut)
+	}
+}
+
+func TestDownload(t *testing.T) {
+	server := newServer()
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "restclient")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "out.csv")
+	code, out, errOut := call(t, "-download", "-o", path, server.URL+"/file")
+	if code != exitOK || out != "" || !strings.Contains(errOut, "Done. 8 B") {
+		t.Fatal(code, out, errOut)
+	}
+	if data, _ := ioutil.ReadFile(path); string(data) != "a,b\n1,2\n" {
+		t.Fatal(string(data))
+	}
+
+	resp := &http.Response{Header: http.Header{}, Request: httptest.NewRequest(http.MethodGet, "/a/b.zip?x=1", nil)}
+	if n := downloadName(resp); n != "b.zip" {
+		t.Fatal(n)
+	}
+	resp.Header.Set("Content-Disposition", `attachment; filename="../report.csv"`)
+	if n := downloadName(resp); n != "report.csv" {
+		t.Fatal(n)
+	}
+	if n := uniqueName(path); n != filepath.Join(dir, "out-1.csv") {
+		t.Fatal(n)
+	}
+}
+
+func TestPretty(t *testing.T) {
+	server := newServer()
+	defer server.Close()
+
+	_, out, _ := call(t, "-pretty", "all", server.URL+"/xml")
+	if !strings.Contains(out, colorBlue+"<a>"+colorReset+"\n    "+colorBlue+"<b>"+colorReset+"1") {
+		t.Fatal(out)
+	}
+	_, out, _ = call(t, "-pretty", "format", "-print", "b", server.URL, "a:=1")
+	if !strings.Contains(out, "\n    \"body\": \"{\\\"a\\\":1}\\n\"\n}") {
+		t.Fatal(out)
+	}
+
+	s := colorJSON(`{"a": [1, true, "x"]}`)
+	if s != `{`+colorBlue+`"a"`+colorReset+`: [`+colorYellow+`1`+colorReset+`, `+colorMagenta+`true`+colorReset+`, `+colorGreen+`"x"`+colorReset+`]}` {
+		t.Fatal(s)
+	}
+	s = colorYAML("# c\na: 1\n- b: x\n")
+	if s != colorGray+"# c"+colorReset+"\n"+colorBlue+"a"+colorReset+": 1\n- "+colorBlue+"b"+colorReset+": x\n" {
+		t.Fatalf("%q", s)
+	}
+	if mediaKind("application/problem+json; charset=utf-8") != bodyJSON || mediaKind("text/plain") != "" {
+		t.Fatal("media kind")
+	}
+}
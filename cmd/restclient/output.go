@@ -0,0 +1,319 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	prettyAll    = "all"
+	prettyColors = "colors"
+	prettyFormat = "format"
+	prettyNone   = "none"
+)
+
+const (
+	colorReset   = "\x1b[0m"
+	colorRed     = "\x1b[31m"
+	colorGreen   = "\x1b[32m"
+	colorYellow  = "\x1b[33m"
+	colorBlue    = "\x1b[34m"
+	colorMagenta = "\x1b[35m"
+	colorCyan    = "\x1b[36m"
+	colorGray    = "\x1b[90m"
+)
+
+const binaryNote = "+-----------------------------------------+\n" +
+	"| NOTE: binary data not shown in terminal |\n" +
+	"+-----------------------------------------+\n"
+
+// printer 按媒体类型格式化及着色输出请求和应答
+type printer struct {
+	w        io.Writer
+	format   bool
+	colors   bool
+	terminal bool
+}
+
+func newPrinter(w io.Writer, pretty string) (*printer, error) {
+	terminal := isTerminal(w)
+	if pretty == "" {
+		pretty = prettyNone
+		if terminal {
+			pretty = prettyAll
+		}
+	}
+	p := &printer{w: w, terminal: terminal}
+	switch pretty {
+	case prettyAll:
+		p.format, p.colors = true, true
+	case prettyColors:
+		p.colors = true
+	case prettyFormat:
+		p.format = true
+	case prettyNone:
+	default:
+		return nil, fmt.Errorf("invalid pretty option: %s", pretty)
+	}
+	return p, nil
+}
+
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+func (p *printer) color(c, s string) string {
+	if !p.colors || s == "" {
+		return s
+	}
+	return c + s + colorReset
+}
+
+func (p *printer) requestHead(request *http.Request) {
+	uri := request.URL.RequestURI()
+	fmt.Fprintf(p.w, "%s %s %s\n", p.color(colorGreen, request.Method), p.color(colorCyan, uri), request.Proto)
+	header := request.Header.Clone()
+	if header.Get("Host") == "" {
+		header.Set("Host", request.Host)
+	}
+	p.header(header)
+}
+
+func (p *printer) responseHead(response *http.Response) {
+	c := colorGreen
+	switch {
+	case response.StatusCode >= http.StatusBadRequest:
+		c = colorRed
+	case response.StatusCode >= http.StatusMultipleChoices:
+		c = colorYellow
+	}
+	text := strings.TrimSpace(strings.TrimPrefix(response.Status, fmt.Sprint(response.StatusCode)))
+	if text == "" {
+		text = http.StatusText(response.StatusCode)
+	}
+	fmt.Fprintf(p.w, "%s %s\n", response.Proto, p.color(c, fmt.Sprintf("%d %s", response.StatusCode, text)))
+	p.header(response.Header)
+}
+
+func (p *printer) header(header http.Header) {
+	keys := make([]string, 0, len(header))
+	for k := range header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, v := range header[k] {
+			fmt.Fprintf(p.w, "%s: %s\n", p.color(colorCyan, k), v)
+		}
+	}
+	fmt.Fprintln(p.w)
+}
+
+// body 按Content-Type格式化及着色输出body
+func (p *printer) body(contentType string, data []byte) {
+	if len(data) == 0 {
+		return
+	}
+	if p.terminal && !utf8.Valid(data) {
+		io.WriteString(p.w, binaryNote)
+		return
+	}
+	kind := mediaKind(contentType)
+	if p.format {
+		data = format(kind, data)
+	}
+	text := string(data)
+	if p.colors {
+		switch kind {
+		case bodyJSON:
+			text = colorJSON(text)
+		case bodyXML:
+			text = colorXML(text)
+		case bodyYAML:
+			text = colorYAML(text)
+		}
+	}
+	io.WriteString(p.w, text)
+	if !strings.HasSuffix(text, "\n") {
+		fmt.Fprintln(p.w)
+	}
+}
+
+// mediaKind 获得Content-Type对应的格式：json、xml、yaml，其他返回空
+func mediaKind(contentType string) string {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	sub := mt[strings.Index(mt, "/")+1:]
+	switch {
+	case sub == "json" || strings.HasSuffix(sub, "+json"):
+		return bodyJSON
+	case sub == "xml" || strings.HasSuffix(sub, "+xml"):
+		return bodyXML
+	case sub == "yaml" || sub == "x-yaml" || strings.HasSuffix(sub, "+yaml"):
+		return bodyYAML
+	}
+	return ""
+}
+
+// format 缩进json及xml，格式错误时返回原始数据
+func format(kind string, data []byte) []byte {
+	switch kind {
+	case bodyJSON:
+		buf := bytes.Buffer{}
+		if json.Indent(&buf, bytes.TrimSpace(data), "", "    ") == nil {
+			buf.WriteByte('\n')
+			return buf.Bytes()
+		}
+	case bodyXML:
+		if ret, err := formatXML(data); err == nil {
+			return ret
+		}
+	}
+	return data
+}
+
+func formatXML(data []byte) ([]byte, error) {
+	buf := bytes.Buffer{}
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	enc := xml.NewEncoder(&buf)
+	enc.Indent("", "    ")
+	for {
+		token, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if c, ok := token.(xml.CharData); ok && len(bytes.TrimSpace(c)) == 0 {
+			continue
+		}
+		if err := enc.EncodeToken(xml.CopyToken(token)); err != nil {
+			return nil, err
+		}
+	}
+	if err := enc.Flush(); err != nil {
+		return nil, err
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+func colorJSON(s string) string {
+	buf := strings.Builder{}
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '"':
+			end := i + 1
+			for end < len(s) && s[end] != '"' {
+				if s[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end < len(s) {
+				end++
+			}
+			color := colorGreen
+			rest := strings.TrimLeft(s[end:], " \t\r\n")
+			if strings.HasPrefix(rest, ":") {
+				color = colorBlue
+			}
+			buf.WriteString(color + s[i:end] + colorReset)
+			i = end
+		case c == '-' || (c >= '0' && c <= '9'):
+			end := i + 1
+			for end < len(s) && strings.IndexByte("0123456789.eE+-", s[end]) >= 0 {
+				end++
+			}
+			buf.WriteString(colorYellow + s[i:end] + colorReset)
+			i = end
+		case strings.HasPrefix(s[i:], "true"), strings.HasPrefix(s[i:], "null"):
+			buf.WriteString(colorMagenta + s[i:i+4] + colorReset)
+			i += 4
+		case strings.HasPrefix(s[i:], "false"):
+			buf.WriteString(colorMagenta + s[i:i+5] + colorReset)
+			i += 5
+		default:
+			buf.WriteByte(c)
+			i++
+		}
+	}
+	return buf.String()
+}
+
+func colorXML(s string) string {
+	buf := strings.Builder{}
+	for i := 0; i < len(s); {
+		if s[i] != '<' {
+			end := strings.IndexByte(s[i:], '<')
+			if end < 0 {
+				end = len(s) - i
+			}
+			buf.WriteString(s[i : i+end])
+			i += end
+			continue
+		}
+		end := strings.IndexByte(s[i:], '>')
+		if end < 0 {
+			buf.WriteString(s[i:])
+			break
+		}
+		buf.WriteString(colorBlue + s[i:i+end+1] + colorReset)
+		i += end + 1
+	}
+	return buf.String()
+}
+
+func colorYAML(s string) string {
+	lines := strings.SplitAfter(s, "\n")
+	for i, line := range lines {
+		trimmed := strings.TrimLeft(line, " ")
+		indent := line[:len(line)-len(trimmed)]
+		if strings.HasPrefix(trimmed, "#") {
+			lines[i] = indent + colorGray + strings.TrimRight(trimmed, "\n") + colorReset + trimmed[len(strings.TrimRight(trimmed, "\n")):]
+			continue
+		}
+		if strings.HasPrefix(trimmed, "- ") {
+			indent += "- "
+			trimmed = trimmed[2:]
+		}
+		if n := strings.Index(trimmed, ":"); n > 0 && (n+1 == len(trimmed) || trimmed[n+1] == ' ' || trimmed[n+1] == '\n') {
+			lines[i] = indent + colorBlue + trimmed[:n] + colorReset + trimmed[n:]
+		}
+	}
+	return strings.Join(lines, "")
+}
@@ -0,0 +1,734 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package restclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"github.com/xfali/restclient/v2/filter"
+	"github.com/xfali/restclient/v2/transport"
+	"github.com/xfali/xlog"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// ConfigEnvPrefix 覆盖配置的环境变量前缀，变量名为前缀加上配置路径的大写下划线形式，如：
+// RESTCLIENT_TIMEOUT覆盖timeout，RESTCLIENT_TRANSPORT_MAX_IDLE_CONNS覆盖transport.maxIdleConns
+// 数组使用逗号分隔，map使用逗号分隔的key=value，如RESTCLIENT_HEADERS="X-App=demo,X-Env=test"
+const ConfigEnvPrefix = "RESTCLIENT_"
+
+// Config client配置，可以从yaml或json文件加载，见LoadConfig及FromConfig
+// 时间使用字符串表示，如"10s"、"500ms"，数值为0时使用默认值
+type Config struct {
+	// 基础地址，见SetBaseUrl
+	BaseUrl string `yaml:"baseUrl,omitempty" json:"baseUrl,omitempty"`
+	// 请求总超时时间，见SetTimeout
+	Timeout time.Duration `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+	// 获得连接的超时时间，见SetConnectTimeout
+	ConnectTimeout time.Duration `yaml:"connectTimeout,omitempty" json:"connectTimeout,omitempty"`
+	// 等待应答第一个字节的超时时间，见SetFirstByteTimeout
+	FirstByteTimeout time.Duration `yaml:"firstByteTimeout,omitempty" json:"firstByteTimeout,omitempty"`
+	// 读取应答body的超时时间，见SetBodyReadTimeout
+	BodyReadTimeout time.Duration `yaml:"bodyReadTimeout,omitempty" json:"bodyReadTimeout,omitempty"`
+	// 开启请求耗时统计，见EnableTimings
+	Timings bool `yaml:"timings,omitempty" json:"timings,omitempty"`
+	// 所有请求的默认header，见SetDefaultHeader
+	Headers map[string]string `yaml:"headers,omitempty" json:"headers,omitempty"`
+	// 连接池配置
+	Transport *TransportConfig `yaml:"transport,omitempty" json:"transport,omitempty"`
+	// TLS配置
+	Tls *TlsConfig `yaml:"tls,omitempty" json:"tls,omitempty"`
+	// 代理地址，为空时使用环境变量中的代理，为"none"时不使用代理
+	Proxy string `yaml:"proxy,omitempty" json:"proxy,omitempty"`
+	// 认证配置
+	Auth *AuthConfig `yaml:"auth,omitempty" json:"auth,omitempty"`
+	// 重试配置，见filter.Retry
+	Retry *RetryConfig `yaml:"retry,omitempty" json:"retry,omitempty"`
+	// 启用的转换器，按顺序配置，靠后的优先，为空时使用默认转换器，可选值见RegisterConfigConverter
+	Converters []string `yaml:"converters,omitempty" json:"converters,omitempty"`
+	// 启用的filter，靠后的位于外层，可选值见RegisterConfigFilter
+	Filters []string `yaml:"filters,omitempty" json:"filters,omitempty"`
+}
+
+// TransportConfig 连接池配置，见transport包
+type TransportConfig struct {
+	DialTimeout           time.Duration `yaml:"dialTimeout,omitempty" json:"dialTimeout,omitempty"`
+	KeepAlive             time.Duration `yaml:"keepAlive,omitempty" json:"keepAlive,omitempty"`
+	MaxIdleConns          int           `yaml:"maxIdleConns,omitempty" json:"maxIdleConns,omitempty"`
+	MaxIdleConnsPerHost   int           `yaml:"maxIdleConnsPerHost,omitempty" json:"maxIdleConnsPerHost,omitempty"`
+	MaxConnsPerHost       int           `yaml:"maxConnsPerHost,omitempty" json:"maxConnsPerHost,omitempty"`
+	IdleConnTimeout       time.Duration `yaml:"idleConnTimeout,omitempty" json:"idleConnTimeout,omitempty"`
+	TlsHandshakeTimeout   time.Duration `yaml:"tlsHandshakeTimeout,omitempty" json:"tlsHandshakeTimeout,omitempty"`
+	ExpectContinueTimeout time.Duration `yaml:"expectContinueTimeout,omitempty" json:"expectContinueTimeout,omitempty"`
+	// 域名解析缓存时间，大于0时开启缓存，见transport.DnsCache
+	DnsCacheTtl time.Duration `yaml:"dnsCacheTtl,omitempty" json:"dnsCacheTtl,omitempty"`
+}
+
+// TlsConfig TLS配置，证书及私钥为PEM格式文件
+type TlsConfig struct {
+	InsecureSkipVerify bool   `yaml:"insecureSkipVerify,omitempty" json:"insecureSkipVerify,omitempty"`
+	CaFile             string `yaml:"caFile,omitempty" json:"caFile,omitempty"`
+	CertFile           string `yaml:"certFile,omitempty" json:"certFile,omitempty"`
+	KeyFile            string `yaml:"keyFile,omitempty" json:"keyFile,omitempty"`
+	ServerName         string `yaml:"serverName,omitempty" json:"serverName,omitempty"`
+	// 最低版本：1.0、1.1、1.2、1.3
+	MinVersion string `yaml:"minVersion,omitempty" json:"minVersion,omitempty"`
+}
+
+// AuthConfig 认证配置
+type AuthConfig struct {
+	// 认证类型：basic、digest、bearer
+	Type     string `yaml:"type" json:"type"`
+	Username string `yaml:"username,omitempty" json:"username,omitempty"`
+	Password string `yaml:"password,omitempty" json:"password,omitempty"`
+	Token    string `yaml:"token,omitempty" json:"token,omitempty"`
+}
+
+// RetryConfig 重试配置，为0或空时使用filter.Retry的默认值
+type RetryConfig struct {
+	MaxAttempts int           `yaml:"maxAttempts,omitempty" json:"maxAttempts,omitempty"`
+	Backoff     time.Duration `yaml:"backoff,omitempty" json:"backoff,omitempty"`
+	MaxBackoff  time.Duration `yaml:"maxBackoff,omitempty" json:"maxBackoff,omitempty"`
+	StatusCodes []int         `yaml:"statusCodes,omitempty" json:"statusCodes,omitempty"`
+	Methods     []string      `yaml:"methods,omitempty" json:"methods,omitempty"`
+}
+
+// ConfigError 配置错误，Key为出错的配置路径，如transport.maxIdleConns
+type ConfigError struct {
+	// 配置来源：文件路径或环境变量名
+	Source string
+	Key    string
+	Err    error
+}
+
+func (e *ConfigError) Error() string {
+	buf := strings.Builder{}
+	buf.WriteString("restclient config: ")
+	if e.Source != "" {
+		buf.WriteString(e.Source + ": ")
+	}
+	if e.Key != "" {
+		buf.WriteString(e.Key + ": ")
+	}
+	buf.WriteString(e.Err.Error())
+	return buf.String()
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+func configErr(key string, format string, args ...interface{}) *ConfigError {
+	return &ConfigError{Key: key, Err: fmt.Errorf(format, args...)}
+}
+
+var (
+	configConverters = map[string]func() Converter{
+		"byte":   func() Converter { return NewByteConverter() },
+		"string": func() Converter { return NewStringConverter() },
+		"json":   func() Converter { return NewJsonConverter() },
+		"xml":    func() Converter { return NewXmlConverter() },
+		"yaml":   func() Converter { return NewYamlConverter() },
+	}
+	configFilters = map[string]func() filter.Filter{
+		"contentLength": func() filter.Filter { return filter.ContentLengthFilter },
+		"recovery":      func() filter.Filter { return filter.NewRecovery(xlog.GetLogger()).Filter },
+		"log":           func() filter.Filter { return filter.NewLog(xlog.GetLogger(), "").Filter },
+		"structuredLog": func() filter.Filter { return filter.NewStructuredLog(xlog.GetLogger()).Filter },
+		"curl":          func() filter.Filter { return filter.NewCurlLog(xlog.GetLogger()).Filter },
+		"hedging":       func() filter.Filter { return filter.NewHedging().Filter },
+	}
+)
+
+// RegisterConfigConverter 注册可在配置converters中使用的转换器，应在加载配置前（如init中）调用
+// 内置：byte、string、json、xml、yaml
+func RegisterConfigConverter(name string, creator func() Converter) {
+	configConverters[name] = creator
+}
+
+// RegisterConfigFilter 注册可在配置filters中使用的filter，应在加载配置前（如init中）调用
+// 内置：contentLength、recovery、log、structuredLog、curl（脱敏restutil.CurlSensitiveHeaders及url中的密码）、hedging
+func RegisterConfigFilter(name string, creator func() filter.Filter) {
+	configFilters[name] = creator
+}
+
+// FromConfig 从yaml或json配置文件创建client，配置可被环境变量覆盖，opts在配置之后生效
+func FromConfig(path string, opts ...Opt) (*defaultRestClient, error) {
+	c, err := LoadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	o, err := c.Options()
+	if err != nil {
+		return nil, err
+	}
+	return New(append(o, opts...)...), nil
+}
+
+// LoadConfig 加载配置文件，扩展名为.json时按json解析，否则按yaml解析
+// 加载后使用环境变量（见ConfigEnvPrefix）覆盖并校验配置
+func LoadConfig(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, &ConfigError{Source: path, Err: err}
+	}
+	var raw interface{}
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		err = json.Unmarshal(data, &raw)
+	} else {
+		err = yaml.Unmarshal(data, &raw)
+	}
+	if err != nil {
+		return nil, &ConfigError{Source: path, Err: err}
+	}
+	c := &Config{}
+	if err := decodeConfig(reflect.ValueOf(c).Elem(), raw, ""); err != nil {
+		err.Source = path
+		return nil, err
+	}
+	if _, err := c.applyEnv(reflect.ValueOf(c).Elem(), nil); err != nil {
+		return nil, err
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// applyEnv 使用环境变量覆盖配置，返回是否有配置被覆盖
+func (c *Config) applyEnv(v reflect.Value, path []string) (bool, error) {
+	applied := false
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := configName(t.Field(i))
+		if name == "" {
+			continue
+		}
+		p := append(append([]string(nil), path...), name)
+		field := v.Field(i)
+		if field.Kind() == reflect.Ptr && field.Type().Elem().Kind() == reflect.Struct {
+			target := field
+			if field.IsNil() {
+				target = reflect.New(field.Type().Elem())
+			}
+			ok, err := c.applyEnv(target.Elem(), p)
+			if err != nil {
+				return false, err
+			}
+			if ok && field.IsNil() {
+				field.Set(target)
+			}
+			applied = applied || ok
+			continue
+		}
+		env := envName(p)
+		if s, ok := os.LookupEnv(env); ok {
+			if err := decodeConfig(field, s, strings.Join(p, ".")); err != nil {
+				err.Source = "env " + env
+				return false, err
+			}
+			applied = true
+		}
+	}
+	return applied, nil
+}
+
+// envName 获得配置路径对应的环境变量名，如transport.maxIdleConns为RESTCLIENT_TRANSPORT_MAX_IDLE_CONNS
+func envName(path []string) string {
+	buf := strings.Builder{}
+	buf.WriteString(ConfigEnvPrefix)
+	for i, p := range path {
+		if i > 0 {
+			buf.WriteByte('_')
+		}
+		for j, r := range p {
+			if unicode.IsUpper(r) && j > 0 {
+				buf.WriteByte('_')
+			}
+			buf.WriteRune(unicode.ToUpper(r))
+		}
+	}
+	return buf.String()
+}
+
+func configName(f reflect.StructField) string {
+	tag := f.Tag.Get("yaml")
+	if tag == "-" {
+		return ""
+	}
+	return strings.Split(tag, ",")[0]
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// decodeConfig 将yaml或json解析的值写入配置，出错时返回出错的配置路径
+func decodeConfig(v reflect.Value, raw interface{}, key string) *ConfigError {
+	if raw == nil {
+		return nil
+	}
+	if v.Type() == durationType {
+		s, ok := raw.(string)
+		if !ok {
+			return configErr(key, "invalid duration %v, expect string such as \"10s\"", raw)
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return configErr(key, "invalid duration %q", s)
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return decodeConfig(v.Elem(), raw, key)
+	case reflect.Struct:
+		m, ok := toStringMap(raw)
+		if !ok {
+			return configErr(key, "expect object but get %v", raw)
+		}
+		fields := map[string]int{}
+		for i := 0; i < v.NumField(); i++ {
+			if name := configName(v.Type().Field(i)); name != "" {
+				fields[name] = i
+			}
+		}
+		for _, k := range sortedConfigKeys(m) {
+			i, ok := fields[k]
+			if !ok {
+				return configErr(joinKey(key, k), "unknown key")
+			}
+			if err := decodeConfig(v.Field(i), m[k], joinKey(key, k)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		m, ok := toStringMap(raw)
+		if !ok {
+			s, isStr := raw.(string)
+			if !isStr {
+				return configErr(key, "expect object but get %v", raw)
+			}
+			m = map[string]interface{}{}
+			for _, kv := range splitList(s) {
+				i := strings.Index(kv, "=")
+				if i <= 0 {
+					return configErr(key, "invalid key=value %q", kv)
+				}
+				m[strings.TrimSpace(kv[:i])] = strings.TrimSpace(kv[i+1:])
+			}
+		}
+		ret := reflect.MakeMapWithSize(v.Type(), len(m))
+		for _, k := range sortedConfigKeys(m) {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if err := decodeConfig(elem, m[k], joinKey(key, k)); err != nil {
+				return err
+			}
+			ret.SetMapIndex(reflect.ValueOf(k), elem)
+		}
+		v.Set(ret)
+	case reflect.Slice:
+		var list []interface{}
+		switch l := raw.(type) {
+		case []interface{}:
+			list = l
+		case string:
+			for _, s := range splitList(l) {
+				list = append(list, s)
+			}
+		default:
+			return configErr(key, "expect list but get %v", raw)
+		}
+		ret := reflect.MakeSlice(v.Type(), len(list), len(list))
+		for i, e := range list {
+			if err := decodeConfig(ret.Index(i), e, fmt.Sprintf("%s[%d]", key, i)); err != nil {
+				return err
+			}
+		}
+		v.Set(ret)
+	case reflect.String:
+		switch s := raw.(type) {
+		case string:
+			v.SetString(s)
+		case int, int64, float64, bool:
+			v.SetString(fmt.Sprint(s))
+		default:
+			return configErr(key, "expect string but get %v", raw)
+		}
+	case reflect.Bool:
+		switch b := raw.(type) {
+		case bool:
+			v.SetBool(b)
+		case string:
+			ret, err := strconv.ParseBool(b)
+			if err != nil {
+				return configErr(key, "invalid bool %q", b)
+			}
+			v.SetBool(ret)
+		default:
+			return configErr(key, "expect bool but get %v", raw)
+		}
+	case reflect.Int:
+		switch n := raw.(type) {
+		case int:
+			v.SetInt(int64(n))
+		case int64:
+			v.SetInt(n)
+		case float64:
+			if n != float64(int64(n)) {
+				return configErr(key, "expect integer but get %v", n)
+			}
+			v.SetInt(int64(n))
+		case string:
+			ret, err := strconv.Atoi(strings.TrimSpace(n))
+			if err != nil {
+				return configErr(key, "invalid integer %q", n)
+			}
+			v.SetInt(int64(ret))
+		default:
+			return configErr(key, "expect integer but get %v", raw)
+		}
+	default:
+		return configErr(key, "unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+func toStringMap(raw interface{}) (map[string]interface{}, bool) {
+	switch m := raw.(type) {
+	case map[string]interface{}:
+		return m, true
+	case map[interface{}]interface{}:
+		ret := make(map[string]interface{}, len(m))
+		for k, v := range m {
+			ret[fmt.Sprint(k)] = v
+		}
+		return ret, true
+	}
+	return nil, false
+}
+
+func sortedConfigKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func splitList(s string) []string {
+	var ret []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			ret = append(ret, v)
+		}
+	}
+	return ret
+}
+
+func joinKey(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// Validate 校验配置，返回的错误为*ConfigError
+func (c *Config) Validate() error {
+	if c.BaseUrl != "" {
+		u, err := url.Parse(c.BaseUrl)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return configErr("baseUrl", "invalid url %q, expect absolute url such as http://localhost:8080", c.BaseUrl)
+		}
+	}
+	for key, d := range map[string]time.Duration{
+		"timeout":          c.Timeout,
+		"connectTimeout":   c.ConnectTimeout,
+		"firstByteTimeout": c.FirstByteTimeout,
+		"bodyReadTimeout":  c.BodyReadTimeout,
+	} {
+		if d < 0 {
+			return configErr(key, "must not be negative")
+		}
+	}
+	if t := c.Transport; t != nil {
+		if err := nonNegative(reflect.ValueOf(t).Elem(), "transport"); err != nil {
+			return err
+		}
+	}
+	if t := c.Tls; t != nil {
+		if (t.CertFile == "") != (t.KeyFile == "") {
+			return configErr("tls.certFile", "certFile and keyFile must be set together")
+		}
+		if _, ok := tlsVersions[t.MinVersion]; t.MinVersion != "" && !ok {
+			return configErr("tls.minVersion", "invalid version %q, expect 1.0, 1.1, 1.2 or 1.3", t.MinVersion)
+		}
+	}
+	if c.Proxy != "" && c.Proxy != "none" {
+		u, err := url.Parse(c.Proxy)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return configErr("proxy", "invalid proxy url %q", c.Proxy)
+		}
+	}
+	if a := c.Auth; a != nil {
+		switch a.Type {
+		case "basic", "digest":
+			if a.Username == "" {
+				return configErr("auth.username", "required by %s auth", a.Type)
+			}
+		case "bearer":
+			if a.Token == "" {
+				return configErr("auth.token", "required by bearer auth")
+			}
+		default:
+			return configErr("auth.type", "invalid type %q, expect basic, digest or bearer", a.Type)
+		}
+	}
+	if r := c.Retry; r != nil {
+		if err := nonNegative(reflect.ValueOf(r).Elem(), "retry"); err != nil {
+			return err
+		}
+		for i, code := range r.StatusCodes {
+			if code < 100 || code > 599 {
+				return configErr(fmt.Sprintf("retry.statusCodes[%d]", i), "invalid status code %d", code)
+			}
+		}
+		for i, m := range r.Methods {
+			if m == "" || strings.ToUpper(m) != m {
+				return configErr(fmt.Sprintf("retry.methods[%d]", i), "invalid method %q", m)
+			}
+		}
+	}
+	for i, v := range c.Converters {
+		if _, ok := configConverters[v]; !ok {
+			return configErr(fmt.Sprintf("converters[%d]", i), "unknown converter %q", v)
+		}
+	}
+	names := map[string]bool{"auth": c.Auth != nil, "retry": c.Retry != nil}
+	for i, v := range c.Filters {
+		if _, ok := configFilters[v]; !ok {
+			return configErr(fmt.Sprintf("filters[%d]", i), "unknown filter %q", v)
+		}
+		if names[v] {
+			return configErr(fmt.Sprintf("filters[%d]", i), "duplicate filter %q", v)
+		}
+		names[v] = true
+	}
+	return nil
+}
+
+func nonNegative(v reflect.Value, prefix string) *ConfigError {
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Field(i)
+		if f.Kind() == reflect.Int || f.Kind() == reflect.Int64 {
+			if f.Int() < 0 {
+				return configErr(joinKey(prefix, configName(v.Type().Field(i))), "must not be negative")
+			}
+		}
+	}
+	return nil
+}
+
+// Options 将配置转换为client的配置项
+func (c *Config) Options() ([]Opt, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	var opts []Opt
+	if c.Timeout > 0 {
+		opts = append(opts, SetTimeout(c.Timeout))
+	}
+	if c.ConnectTimeout > 0 {
+		opts = append(opts, SetConnectTimeout(c.ConnectTimeout))
+	}
+	if c.FirstByteTimeout > 0 {
+		opts = append(opts, SetFirstByteTimeout(c.FirstByteTimeout))
+	}
+	if c.BodyReadTimeout > 0 {
+		opts = append(opts, SetBodyReadTimeout(c.BodyReadTimeout))
+	}
+	if c.Timings {
+		opts = append(opts, EnableTimings())
+	}
+	if c.BaseUrl != "" {
+		opts = append(opts, SetBaseUrl(c.BaseUrl))
+	}
+	if len(c.Headers) > 0 {
+		header := http.Header{}
+		for k, v := range c.Headers {
+			header.Set(k, v)
+		}
+		opts = append(opts, SetDefaultHeader(header))
+	}
+	if c.Transport != nil || c.Tls != nil || c.Proxy != "" {
+		t, err := c.transport()
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, SetRoundTripper(t))
+	}
+	if len(c.Converters) > 0 {
+		convs := make([]Converter, 0, len(c.Converters))
+		for _, v := range c.Converters {
+			convs = append(convs, configConverters[v]())
+		}
+		opts = append(opts, SetConverters(convs))
+	}
+	// 先添加的filter位于内层
+	if a := c.Auth; a != nil {
+		var f filter.Filter
+		switch a.Type {
+		case "basic":
+			f = filter.NewBasicAuth(a.Username, a.Password).Filter
+		case "digest":
+			f = filter.NewDigestAuth(a.Username, a.Password).Filter
+		case "bearer":
+			f = filter.NewAccessTokenAuth(a.Token).Filter
+		}
+		opts = append(opts, AddNamedFilter("auth", f))
+	}
+	if r := c.Retry; r != nil {
+		var ro []filter.RetryOpt
+		if r.MaxAttempts > 0 {
+			ro = append(ro, filter.OptSetRetryMaxAttempts(r.MaxAttempts))
+		}
+		if r.Backoff > 0 || r.MaxBackoff > 0 {
+			backoff, maxBackoff := filter.DefaultRetryBackoff, filter.DefaultRetryMaxBackoff
+			if r.Backoff > 0 {
+				backoff = r.Backoff
+			}
+			if r.MaxBackoff > 0 {
+				maxBackoff = r.MaxBackoff
+			}
+			ro = append(ro, filter.OptSetRetryBackoff(backoff, maxBackoff))
+		}
+		if len(r.StatusCodes) > 0 {
+			ro = append(ro, filter.OptSetRetryStatusCodes(r.StatusCodes...))
+		}
+		if len(r.Methods) > 0 {
+			ro = append(ro, filter.OptSetRetryMethods(r.Methods...))
+		}
+		opts = append(opts, AddNamedFilter("retry", filter.NewRetry(ro...).Filter))
+	}
+	for _, v := range c.Filters {
+		opts = append(opts, AddNamedFilter(v, configFilters[v]()))
+	}
+	return opts, nil
+}
+
+func (c *Config) transport() (*http.Transport, error) {
+	var opts []transport.Opt
+	if t := c.Transport; t != nil {
+		if t.DialTimeout > 0 || t.KeepAlive > 0 || t.DnsCacheTtl > 0 {
+			dial, keepAlive := transport.ConnectTimeout, transport.KeepaliveTime
+			if t.DialTimeout > 0 {
+				dial = t.DialTimeout
+			}
+			if t.KeepAlive > 0 {
+				keepAlive = t.KeepAlive
+			}
+			var dns *transport.DnsCache
+			if t.DnsCacheTtl > 0 {
+				dns = transport.NewDnsCache(transport.OptSetDnsTTL(t.DnsCacheTtl))
+			}
+			opts = append(opts, transport.SetDialContext(dial, keepAlive, dns))
+		}
+		if t.MaxIdleConns > 0 {
+			opts = append(opts, transport.SetMaxIdleConnects(t.MaxIdleConns))
+		}
+		if t.MaxIdleConnsPerHost > 0 {
+			opts = append(opts, transport.SetMaxIdleConnectsPerHost(t.MaxIdleConnsPerHost))
+		}
+		if t.MaxConnsPerHost > 0 {
+			opts = append(opts, transport.SetMaxConnectsPerHost(t.MaxConnsPerHost))
+		}
+		if t.IdleConnTimeout > 0 {
+			opts = append(opts, transport.SetIdleConnectTimeout(t.IdleConnTimeout))
+		}
+		if t.TlsHandshakeTimeout > 0 {
+			opts = append(opts, transport.SetTlsShakeTimeout(t.TlsHandshakeTimeout))
+		}
+		if t.ExpectContinueTimeout > 0 {
+			opts = append(opts, transport.SetExpectContinueTimeout(t.ExpectContinueTimeout))
+		}
+	}
+	if c.Tls != nil {
+		tc, err := c.Tls.build()
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, transport.SetTlsConfig(tc))
+	}
+	switch c.Proxy {
+	case "":
+	case "none":
+		opts = append(opts, transport.SetProxy(nil))
+	default:
+		u, _ := url.Parse(c.Proxy)
+		opts = append(opts, transport.SetProxy(http.ProxyURL(u)))
+	}
+	return transport.New(opts...), nil
+}
+
+func (t *TlsConfig) build() (*tls.Config, error) {
+	ret := &tls.Config{
+		InsecureSkipVerify: t.InsecureSkipVerify,
+		ServerName:         t.ServerName,
+		MinVersion:         tlsVersions[t.MinVersion],
+	}
+	if t.CaFile != "" {
+		data, err := ioutil.ReadFile(t.CaFile)
+		if err != nil {
+			return nil, &ConfigError{Key: "tls.caFile", Err: err}
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, configErr("tls.caFile", "no valid PEM certificate in %s", t.CaFile)
+		}
+		ret.RootCAs = pool
+	}
+	if t.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, &ConfigError{Key: "tls.certFile", Err: err}
+		}
+		ret.Certificates = []tls.Certificate{cert}
+	}
+	return ret, nil
+}
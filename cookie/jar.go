@@ -0,0 +1,510 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cookie
+
+import (
+	"errors"
+	"github.com/xfali/restclient/v2/filter"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// cookie的Domain为公共后缀或与请求的host不匹配
+	ErrInvalidDomain = errors.New("cookie: invalid domain")
+	// 非安全连接设置Secure cookie或__Secure-、__Host-前缀的cookie不符合要求
+	ErrInsecure = errors.New("cookie: secure cookie from insecure url")
+)
+
+// Jar 遵循RFC 6265的cookie缓存，实现了Cache及http.CookieJar接口
+// 1、按Domain、Path匹配cookie，拒绝设置在公共后缀上的cookie，区分host-only cookie
+// 2、Secure cookie仅通过https发送，非安全连接不能设置或覆盖Secure cookie（RFC 6265bis）
+// 3、支持__Secure-、__Host-前缀，保留HttpOnly、SameSite属性
+// 4、配置Store后持久化cookie（默认仅持久化设置了过期时间的cookie），重启后会话仍然有效
+// 注意：作为客户端所有请求都视为同站（same-site）请求，SameSite不影响cookie的发送
+type Jar struct {
+	psl           PublicSuffixList
+	store         Store
+	keepSession   bool
+	purgeInterval time.Duration
+	now           func() time.Time
+
+	// domain -> id(name;path) -> cookie
+	entries   map[string]map[string]*Entry
+	lock      sync.Mutex
+	saveLock  sync.Mutex
+	stop      chan struct{}
+	closeOnce sync.Once
+}
+
+type JarOpt func(*Jar)
+
+// NewJar 创建cookie缓存，配置Store时从Store加载cookie
+// psl为公共后缀列表，与net/http/cookiejar一致需要显式指定，推荐使用golang.org/x/net/publicsuffix.List，
+// 也可以使用不完整的BuiltinPublicSuffixList；为nil时不检查公共后缀，任意站点可以为同一公共后缀下的其他站点设置cookie
+func NewJar(psl PublicSuffixList, opts ...JarOpt) (*Jar, error) {
+	ret := &Jar{
+		psl:           psl,
+		purgeInterval: DefaultPurgeInterval,
+		now:           time.Now,
+		entries:       map[string]map[string]*Entry{},
+		stop:          make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(ret)
+	}
+	if ret.store != nil {
+		entries, err := ret.store.Load()
+		if err != nil {
+			return nil, err
+		}
+		now := ret.now()
+		for _, e := range entries {
+			if e.Persistent && !e.Expires.After(now) {
+				continue
+			}
+			ret.put(e)
+		}
+	}
+	return ret, nil
+}
+
+// OptSetStore 配置持久化存储，cookie变化时自动保存
+func OptSetStore(store Store) JarOpt {
+	return func(j *Jar) {
+		j.store = store
+	}
+}
+
+// OptSetKeepSessionCookies 配置是否持久化会话cookie（未设置过期时间的cookie），默认不持久化
+func OptSetKeepSessionCookies(keep bool) JarOpt {
+	return func(j *Jar) {
+		j.keepSession = keep
+	}
+}
+
+// OptSetJarPurgeInterval 配置AutoPurge的回收间隔
+func OptSetJarPurgeInterval(interval time.Duration) JarOpt {
+	return func(j *Jar) {
+		j.purgeInterval = interval
+	}
+}
+
+// Set 设置cookie（RFC 6265 5.3），path为设置cookie的请求url
+// cookie不符合要求时返回ErrInvalidDomain或ErrInsecure，持久化失败时返回存储的错误
+func (j *Jar) Set(path string, cookie *http.Cookie) error {
+	if cookie == nil {
+		return nil
+	}
+	u, err := url.Parse(path)
+	if err != nil {
+		return err
+	}
+	changed, err := j.set(u, cookie)
+	if err != nil || !changed {
+		return err
+	}
+	return j.Save()
+}
+
+func (j *Jar) set(u *url.URL, cookie *http.Cookie) (bool, error) {
+	host, err := canonicalHost(u.Host)
+	if err != nil {
+		return false, err
+	}
+	secureURL := u.Scheme == "https" || u.Scheme == "wss"
+
+	e := &Entry{
+		Name:     cookie.Name,
+		Value:    cookie.Value,
+		Secure:   cookie.Secure,
+		HttpOnly: cookie.HttpOnly,
+		SameSite: sameSiteString(cookie.SameSite),
+	}
+	if e.Domain, e.HostOnly, err = j.domain(host, cookie.Domain); err != nil {
+		return false, err
+	}
+	e.Path = cookie.Path
+	if e.Path == "" || e.Path[0] != '/' {
+		e.Path = defaultPath(u.Path)
+	}
+	if e.Secure && !secureURL {
+		return false, ErrInsecure
+	}
+	if strings.HasPrefix(e.Name, "__Secure-") && !e.Secure {
+		return false, ErrInsecure
+	}
+	if strings.HasPrefix(e.Name, "__Host-") && (!e.Secure || !e.HostOnly || cookie.Path != "/") {
+		return false, ErrInsecure
+	}
+
+	now := j.now()
+	remove := false
+	switch {
+	case cookie.MaxAge < 0:
+		remove = true
+	case cookie.MaxAge > 0:
+		e.Persistent = true
+		e.Expires = now.Add(time.Duration(cookie.MaxAge) * time.Second)
+	case !cookie.Expires.IsZero():
+		e.Persistent = true
+		e.Expires = cookie.Expires
+		remove = !e.Expires.After(now)
+	}
+
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	id := e.Name + ";" + e.Path
+	old, exists := j.entries[e.Domain][id]
+	// 非安全连接不能覆盖Secure cookie
+	if exists && old.Secure && !secureURL {
+		return false, ErrInsecure
+	}
+	if remove {
+		if exists {
+			delete(j.entries[e.Domain], id)
+		}
+		return exists, nil
+	}
+	e.Creation = now
+	if exists {
+		e.Creation = old.Creation
+	}
+	e.LastAccess = now
+	j.put(e)
+	return true, nil
+}
+
+// domain 计算cookie的domain及是否为host-only cookie（RFC 6265 5.3 4-6）
+func (j *Jar) domain(host, domain string) (string, bool, error) {
+	if domain == "" {
+		return host, true, nil
+	}
+	domain = strings.ToLower(strings.TrimPrefix(domain, "."))
+	if isIP(host) {
+		if domain != host {
+			return "", false, ErrInvalidDomain
+		}
+		return host, true, nil
+	}
+	if j.psl != nil && j.psl.PublicSuffix(domain) == domain {
+		// 在公共后缀上设置的cookie仅当请求的host即为该后缀时有效，且为host-only
+		if domain == host {
+			return host, true, nil
+		}
+		return "", false, ErrInvalidDomain
+	}
+	if !domainMatch(host, domain) {
+		return "", false, ErrInvalidDomain
+	}
+	return domain, false, nil
+}
+
+func (j *Jar) put(e *Entry) {
+	m, ok := j.entries[e.Domain]
+	if !ok {
+		m = map[string]*Entry{}
+		j.entries[e.Domain] = m
+	}
+	m[e.Name+";"+e.Path] = e
+}
+
+// Get 获得请求url需要发送的cookie（RFC 6265 5.4），同时回收匹配域名下已过期的cookie
+// 返回的cookie按path由长到短、创建时间由早到晚排序
+func (j *Jar) Get(path string) []*http.Cookie {
+	u, err := url.Parse(path)
+	if err != nil {
+		return nil
+	}
+	return j.get(u)
+}
+
+func (j *Jar) get(u *url.URL) []*http.Cookie {
+	host, err := canonicalHost(u.Host)
+	if err != nil {
+		return nil
+	}
+	secureURL := u.Scheme == "https" || u.Scheme == "wss"
+	reqPath := u.Path
+	if reqPath == "" {
+		reqPath = "/"
+	}
+
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	now := j.now()
+	var selected []*Entry
+	for _, domain := range candidateDomains(host) {
+		for id, e := range j.entries[domain] {
+			if e.Persistent && !e.Expires.After(now) {
+				delete(j.entries[domain], id)
+				continue
+			}
+			if e.HostOnly && e.Domain != host {
+				continue
+			}
+			if e.Secure && !secureURL {
+				continue
+			}
+			if !pathMatch(reqPath, e.Path) {
+				continue
+			}
+			e.LastAccess = now
+			selected = append(selected, e)
+		}
+	}
+	sort.Slice(selected, func(a, b int) bool {
+		if len(selected[a].Path) != len(selected[b].Path) {
+			return len(selected[a].Path) > len(selected[b].Path)
+		}
+		return selected[a].Creation.Before(selected[b].Creation)
+	})
+	ret := make([]*http.Cookie, 0, len(selected))
+	for _, e := range selected {
+		ret = append(ret, toCookie(e))
+	}
+	return ret
+}
+
+// SetCookies 实现http.CookieJar，错误的cookie被忽略
+func (j *Jar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	changed := false
+	for _, c := range cookies {
+		if ok, err := j.set(u, c); err == nil && ok {
+			changed = true
+		}
+	}
+	if changed {
+		_ = j.Save()
+	}
+}
+
+// Cookies 实现http.CookieJar
+func (j *Jar) Cookies(u *url.URL) []*http.Cookie {
+	return j.get(u)
+}
+
+// Purge 回收过期的cookie
+func (j *Jar) Purge() {
+	j.lock.Lock()
+	now := j.now()
+	changed := false
+	for domain, m := range j.entries {
+		for id, e := range m {
+			if e.Persistent && !e.Expires.After(now) {
+				delete(m, id)
+				changed = true
+			}
+		}
+		if len(m) == 0 {
+			delete(j.entries, domain)
+		}
+	}
+	j.lock.Unlock()
+	if changed {
+		_ = j.Save()
+	}
+}
+
+// AutoPurge 开启定时回收过期cookie的协程，需要调用Close关闭
+func (j *Jar) AutoPurge() {
+	interval := j.purgeInterval
+	if interval <= 0 {
+		interval = DefaultPurgeInterval
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-j.stop:
+				return
+			case <-ticker.C:
+				j.Purge()
+			}
+		}
+	}()
+}
+
+// Close 停止自动回收并保存cookie
+func (j *Jar) Close() error {
+	j.closeOnce.Do(func() {
+		close(j.stop)
+	})
+	return j.Save()
+}
+
+// Entries 获得所有cookie的快照
+func (j *Jar) Entries() []*Entry {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	return j.snapshot(true)
+}
+
+func (j *Jar) snapshot(all bool) []*Entry {
+	var ret []*Entry
+	for _, m := range j.entries {
+		for _, e := range m {
+			if all || e.Persistent || j.keepSession {
+				v := *e
+				ret = append(ret, &v)
+			}
+		}
+	}
+	sort.Slice(ret, func(a, b int) bool {
+		if ret[a].Domain != ret[b].Domain {
+			return ret[a].Domain < ret[b].Domain
+		}
+		if ret[a].Path != ret[b].Path {
+			return ret[a].Path < ret[b].Path
+		}
+		return ret[a].Name < ret[b].Name
+	})
+	return ret
+}
+
+// Save 将cookie保存到Store，未配置Store时不做任何处理
+func (j *Jar) Save() error {
+	if j.store == nil {
+		return nil
+	}
+	// 保证快照与写入的顺序一致，避免旧的快照覆盖新的数据
+	j.saveLock.Lock()
+	defer j.saveLock.Unlock()
+	j.lock.Lock()
+	entries := j.snapshot(false)
+	j.lock.Unlock()
+	return j.store.Save(entries)
+}
+
+func (j *Jar) Filter(request *http.Request, fc filter.FilterChain) (*http.Response, error) {
+	for _, v := range j.get(request.URL) {
+		request.AddCookie(v)
+	}
+	resp, err := fc.Filter(request)
+	if resp != nil {
+		j.SetCookies(request.URL, resp.Cookies())
+	}
+	return resp, err
+}
+
+func toCookie(e *Entry) *http.Cookie {
+	ret := &http.Cookie{
+		Name:     e.Name,
+		Value:    e.Value,
+		Path:     e.Path,
+		Secure:   e.Secure,
+		HttpOnly: e.HttpOnly,
+		SameSite: parseSameSite(e.SameSite),
+	}
+	if !e.HostOnly {
+		ret.Domain = e.Domain
+	}
+	if e.Persistent {
+		ret.Expires = e.Expires
+	}
+	return ret
+}
+
+func canonicalHost(host string) (string, error) {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.Trim(host, "[]"), ".")
+	if host == "" {
+		return "", ErrInvalidDomain
+	}
+	return strings.ToLower(host), nil
+}
+
+func isIP(host string) bool {
+	return net.ParseIP(host) != nil
+}
+
+// domainMatch RFC 6265 5.1.3
+func domainMatch(host, domain string) bool {
+	if host == domain {
+		return true
+	}
+	return !isIP(host) && strings.HasSuffix(host, "."+domain)
+}
+
+// pathMatch RFC 6265 5.1.4
+func pathMatch(reqPath, cookiePath string) bool {
+	if reqPath == cookiePath {
+		return true
+	}
+	if strings.HasPrefix(reqPath, cookiePath) {
+		return cookiePath[len(cookiePath)-1] == '/' || reqPath[len(cookiePath)] == '/'
+	}
+	return false
+}
+
+// defaultPath RFC 6265 5.1.4
+func defaultPath(p string) string {
+	if p == "" || p[0] != '/' {
+		return "/"
+	}
+	i := strings.LastIndex(p, "/")
+	if i == 0 {
+		return "/"
+	}
+	return p[:i]
+}
+
+// candidateDomains 获得host及其所有上级域名
+func candidateDomains(host string) []string {
+	if isIP(host) {
+		return []string{host}
+	}
+	ret := []string{host}
+	for i := 0; i < len(host); i++ {
+		if host[i] == '.' {
+			ret = append(ret, host[i+1:])
+		}
+	}
+	return ret
+}
+
+func sameSiteString(v http.SameSite) string {
+	switch v {
+	case http.SameSiteLaxMode:
+		return "Lax"
+	case http.SameSiteStrictMode:
+		return "Strict"
+	case http.SameSiteNoneMode:
+		return "None"
+	}
+	return ""
+}
+
+func parseSameSite(v string) http.SameSite {
+	switch v {
+	case "Lax":
+		return http.SameSiteLaxMode
+	case "Strict":
+		return http.SameSiteStrictMode
+	case "None":
+		return http.SameSiteNoneMode
+	}
+	return http.SameSiteDefaultMode
+}
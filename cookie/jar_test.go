@@ -0,0 +1,149 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cookie
+
+import (
+	"github.com/xfali/restclient/v2"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func names(cookies []*http.Cookie) string {
+	ret := ""
+	for _, c := range cookies {
+		if ret != "" {
+			ret += ","
+		}
+		ret += c.Name
+	}
+	return ret
+}
+
+func TestJarDomain(t *testing.T) {
+	jar, _ := NewJar(BuiltinPublicSuffixList)
+	var _ Cache = jar
+	var _ http.CookieJar = jar
+
+	if err := jar.Set("https://www.example.com/", &http.Cookie{Name: "host", Value: "1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := jar.Set("https://www.example.com/", &http.Cookie{Name: "domain", Value: "1", Domain: ".example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := jar.Set("https://www.example.com/", &http.Cookie{Name: "other", Value: "1", Domain: "other.com"}); err != ErrInvalidDomain {
+		t.Fatal("expect invalid domain, but get ", err)
+	}
+	if err := jar.Set("https://www.example.co.uk/", &http.Cookie{Name: "psl", Value: "1", Domain: "co.uk"}); err != ErrInvalidDomain {
+		t.Fatal("expect public suffix rejected, but get ", err)
+	}
+
+	if v := names(jar.Get("https://www.example.com/a")); v != "host,domain" {
+		t.Fatal(v)
+	}
+	if v := names(jar.Get("https://api.example.com/a")); v != "domain" {
+		t.Fatal(v)
+	}
+	if v := names(jar.Get("https://notexample.com/a")); v != "" {
+		t.Fatal(v)
+	}
+}
+
+func TestJarPathAndSecure(t *testing.T) {
+	jar, _ := NewJar(BuiltinPublicSuffixList)
+	_ = jar.Set("https://example.com/api/users/1", &http.Cookie{Name: "default", Value: "1"})
+	_ = jar.Set("https://example.com/", &http.Cookie{Name: "root", Value: "1", Path: "/"})
+	_ = jar.Set("https://example.com/", &http.Cookie{Name: "secure", Value: "1", Path: "/", Secure: true})
+	if err := jar.Set("http://example.com/", &http.Cookie{Name: "secure", Value: "2", Path: "/"}); err != ErrInsecure {
+		t.Fatal("expect insecure, but get ", err)
+	}
+	if err := jar.Set("https://example.com/a", &http.Cookie{Name: "__Host-id", Value: "1", Secure: true}); err != ErrInsecure {
+		t.Fatal("expect __Host- rejected, but get ", err)
+	}
+
+	// 默认path为/api/users，path长的排在前面
+	if v := names(jar.Get("https://example.com/api/users/2")); v != "default,root,secure" {
+		t.Fatal(v)
+	}
+	if v := names(jar.Get("https://example.com/api/usersx")); v != "root,secure" {
+		t.Fatal(v)
+	}
+	if v := names(jar.Get("http://example.com/")); v != "root" {
+		t.Fatal(v)
+	}
+
+	_ = jar.Set("https://example.com/", &http.Cookie{Name: "root", Path: "/", MaxAge: -1})
+	if v := names(jar.Get("http://example.com/")); v != "" {
+		t.Fatal(v)
+	}
+}
+
+func TestJarPersist(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cookie")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store := NewFileStore(filepath.Join(dir, "cookies.json"))
+
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Path == "/login" {
+			http.SetCookie(writer, &http.Cookie{Name: "token", Value: "abc", Path: "/", MaxAge: 3600, HttpOnly: true})
+			http.SetCookie(writer, &http.Cookie{Name: "session", Value: "xyz", Path: "/"})
+			return
+		}
+		if c, err := request.Cookie("token"); err != nil || c.Value != "abc" {
+			writer.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer server.Close()
+
+	jar, err := NewJar(BuiltinPublicSuffixList, OptSetStore(store))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := restclient.New(restclient.AddFilter(jar.Filter))
+	if err := client.Exchange(server.URL + "/login"); err != nil {
+		t.Fatal(err)
+	}
+	_ = jar.Close()
+
+	// 重新加载，会话cookie不持久化
+	jar, err = NewJar(BuiltinPublicSuffixList, OptSetStore(store))
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := jar.Entries()
+	if len(entries) != 1 || entries[0].Name != "token" || !entries[0].HttpOnly {
+		t.Fatal(entries)
+	}
+	client = restclient.New(restclient.AddFilter(jar.Filter))
+	if err := client.Exchange(server.URL + "/data"); err != nil {
+		t.Fatal(err)
+	}
+
+	jar.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	jar.Purge()
+	jar, _ = NewJar(BuiltinPublicSuffixList, OptSetStore(store))
+	if len(jar.Entries()) != 0 {
+		t.Fatal("expect expired cookie purged")
+	}
+}
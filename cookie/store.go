@@ -0,0 +1,110 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cookie
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Entry 持久化的cookie
+type Entry struct {
+	Name       string    `json:"name"`
+	Value      string    `json:"value"`
+	Domain     string    `json:"domain"`
+	Path       string    `json:"path"`
+	HostOnly   bool      `json:"hostOnly"`
+	Secure     bool      `json:"secure"`
+	HttpOnly   bool      `json:"httpOnly"`
+	SameSite   string    `json:"sameSite,omitempty"`
+	Persistent bool      `json:"persistent"`
+	Expires    time.Time `json:"expires,omitempty"`
+	Creation   time.Time `json:"creation"`
+	LastAccess time.Time `json:"lastAccess"`
+}
+
+// Store cookie持久化存储
+type Store interface {
+	// 加载所有cookie，存储不存在时返回空
+	Load() ([]*Entry, error)
+
+	// 保存所有cookie（全量覆盖）
+	Save(entries []*Entry) error
+}
+
+// FileStore 基于json文件的存储
+type FileStore struct {
+	path string
+}
+
+// NewFileStore 创建json文件存储，文件包含会话凭证，以0600权限写入
+func NewFileStore(path string) *FileStore {
+	return &FileStore{
+		path: path,
+	}
+}
+
+func (s *FileStore) Load() ([]*Entry, error) {
+	data, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var ret []*Entry
+	if len(data) == 0 {
+		return nil, nil
+	}
+	if err := json.Unmarshal(data, &ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (s *FileStore) Save(entries []*Entry) error {
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(s.path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	// 先写入临时文件再重命名，避免写入中断导致文件损坏
+	f, err := ioutil.TempFile(dir, ".cookies-*")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), 0600)
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), s.path)
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+	}
+	return err
+}
@@ -0,0 +1,71 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cookie
+
+import (
+	"strings"
+)
+
+// PublicSuffixList 公共后缀列表，用于拒绝设置在公共后缀（如com、co.uk）上的cookie
+// 与net/http/cookiejar.PublicSuffixList一致，可直接使用golang.org/x/net/publicsuffix.List
+type PublicSuffixList interface {
+	// 获得域名的公共后缀
+	PublicSuffix(domain string) string
+
+	// 列表的描述
+	String() string
+}
+
+// BuiltinPublicSuffixList 内置的公共后缀列表，不完整：仅包含顶级域名及少量常见的多级公共后缀，
+// 未包含的公共后缀（如pvt.k12.ma.us、s3.amazonaws.com）上的cookie不会被拒绝，
+// 可用于测试或只访问已知站点的工具，其他场景请使用golang.org/x/net/publicsuffix.List
+var BuiltinPublicSuffixList PublicSuffixList = builtinSuffixList{}
+
+var builtinSuffixes = map[string]bool{
+	"co.uk": true, "org.uk": true, "ac.uk": true, "gov.uk": true, "ltd.uk": true, "me.uk": true, "net.uk": true,
+	"com.cn": true, "net.cn": true, "org.cn": true, "gov.cn": true, "edu.cn": true, "ac.cn": true,
+	"com.hk": true, "com.tw": true, "com.sg": true,
+	"com.au": true, "net.au": true, "org.au": true, "edu.au": true, "gov.au": true,
+	"co.jp": true, "ne.jp": true, "or.jp": true, "ac.jp": true, "go.jp": true,
+	"co.kr": true, "or.kr": true,
+	"com.br": true, "net.br": true, "org.br": true,
+	"co.nz": true, "org.nz": true, "co.in": true, "co.za": true, "com.mx": true, "com.tr": true, "com.ru": true,
+	"github.io": true, "gitlab.io": true, "herokuapp.com": true, "appspot.com": true, "blogspot.com": true,
+	"cloudfront.net": true, "azurewebsites.net": true, "vercel.app": true, "netlify.app": true, "pages.dev": true,
+}
+
+type builtinSuffixList struct{}
+
+func (builtinSuffixList) PublicSuffix(domain string) string {
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	// 由长到短匹配多级后缀
+	for i := 0; i < len(domain); i++ {
+		if i == 0 || domain[i-1] == '.' {
+			if builtinSuffixes[domain[i:]] {
+				return domain[i:]
+			}
+		}
+	}
+	if i := strings.LastIndex(domain, "."); i != -1 {
+		return domain[i+1:]
+	}
+	return domain
+}
+
+func (builtinSuffixList) String() string {
+	return "restclient builtin public suffix list"
+}
@@ -30,7 +30,6 @@ import (
 	"net/http"
 	"reflect"
 	"strings"
-	"time"
 )
 
 type AcceptFlag int
@@ -67,7 +66,7 @@ type HttpClientCreator func() *http.Client
 type defaultRestClient struct {
 	client        *http.Client
 	converters    []Converter
-	filterManager filter.FilterManager
+	filterManager filter.NamedFilterManager
 	pool          buffer.Pool
 
 	cliCreator HttpClientCreator
@@ -75,7 +74,10 @@ type defaultRestClient struct {
 	acceptFlag AcceptFlag
 	respFlag   ResponseBodyFlag
 	transport  http.RoundTripper
-	timeout    time.Duration
+	timeouts   timeouts
+	timings    bool
+	baseUrl    string
+	header     http.Header
 }
 
 type Opt func(client *defaultRestClient)
@@ -85,11 +87,10 @@ func New(opts ...Opt) *defaultRestClient {
 		transport:  defaultTransport,
 		converters: defaultConverters,
 		pool:       buffer.NewPool(),
-		timeout:    DefaultTimeout,
+		timeouts:   timeouts{total: DefaultTimeout},
 		acceptFlag: AcceptAutoFirst,
 		respFlag:   ResponseBodyAll,
 	}
-	ret.filterManager.Add(ret.filter)
 	for _, opt := range opts {
 		opt(ret)
 	}
@@ -101,11 +102,26 @@ func New(opts ...Opt) *defaultRestClient {
 	return ret
 }
 
-func (c *defaultRestClient) Exchange(url string, opts ...request.Opt) Error {
+func (c *defaultRestClient) Exchange(url string, opts ...request.Opt) (ret Error) {
 	param := emptyParam()
 	for _, opt := range opts {
 		opt(param)
 	}
+	if param.err != nil {
+		return withErr(DefaultErrorStatus, param.err)
+	}
+	url = c.resolveUrl(url)
+	if len(c.header) > 0 {
+		if param.header == nil {
+			param.header = make(http.Header)
+		}
+		// 默认header不覆盖请求中的配置
+		for k, vs := range c.header {
+			if param.header.Get(k) == "" {
+				param.header[k] = append([]string(nil), vs...)
+			}
+		}
+	}
 
 	// 序列化request body
 	r, err := c.encodeRequest(param.reqBody, param.header)
@@ -122,22 +138,102 @@ func (c *defaultRestClient) Exchange(url string, opts ...request.Opt) Error {
 		param.header = c.addAccept(param.result, param.header)
 	}
 
+	ctx := param.ctx
+	if param.route != "" {
+		ctx = restutil.WithRoute(ctx, param.route)
+	}
+	// 超时控制，请求配置覆盖client的默认配置
+	ctx, tc := newTimeoutControl(ctx, c.timeouts.merge(param.timeouts))
+	defer tc.close()
+	// 通知filter请求的最终结果，包括解析应答失败等filter之外的错误
+	ctx, done := restutil.WithExchange(ctx)
+	defer func() {
+		done(ret)
+	}()
+
+	timings := param.timings
+	if timings == nil && c.timings {
+		timings = restutil.NewTimings()
+	}
+	if timings != nil {
+		timings.Reset()
+		ctx = restutil.WithTimings(ctx, timings)
+	}
+
 	// 创建http.Request
-	req := defaultRequestCreator(param.ctx, param.method, url, r, param.header)
+	req := defaultRequestCreator(ctx, param.method, url, r, param.header)
 	fm := c.filterManager
 	if param.filterManager.Valid() {
-		fm = filter.MergeFilterManager(c.filterManager, param.filterManager)
+		fm = filter.MergeNamedFilterManager(c.filterManager, param.filterManager)
 	}
-	response, err := fm.RunFilter(req)
+	// 发送请求的filter始终位于最内层
+	chain := append(filter.FilterChain{c.filter}, fm.Chain(param.disabled...)...)
+	response, err := chain.Filter(req)
 	if err != nil {
-		return withErr(DefaultErrorStatus, err)
+		return withErr(DefaultErrorStatus, tc.wrap(err)).withTimings(timings)
 	}
 
-	return c.processResponse(response, param, nilResult)
+	tc.startBodyRead()
+	if e := c.processResponse(response, param, nilResult); e != nil {
+		if tc.expired() != 0 {
+			return withErr(e.StatusCode(), tc.wrap(e.Origin())).withTimings(timings)
+		}
+		if de, ok := e.(defaultError); ok {
+			return de.withTimings(timings)
+		}
+		return e
+	}
+	return nil
+}
+
+// resolveUrl 配置了baseUrl时，将不包含scheme的相对地址拼接到baseUrl之后
+func (c *defaultRestClient) resolveUrl(url string) string {
+	if c.baseUrl == "" || strings.Contains(url, "://") {
+		return url
+	}
+	if url == "" || strings.HasPrefix(url, "?") {
+		return c.baseUrl + url
+	}
+	return strings.TrimSuffix(c.baseUrl, "/") + "/" + strings.TrimPrefix(url, "/")
 }
 
 func (c *defaultRestClient) filter(request *http.Request, fc filter.FilterChain) (*http.Response, error) {
-	return c.client.Do(request)
+	// 获得连接及等待第一个字节的超时在每次发送时重新计时，超时时只取消本次发送，外层filter可以重试
+	ctx, st := newSendTimeout(request.Context())
+	if st != nil {
+		request = request.WithContext(ctx)
+	}
+	resp, err := c.client.Do(request)
+	if st != nil {
+		resp, err = st.done(resp, err)
+	}
+	if timings := restutil.GetTimings(request.Context()); timings != nil {
+		if err != nil || resp.Body == nil {
+			timings.Finish()
+		} else {
+			resp.Body = &timingsBody{ReadCloser: resp.Body, timings: timings}
+		}
+	}
+	return resp, err
+}
+
+// timingsBody 应答body读取完成或关闭时结束耗时统计
+type timingsBody struct {
+	io.ReadCloser
+	timings *restutil.Timings
+}
+
+func (b *timingsBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil {
+		b.timings.Finish()
+	}
+	return n, err
+}
+
+func (b *timingsBody) Close() error {
+	b.timings.Finish()
+	return b.ReadCloser.Close()
 }
 
 func copyResponse(dst, src *http.Response) {
@@ -164,9 +260,9 @@ func defaultRequestCreator(ctx context.Context, method, url string, r io.Reader,
 }
 
 func (c *defaultRestClient) newClient() *http.Client {
+	// 超时由每个请求单独控制，以便请求的配置可以覆盖client的默认配置
 	return &http.Client{
 		Transport: c.transport,
-		Timeout:   c.timeout,
 	}
 }
 
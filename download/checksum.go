@@ -0,0 +1,161 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package download
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+const (
+	HeaderContentMD5 = "Content-MD5"
+	HeaderDigest     = "Digest"
+	HeaderReprDigest = "Repr-Digest"
+)
+
+// 支持的摘要算法，名称为Digest/Repr-Digest中使用的小写名称
+var algorithms = map[string]func() hash.Hash{
+	"md5":     md5.New,
+	"sha":     sha1.New,
+	"sha-256": sha256.New,
+	"sha-512": sha512.New,
+}
+
+// ChecksumError 下载内容的摘要与期望值不一致
+type ChecksumError struct {
+	// 摘要算法名称
+	Algorithm string
+	Expected  []byte
+	Actual    []byte
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("download: %s checksum mismatch, expected %x, got %x", e.Algorithm, e.Expected, e.Actual)
+}
+
+type checksum struct {
+	algo     string
+	newHash  func() hash.Hash
+	expected []byte
+}
+
+// headerChecksums 从应答header中获得完整内容的摘要
+// Digest（RFC 3230）及Repr-Digest（RFC 9530）针对完整资源，Content-MD5仅在完整应答（200）时有效
+func headerChecksums(header http.Header, full bool) []checksum {
+	var ret []checksum
+	for _, v := range header.Values(HeaderReprDigest) {
+		for _, item := range strings.Split(v, ",") {
+			name, value := splitPair(item)
+			if len(value) < 2 || value[0] != ':' || value[len(value)-1] != ':' {
+				continue
+			}
+			ret = appendChecksum(ret, name, value[1:len(value)-1])
+		}
+	}
+	for _, v := range header.Values(HeaderDigest) {
+		for _, item := range strings.Split(v, ",") {
+			name, value := splitPair(item)
+			ret = appendChecksum(ret, name, value)
+		}
+	}
+	if full {
+		if v := strings.TrimSpace(header.Get(HeaderContentMD5)); v != "" {
+			ret = appendChecksum(ret, "md5", v)
+		}
+	}
+	return ret
+}
+
+func splitPair(s string) (string, string) {
+	i := strings.Index(s, "=")
+	if i < 0 {
+		return "", ""
+	}
+	return strings.ToLower(strings.TrimSpace(s[:i])), strings.TrimSpace(s[i+1:])
+}
+
+func appendChecksum(sums []checksum, algo, value string) []checksum {
+	newHash, ok := algorithms[algo]
+	if !ok {
+		return sums
+	}
+	expected, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return sums
+	}
+	for _, v := range sums {
+		if v.algo == algo && string(v.expected) == string(expected) {
+			return sums
+		}
+	}
+	return append(sums, checksum{algo: algo, newHash: newHash, expected: expected})
+}
+
+func newHashes(sums []checksum) []hash.Hash {
+	ret := make([]hash.Hash, len(sums))
+	for i, v := range sums {
+		ret[i] = v.newHash()
+	}
+	return ret
+}
+
+func writers(hashes []hash.Hash) []io.Writer {
+	ret := make([]io.Writer, len(hashes))
+	for i, v := range hashes {
+		ret[i] = v
+	}
+	return ret
+}
+
+// verify 比较计算结果与期望值，返回校验通过的算法名称
+func verify(sums []checksum, hashes []hash.Hash) ([]string, error) {
+	var ret []string
+	for i, v := range sums {
+		actual := hashes[i].Sum(nil)
+		if string(actual) != string(v.expected) {
+			return ret, &ChecksumError{Algorithm: v.algo, Expected: v.expected, Actual: actual}
+		}
+		ret = append(ret, v.algo)
+	}
+	return ret, nil
+}
+
+// verifyFile 读取文件计算摘要并校验
+func verifyFile(path string, sums []checksum) ([]string, error) {
+	if len(sums) == 0 {
+		return nil, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	hashes := newHashes(sums)
+	if _, err := io.Copy(io.MultiWriter(writers(hashes)...), f); err != nil {
+		return nil, err
+	}
+	return verify(sums, hashes)
+}
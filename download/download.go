@@ -0,0 +1,501 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package download
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/xfali/restclient/v2"
+	"github.com/xfali/restclient/v2/filter"
+	"github.com/xfali/restclient/v2/request"
+	"hash"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// 默认中断后最多续传的次数
+	DefaultMaxResumes = 3
+	// 默认续传前的等待时间
+	DefaultResumeDelay = time.Second
+	// 默认读取应答body的缓冲大小
+	DefaultBufferSize = 32 * 1024
+	// 默认并行下载的最小分块大小
+	DefaultMinChunkSize = 4 * 1024 * 1024
+)
+
+var (
+	// ErrResourceChanged 续传时服务端忽略了Range或资源已变化，且写入目标无法从头重新写入
+	ErrResourceChanged = errors.New("download: resource changed or range not supported, writer can not be rewound")
+
+	// errRangeIgnored 分块下载时服务端未按Range返回
+	errRangeIgnored = errors.New("download: range request ignored by server")
+)
+
+// Progress 下载进度
+type Progress struct {
+	// 已下载的字节数
+	Downloaded int64
+	// 总大小，未知时为-1
+	Total int64
+}
+
+// ProgressFunc 进度回调，每次写入数据后调用，并行下载时不会并发调用
+type ProgressFunc func(p Progress)
+
+// Result 下载结果
+type Result struct {
+	// 下载的字节数
+	Size int64
+	// 中断后续传的次数
+	Resumes int
+	// 服务端忽略Range或资源变化后从头下载的次数
+	Restarts int
+	// 是否分块并行下载
+	Parallel bool
+	// 校验通过的摘要算法，如"sha-256"、"md5"
+	Verified []string
+}
+
+// Downloader 大文件下载器，将应答body以流的方式写入io.Writer或文件，不在内存中缓存完整内容
+// 下载中断后使用Range及If-Range续传，服务端不支持Range时从头下载；下载完成后校验摘要：
+//
+//	d := download.New(client, download.OptSetProgress(func(p download.Progress) {
+//		fmt.Println(p.Downloaded, p.Total)
+//	}), download.OptSetParallel(4, 0))
+//	ret, err := d.ToFile(ctx, "http://localhost:8080/artifact.tar.gz", "artifact.tar.gz")
+type Downloader struct {
+	client      restclient.RestClient
+	opts        []request.Opt
+	progress    ProgressFunc
+	maxResumes  int
+	resumeDelay time.Duration
+	bufSize     int
+	sums        []checksum
+	headerSums  bool
+	chunks      int
+	chunkSize   int64
+	err         error
+}
+
+type Opt func(*Downloader)
+
+// New 创建下载器
+func New(client restclient.RestClient, opts ...Opt) *Downloader {
+	ret := &Downloader{
+		client:      client,
+		maxResumes:  DefaultMaxResumes,
+		resumeDelay: DefaultResumeDelay,
+		bufSize:     DefaultBufferSize,
+		headerSums:  true,
+		chunkSize:   DefaultMinChunkSize,
+	}
+	for _, opt := range opts {
+		opt(ret)
+	}
+	return ret
+}
+
+// OptSetRequestOpts 配置下载请求的参数，如header、超时等
+// 注意：应答body在filter链中读取，总超时（request.WithTimeout）包含读取body的时间
+func OptSetRequestOpts(opts ...request.Opt) Opt {
+	return func(d *Downloader) {
+		d.opts = append(d.opts, opts...)
+	}
+}
+
+// OptSetProgress 配置进度回调
+func OptSetProgress(fn ProgressFunc) Opt {
+	return func(d *Downloader) {
+		d.progress = fn
+	}
+}
+
+// OptSetMaxResumes 配置中断后最多续传的次数，0表示不续传，默认为DefaultMaxResumes
+func OptSetMaxResumes(n int) Opt {
+	return func(d *Downloader) {
+		d.maxResumes = n
+	}
+}
+
+// OptSetResumeDelay 配置续传前的等待时间，默认为DefaultResumeDelay
+func OptSetResumeDelay(delay time.Duration) Opt {
+	return func(d *Downloader) {
+		d.resumeDelay = delay
+	}
+}
+
+// OptSetBufferSize 配置读取应答body的缓冲大小，默认为DefaultBufferSize
+func OptSetBufferSize(size int) Opt {
+	return func(d *Downloader) {
+		if size > 0 {
+			d.bufSize = size
+		}
+	}
+}
+
+// OptSetChecksum 配置期望的摘要，下载完成后校验，expected为十六进制字符串
+// 如：OptSetChecksum("sha-256", sha256.New, "9f86d081...")
+func OptSetChecksum(algo string, newHash func() hash.Hash, expected string) Opt {
+	return func(d *Downloader) {
+		v, err := hex.DecodeString(expected)
+		if err != nil {
+			d.err = fmt.Errorf("download: invalid %s checksum %q: %v", algo, expected, err)
+			return
+		}
+		d.sums = append(d.sums, checksum{algo: algo, newHash: newHash, expected: v})
+	}
+}
+
+// OptSetHeaderChecksum 配置是否校验应答header（Content-MD5、Digest、Repr-Digest）中的摘要，默认开启
+func OptSetHeaderChecksum(enable bool) Opt {
+	return func(d *Downloader) {
+		d.headerSums = enable
+	}
+}
+
+// OptSetParallel 配置下载到文件时分块并行下载，chunks为并行数，minChunkSize为最小分块大小（小于等于0时使用DefaultMinChunkSize）
+// 仅在服务端支持Range且资源大小已知时生效，否则顺序下载
+func OptSetParallel(chunks int, minChunkSize int64) Opt {
+	return func(d *Downloader) {
+		d.chunks = chunks
+		if minChunkSize > 0 {
+			d.chunkSize = minChunkSize
+		}
+	}
+}
+
+// ToWriter 下载到w，w无法重新写入，因此续传时服务端忽略Range且资源未变化时将跳过已写入的数据，资源已变化时返回ErrResourceChanged
+func (d *Downloader) ToWriter(ctx context.Context, u string, w io.Writer) (*Result, error) {
+	if d.err != nil {
+		return nil, d.err
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	t := d.newTransfer(u)
+	var hashes []hash.Hash
+	t.w = w
+	t.rewind = func(same bool) (int64, error) {
+		if !same {
+			return 0, ErrResourceChanged
+		}
+		return t.written, nil
+	}
+	t.onResponse = func(resp *http.Response) error {
+		// 从第一个字节开始计算摘要
+		if hashes == nil {
+			hashes = newHashes(t.sums)
+			t.w = io.MultiWriter(append([]io.Writer{w}, writers(hashes)...)...)
+		}
+		return nil
+	}
+	err := t.run(ctx)
+	ret := t.result()
+	if err != nil {
+		return ret, err
+	}
+	ret.Verified, err = verify(t.sums, hashes)
+	return ret, err
+}
+
+func (d *Downloader) newTransfer(u string) *transfer {
+	return &transfer{
+		d:        d,
+		url:      u,
+		end:      -1,
+		total:    -1,
+		progress: &progress{fn: d.progress, cur: Progress{Total: -1}},
+	}
+}
+
+// get 发送GET请求，在filter链中将200及206应答的body交给receive处理
+func (d *Downloader) get(ctx context.Context, u string, header http.Header, receive func(resp *http.Response) error) error {
+	var recvErr error
+	f := func(req *http.Request, fc filter.FilterChain) (*http.Response, error) {
+		resp, err := fc.Filter(req)
+		if err != nil || resp == nil || resp.Body == nil {
+			return resp, err
+		}
+		if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusPartialContent {
+			recvErr = receive(resp)
+			_ = resp.Body.Close()
+			resp.Body = http.NoBody
+		}
+		return resp, nil
+	}
+	opts := make([]request.Opt, 0, len(d.opts)+len(header)+3)
+	opts = append(opts, d.opts...)
+	// 禁止透明解压，保证Range偏移与写入的数据一致
+	opts = append(opts, request.AddRequestHeader(HeaderAcceptEncoding, "identity"))
+	for k := range header {
+		opts = append(opts, request.AddRequestHeader(k, header.Get(k)))
+	}
+	opts = append(opts, request.WithRequestContext(ctx), request.AddFilter(f))
+	err := d.client.Exchange(u, opts...)
+	if recvErr != nil {
+		return recvErr
+	}
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// interruptedError 读取应答body时中断，可以续传
+type interruptedError struct {
+	err error
+}
+
+func (e *interruptedError) Error() string {
+	return "download: interrupted: " + e.err.Error()
+}
+
+func (e *interruptedError) Unwrap() error {
+	return e.err
+}
+
+// temporary 判断错误是否可以通过续传恢复
+func temporary(err error) bool {
+	var ie *interruptedError
+	if errors.As(err, &ie) {
+		return true
+	}
+	if e, ok := err.(restclient.Error); ok {
+		switch e.StatusCode() {
+		case http.StatusRequestTimeout, http.StatusTooManyRequests:
+			return true
+		}
+		if e.StatusCode() >= http.StatusInternalServerError {
+			return true
+		}
+		var te *restclient.TimeoutError
+		var ne net.Error
+		return errors.As(e.Origin(), &te) || errors.As(e.Origin(), &ne)
+	}
+	return false
+}
+
+type progress struct {
+	lock sync.Mutex
+	fn   ProgressFunc
+	cur  Progress
+}
+
+func (p *progress) add(n int64) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.cur.Downloaded += n
+	if p.fn != nil {
+		p.fn(p.cur)
+	}
+}
+
+func (p *progress) reset(downloaded, total int64) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.cur = Progress{Downloaded: downloaded, Total: total}
+}
+
+func (p *progress) setTotal(total int64) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.cur.Total = total
+}
+
+// transfer 下载[start, end]范围的数据，中断后从已写入的位置续传
+type transfer struct {
+	d   *Downloader
+	url string
+	w   io.Writer
+	// rewind 需要从头下载时调用，same表示资源未变化，返回需要跳过的已写入字节数
+	rewind func(same bool) (int64, error)
+	// onResponse 收到应答、写入数据前调用
+	onResponse func(resp *http.Response) error
+	progress   *progress
+
+	// 下载范围，end小于0表示到结尾
+	start, end int64
+	// 已写入的字节数，相对于start
+	written int64
+	// 资源总大小，未知时为-1
+	total     int64
+	validator validator
+	// 期望的摘要，收到第一个应答时确定
+	sums     []checksum
+	checked  bool
+	resumes  int
+	restarts int
+}
+
+func (t *transfer) result() *Result {
+	return &Result{
+		Size:     t.written,
+		Resumes:  t.resumes,
+		Restarts: t.restarts,
+	}
+}
+
+func (t *transfer) run(ctx context.Context) error {
+	for {
+		err := t.fetch(ctx)
+		if err == nil || ctx.Err() != nil || !temporary(err) || t.resumes >= t.d.maxResumes {
+			return err
+		}
+		t.resumes++
+		if t.d.resumeDelay > 0 {
+			timer := time.NewTimer(t.d.resumeDelay)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return err
+			case <-timer.C:
+			}
+		}
+	}
+}
+
+func (t *transfer) fetch(ctx context.Context) error {
+	header := http.Header{}
+	if pos := t.start + t.written; pos > 0 || t.end >= 0 {
+		header.Set(HeaderRange, rangeHeader(pos, t.end))
+		if v := t.validator.ifRange(); v != "" {
+			header.Set(HeaderIfRange, v)
+		}
+	}
+	err := t.d.get(ctx, t.url, header, t.receive)
+	if e, ok := err.(restclient.Error); ok && e.StatusCode() == http.StatusRequestedRangeNotSatisfiable &&
+		t.start == 0 && t.end < 0 && t.written > 0 {
+		// 已下载的数据超出了资源大小，资源已变化，从头下载
+		if _, err := t.restart(false); err != nil {
+			return err
+		}
+		return t.d.get(ctx, t.url, http.Header{}, t.receive)
+	}
+	return err
+}
+
+func (t *transfer) receive(resp *http.Response) error {
+	skip := int64(0)
+	v := newValidator(resp.Header)
+	if resp.StatusCode == http.StatusPartialContent {
+		start, end, total, err := parseContentRange(resp.Header.Get(HeaderContentRange))
+		if err != nil {
+			return err
+		}
+		if start != t.start+t.written || (t.end >= 0 && end != t.end) {
+			return fmt.Errorf("download: unexpected Content-Range %q, expect start %d",
+				resp.Header.Get(HeaderContentRange), t.start+t.written)
+		}
+		if total >= 0 {
+			t.total = total
+		}
+	} else {
+		if t.start+t.written > 0 || t.end >= 0 {
+			// 服务端忽略了Range，或If-Range验证失败（资源已变化），从头下载
+			same, ok := t.validator.same(v)
+			if !ok {
+				same = t.total >= 0 && resp.ContentLength == t.total
+			}
+			n, err := t.restart(same)
+			if err != nil {
+				return err
+			}
+			skip = n
+		}
+		t.total = resp.ContentLength
+	}
+	if v.ETag != "" || v.LastModified != "" {
+		t.validator = v
+	}
+	if !t.checked {
+		t.checked = true
+		t.sums = append([]checksum(nil), t.d.sums...)
+		if t.d.headerSums {
+			t.sums = append(t.sums, headerChecksums(resp.Header, resp.StatusCode == http.StatusOK)...)
+		}
+	}
+	t.progress.setTotal(t.total)
+	if t.onResponse != nil {
+		if err := t.onResponse(resp); err != nil {
+			return err
+		}
+	}
+	return t.copy(resp.Body, skip)
+}
+
+func (t *transfer) restart(same bool) (int64, error) {
+	skip, err := t.rewind(same)
+	if err != nil {
+		return 0, err
+	}
+	if !same {
+		t.checked = false
+	}
+	t.restarts++
+	t.written = 0
+	t.progress.reset(skip, -1)
+	return skip, nil
+}
+
+// copy 将body写入目标，跳过前skip个字节，读取错误返回interruptedError
+func (t *transfer) copy(body io.Reader, skip int64) error {
+	buf := make([]byte, t.d.bufSize)
+	for {
+		n, err := body.Read(buf)
+		if n > 0 {
+			p := buf[:n]
+			if skip > 0 {
+				s := int64(len(p))
+				if s > skip {
+					s = skip
+				}
+				p = p[s:]
+				skip -= s
+				t.written += s
+			}
+			if len(p) > 0 {
+				if _, werr := t.w.Write(p); werr != nil {
+					return werr
+				}
+				t.written += int64(len(p))
+				t.progress.add(int64(len(p)))
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return &interruptedError{err: err}
+		}
+	}
+	want := int64(-1)
+	if t.end >= 0 {
+		want = t.end - t.start + 1
+	} else if t.total >= 0 {
+		want = t.total - t.start
+	}
+	if want >= 0 && t.written != want {
+		return &interruptedError{err: io.ErrUnexpectedEOF}
+	}
+	return nil
+}
@@ -0,0 +1,352 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package download
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/xfali/restclient/v2"
+)
+
+// abortWriter 写入limit字节后中断连接
+type abortWriter struct {
+	http.ResponseWriter
+	limit int
+}
+
+func (w *abortWriter) Write(p []byte) (int, error) {
+	if len(p) > w.limit {
+		n, _ := w.ResponseWriter.Write(p[:w.limit])
+		w.limit -= n
+		w.ResponseWriter.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler)
+	}
+	w.limit -= len(p)
+	return w.ResponseWriter.Write(p)
+}
+
+type server struct {
+	*httptest.Server
+	data   []byte
+	etag   string
+	lock   sync.Mutex
+	ranges []string
+	// 大于0时第一个请求在写入该字节数后中断
+	abort int32
+}
+
+func newServer(t *testing.T, size int) *server {
+	data := make([]byte, size)
+	rand.New(rand.NewSource(1)).Read(data)
+	s := &server{data: data, etag: `"v1"`}
+	sum := sha256.Sum256(data)
+	s.Server = httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.Header.Get(HeaderAcceptEncoding) != "identity" {
+			t.Error("expect identity encoding")
+		}
+		s.lock.Lock()
+		s.ranges = append(s.ranges, request.Header.Get(HeaderRange)+"|"+request.Header.Get(HeaderIfRange))
+		etag := s.etag
+		s.lock.Unlock()
+		var w http.ResponseWriter = writer
+		if n := atomic.SwapInt32(&s.abort, 0); n > 0 {
+			w = &abortWriter{ResponseWriter: writer, limit: int(n)}
+		}
+		switch request.URL.Path {
+		case "/file":
+			w.Header().Set(HeaderETag, etag)
+			w.Header().Set(HeaderReprDigest, "sha-256=:"+base64.StdEncoding.EncodeToString(sum[:])+":")
+			http.ServeContent(w, request, "", time.Time{}, bytes.NewReader(data))
+		case "/norange":
+			md := md5.Sum(data)
+			w.Header().Set(HeaderETag, etag)
+			w.Header().Set(HeaderContentMD5, base64.StdEncoding.EncodeToString(md[:]))
+			_, _ = w.Write(data)
+		case "/bad":
+			w.Header().Set(HeaderDigest, "SHA-256="+base64.StdEncoding.EncodeToString(make([]byte, 32)))
+			http.ServeContent(w, request, "", time.Time{}, bytes.NewReader(data))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	return s
+}
+
+func (s *server) requests() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	ret := s.ranges
+	s.ranges = nil
+	return ret
+}
+
+func TestToWriter(t *testing.T) {
+	s := newServer(t, 100*1024)
+	defer s.Close()
+	var last Progress
+	d := New(restclient.New(), OptSetResumeDelay(0), OptSetProgress(func(p Progress) {
+		if p.Downloaded < last.Downloaded {
+			t.Error("progress went backwards", last, p)
+		}
+		last = p
+	}))
+
+	t.Run("resume", func(t *testing.T) {
+		last = Progress{}
+		atomic.StoreInt32(&s.abort, 30000)
+		buf := &bytes.Buffer{}
+		ret, err := d.ToWriter(context.Background(), s.URL+"/file", buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf.Bytes(), s.data) || ret.Resumes != 1 || ret.Restarts != 0 || ret.Size != int64(len(s.data)) {
+			t.Fatal(ret, buf.Len())
+		}
+		if len(ret.Verified) != 1 || ret.Verified[0] != "sha-256" {
+			t.Fatal(ret.Verified)
+		}
+		if last.Downloaded != int64(len(s.data)) || last.Total != int64(len(s.data)) {
+			t.Fatal(last)
+		}
+		reqs := s.requests()
+		if len(reqs) != 2 || !strings.HasPrefix(reqs[1], "bytes=") || !strings.HasSuffix(reqs[1], `|"v1"`) {
+			t.Fatal(reqs)
+		}
+	})
+
+	t.Run("range ignored", func(t *testing.T) {
+		last = Progress{}
+		atomic.StoreInt32(&s.abort, 30000)
+		buf := &bytes.Buffer{}
+		ret, err := d.ToWriter(context.Background(), s.URL+"/norange", buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf.Bytes(), s.data) || ret.Resumes != 1 || ret.Restarts != 1 {
+			t.Fatal(ret, buf.Len())
+		}
+		if len(ret.Verified) != 1 || ret.Verified[0] != "md5" {
+			t.Fatal(ret.Verified)
+		}
+		s.requests()
+	})
+
+	t.Run("changed", func(t *testing.T) {
+		atomic.StoreInt32(&s.abort, 30000)
+		d := New(restclient.New(), OptSetResumeDelay(0))
+		_, err := d.ToWriter(context.Background(), s.URL+"/norange", &lockedWriter{s: s})
+		if err != ErrResourceChanged {
+			t.Fatal(err)
+		}
+		s.lock.Lock()
+		s.etag = `"v1"`
+		s.lock.Unlock()
+		s.requests()
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		_, err := d.ToWriter(context.Background(), s.URL+"/none", ioutil.Discard)
+		if e, ok := err.(restclient.Error); !ok || e.StatusCode() != http.StatusNotFound {
+			t.Fatal(err)
+		}
+		s.requests()
+	})
+}
+
+// lockedWriter 写入时修改服务端资源的ETag
+type lockedWriter struct {
+	s *server
+}
+
+func (w *lockedWriter) Write(p []byte) (int, error) {
+	w.s.lock.Lock()
+	w.s.etag = `"v2"`
+	w.s.lock.Unlock()
+	return len(p), nil
+}
+
+func TestToFile(t *testing.T) {
+	s := newServer(t, 100*1024)
+	defer s.Close()
+	dir, err := ioutil.TempDir("", "download")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	d := New(restclient.New(), OptSetResumeDelay(0))
+
+	check := func(t *testing.T, path string) {
+		data, err := ioutil.ReadFile(path)
+		if err != nil || !bytes.Equal(data, s.data) {
+			t.Fatal(err, len(data))
+		}
+		if _, err := os.Stat(path + PartSuffix); !os.IsNotExist(err) {
+			t.Fatal("expect part removed")
+		}
+		if _, err := os.Stat(path + PartSuffix + MetaSuffix); !os.IsNotExist(err) {
+			t.Fatal("expect meta removed")
+		}
+	}
+
+	t.Run("resume from part", func(t *testing.T) {
+		path := filepath.Join(dir, "resume.bin")
+		if err := ioutil.WriteFile(path+PartSuffix, s.data[:1000], 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := saveMeta(path+PartSuffix+MetaSuffix, meta{Url: s.URL + "/file",
+			Validator: validator{ETag: `"v1"`}, Total: int64(len(s.data))}); err != nil {
+			t.Fatal(err)
+		}
+		ret, err := d.ToFile(context.Background(), s.URL+"/file", path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		check(t, path)
+		if reqs := s.requests(); len(reqs) != 1 || reqs[0] != `bytes=1000-|"v1"` || ret.Restarts != 0 {
+			t.Fatal(reqs, ret)
+		}
+	})
+
+	t.Run("changed part", func(t *testing.T) {
+		path := filepath.Join(dir, "changed.bin")
+		if err := ioutil.WriteFile(path+PartSuffix, []byte("stale data"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := saveMeta(path+PartSuffix+MetaSuffix, meta{Url: s.URL + "/file",
+			Validator: validator{ETag: `"v0"`}, Total: int64(len(s.data))}); err != nil {
+			t.Fatal(err)
+		}
+		ret, err := d.ToFile(context.Background(), s.URL+"/file", path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		check(t, path)
+		if ret.Restarts != 1 || len(ret.Verified) != 1 {
+			t.Fatal(ret)
+		}
+		s.requests()
+	})
+
+	t.Run("checksum", func(t *testing.T) {
+		path := filepath.Join(dir, "bad.bin")
+		_, err := d.ToFile(context.Background(), s.URL+"/bad", path)
+		var ce *ChecksumError
+		if !errors.As(err, &ce) || ce.Algorithm != "sha-256" {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(path + PartSuffix); !os.IsNotExist(err) {
+			t.Fatal("expect part removed")
+		}
+
+		sum := sha256.Sum256(s.data)
+		d := New(restclient.New(), OptSetChecksum("sha-256", sha256.New, hex.EncodeToString(sum[:])),
+			OptSetHeaderChecksum(false))
+		ret, err := d.ToFile(context.Background(), s.URL+"/bad", path)
+		if err != nil || len(ret.Verified) != 1 {
+			t.Fatal(err, ret)
+		}
+		check(t, path)
+		s.requests()
+
+		d = New(restclient.New(), OptSetChecksum("sha-256", sha256.New, "xyz"))
+		if _, err := d.ToFile(context.Background(), s.URL+"/file", path); err == nil {
+			t.Fatal("expect invalid checksum error")
+		}
+	})
+
+	t.Run("parallel", func(t *testing.T) {
+		path := filepath.Join(dir, "parallel.bin")
+		var calls int32
+		d := New(restclient.New(), OptSetResumeDelay(0), OptSetParallel(4, 16*1024),
+			OptSetProgress(func(p Progress) {
+				atomic.AddInt32(&calls, 1)
+			}))
+		atomic.StoreInt32(&s.abort, 0)
+		ret, err := d.ToFile(context.Background(), s.URL+"/file", path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		check(t, path)
+		reqs := s.requests()
+		if !ret.Parallel || len(reqs) != 5 || reqs[0] != "bytes=0-0|" || atomic.LoadInt32(&calls) == 0 {
+			t.Fatal(ret, reqs)
+		}
+		for _, v := range reqs[1:] {
+			if !strings.HasSuffix(v, `|"v1"`) {
+				t.Fatal(reqs)
+			}
+		}
+
+		// 服务端不支持Range时顺序下载
+		ret, err = d.ToFile(context.Background(), s.URL+"/norange", path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		check(t, path)
+		if reqs := s.requests(); ret.Parallel || len(reqs) != 1 {
+			t.Fatal(ret, reqs)
+		}
+	})
+}
+
+func TestHeader(t *testing.T) {
+	start, end, total, err := parseContentRange("bytes 10-19/100")
+	if err != nil || start != 10 || end != 19 || total != 100 {
+		t.Fatal(start, end, total, err)
+	}
+	if _, _, total, err := parseContentRange("bytes 0-0/*"); err != nil || total != -1 {
+		t.Fatal(total, err)
+	}
+	for _, v := range []string{"", "bytes */100", "bytes 5-1/10", "bytes 0-10/10", "items 0-1/2"} {
+		if _, _, _, err := parseContentRange(v); err == nil {
+			t.Fatal("expect error ", v)
+		}
+	}
+
+	header := http.Header{}
+	header.Set(HeaderReprDigest, "sha-256=:"+base64.StdEncoding.EncodeToString(make([]byte, 32))+":, unknown=:AA==:")
+	header.Set(HeaderDigest, "MD5="+base64.StdEncoding.EncodeToString(make([]byte, 16))+",SHA-256=!!")
+	header.Set(HeaderContentMD5, base64.StdEncoding.EncodeToString(make([]byte, 16)))
+	if sums := headerChecksums(header, false); len(sums) != 2 || sums[0].algo != "sha-256" || sums[1].algo != "md5" {
+		t.Fatal(sums)
+	}
+	// Content-MD5与Digest中的md5相同，不重复校验
+	if sums := headerChecksums(header, true); len(sums) != 2 {
+		t.Fatal(sums)
+	}
+
+	if v := (validator{ETag: `W/"1"`, LastModified: "Mon"}).ifRange(); v != "Mon" {
+		t.Fatal(v)
+	}
+}
@@ -0,0 +1,254 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package download
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+)
+
+const (
+	// PartSuffix 下载未完成时数据文件的后缀
+	PartSuffix = ".part"
+	// MetaSuffix 下载未完成时记录资源信息的文件后缀，位于数据文件名之后
+	MetaSuffix = ".meta"
+)
+
+// meta 续传需要的资源信息
+type meta struct {
+	Url       string    `json:"url"`
+	Validator validator `json:"validator"`
+	Total     int64     `json:"total"`
+}
+
+func loadMeta(path string) *meta {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	ret := &meta{}
+	if err := json.Unmarshal(data, ret); err != nil {
+		return nil
+	}
+	return ret
+}
+
+func saveMeta(path string, m meta) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// ToFile 下载到文件path，下载中的数据写入path+PartSuffix，并记录资源验证器（ETag、Last-Modified）
+// 中断（包括进程退出）后再次调用时使用If-Range从已下载的位置续传，完成且校验通过后重命名为path
+// 校验失败时删除已下载的数据并返回*ChecksumError
+func (d *Downloader) ToFile(ctx context.Context, u, path string) (*Result, error) {
+	if d.err != nil {
+		return nil, d.err
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	part := path + PartSuffix
+	metaPath := part + MetaSuffix
+	f, err := os.OpenFile(part, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	t := d.newTransfer(u)
+	if m := loadMeta(metaPath); m != nil && m.Url == u && info.Size() > 0 && (m.Total < 0 || info.Size() <= m.Total) {
+		t.written = info.Size()
+		t.validator = m.Validator
+		t.total = m.Total
+		t.progress.reset(t.written, t.total)
+	} else {
+		_ = os.Remove(metaPath)
+		if err := f.Truncate(0); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := f.Seek(t.written, io.SeekStart); err != nil {
+		return nil, err
+	}
+	t.w = f
+	t.rewind = func(same bool) (int64, error) {
+		if err := f.Truncate(0); err != nil {
+			return 0, err
+		}
+		_, err := f.Seek(0, io.SeekStart)
+		return 0, err
+	}
+	t.onResponse = func(resp *http.Response) error {
+		return saveMeta(metaPath, meta{Url: u, Validator: t.validator, Total: t.total})
+	}
+
+	parallel, err := d.download(ctx, t, f)
+	ret := t.result()
+	ret.Parallel = parallel
+	if err != nil {
+		return ret, err
+	}
+	if err := f.Close(); err != nil {
+		return ret, err
+	}
+	ret.Verified, err = verifyFile(part, t.sums)
+	if err != nil {
+		// 数据有误，删除后下次从头下载
+		_ = os.Remove(part)
+		_ = os.Remove(metaPath)
+		return ret, err
+	}
+	if err := os.Rename(part, path); err != nil {
+		return ret, err
+	}
+	_ = os.Remove(metaPath)
+	return ret, nil
+}
+
+// download 配置了并行下载时先请求第一个字节判断服务端是否支持Range，支持且资源足够大时分块并行下载，否则顺序下载
+func (d *Downloader) download(ctx context.Context, t *transfer, f *os.File) (bool, error) {
+	if d.chunks > 1 && t.written == 0 {
+		ranged := false
+		header := http.Header{}
+		header.Set(HeaderRange, rangeHeader(0, 0))
+		err := d.get(ctx, t.url, header, func(resp *http.Response) error {
+			if resp.StatusCode != http.StatusPartialContent {
+				// 服务端不支持Range，直接使用该应答顺序下载
+				return t.receive(resp)
+			}
+			_, _, total, err := parseContentRange(resp.Header.Get(HeaderContentRange))
+			if err != nil {
+				return err
+			}
+			ranged = true
+			t.total = total
+			t.validator = newValidator(resp.Header)
+			t.checked = true
+			t.sums = append([]checksum(nil), d.sums...)
+			if d.headerSums {
+				t.sums = append(t.sums, headerChecksums(resp.Header, false)...)
+			}
+			return nil
+		})
+		switch {
+		case !ranged:
+			if err == nil || ctx.Err() != nil || !temporary(err) || d.maxResumes == 0 {
+				return false, err
+			}
+			t.resumes++
+		case t.total >= 2*d.chunkSize:
+			err := d.parallel(ctx, t, f)
+			if !errors.Is(err, errRangeIgnored) {
+				return true, err
+			}
+			// 服务端未按Range返回，从头顺序下载
+			if _, err := t.restart(false); err != nil {
+				return false, err
+			}
+		default:
+			// 资源较小，以完整应答重新获得摘要
+			t.checked = false
+		}
+	}
+	return false, t.run(ctx)
+}
+
+// parallel 将资源分为多块，每块使用独立的Range请求并行下载，写入文件对应的位置
+func (d *Downloader) parallel(ctx context.Context, t *transfer, f io.WriterAt) error {
+	n := int64(d.chunks)
+	if max := t.total / d.chunkSize; n > max {
+		n = max
+	}
+	size := t.total / n
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	t.progress.reset(0, t.total)
+
+	var (
+		wg       sync.WaitGroup
+		lock     sync.Mutex
+		firstErr error
+	)
+	chunks := make([]*transfer, n)
+	for i := range chunks {
+		start := int64(i) * size
+		end := start + size - 1
+		if i == len(chunks)-1 {
+			end = t.total - 1
+		}
+		c := &transfer{
+			d:         d,
+			url:       t.url,
+			w:         &offsetWriter{w: f, off: start},
+			progress:  t.progress,
+			start:     start,
+			end:       end,
+			total:     t.total,
+			validator: t.validator,
+			checked:   true,
+		}
+		c.rewind = func(bool) (int64, error) {
+			return 0, errRangeIgnored
+		}
+		chunks[i] = c
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := c.run(ctx); err != nil {
+				lock.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				lock.Unlock()
+				cancel()
+			}
+		}()
+	}
+	wg.Wait()
+	for _, c := range chunks {
+		t.resumes += c.resumes
+	}
+	if firstErr == nil {
+		t.written = t.total
+	}
+	return firstErr
+}
+
+type offsetWriter struct {
+	w   io.WriterAt
+	off int64
+}
+
+func (w *offsetWriter) Write(p []byte) (int, error) {
+	n, err := w.w.WriteAt(p, w.off)
+	w.off += int64(n)
+	return n, err
+}
@@ -0,0 +1,101 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package download
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	HeaderRange          = "Range"
+	HeaderIfRange        = "If-Range"
+	HeaderContentRange   = "Content-Range"
+	HeaderAcceptRanges   = "Accept-Ranges"
+	HeaderETag           = "ETag"
+	HeaderLastModified   = "Last-Modified"
+	HeaderAcceptEncoding = "Accept-Encoding"
+)
+
+// rangeHeader 生成Range header，end小于0表示到结尾
+func rangeHeader(start, end int64) string {
+	if end < 0 {
+		return fmt.Sprintf("bytes=%d-", start)
+	}
+	return fmt.Sprintf("bytes=%d-%d", start, end)
+}
+
+// parseContentRange 解析"bytes start-end/total"，total未知（*）时返回-1
+func parseContentRange(v string) (start, end, total int64, err error) {
+	s := strings.TrimSpace(v)
+	if !strings.HasPrefix(s, "bytes ") {
+		return 0, 0, 0, fmt.Errorf("download: invalid Content-Range %q", v)
+	}
+	s = strings.TrimSpace(s[len("bytes "):])
+	i := strings.Index(s, "/")
+	j := strings.Index(s, "-")
+	if i < 0 || j < 0 || j > i {
+		return 0, 0, 0, fmt.Errorf("download: invalid Content-Range %q", v)
+	}
+	if start, err = strconv.ParseInt(s[:j], 10, 64); err != nil {
+		return 0, 0, 0, fmt.Errorf("download: invalid Content-Range %q", v)
+	}
+	if end, err = strconv.ParseInt(s[j+1:i], 10, 64); err != nil || end < start {
+		return 0, 0, 0, fmt.Errorf("download: invalid Content-Range %q", v)
+	}
+	total = -1
+	if t := s[i+1:]; t != "*" {
+		if total, err = strconv.ParseInt(t, 10, 64); err != nil || total <= end {
+			return 0, 0, 0, fmt.Errorf("download: invalid Content-Range %q", v)
+		}
+	}
+	return start, end, total, nil
+}
+
+// validator 资源的验证器，用于If-Range判断续传时资源是否变化
+type validator struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+}
+
+func newValidator(header http.Header) validator {
+	return validator{
+		ETag:         header.Get(HeaderETag),
+		LastModified: header.Get(HeaderLastModified),
+	}
+}
+
+// ifRange 获得If-Range的值，弱ETag不能用于If-Range，此时使用Last-Modified
+func (v validator) ifRange() string {
+	if v.ETag != "" && !strings.HasPrefix(v.ETag, "W/") {
+		return v.ETag
+	}
+	return v.LastModified
+}
+
+// same 判断是否为同一资源，双方都没有验证器时无法判断，返回ok为false
+func (v validator) same(o validator) (same bool, ok bool) {
+	if v.ETag != "" && o.ETag != "" {
+		return v.ETag == o.ETag, true
+	}
+	if v.LastModified != "" && o.LastModified != "" {
+		return v.LastModified == o.LastModified, true
+	}
+	return false, false
+}
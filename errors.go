@@ -18,6 +18,7 @@ package restclient
 
 import (
 	"fmt"
+	"github.com/xfali/restclient/v2/restutil"
 	"net/http"
 )
 
@@ -34,8 +35,9 @@ type Error interface {
 }
 
 type defaultError struct {
-	status int
-	err    error
+	status  int
+	err     error
+	timings *restutil.Timings
 }
 
 func withErr(status int, err error) defaultError {
@@ -52,6 +54,19 @@ func withStatus(status int) defaultError {
 	}
 }
 
+func (e defaultError) withTimings(timings *restutil.Timings) defaultError {
+	e.timings = timings
+	return e
+}
+
+// GetTimings 获得请求失败时各阶段的耗时，仅在开启耗时统计（EnableTimings或request.WithTimings）时返回非nil
+func GetTimings(err error) *restutil.Timings {
+	if e, ok := err.(defaultError); ok {
+		return e.timings
+	}
+	return nil
+}
+
 func (e defaultError) Origin() error {
 	return e.err
 }
@@ -0,0 +1,205 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package filter
+
+import (
+	"github.com/xfali/restclient/v2/restutil"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// Predicate 判断filter是否作用于请求
+type Predicate func(request *http.Request) bool
+
+// When 仅对满足条件的请求执行filter，否则直接执行后续的filter
+func When(predicate Predicate, filter Filter) Filter {
+	return func(request *http.Request, fc FilterChain) (*http.Response, error) {
+		if predicate(request) {
+			return filter(request, fc)
+		}
+		return fc.Filter(request)
+	}
+}
+
+// WhenI 同When，用于IFilter
+func WhenI(predicate Predicate, filter IFilter) Filter {
+	return When(predicate, filter.Filter)
+}
+
+// MatchHost 匹配请求的host（不含端口，忽略大小写），支持path.Match的通配符，如*.example.com
+func MatchHost(globs ...string) Predicate {
+	patterns := make([]string, len(globs))
+	for i := range globs {
+		patterns[i] = strings.ToLower(globs[i])
+	}
+	return func(request *http.Request) bool {
+		host := strings.ToLower(request.URL.Hostname())
+		for _, g := range patterns {
+			if ok, _ := path.Match(g, host); ok {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// MatchPathPrefix 匹配请求路径的前缀，前缀以/结尾或与路径在/处分隔时匹配，如/api匹配/api、/api/users，不匹配/apis
+func MatchPathPrefix(prefixes ...string) Predicate {
+	return func(request *http.Request) bool {
+		p := request.URL.Path
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(p, prefix) &&
+				(len(p) == len(prefix) || strings.HasSuffix(prefix, "/") || p[len(prefix)] == '/') {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// MatchPath 按path.Match的规则匹配请求路径，如/users/*/orders
+func MatchPath(patterns ...string) Predicate {
+	return func(request *http.Request) bool {
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(pattern, request.URL.Path); ok {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// MatchMethod 匹配请求方法
+func MatchMethod(methods ...string) Predicate {
+	return func(request *http.Request) bool {
+		for _, m := range methods {
+			if strings.EqualFold(m, request.Method) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// MatchRoute 匹配请求的路由模板（request.WithRoute或UrlBuilder设置），如/users/:id
+func MatchRoute(routes ...string) Predicate {
+	return func(request *http.Request) bool {
+		route := restutil.GetRoute(request.Context())
+		for _, r := range routes {
+			if r == route {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// And 所有条件都满足时匹配
+func And(predicates ...Predicate) Predicate {
+	return func(request *http.Request) bool {
+		for _, p := range predicates {
+			if !p(request) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Or 任意条件满足时匹配
+func Or(predicates ...Predicate) Predicate {
+	return func(request *http.Request) bool {
+		for _, p := range predicates {
+			if p(request) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Not 条件不满足时匹配
+func Not(predicate Predicate) Predicate {
+	return func(request *http.Request) bool {
+		return !predicate(request)
+	}
+}
+
+// RouteTable 按请求选择filter组，使一个client可以对不同的后端使用不同的认证、重试、日志等策略：
+//
+//	table := filter.NewRouteTable().
+//		Route(filter.MatchHost("api.example.com"), tokenAuth.Filter, retry).
+//		Route(filter.MatchHost("*.internal"), basicAuth.Filter).
+//		Default(log)
+//
+// 按Route添加的顺序匹配，仅执行第一个匹配的filter组，都不匹配时执行Default的filter组
+// 同一组内的filter与FilterManager一致，按添加的逆序执行
+type RouteTable struct {
+	routes []routeEntry
+	def    FilterChain
+}
+
+type routeEntry struct {
+	predicate Predicate
+	chain     FilterChain
+}
+
+// NewRouteTable 创建路由表
+func NewRouteTable() *RouteTable {
+	return &RouteTable{}
+}
+
+// Route 添加匹配条件及对应的filter组
+func (t *RouteTable) Route(predicate Predicate, filters ...Filter) *RouteTable {
+	t.routes = append(t.routes, routeEntry{
+		predicate: predicate,
+		chain:     filters,
+	})
+	return t
+}
+
+// Default 配置没有匹配的路由时执行的filter组
+func (t *RouteTable) Default(filters ...Filter) *RouteTable {
+	t.def = filters
+	return t
+}
+
+// Register 将路由表作为命名filter注册到NamedFilterManager
+func (t *RouteTable) Register(fm *NamedFilterManager, name string, opts ...FilterOpt) error {
+	return fm.AddNamed(name, t.Filter, opts...)
+}
+
+func (t *RouteTable) Filter(request *http.Request, fc FilterChain) (*http.Response, error) {
+	chain := t.def
+	for _, r := range t.routes {
+		if r.predicate(request) {
+			chain = r.chain
+			break
+		}
+	}
+	if len(chain) == 0 {
+		return fc.Filter(request)
+	}
+	// 路由的filter组执行完成后继续执行外部的filter链
+	sub := make(FilterChain, 0, len(chain)+1)
+	sub = append(sub, func(request *http.Request, _ FilterChain) (*http.Response, error) {
+		return fc.Filter(request)
+	})
+	sub = append(sub, chain...)
+	return sub.Filter(request)
+}
@@ -0,0 +1,75 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package filter
+
+import (
+	"context"
+	"github.com/xfali/restclient/v2/restutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestPredicate(t *testing.T) {
+	request, _ := http.NewRequest(http.MethodPost, "https://API.example.com:8443/api/users/1/orders", nil)
+	request = request.WithContext(restutil.WithRoute(context.Background(), "/api/users/:id/orders"))
+	cases := []struct {
+		name   string
+		p      Predicate
+		expect bool
+	}{
+		{"host glob", MatchHost("*.example.com"), true},
+		{"host", MatchHost("example.com"), false},
+		{"prefix", MatchPathPrefix("/api"), true},
+		{"prefix boundary", MatchPathPrefix("/ap"), false},
+		{"path", MatchPath("/api/users/*/orders"), true},
+		{"method", MatchMethod("get", "post"), true},
+		{"route", MatchRoute("/api/users/:id/orders"), true},
+		{"and", And(MatchMethod(http.MethodPost), MatchHost("other.com")), false},
+		{"or", Or(MatchMethod(http.MethodGet), MatchHost("api.example.com")), true},
+		{"not", Not(MatchMethod(http.MethodGet)), true},
+	}
+	for _, c := range cases {
+		if c.p(request) != c.expect {
+			t.Fatal(c.name)
+		}
+	}
+}
+
+func TestRouteTable(t *testing.T) {
+	var trace []string
+	table := NewRouteTable().
+		Route(MatchHost("a.com"), record("a1", &trace), record("a2", &trace)).
+		Route(MatchHost("*.com"), record("com", &trace)).
+		Default(record("default", &trace))
+	fm := NamedFilterManager{}
+	fm.Add(record("inner", &trace))
+	if err := table.Register(&fm, "route"); err != nil {
+		t.Fatal(err)
+	}
+	fm.Add(When(MatchMethod(http.MethodPost), record("post", &trace)))
+
+	for _, v := range []string{"http://a.com", "http://b.com", "http://c.org"} {
+		request, _ := http.NewRequest(http.MethodGet, v, nil)
+		_, _ = fm.RunFilter(request)
+	}
+	request, _ := http.NewRequest(http.MethodPost, "http://a.com", nil)
+	_, _ = fm.RunFilter(request)
+	if v := strings.Join(trace, ","); v != "a2,a1,inner,com,inner,default,inner,post,a2,a1,inner" {
+		t.Fatal(v)
+	}
+}
@@ -0,0 +1,84 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package filter
+
+import (
+	"github.com/xfali/restclient/v2/restutil"
+	"github.com/xfali/xlog"
+	"net/http"
+)
+
+// CurlLog 调试filter，将最终发送的请求以等价的curl命令输出到日志，便于复现问题
+// 注意：filter按添加的逆序执行，为了获得认证等filter执行后的请求，应最先添加该filter，如：
+// restclient.New(restclient.AddIFilter(filter.NewCurlLog(log), auth))
+type CurlLog struct {
+	log       xlog.Logger
+	onFailure bool
+	opts      []restutil.CurlOpt
+}
+
+type CurlLogOpt func(*CurlLog)
+
+// NewCurlLog 创建curl日志filter，请求失败（包括状态码>=400）时以WARN级别输出，否则以DEBUG级别输出
+func NewCurlLog(log xlog.Logger, opts ...CurlLogOpt) *CurlLog {
+	ret := &CurlLog{
+		log: log,
+	}
+	for _, opt := range opts {
+		opt(ret)
+	}
+	return ret
+}
+
+// OptSetCurlLogOnFailure 配置是否仅在请求失败时输出
+func OptSetCurlLogOnFailure(v bool) CurlLogOpt {
+	return func(l *CurlLog) {
+		l.onFailure = v
+	}
+}
+
+// OptSetCurlLogOptions 配置curl命令的生成选项，默认脱敏restutil.CurlSensitiveHeaders及url中的密码，如增加脱敏的header：
+// OptSetCurlLogOptions(restutil.OptSetCurlRedactHeaders("X-Token"))
+func OptSetCurlLogOptions(opts ...restutil.CurlOpt) CurlLogOpt {
+	return func(l *CurlLog) {
+		l.opts = opts
+	}
+}
+
+func (l *CurlLog) Filter(request *http.Request, fc FilterChain) (*http.Response, error) {
+	cmd, cmdErr := restutil.NewCurlCommand(request, l.opts...)
+	resp, err := fc.Filter(request)
+	failed := err != nil || resp == nil || resp.StatusCode >= http.StatusBadRequest
+	if l.onFailure && !failed {
+		return resp, err
+	}
+
+	var curl string
+	if cmdErr == nil {
+		curl, cmdErr = cmd.Render()
+	}
+	if cmdErr != nil {
+		l.log.Warnf("create curl command failed: %v\n", cmdErr)
+		return resp, err
+	}
+	if failed {
+		l.log.Warnln(curl)
+	} else {
+		l.log.Debugln(curl)
+	}
+	return resp, err
+}
@@ -158,6 +158,8 @@ func ContentLengthFilter(request *http.Request, fc FilterChain) (*http.Response,
 }
 
 type LogFunc func(format string, args ...interface{})
+
+// Deprecated: Log会完整缓存并输出请求及应答的body和所有header（包括Authorization、Cookie等），请使用StructuredLog
 type Log struct {
 	Log  xlog.Logger
 	Tag  string
@@ -17,7 +17,10 @@
 package filter
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"sort"
 )
 
 type IFilter interface {
@@ -29,6 +32,295 @@ type Filter func(request *http.Request, fc FilterChain) (*http.Response, error)
 type FilterChain []Filter
 type FilterManager FilterChain
 
+var (
+	// filter的名称重复
+	ErrDuplicateName = errors.New("filter: duplicate name")
+	// filter的Before、After约束存在循环
+	ErrCycle = errors.New("filter: order constraints contain a cycle")
+)
+
+// NamedFilterManager 管理filter及其执行顺序：
+// 1、priority越大越先执行（越外层），priority相同时后添加的先执行
+// 2、Before、After约束优先于priority
+// 3、命名的filter可以被移除、替换，或在单个请求中禁用（request.DisableFilters）
+// 注意：NamedFilterManager不是并发安全的，应在创建client时配置完成
+type NamedFilterManager struct {
+	entries []*filterEntry
+	seq     int
+	// 执行顺序由内到外，与FilterChain一致
+	chain FilterChain
+	names []string
+}
+
+type filterEntry struct {
+	name     string
+	filter   Filter
+	priority int
+	before   []string
+	after    []string
+	seq      int
+}
+
+// FilterInfo filter的描述信息
+type FilterInfo struct {
+	Name     string
+	Priority int
+	Before   []string
+	After    []string
+}
+
+type FilterOpt func(*filterEntry)
+
+// WithPriority 配置filter的优先级，越大越先执行，默认为0
+func WithPriority(priority int) FilterOpt {
+	return func(e *filterEntry) {
+		e.priority = priority
+	}
+}
+
+// WithBefore 配置filter在指定名称的filter之前执行（位于其外层）
+func WithBefore(names ...string) FilterOpt {
+	return func(e *filterEntry) {
+		e.before = append(e.before, names...)
+	}
+}
+
+// WithAfter 配置filter在指定名称的filter之后执行（位于其内层）
+func WithAfter(names ...string) FilterOpt {
+	return func(e *filterEntry) {
+		e.after = append(e.after, names...)
+	}
+}
+
+// Add 添加匿名filter
+func (fm *NamedFilterManager) Add(filter ...Filter) {
+	for _, f := range filter {
+		fm.add(&filterEntry{filter: f})
+	}
+	fm.sort()
+}
+
+// AddNamed 添加命名filter，名称重复时返回ErrDuplicateName，顺序约束存在循环时返回ErrCycle
+func (fm *NamedFilterManager) AddNamed(name string, filter Filter, opts ...FilterOpt) error {
+	if name == "" {
+		fm.Add(filter)
+		return nil
+	}
+	if fm.find(name) != -1 {
+		return fmt.Errorf("%w: %s", ErrDuplicateName, name)
+	}
+	e := &filterEntry{name: name, filter: filter}
+	for _, opt := range opts {
+		opt(e)
+	}
+	fm.add(e)
+	if !fm.sort() {
+		fm.entries = fm.entries[:len(fm.entries)-1]
+		fm.sort()
+		return fmt.Errorf("%w: %s", ErrCycle, name)
+	}
+	return nil
+}
+
+// Remove 移除指定名称的filter，不存在时返回false
+func (fm *NamedFilterManager) Remove(name string) bool {
+	i := fm.find(name)
+	if i == -1 {
+		return false
+	}
+	fm.entries = without(fm.entries, i)
+	fm.sort()
+	return true
+}
+
+// Replace 替换指定名称的filter，保留其优先级及顺序约束，不存在时返回false
+func (fm *NamedFilterManager) Replace(name string, filter Filter) bool {
+	i := fm.find(name)
+	if i == -1 {
+		return false
+	}
+	e := *fm.entries[i]
+	e.filter = filter
+	// 不修改原有的entries，避免影响共享底层数组的副本
+	entries := make([]*filterEntry, len(fm.entries))
+	copy(entries, fm.entries)
+	entries[i] = &e
+	fm.entries = entries
+	fm.sort()
+	return true
+}
+
+// List 按执行顺序（由外到内）获得filter的信息，匿名filter的Name为空
+func (fm NamedFilterManager) List() []FilterInfo {
+	ret := make([]FilterInfo, 0, len(fm.entries))
+	for _, e := range fm.ordered() {
+		ret = append(ret, FilterInfo{
+			Name:     e.name,
+			Priority: e.priority,
+			Before:   e.before,
+			After:    e.after,
+		})
+	}
+	return ret
+}
+
+func (fm NamedFilterManager) Valid() bool {
+	return len(fm.entries) > 0
+}
+
+func (fm NamedFilterManager) RunFilter(request *http.Request) (*http.Response, error) {
+	return fm.Chain().Filter(request)
+}
+
+// Chain 获得FilterChain（由内到外，与原[]Filter的顺序一致），disabled为需要跳过的filter名称
+func (fm NamedFilterManager) Chain(disabled ...string) FilterChain {
+	if len(disabled) == 0 {
+		return fm.chain
+	}
+	skip := make(map[string]bool, len(disabled))
+	for _, v := range disabled {
+		skip[v] = true
+	}
+	ret := make(FilterChain, 0, len(fm.chain))
+	for i, f := range fm.chain {
+		if fm.names[i] == "" || !skip[fm.names[i]] {
+			ret = append(ret, f)
+		}
+	}
+	return ret
+}
+
+// MergeNamedFilterManager 合并NamedFilterManager，后面的filter与前面的同名时替换前面的filter
+func MergeNamedFilterManager(fms ...NamedFilterManager) NamedFilterManager {
+	ret := NamedFilterManager{}
+	for _, fm := range fms {
+		// 按添加顺序合并，保持priority相同时的相对顺序
+		entries := make([]*filterEntry, len(fm.entries))
+		copy(entries, fm.entries)
+		sort.SliceStable(entries, func(i, j int) bool {
+			return entries[i].seq < entries[j].seq
+		})
+		for _, e := range entries {
+			if e.name != "" {
+				if i := ret.find(e.name); i != -1 {
+					ret.entries = without(ret.entries, i)
+				}
+			}
+			ret.add(e)
+		}
+	}
+	ret.sort()
+	return ret
+}
+
+// without 返回移除第i个元素的新slice，不修改原slice的底层数组
+func without(entries []*filterEntry, i int) []*filterEntry {
+	ret := make([]*filterEntry, len(entries)-1)
+	copy(ret, entries[:i])
+	copy(ret[i:], entries[i+1:])
+	return ret
+}
+
+func (fm *NamedFilterManager) add(e *filterEntry) {
+	v := *e
+	fm.seq++
+	v.seq = fm.seq
+	fm.entries = append(fm.entries, &v)
+}
+
+func (fm *NamedFilterManager) find(name string) int {
+	for i, e := range fm.entries {
+		if e.name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// sort 重新计算执行顺序，顺序约束存在循环时返回false（忽略导致循环的约束）
+func (fm *NamedFilterManager) sort() bool {
+	ordered, ok := fm.order()
+	chain := make(FilterChain, len(ordered))
+	names := make([]string, len(ordered))
+	for i, e := range ordered {
+		chain[len(ordered)-1-i] = e.filter
+		names[len(ordered)-1-i] = e.name
+	}
+	fm.chain = chain
+	fm.names = names
+	return ok
+}
+
+func (fm NamedFilterManager) ordered() []*filterEntry {
+	ret, _ := fm.order()
+	return ret
+}
+
+// order 计算由外到内的执行顺序：按priority、添加顺序排序后，在满足Before、After约束的前提下保持该顺序
+func (fm NamedFilterManager) order() ([]*filterEntry, bool) {
+	base := make([]*filterEntry, len(fm.entries))
+	copy(base, fm.entries)
+	sort.SliceStable(base, func(i, j int) bool {
+		if base[i].priority != base[j].priority {
+			return base[i].priority > base[j].priority
+		}
+		return base[i].seq > base[j].seq
+	})
+
+	index := map[string]int{}
+	for i, e := range base {
+		if e.name != "" {
+			index[e.name] = i
+		}
+	}
+	// edges[i]中的filter必须在i之后执行
+	edges := make([][]int, len(base))
+	indegree := make([]int, len(base))
+	link := func(from, to int) {
+		edges[from] = append(edges[from], to)
+		indegree[to]++
+	}
+	for i, e := range base {
+		for _, name := range e.before {
+			if j, ok := index[name]; ok && j != i {
+				link(i, j)
+			}
+		}
+		for _, name := range e.after {
+			if j, ok := index[name]; ok && j != i {
+				link(j, i)
+			}
+		}
+	}
+
+	ret := make([]*filterEntry, 0, len(base))
+	done := make([]bool, len(base))
+	for len(ret) < len(base) {
+		next := -1
+		for i := range base {
+			if !done[i] && indegree[i] == 0 {
+				next = i
+				break
+			}
+		}
+		if next == -1 {
+			// 存在循环，剩余的filter按基础顺序排列
+			for i := range base {
+				if !done[i] {
+					ret = append(ret, base[i])
+				}
+			}
+			return ret, false
+		}
+		done[next] = true
+		ret = append(ret, base[next])
+		for _, j := range edges[next] {
+			indegree[j]--
+		}
+	}
+	return ret, true
+}
+
 func (fc *FilterManager) Add(filter ...Filter) {
 	*fc = append(*fc, filter...)
 }
@@ -0,0 +1,124 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package filter
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func record(name string, trace *[]string) Filter {
+	return func(request *http.Request, fc FilterChain) (*http.Response, error) {
+		*trace = append(*trace, name)
+		return fc.Filter(request)
+	}
+}
+
+func run(fm NamedFilterManager, disabled ...string) {
+	request, _ := http.NewRequest(http.MethodGet, "http://localhost", nil)
+	_, _ = fm.Chain(disabled...).Filter(request)
+}
+
+func TestFilterManager(t *testing.T) {
+	var trace []string
+	fm := NamedFilterManager{}
+	fm.Add(record("anonymous", &trace))
+	_ = fm.AddNamed("log", record("log", &trace))
+	_ = fm.AddNamed("auth", record("auth", &trace), WithPriority(10))
+	_ = fm.AddNamed("retry", record("retry", &trace), WithAfter("log"), WithPriority(20))
+	_ = fm.AddNamed("metrics", record("metrics", &trace), WithBefore("auth"))
+
+	run(fm)
+	if v := strings.Join(trace, ","); v != "metrics,auth,log,retry,anonymous" {
+		t.Fatal(v)
+	}
+
+	if err := fm.AddNamed("log", record("log", &trace)); !errors.Is(err, ErrDuplicateName) {
+		t.Fatal("expect duplicate, but get ", err)
+	}
+	if err := fm.AddNamed("cycle", record("cycle", &trace), WithBefore("metrics"), WithAfter("auth")); !errors.Is(err, ErrCycle) {
+		t.Fatal("expect cycle, but get ", err)
+	}
+
+	trace = nil
+	fm.Remove("metrics")
+	fm.Replace("log", record("log2", &trace))
+	run(fm, "auth")
+	if v := strings.Join(trace, ","); v != "log2,retry,anonymous" {
+		t.Fatal(v)
+	}
+
+	var names []string
+	for _, v := range fm.List() {
+		names = append(names, v.Name)
+	}
+	if v := strings.Join(names, ","); v != "auth,log,retry," {
+		t.Fatal(v)
+	}
+
+	// 请求级的同名filter替换client的filter，且位于外层
+	trace = nil
+	req := NamedFilterManager{}
+	req.Add(record("request", &trace))
+	_ = req.AddNamed("auth", record("auth2", &trace), WithPriority(10))
+	run(MergeNamedFilterManager(fm, req))
+	if v := strings.Join(trace, ","); v != "auth2,request,log2,retry,anonymous" {
+		t.Fatal(v)
+	}
+}
+
+func TestNamedFilterManagerCopy(t *testing.T) {
+	var trace []string
+	fm := NamedFilterManager{}
+	_ = fm.AddNamed("a", record("a", &trace))
+	_ = fm.AddNamed("b", record("b", &trace))
+	_ = fm.AddNamed("c", record("c", &trace))
+
+	// 副本的Remove、Replace及合并不能影响原有的filter
+	cp := fm
+	cp.Remove("a")
+	cp.Replace("b", record("b2", &trace))
+	req := NamedFilterManager{}
+	_ = req.AddNamed("c", record("c2", &trace))
+	_ = MergeNamedFilterManager(fm, req)
+
+	var names []string
+	for _, v := range fm.List() {
+		names = append(names, v.Name)
+	}
+	if v := strings.Join(names, ","); v != "c,b,a" {
+		t.Fatal(v)
+	}
+	run(fm)
+	if v := strings.Join(trace, ","); v != "c,b,a" {
+		t.Fatal(v)
+	}
+}
+
+func TestMergeFilterManager(t *testing.T) {
+	var trace []string
+	fm := FilterManager{}
+	fm.Add(record("a", &trace))
+	req := FilterManager{}
+	req.Add(record("b", &trace))
+	_, _ = MergeFilterManager(fm, req).RunFilter(nil)
+	if v := strings.Join(trace, ","); v != "b,a" {
+		t.Fatal(v)
+	}
+}
@@ -0,0 +1,351 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package filter
+
+import (
+	"context"
+	"github.com/xfali/restclient/v2/buffer"
+	"github.com/xfali/restclient/v2/restutil"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// 默认对冲请求延迟
+	DefaultHedgingDelay = 100 * time.Millisecond
+	// 默认每个请求最多额外发送的对冲请求数
+	DefaultHedgingMax = 1
+	// 默认对冲预算：对冲请求数占总请求数的比例
+	DefaultHedgingBudget = 0.1
+	// 默认延迟统计窗口大小
+	DefaultHedgingWindow = 1000
+	// 计算百分位延迟所需的最少样本数，不足时使用固定延迟
+	hedgingMinSamples = 20
+	// 预算最多累积的对冲次数
+	hedgingMaxTokens = 10
+)
+
+// Hedging 对冲请求filter，用于降低幂等请求的长尾延迟
+// 请求发出后超过延迟仍未返回时，再发送一个相同的请求，使用最先成功返回的应答，其余请求通过context取消
+// 1、仅对幂等方法生效（默认GET、HEAD、OPTIONS、TRACE、PUT、DELETE）
+// 2、延迟可以是固定值，也可以是统计得到的历史延迟百分位
+// 3、对冲请求数受预算限制，避免在服务整体变慢时放大负载
+type Hedging struct {
+	delay      time.Duration
+	percentile float64
+	max        int
+	budget     float64
+	methods    map[string]bool
+	pool       buffer.Pool
+
+	lock    sync.Mutex
+	samples []time.Duration
+	next    int
+	tokens  float64
+}
+
+type HedgingOpt func(*Hedging)
+
+// NewHedging 创建对冲请求filter
+func NewHedging(opts ...HedgingOpt) *Hedging {
+	ret := &Hedging{
+		delay:  DefaultHedgingDelay,
+		max:    DefaultHedgingMax,
+		budget: DefaultHedgingBudget,
+		methods: map[string]bool{
+			http.MethodGet:     true,
+			http.MethodHead:    true,
+			http.MethodOptions: true,
+			http.MethodTrace:   true,
+			http.MethodPut:     true,
+			http.MethodDelete:  true,
+		},
+		pool:    buffer.NewPool(),
+		samples: make([]time.Duration, 0, DefaultHedgingWindow),
+		tokens:  1,
+	}
+	for _, opt := range opts {
+		opt(ret)
+	}
+	return ret
+}
+
+// OptSetHedgingDelay 配置发送对冲请求的固定延迟，配置百分位时作为样本不足时的延迟
+func OptSetHedgingDelay(delay time.Duration) HedgingOpt {
+	return func(h *Hedging) {
+		h.delay = delay
+	}
+}
+
+// OptSetHedgingPercentile 使用历史延迟的百分位作为对冲延迟，取值(0, 1)，如0.95
+func OptSetHedgingPercentile(percentile float64) HedgingOpt {
+	return func(h *Hedging) {
+		h.percentile = percentile
+	}
+}
+
+// OptSetHedgingMax 配置每个请求最多额外发送的对冲请求数
+func OptSetHedgingMax(max int) HedgingOpt {
+	return func(h *Hedging) {
+		h.max = max
+	}
+}
+
+// OptSetHedgingBudget 配置对冲预算，即对冲请求数占总请求数的比例，如0.1表示最多增加10%的请求
+func OptSetHedgingBudget(budget float64) HedgingOpt {
+	return func(h *Hedging) {
+		h.budget = budget
+	}
+}
+
+// OptSetHedgingMethods 配置允许对冲的请求方法，注意只应配置幂等方法
+func OptSetHedgingMethods(methods ...string) HedgingOpt {
+	return func(h *Hedging) {
+		h.methods = make(map[string]bool, len(methods))
+		for _, v := range methods {
+			h.methods[v] = true
+		}
+	}
+}
+
+// OptSetHedgingBufferPool 配置缓存请求body的内存池
+func OptSetHedgingBufferPool(pool buffer.Pool) HedgingOpt {
+	return func(h *Hedging) {
+		h.pool = pool
+	}
+}
+
+type hedgingResult struct {
+	index   int
+	resp    *http.Response
+	err     error
+	latency time.Duration
+	timings *restutil.Timings
+}
+
+// adopt 开启耗时统计时只记录被采用的请求
+func (r *hedgingResult) adopt(timings *restutil.Timings) {
+	if timings != nil && r.timings != nil {
+		timings.Adopt(r.timings)
+	}
+}
+
+func (h *Hedging) Filter(request *http.Request, fc FilterChain) (*http.Response, error) {
+	if h.max <= 0 || !h.methods[request.Method] {
+		return fc.Filter(request)
+	}
+
+	var (
+		buf  *buffer.ReadWriteCloser
+		data []byte
+	)
+	if request.Body != nil && request.Body != http.NoBody {
+		buf = buffer.NewReadWriteCloser(h.pool)
+		_, err := io.Copy(buf, request.Body)
+		request.Body.Close()
+		if err != nil {
+			buf.Close()
+			return nil, err
+		}
+		data = buf.Bytes()
+	}
+	h.deposit()
+
+	// 并发的请求各自记录耗时，避免互相覆盖
+	timings := restutil.GetTimings(request.Context())
+	results := make(chan hedgingResult, h.max+1)
+	cancels := make([]context.CancelFunc, 0, h.max+1)
+	wg := sync.WaitGroup{}
+	launch := func() {
+		ctx, cancel := context.WithCancel(request.Context())
+		var attempt *restutil.Timings
+		if timings != nil {
+			attempt = timings.Attempt()
+			ctx = restutil.WithTimings(ctx, attempt)
+		}
+		r := request.Clone(ctx)
+		if buf != nil {
+			r.ContentLength = int64(len(data))
+			r.Body = newBody(data)
+			r.GetBody = func() (io.ReadCloser, error) {
+				return newBody(data), nil
+			}
+		}
+		index := len(cancels)
+		cancels = append(cancels, cancel)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			now := time.Now()
+			resp, err := fc.Filter(r)
+			results <- hedgingResult{index: index, resp: resp, err: err, latency: time.Since(now), timings: attempt}
+		}()
+	}
+	defer func() {
+		// 所有请求结束后才能归还请求body的buffer
+		if buf != nil {
+			go func() {
+				wg.Wait()
+				buf.Close()
+			}()
+		}
+	}()
+
+	launch()
+	timer := time.NewTimer(h.hedgingDelay())
+	defer timer.Stop()
+
+	pending := 1
+	var last *hedgingResult
+	discard := func() {
+		if last != nil {
+			if last.resp != nil && last.resp.Body != nil {
+				last.resp.Body.Close()
+			}
+			cancels[last.index]()
+		}
+	}
+	for {
+		select {
+		case <-timer.C:
+			if len(cancels) <= h.max && h.withdraw() {
+				launch()
+				pending++
+				timer.Reset(h.hedgingDelay())
+			}
+		case ret := <-results:
+			pending--
+			if ret.err == nil && ret.resp != nil && ret.resp.StatusCode < http.StatusInternalServerError {
+				h.observe(ret.latency)
+				ret.adopt(timings)
+				discard()
+				h.cancelLosers(ret.index, cancels, results, pending)
+				return withCancel(ret.resp, cancels[ret.index]), nil
+			}
+			// 失败的结果只保留最后一个，所有请求都失败时返回
+			discard()
+			last = &ret
+			if pending == 0 {
+				last.adopt(timings)
+				return withCancel(last.resp, cancels[last.index]), last.err
+			}
+		}
+	}
+}
+
+// withCancel 应答body关闭时再取消请求的context，否则会中断body的读取
+func withCancel(resp *http.Response, cancel context.CancelFunc) *http.Response {
+	if resp != nil && resp.Body != nil {
+		resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	} else {
+		cancel()
+	}
+	return resp
+}
+
+// cancelLosers 取消其他请求，并在后台关闭其应答body
+func (h *Hedging) cancelLosers(winner int, cancels []context.CancelFunc, results chan hedgingResult, pending int) {
+	for i, cancel := range cancels {
+		if i != winner {
+			cancel()
+		}
+	}
+	if pending > 0 {
+		go func() {
+			for i := 0; i < pending; i++ {
+				ret := <-results
+				if ret.resp != nil && ret.resp.Body != nil {
+					_, _ = io.Copy(ioutil.Discard, ret.resp.Body)
+					ret.resp.Body.Close()
+				}
+			}
+		}()
+	}
+}
+
+func (h *Hedging) hedgingDelay() time.Duration {
+	if h.percentile <= 0 || h.percentile >= 1 {
+		return h.delay
+	}
+	h.lock.Lock()
+	if len(h.samples) < hedgingMinSamples {
+		h.lock.Unlock()
+		return h.delay
+	}
+	samples := append([]time.Duration(nil), h.samples...)
+	h.lock.Unlock()
+
+	sort.Slice(samples, func(i, j int) bool {
+		return samples[i] < samples[j]
+	})
+	return samples[int(float64(len(samples)-1)*h.percentile)]
+}
+
+func (h *Hedging) observe(latency time.Duration) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if len(h.samples) < cap(h.samples) {
+		h.samples = append(h.samples, latency)
+	} else if len(h.samples) > 0 {
+		h.samples[h.next] = latency
+		h.next = (h.next + 1) % len(h.samples)
+	}
+}
+
+func (h *Hedging) deposit() {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.tokens += h.budget
+	if h.tokens > hedgingMaxTokens {
+		h.tokens = hedgingMaxTokens
+	}
+}
+
+func (h *Hedging) withdraw() bool {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if h.tokens >= 1 {
+		h.tokens--
+		return true
+	}
+	return false
+}
+
+func newBody(data []byte) io.ReadCloser {
+	if len(data) == 0 {
+		return http.NoBody
+	}
+	return buffer.NewReadCloser(data)
+}
+
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
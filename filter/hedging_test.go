@@ -0,0 +1,110 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package filter
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHedging(t *testing.T) {
+	var (
+		count    int32
+		canceled int32
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		body, _ := ioutil.ReadAll(request.Body)
+		if atomic.AddInt32(&count, 1) == 1 {
+			select {
+			case <-request.Context().Done():
+				atomic.AddInt32(&canceled, 1)
+				return
+			case <-time.After(2 * time.Second):
+			}
+		}
+		_, _ = writer.Write(body)
+	}))
+	defer server.Close()
+
+	client := &http.Client{}
+	do := func(request *http.Request, fc FilterChain) (*http.Response, error) {
+		return client.Do(request)
+	}
+
+	t.Run("hedged", func(t *testing.T) {
+		h := NewHedging(OptSetHedgingDelay(50 * time.Millisecond))
+		fm := FilterManager{}
+		fm.Add(do, h.Filter)
+		request, _ := http.NewRequest(http.MethodPut, server.URL, strings.NewReader("hello"))
+		now := time.Now()
+		resp, err := fm.RunFilter(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(data) != "hello" {
+			t.Fatal("expect hello but get ", string(data))
+		}
+		if time.Since(now) > time.Second {
+			t.Fatal("expect hedged response")
+		}
+		time.Sleep(100 * time.Millisecond)
+		if atomic.LoadInt32(&canceled) != 1 {
+			t.Fatal("expect slow request canceled")
+		}
+	})
+
+	t.Run("not idempotent", func(t *testing.T) {
+		atomic.StoreInt32(&count, 0)
+		h := NewHedging(OptSetHedgingDelay(50 * time.Millisecond))
+		fm := FilterManager{}
+		fm.Add(do, h.Filter)
+		request, _ := http.NewRequest(http.MethodPost, server.URL, strings.NewReader("hello"))
+		resp, err := fm.RunFilter(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if atomic.LoadInt32(&count) != 1 {
+			t.Fatal("expect 1 request but get ", count)
+		}
+	})
+
+	t.Run("budget", func(t *testing.T) {
+		atomic.StoreInt32(&count, 0)
+		h := NewHedging(OptSetHedgingDelay(10*time.Millisecond), OptSetHedgingBudget(0))
+		h.tokens = 0
+		fm := FilterManager{}
+		fm.Add(do, h.Filter)
+		request, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+		now := time.Now()
+		resp, err := fm.RunFilter(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if time.Since(now) < time.Second {
+			t.Fatal("expect no hedged request without budget")
+		}
+	})
+}
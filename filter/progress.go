@@ -0,0 +1,141 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package filter
+
+import (
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Direction 传输方向
+type Direction int
+
+const (
+	// 发送请求body
+	DirectionSend Direction = iota
+	// 接收应答body
+	DirectionReceive
+)
+
+func (d Direction) String() string {
+	if d == DirectionSend {
+		return "send"
+	}
+	return "receive"
+}
+
+// TransferProgress 请求或应答body的传输进度
+type TransferProgress struct {
+	Direction Direction
+	// 已传输的字节数
+	Transferred int64
+	// 总字节数，未知时为-1
+	Total int64
+	// 是否传输完成（读取到body结尾）
+	Done bool
+}
+
+// ProgressFunc 进度回调，request为当前请求
+// 发送与接收可能在不同的goroutine中回调，同一方向的回调不会并发
+type ProgressFunc func(request *http.Request, progress TransferProgress)
+
+// Progress 传输进度filter，封装请求body及应答body，在读取时回调进度
+// 作为client的filter时报告所有请求的进度，也可以通过request.AddIFilter只用于单个请求
+// 请求body通过wrapRequestBody封装，与Retry、Hedging同时使用时的顺序见wrapRequestBody
+type Progress struct {
+	fn       ProgressFunc
+	interval time.Duration
+	send     bool
+	receive  bool
+}
+
+type ProgressOpt func(*Progress)
+
+// NewProgress 创建传输进度filter，默认报告发送及接收进度
+func NewProgress(fn ProgressFunc, opts ...ProgressOpt) *Progress {
+	ret := &Progress{
+		fn:      fn,
+		send:    true,
+		receive: true,
+	}
+	for _, opt := range opts {
+		opt(ret)
+	}
+	return ret
+}
+
+// OptSetProgressInterval 配置两次回调的最小间隔，传输完成时总会回调，默认为0即每次读取都回调
+func OptSetProgressInterval(interval time.Duration) ProgressOpt {
+	return func(p *Progress) {
+		p.interval = interval
+	}
+}
+
+// OptSetProgressDirection 配置是否报告发送及接收进度
+func OptSetProgressDirection(send, receive bool) ProgressOpt {
+	return func(p *Progress) {
+		p.send = send
+		p.receive = receive
+	}
+}
+
+func (p *Progress) Filter(request *http.Request, fc FilterChain) (*http.Response, error) {
+	if p.fn == nil {
+		return fc.Filter(request)
+	}
+	if p.send {
+		wrapRequestBody(request, 0, func(total int64) func(n int, err error) error {
+			return p.tracker(request, DirectionSend, total)
+		})
+	}
+	resp, err := fc.Filter(request)
+	if err == nil && p.receive && resp != nil {
+		wrapResponseBody(resp, 0, p.tracker(request, DirectionReceive, resp.ContentLength))
+	}
+	return resp, err
+}
+
+func (p *Progress) tracker(request *http.Request, direction Direction, total int64) func(n int, err error) error {
+	var (
+		lock sync.Mutex
+		last time.Time
+		cur  = TransferProgress{Direction: direction, Total: total}
+	)
+	return func(n int, err error) error {
+		lock.Lock()
+		defer lock.Unlock()
+		if cur.Done {
+			return nil
+		}
+		cur.Transferred += int64(n)
+		cur.Done = err == io.EOF || (total >= 0 && cur.Transferred >= total)
+		if n == 0 && !cur.Done {
+			return nil
+		}
+		if !cur.Done && p.interval > 0 {
+			now := time.Now()
+			if now.Sub(last) < p.interval {
+				return nil
+			}
+			last = now
+		}
+		p.fn(request, cur)
+		return nil
+	}
+}
@@ -0,0 +1,207 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package filter
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// 默认最多尝试次数（包括第一次请求）
+	DefaultRetryMaxAttempts = 3
+	// 默认首次重试的等待时间，之后每次翻倍
+	DefaultRetryBackoff = 100 * time.Millisecond
+	// 默认最大等待时间
+	DefaultRetryMaxBackoff = 5 * time.Second
+)
+
+// Retry 重试filter，请求失败或返回可重试的状态码时按指数退避重新发送请求
+// 1、默认仅重试幂等方法（GET、HEAD、OPTIONS、TRACE、PUT、DELETE）
+// 2、默认重试的状态码为429、502、503、504，应答包含Retry-After时优先使用其等待时间（不超过最大等待时间）
+// 3、请求的context结束后不再重试
+type Retry struct {
+	maxAttempts int
+	backoff     time.Duration
+	maxBackoff  time.Duration
+	statusCodes map[int]bool
+	methods     map[string]bool
+}
+
+type RetryOpt func(*Retry)
+
+// NewRetry 创建重试filter
+func NewRetry(opts ...RetryOpt) *Retry {
+	ret := &Retry{
+		maxAttempts: DefaultRetryMaxAttempts,
+		backoff:     DefaultRetryBackoff,
+		maxBackoff:  DefaultRetryMaxBackoff,
+		statusCodes: map[int]bool{
+			http.StatusTooManyRequests:    true,
+			http.StatusBadGateway:         true,
+			http.StatusServiceUnavailable: true,
+			http.StatusGatewayTimeout:     true,
+		},
+		methods: map[string]bool{
+			http.MethodGet:     true,
+			http.MethodHead:    true,
+			http.MethodOptions: true,
+			http.MethodTrace:   true,
+			http.MethodPut:     true,
+			http.MethodDelete:  true,
+		},
+	}
+	for _, opt := range opts {
+		opt(ret)
+	}
+	return ret
+}
+
+// OptSetRetryMaxAttempts 配置最多尝试次数（包括第一次请求）
+func OptSetRetryMaxAttempts(n int) RetryOpt {
+	return func(r *Retry) {
+		r.maxAttempts = n
+	}
+}
+
+// OptSetRetryBackoff 配置首次重试的等待时间及最大等待时间
+func OptSetRetryBackoff(backoff, maxBackoff time.Duration) RetryOpt {
+	return func(r *Retry) {
+		r.backoff = backoff
+		r.maxBackoff = maxBackoff
+	}
+}
+
+// OptSetRetryStatusCodes 配置需要重试的应答状态码
+func OptSetRetryStatusCodes(codes ...int) RetryOpt {
+	return func(r *Retry) {
+		r.statusCodes = make(map[int]bool, len(codes))
+		for _, v := range codes {
+			r.statusCodes[v] = true
+		}
+	}
+}
+
+// OptSetRetryMethods 配置允许重试的请求方法，注意只应配置幂等方法
+func OptSetRetryMethods(methods ...string) RetryOpt {
+	return func(r *Retry) {
+		r.methods = make(map[string]bool, len(methods))
+		for _, v := range methods {
+			r.methods[v] = true
+		}
+	}
+}
+
+func (r *Retry) Filter(request *http.Request, fc FilterChain) (*http.Response, error) {
+	if r.maxAttempts <= 1 || !r.methods[request.Method] {
+		return fc.Filter(request)
+	}
+
+	var data []byte
+	if request.Body != nil && request.Body != http.NoBody {
+		// 请求body可能在应答返回后仍在发送，不使用内存池
+		b, err := ioutil.ReadAll(request.Body)
+		request.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		data = b
+		request.GetBody = func() (io.ReadCloser, error) {
+			return newBody(data), nil
+		}
+	}
+
+	for attempt := 1; ; attempt++ {
+		req := request
+		if attempt > 1 {
+			req = request.WithContext(context.WithValue(request.Context(), resendCountKey{}, attempt-1))
+		}
+		if data != nil {
+			req.Body = newBody(data)
+		}
+		resp, err := fc.Filter(req)
+		if attempt >= r.maxAttempts || !r.retryable(request.Context(), resp, err) {
+			return resp, err
+		}
+		wait := r.wait(attempt, resp)
+		if resp != nil && resp.Body != nil {
+			_, _ = io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-request.Context().Done():
+			timer.Stop()
+			return nil, request.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+type resendCountKey struct{}
+
+// ResendCount 获得请求的重发次数，首次发送为0
+// 由Retry在每次重试时设置，位于Retry内层的filter（如tracing）可以据此区分每次发送
+func ResendCount(ctx context.Context) int {
+	if n, ok := ctx.Value(resendCountKey{}).(int); ok {
+		return n
+	}
+	return 0
+}
+
+func (r *Retry) retryable(ctx context.Context, resp *http.Response, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if err != nil {
+		return true
+	}
+	return resp != nil && r.statusCodes[resp.StatusCode]
+}
+
+// wait 获得第attempt次请求失败后的等待时间
+func (r *Retry) wait(attempt int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if v := resp.Header.Get("Retry-After"); v != "" {
+			if seconds, err := strconv.Atoi(v); err == nil && seconds >= 0 {
+				return r.limit(time.Duration(seconds) * time.Second)
+			}
+			if t, err := http.ParseTime(v); err == nil {
+				return r.limit(time.Until(t))
+			}
+		}
+	}
+	wait := r.backoff
+	for i := 1; i < attempt && wait < r.maxBackoff; i++ {
+		wait *= 2
+	}
+	return r.limit(wait)
+}
+
+func (r *Retry) limit(d time.Duration) time.Duration {
+	if d < 0 {
+		return 0
+	}
+	if r.maxBackoff > 0 && d > r.maxBackoff {
+		return r.maxBackoff
+	}
+	return d
+}
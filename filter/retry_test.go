@@ -0,0 +1,137 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package filter
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetry(t *testing.T) {
+	var count int32
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		body, _ := ioutil.ReadAll(request.Body)
+		n := atomic.AddInt32(&count, 1)
+		switch request.URL.Path {
+		case "/after":
+			writer.Header().Set("Retry-After", "100")
+			writer.WriteHeader(http.StatusServiceUnavailable)
+			return
+		case "/fail":
+			writer.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		if n < 3 {
+			writer.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = writer.Write(body)
+	}))
+	defer server.Close()
+
+	client := &http.Client{}
+	do := func(request *http.Request, fc FilterChain) (*http.Response, error) {
+		return client.Do(request)
+	}
+	newFm := func(opts ...RetryOpt) FilterManager {
+		fm := FilterManager{}
+		fm.Add(do, NewRetry(opts...).Filter)
+		return fm
+	}
+
+	t.Run("retry", func(t *testing.T) {
+		atomic.StoreInt32(&count, 0)
+		fm := newFm(OptSetRetryBackoff(10*time.Millisecond, 20*time.Millisecond))
+		request, _ := http.NewRequest(http.MethodPut, server.URL, strings.NewReader("hello"))
+		resp, err := fm.RunFilter(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || string(data) != "hello" || atomic.LoadInt32(&count) != 3 {
+			t.Fatal(resp.StatusCode, string(data), count)
+		}
+	})
+
+	t.Run("exhausted", func(t *testing.T) {
+		atomic.StoreInt32(&count, 0)
+		fm := newFm(OptSetRetryMaxAttempts(2), OptSetRetryBackoff(time.Millisecond, time.Millisecond))
+		request, _ := http.NewRequest(http.MethodGet, server.URL+"/fail", nil)
+		resp, err := fm.RunFilter(request)
+		if err != nil || resp.StatusCode != http.StatusBadGateway || atomic.LoadInt32(&count) != 2 {
+			t.Fatal(err, count)
+		}
+		resp.Body.Close()
+	})
+
+	t.Run("not idempotent", func(t *testing.T) {
+		atomic.StoreInt32(&count, 0)
+		fm := newFm()
+		request, _ := http.NewRequest(http.MethodPost, server.URL+"/fail", strings.NewReader("hello"))
+		resp, err := fm.RunFilter(request)
+		if err != nil || atomic.LoadInt32(&count) != 1 {
+			t.Fatal(err, count)
+		}
+		resp.Body.Close()
+	})
+
+	t.Run("retry after", func(t *testing.T) {
+		atomic.StoreInt32(&count, 0)
+		fm := newFm(OptSetRetryMaxAttempts(2), OptSetRetryBackoff(time.Millisecond, 50*time.Millisecond))
+		request, _ := http.NewRequest(http.MethodGet, server.URL+"/after", nil)
+		now := time.Now()
+		resp, err := fm.RunFilter(request)
+		if err != nil || atomic.LoadInt32(&count) != 2 {
+			t.Fatal(err, count)
+		}
+		resp.Body.Close()
+		// Retry-After超过最大等待时间
+		if d := time.Since(now); d < 50*time.Millisecond || d > time.Second {
+			t.Fatal(d)
+		}
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		atomic.StoreInt32(&count, 0)
+		fm := newFm(OptSetRetryBackoff(time.Second, time.Second))
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		request, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/fail", nil)
+		_, err := fm.RunFilter(request)
+		if !errors.Is(err, context.DeadlineExceeded) || atomic.LoadInt32(&count) != 1 {
+			t.Fatal(err, count)
+		}
+	})
+}
+
+func TestRetryBackoff(t *testing.T) {
+	r := NewRetry(OptSetRetryBackoff(100*time.Millisecond, time.Second))
+	expect := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second}
+	for i, v := range expect {
+		if w := r.wait(i+1, nil); w != v {
+			t.Fatalf("attempt %d expect %v but get %v", i+1, v, w)
+		}
+	}
+}
@@ -0,0 +1,393 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package filter
+
+import (
+	"github.com/xfali/restclient/v2/buffer"
+	"github.com/xfali/restclient/v2/restutil"
+	"github.com/xfali/xlog"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+type Outcome int
+
+const (
+	// 请求成功，状态码小于400
+	OutcomeSuccess Outcome = iota
+	// 状态码4xx
+	OutcomeClientError
+	// 状态码5xx
+	OutcomeServerError
+	// 请求失败，未获得应答
+	OutcomeFailure
+)
+
+const (
+	// 默认记录的body最大长度
+	DefaultLogMaxBodySize = 4096
+	// 脱敏后的值
+	Redacted = "[REDACTED]"
+)
+
+var (
+	// 默认脱敏的header
+	DefaultLogRedactHeaders = []string{
+		restutil.HeaderAuthorization,
+		"Proxy-Authorization",
+		"Cookie",
+		"Set-Cookie",
+		"X-Api-Key",
+	}
+	// 默认脱敏的json字段及url query参数
+	DefaultLogRedactFields = []string{
+		"password",
+		"passwd",
+		"secret",
+		"client_secret",
+		"token",
+		"access_token",
+		"refresh_token",
+		"api_key",
+	}
+	// 默认作为文本记录的Content-Type，其他类型视为二进制不记录body
+	DefaultLogTextContentTypes = []string{
+		"text/*",
+		"application/json",
+		"application/*+json",
+		"application/xml",
+		"application/*+xml",
+		"application/x-www-form-urlencoded",
+		"application/javascript",
+	}
+)
+
+// StructuredLog 结构化日志filter，用于替代Log
+// 1、以key/value形式输出，每个请求在完成（应答body关闭）时输出一条日志
+// 2、按请求结果配置日志级别
+// 3、header及json字段脱敏
+// 4、body超过长度限制时截断，二进制类型的body不记录
+// 5、不会为了记录日志而完整缓存body，只保留不超过长度限制的部分
+type StructuredLog struct {
+	log           xlog.Logger
+	tag           string
+	levels        map[Outcome]xlog.Level
+	maxBodySize   int
+	logHeaders    bool
+	redactHeaders map[string]bool
+	redactFields  []string
+	fieldsRegexp  *regexp.Regexp
+	textTypes     []string
+}
+
+type StructuredLogOpt func(*StructuredLog)
+
+// NewStructuredLog 创建结构化日志filter
+func NewStructuredLog(log xlog.Logger, opts ...StructuredLogOpt) *StructuredLog {
+	ret := &StructuredLog{
+		log: log,
+		tag: "restclient",
+		levels: map[Outcome]xlog.Level{
+			OutcomeSuccess:     xlog.INFO,
+			OutcomeClientError: xlog.WARN,
+			OutcomeServerError: xlog.ERROR,
+			OutcomeFailure:     xlog.ERROR,
+		},
+		maxBodySize: DefaultLogMaxBodySize,
+		logHeaders:  true,
+		textTypes:   DefaultLogTextContentTypes,
+	}
+	OptSetLogRedactHeaders(DefaultLogRedactHeaders...)(ret)
+	OptSetLogRedactFields(DefaultLogRedactFields...)(ret)
+	for _, opt := range opts {
+		opt(ret)
+	}
+	return ret
+}
+
+// OptSetLogTag 配置日志标签，默认为restclient
+func OptSetLogTag(tag string) StructuredLogOpt {
+	return func(l *StructuredLog) {
+		l.tag = tag
+	}
+}
+
+// OptSetLogLevel 配置请求结果对应的日志级别，默认成功为INFO，4xx为WARN，5xx及请求失败为ERROR
+func OptSetLogLevel(outcome Outcome, level xlog.Level) StructuredLogOpt {
+	return func(l *StructuredLog) {
+		l.levels[outcome] = level
+	}
+}
+
+// OptSetLogMaxBodySize 配置记录的body最大长度，超过部分截断，小于等于0时不记录body
+func OptSetLogMaxBodySize(size int) StructuredLogOpt {
+	return func(l *StructuredLog) {
+		l.maxBodySize = size
+	}
+}
+
+// OptSetLogHeaders 配置是否记录header，默认记录
+func OptSetLogHeaders(v bool) StructuredLogOpt {
+	return func(l *StructuredLog) {
+		l.logHeaders = v
+	}
+}
+
+// OptSetLogRedactHeaders 配置需要脱敏的header（替换默认配置），不区分大小写
+func OptSetLogRedactHeaders(headers ...string) StructuredLogOpt {
+	return func(l *StructuredLog) {
+		l.redactHeaders = make(map[string]bool, len(headers))
+		for _, v := range headers {
+			l.redactHeaders[http.CanonicalHeaderKey(v)] = true
+		}
+	}
+}
+
+// OptSetLogRedactFields 配置需要脱敏的json字段及url query参数（替换默认配置），不区分大小写
+// json字段在任意层级匹配，字段的值为对象或数组时不会脱敏
+func OptSetLogRedactFields(fields ...string) StructuredLogOpt {
+	return func(l *StructuredLog) {
+		l.redactFields = fields
+		l.fieldsRegexp = nil
+		if len(fields) == 0 {
+			return
+		}
+		quoted := make([]string, len(fields))
+		for i, v := range fields {
+			quoted[i] = regexp.QuoteMeta(v)
+		}
+		// 匹配"field": "value"或"field": 123，body被截断时value可能没有结束引号
+		l.fieldsRegexp = regexp.MustCompile(`(?i)("(?:` + strings.Join(quoted, "|") + `)"\s*:\s*)("(?:[^"\\]|\\.)*"?|[^,}\]\s]+)`)
+	}
+}
+
+// OptSetLogTextContentTypes 配置作为文本记录body的Content-Type（替换默认配置），支持text/*及application/*+json形式
+// 未设置Content-Type时根据内容是否为有效的UTF-8判断
+func OptSetLogTextContentTypes(types ...string) StructuredLogOpt {
+	return func(l *StructuredLog) {
+		l.textTypes = types
+	}
+}
+
+func (l *StructuredLog) Filter(request *http.Request, fc FilterChain) (*http.Response, error) {
+	entry := &logEntry{
+		filter: l,
+		start:  time.Now(),
+		fields: []interface{}{
+			"tag", l.tag,
+			"id", RandomId(10),
+			"method", request.Method,
+			"url", l.redactUrl(request.URL),
+		},
+	}
+	if l.logHeaders {
+		entry.add("request_header", l.redactHeader(request.Header))
+	}
+	reqCapture := buffer.CaptureRequest(request, l.bodyLimit(request.Header))
+	// 开启耗时统计时一并记录
+	timings := restutil.GetTimings(request.Context())
+
+	resp, err := fc.Filter(request)
+	if reqCapture != nil {
+		entry.addBody("request", request.Header, reqCapture)
+	}
+	if err != nil || resp == nil {
+		entry.add("error", err)
+		entry.addTimings(timings)
+		entry.finish(OutcomeFailure)
+		return resp, err
+	}
+
+	entry.add("status", resp.StatusCode)
+	if l.logHeaders {
+		entry.add("response_header", l.redactHeader(resp.Header))
+	}
+	outcome := OutcomeSuccess
+	if resp.StatusCode >= http.StatusInternalServerError {
+		outcome = OutcomeServerError
+	} else if resp.StatusCode >= http.StatusBadRequest {
+		outcome = OutcomeClientError
+	}
+
+	if resp.Body == nil {
+		entry.addTimings(timings)
+		entry.finish(outcome)
+		return resp, err
+	}
+	capture := buffer.NewCapture(l.bodyLimit(resp.Header))
+	resp.Body = buffer.CaptureBody(resp.Body, capture, func(readErr error) {
+		entry.addBody("response", resp.Header, capture)
+		if readErr != nil {
+			entry.add("error", readErr)
+		}
+		entry.addTimings(timings)
+		entry.finish(outcome)
+	})
+	return resp, err
+}
+
+// bodyLimit 获得记录body的最大长度，小于0表示二进制内容，不记录
+func (l *StructuredLog) bodyLimit(header http.Header) int {
+	if l.maxBodySize <= 0 {
+		return 0
+	}
+	if ct := header.Get(restutil.HeaderContentType); ct != "" && !l.isText(ct) {
+		return -1
+	}
+	return l.maxBodySize
+}
+
+func (l *StructuredLog) isText(contentType string) bool {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, v := range l.textTypes {
+		if matchMediaType(v, mt) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchMediaType 支持text/*及application/*+json形式的模式
+func matchMediaType(pattern, mediaType string) bool {
+	i := strings.Index(pattern, "*")
+	if i == -1 {
+		return pattern == mediaType
+	}
+	return len(mediaType) >= len(pattern)-1 &&
+		strings.HasPrefix(mediaType, pattern[:i]) &&
+		strings.HasSuffix(mediaType, pattern[i+1:])
+}
+
+func (l *StructuredLog) redactHeader(header http.Header) http.Header {
+	ret := make(http.Header, len(header))
+	for k, vs := range header {
+		if l.redactHeaders[http.CanonicalHeaderKey(k)] {
+			ret[k] = []string{Redacted}
+		} else {
+			ret[k] = vs
+		}
+	}
+	return ret
+}
+
+func (l *StructuredLog) redactUrl(u *url.URL) string {
+	ret := *u
+	if _, ok := ret.User.Password(); ok {
+		ret.User = url.UserPassword(ret.User.Username(), Redacted)
+	}
+	if ret.RawQuery != "" && len(l.redactFields) > 0 {
+		query := ret.Query()
+		changed := false
+		for k := range query {
+			for _, f := range l.redactFields {
+				if strings.EqualFold(k, f) {
+					query[k] = []string{Redacted}
+					changed = true
+				}
+			}
+		}
+		if changed {
+			ret.RawQuery = query.Encode()
+		}
+	}
+	return ret.String()
+}
+
+func (l *StructuredLog) redactBody(data []byte) string {
+	if l.fieldsRegexp == nil {
+		return string(data)
+	}
+	return l.fieldsRegexp.ReplaceAllString(string(data), `${1}"`+Redacted+`"`)
+}
+
+type logEntry struct {
+	filter *StructuredLog
+	start  time.Time
+	lock   sync.Mutex
+	fields []interface{}
+}
+
+func (e *logEntry) add(key string, value interface{}) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.fields = append(e.fields, key, value)
+}
+
+func (e *logEntry) addBody(prefix string, header http.Header, capture *buffer.Capture) {
+	data, size := capture.Snapshot()
+	e.add(prefix+"_size", size)
+	switch {
+	case e.filter.bodyLimit(header) < 0:
+		e.add(prefix+"_body", "<binary>")
+	case len(data) > 0:
+		if header.Get(restutil.HeaderContentType) == "" && !utf8.Valid(trimIncompleteRune(data)) {
+			e.add(prefix+"_body", "<binary>")
+			return
+		}
+		e.add(prefix+"_body", e.filter.redactBody(data))
+		if size > int64(len(data)) {
+			e.add(prefix+"_truncated", true)
+		}
+	}
+}
+
+func (e *logEntry) addTimings(timings *restutil.Timings) {
+	if timings != nil {
+		e.add("timings", timings.String())
+	}
+}
+
+func (e *logEntry) finish(outcome Outcome) {
+	e.lock.Lock()
+	fields := append(e.fields, "duration_ms", time.Since(e.start).Milliseconds())
+	e.lock.Unlock()
+
+	log := e.filter.log.WithFields(fields...)
+	const msg = "restclient exchange"
+	switch e.filter.levels[outcome] {
+	case xlog.DEBUG:
+		log.Debug(msg)
+	case xlog.INFO:
+		log.Info(msg)
+	case xlog.WARN:
+		log.Warn(msg)
+	default:
+		log.Error(msg)
+	}
+}
+
+// trimIncompleteRune 去除截断时末尾不完整的UTF-8字符
+func trimIncompleteRune(data []byte) []byte {
+	for i := 0; i < utf8.UTFMax && i < len(data); i++ {
+		if utf8.RuneStart(data[len(data)-1-i]) {
+			if !utf8.FullRune(data[len(data)-1-i:]) {
+				return data[:len(data)-1-i]
+			}
+			break
+		}
+	}
+	return data
+}
@@ -0,0 +1,117 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package filter
+
+import (
+	"bytes"
+	"github.com/xfali/xlog"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestStructuredLog(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		switch request.URL.Path {
+		case "/binary":
+			writer.Header().Set("Content-Type", "application/octet-stream")
+			_, _ = writer.Write([]byte{0, 1, 2, 3})
+		case "/notfound":
+			writer.WriteHeader(http.StatusNotFound)
+		default:
+			writer.Header().Set("Content-Type", "application/json")
+			writer.Header().Set("Set-Cookie", "session=abc")
+			_, _ = writer.Write([]byte(`{"name":"test","token":"abc123","data":"` + strings.Repeat("x", 100) + `"}`))
+		}
+	}))
+	defer server.Close()
+
+	buf := &bytes.Buffer{}
+	logging := xlog.NewLogging()
+	logging.SetOutput(buf)
+	logging.SetSeverityLevel(xlog.DEBUG)
+	logging.SetFormatter(&xlog.TextFormatter{})
+	logger := xlog.NewFactory(logging).GetLogger()
+
+	client := &http.Client{}
+	do := func(request *http.Request, fc FilterChain) (*http.Response, error) {
+		return client.Do(request)
+	}
+	l := NewStructuredLog(logger, OptSetLogMaxBodySize(64), OptSetLogLevel(OutcomeSuccess, xlog.DEBUG))
+	fm := FilterManager{}
+	fm.Add(do, l.Filter)
+
+	exchange := func(path, body string) {
+		request, _ := http.NewRequest(http.MethodPost, server.URL+path, strings.NewReader(body))
+		request.Header.Set("Authorization", "Bearer secret-token")
+		request.Header.Set("Content-Type", "application/json")
+		resp, err := fm.RunFilter(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = ioutil.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+	}
+
+	t.Run("redact and truncate", func(t *testing.T) {
+		buf.Reset()
+		exchange("/?access_token=xyz", `{"user":"a","password":"p@ss\"word"}`)
+		out := buf.String()
+		t.Log(out)
+		for _, v := range []string{"secret-token", "p@ss", "abc123", "session=abc", "xyz"} {
+			if strings.Contains(out, v) {
+				t.Fatal("expect redacted: ", v)
+			}
+		}
+		for _, v := range []string{"DEBUG", `"password":"[REDACTED]"`, `"token":"[REDACTED]"`,
+			"response_truncated", "status", "200"} {
+			if !strings.Contains(out, v) {
+				t.Fatal("expect ", v)
+			}
+		}
+	})
+
+	t.Run("binary", func(t *testing.T) {
+		buf.Reset()
+		exchange("/binary", `{}`)
+		out := buf.String()
+		t.Log(out)
+		if !strings.Contains(out, "<binary>") {
+			t.Fatal("expect binary body skipped")
+		}
+	})
+
+	t.Run("client error", func(t *testing.T) {
+		buf.Reset()
+		exchange("/notfound", "")
+		out := buf.String()
+		t.Log(out)
+		if !strings.Contains(out, "WARN") || !strings.Contains(out, "404") {
+			t.Fatal("expect warn level")
+		}
+	})
+}
+
+func TestTruncatedRedact(t *testing.T) {
+	l := NewStructuredLog(xlog.GetLogger())
+	out := l.redactBody([]byte(`{"a":{"Secret": 12345, "token":"abcd`))
+	if out != `{"a":{"Secret": "[REDACTED]", "token":"[REDACTED]"` {
+		t.Fatal(out)
+	}
+}
@@ -0,0 +1,151 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package filter
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RateLimiter 按字节限速的令牌桶，可以在多个filter、client间共享以限制总带宽
+type RateLimiter struct {
+	lock   sync.Mutex
+	rate   float64
+	burst  int
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter 创建限速器，bytesPerSecond为每秒字节数，burst为允许的突发字节数（小于等于0时为bytesPerSecond/10，至少1KB）
+func NewRateLimiter(bytesPerSecond int64, burst int) *RateLimiter {
+	if burst <= 0 {
+		burst = int(bytesPerSecond / 10)
+		if burst < 1024 {
+			burst = 1024
+		}
+	}
+	return &RateLimiter{
+		rate:   float64(bytesPerSecond),
+		burst:  burst,
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Burst 获得允许的突发字节数
+func (l *RateLimiter) Burst() int {
+	return l.burst
+}
+
+// WaitN 消耗n个字节的令牌，令牌不足时等待，ctx结束时返回ctx.Err()
+func (l *RateLimiter) WaitN(ctx context.Context, n int) error {
+	if l == nil || l.rate <= 0 || n <= 0 {
+		return nil
+	}
+	l.lock.Lock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > float64(l.burst) {
+		l.tokens = float64(l.burst)
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	wait := time.Duration(0)
+	if l.tokens < 0 {
+		wait = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.lock.Unlock()
+	if wait == 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		// 归还未使用的令牌
+		l.lock.Lock()
+		l.tokens += float64(n)
+		l.lock.Unlock()
+		return ctx.Err()
+	}
+}
+
+// Throttle 带宽限制filter，封装请求body及应答body，在读取时按限速等待
+// 作为client的filter时所有请求共享同一限速器，即限制总带宽；通过request.AddIFilter使用时只限制单个请求
+// 请求body通过wrapRequestBody封装，与Retry、Hedging同时使用时的顺序见wrapRequestBody
+type Throttle struct {
+	send    *RateLimiter
+	receive *RateLimiter
+}
+
+type ThrottleOpt func(*Throttle)
+
+// NewThrottle 创建带宽限制filter
+func NewThrottle(opts ...ThrottleOpt) *Throttle {
+	ret := &Throttle{}
+	for _, opt := range opts {
+		opt(ret)
+	}
+	return ret
+}
+
+// OptSetThrottleSendRate 配置发送请求body的带宽，单位为字节每秒
+func OptSetThrottleSendRate(bytesPerSecond int64) ThrottleOpt {
+	return OptSetThrottleSendLimiter(NewRateLimiter(bytesPerSecond, 0))
+}
+
+// OptSetThrottleReceiveRate 配置接收应答body的带宽，单位为字节每秒
+func OptSetThrottleReceiveRate(bytesPerSecond int64) ThrottleOpt {
+	return OptSetThrottleReceiveLimiter(NewRateLimiter(bytesPerSecond, 0))
+}
+
+// OptSetThrottleSendLimiter 配置发送请求body使用的限速器，可与其他Throttle共享
+func OptSetThrottleSendLimiter(limiter *RateLimiter) ThrottleOpt {
+	return func(t *Throttle) {
+		t.send = limiter
+	}
+}
+
+// OptSetThrottleReceiveLimiter 配置接收应答body使用的限速器，可与其他Throttle共享
+func OptSetThrottleReceiveLimiter(limiter *RateLimiter) ThrottleOpt {
+	return func(t *Throttle) {
+		t.receive = limiter
+	}
+}
+
+func (t *Throttle) Filter(request *http.Request, fc FilterChain) (*http.Response, error) {
+	ctx := request.Context()
+	if t.send != nil {
+		wrapRequestBody(request, t.send.Burst(), func(total int64) func(n int, err error) error {
+			return func(n int, err error) error {
+				return t.send.WaitN(ctx, n)
+			}
+		})
+	}
+	resp, err := fc.Filter(request)
+	if err == nil && t.receive != nil {
+		wrapResponseBody(resp, t.receive.Burst(), func(n int, err error) error {
+			return t.receive.WaitN(ctx, n)
+		})
+	}
+	return resp, err
+}
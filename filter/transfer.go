@@ -0,0 +1,101 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package filter
+
+import (
+	"github.com/xfali/restclient/v2/buffer"
+	"io"
+	"net/http"
+)
+
+// transferBody 封装请求或应答body，每次读取后调用onRead
+// 不暴露被封装body的Bytes等方法，保证内层filter及transport只能通过Read读取数据
+type transferBody struct {
+	io.ReadCloser
+	// 单次读取的最大字节数，0表示不限制
+	max    int
+	onRead func(n int, err error) error
+}
+
+func (b *transferBody) Read(p []byte) (int, error) {
+	if b.max > 0 && len(p) > b.max {
+		p = p[:b.max]
+	}
+	n, err := b.ReadCloser.Read(p)
+	if e := b.onRead(n, err); e != nil {
+		return n, e
+	}
+	return n, err
+}
+
+type transferBodyWithLength struct {
+	*transferBody
+	cl buffer.ContentLength
+}
+
+func (b *transferBodyWithLength) ContentLength() int64 {
+	return b.cl.ContentLength()
+}
+
+// bodyLength 获得body的总大小，未知时返回-1
+// encodeRequest生成的buffer.ReadWriteCloser在读取后长度会减少，因此需要在读取前获得
+func bodyLength(body io.ReadCloser, contentLength int64) int64 {
+	if contentLength > 0 {
+		return contentLength
+	}
+	if cl, ok := body.(buffer.ContentLength); ok {
+		return cl.ContentLength()
+	}
+	return -1
+}
+
+// wrapBody 封装body，body实现了buffer.ContentLength时保留该接口，以便后续ContentLengthFilter使用
+// Close直接关闭原body，池化的buffer仍只归还一次
+func wrapBody(body io.ReadCloser, max int, onRead func(n int, err error) error) io.ReadCloser {
+	ret := &transferBody{ReadCloser: body, max: max, onRead: onRead}
+	if cl, ok := body.(buffer.ContentLength); ok {
+		return &transferBodyWithLength{transferBody: ret, cl: cl}
+	}
+	return ret
+}
+
+// wrapRequestBody 封装请求body，newOnRead为每个body（包括重定向时GetBody重新获得的body）创建读取回调
+// 注意：Retry、Hedging等会预先读取请求body的filter应位于使用wrapRequestBody的filter（Progress、Throttle）外层
+// （在其之后添加或配置更高的优先级），否则回调作用于预读取而不是实际发送
+func wrapRequestBody(request *http.Request, max int, newOnRead func(total int64) func(n int, err error) error) {
+	if request.Body == nil || request.Body == http.NoBody {
+		return
+	}
+	request.Body = wrapBody(request.Body, max, newOnRead(bodyLength(request.Body, request.ContentLength)))
+	if getBody := request.GetBody; getBody != nil {
+		request.GetBody = func() (io.ReadCloser, error) {
+			body, err := getBody()
+			if err != nil || body == nil || body == http.NoBody {
+				return body, err
+			}
+			return wrapBody(body, max, newOnRead(bodyLength(body, request.ContentLength))), nil
+		}
+	}
+}
+
+// wrapResponseBody 封装应答body
+func wrapResponseBody(resp *http.Response, max int, onRead func(n int, err error) error) {
+	if resp == nil || resp.Body == nil || resp.Body == http.NoBody {
+		return
+	}
+	resp.Body = wrapBody(resp.Body, max, onRead)
+}
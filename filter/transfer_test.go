@@ -0,0 +1,136 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package filter
+
+import (
+	"bytes"
+	"context"
+	"github.com/xfali/restclient/v2/buffer"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestProgress(t *testing.T) {
+	data := strings.Repeat("x", 100*1024)
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		body, _ := ioutil.ReadAll(request.Body)
+		writer.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		_, _ = writer.Write(body)
+	}))
+	defer server.Close()
+
+	var (
+		lock sync.Mutex
+		last = map[Direction]TransferProgress{}
+	)
+	p := NewProgress(func(request *http.Request, progress TransferProgress) {
+		lock.Lock()
+		defer lock.Unlock()
+		if progress.Transferred < last[progress.Direction].Transferred {
+			t.Error("progress went backwards")
+		}
+		last[progress.Direction] = progress
+	})
+	fm := FilterManager{}
+	fm.Add(func(request *http.Request, fc FilterChain) (*http.Response, error) {
+		return http.DefaultClient.Do(request)
+	}, ContentLengthFilter, p.Filter)
+
+	buf := buffer.NewReadWriteCloser(buffer.NewPool())
+	_, _ = buf.Write([]byte(data))
+	request, _ := http.NewRequest(http.MethodPost, server.URL, buf)
+	resp, err := fm.RunFilter(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != data || request.ContentLength != int64(len(data)) {
+		t.Fatal(len(body), request.ContentLength)
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	for _, d := range []Direction{DirectionSend, DirectionReceive} {
+		if v := last[d]; !v.Done || v.Transferred != int64(len(data)) || v.Total != int64(len(data)) {
+			t.Fatal(d, v)
+		}
+	}
+}
+
+func TestThrottle(t *testing.T) {
+	data := strings.Repeat("x", 30*1024)
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		body, _ := ioutil.ReadAll(request.Body)
+		_, _ = writer.Write(body)
+	}))
+	defer server.Close()
+
+	throttle := NewThrottle(OptSetThrottleSendLimiter(NewRateLimiter(100*1024, 10*1024)),
+		OptSetThrottleReceiveRate(100*1024))
+	fm := FilterManager{}
+	fm.Add(func(request *http.Request, fc FilterChain) (*http.Response, error) {
+		return http.DefaultClient.Do(request)
+	}, throttle.Filter)
+
+	now := time.Now()
+	request, _ := http.NewRequest(http.MethodPost, server.URL, bytes.NewReader([]byte(data)))
+	resp, err := fm.RunFilter(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	// 发送及接收突发后各剩余20KB，至少需要约400ms
+	if string(body) != data || time.Since(now) < 300*time.Millisecond {
+		t.Fatal(len(body), time.Since(now))
+	}
+	// GetBody获得的body同样限速
+	if _, ok := request.Body.(*transferBody); !ok {
+		t.Fatal("expect body wrapped")
+	}
+	if b, err := request.GetBody(); err != nil {
+		t.Fatal(err)
+	} else if _, ok := b.(*transferBody); !ok {
+		t.Fatal("expect GetBody wrapped")
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	l := NewRateLimiter(1024, 1024)
+	if err := l.WaitN(context.Background(), 1024); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := l.WaitN(ctx, 1024); err != context.DeadlineExceeded {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	if err := l.WaitN(context.Background(), 100); err != nil || time.Since(now) < 50*time.Millisecond {
+		t.Fatal(err, time.Since(now))
+	}
+	var nl *RateLimiter
+	if err := nl.WaitN(context.Background(), 100); err != nil {
+		t.Fatal(err)
+	}
+}
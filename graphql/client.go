@@ -0,0 +1,212 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/xfali/restclient/v2"
+	"github.com/xfali/restclient/v2/filter"
+	"github.com/xfali/restclient/v2/request"
+	"github.com/xfali/restclient/v2/restutil"
+	"io"
+	"net/http"
+	"sync/atomic"
+)
+
+const (
+	// GraphQL over HTTP规范的应答类型
+	MediaTypeGraphQLResponse = "application/graphql-response+json"
+)
+
+// Request GraphQL请求
+type Request struct {
+	// 查询或变更的文本
+	Query string
+	// 查询文本包含多个操作时指定执行的操作
+	OperationName string
+	// 变量，值为Upload（或*Upload）时使用multipart请求上传文件
+	Variables map[string]interface{}
+}
+
+type payload struct {
+	Query         string                 `json:"query,omitempty"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+	Extensions    map[string]interface{} `json:"extensions,omitempty"`
+}
+
+type response struct {
+	Data       interface{}            `json:"data"`
+	Errors     Errors                 `json:"errors"`
+	Extensions map[string]interface{} `json:"extensions"`
+}
+
+// Client GraphQL客户端，以POST发送json格式的请求，将应答中的data解析到结果中，errors以Errors返回：
+//
+//	c := graphql.New(client, "http://localhost:8080/graphql", graphql.OptSetPersistedQueries())
+//	ret := struct {
+//		User struct {
+//			Name string `json:"name"`
+//		} `json:"user"`
+//	}{}
+//	err := c.Query(ctx, `query ($id: ID!) { user(id: $id) { name } }`, map[string]interface{}{"id": "1"}, &ret)
+type Client struct {
+	client restclient.RestClient
+	url    string
+	opts   []request.Opt
+	apq    bool
+	// 服务端不支持持久化查询时置为1
+	apqDisabled int32
+}
+
+type Opt func(*Client)
+
+// New 创建GraphQL客户端，url为GraphQL服务的地址
+func New(client restclient.RestClient, url string, opts ...Opt) *Client {
+	ret := &Client{
+		client: client,
+		url:    url,
+	}
+	for _, opt := range opts {
+		opt(ret)
+	}
+	return ret
+}
+
+// OptSetRequestOpts 配置每个请求的参数，如header、filter等
+func OptSetRequestOpts(opts ...request.Opt) Opt {
+	return func(c *Client) {
+		c.opts = append(c.opts, opts...)
+	}
+}
+
+// OptSetPersistedQueries 开启自动持久化查询（APQ）：先只发送查询的sha256 hash，
+// 服务端返回PersistedQueryNotFound时再发送完整查询，服务端不支持时之后的请求不再使用
+// 包含文件上传的请求不使用持久化查询
+func OptSetPersistedQueries() Opt {
+	return func(c *Client) {
+		c.apq = true
+	}
+}
+
+// Query 发送查询，result为data的解析目标，可以为nil
+func (c *Client) Query(ctx context.Context, query string, variables map[string]interface{}, result interface{}, opts ...request.Opt) error {
+	return c.Do(ctx, &Request{Query: query, Variables: variables}, result, opts...)
+}
+
+// Mutate 发送变更，同Query
+func (c *Client) Mutate(ctx context.Context, mutation string, variables map[string]interface{}, result interface{}, opts ...request.Opt) error {
+	return c.Do(ctx, &Request{Query: mutation, Variables: variables}, result, opts...)
+}
+
+// Do 发送请求，opts为本次请求的额外参数
+// 应答包含errors时返回Errors，此时data中未出错的字段仍会解析到result中
+func (c *Client) Do(ctx context.Context, req *Request, result interface{}, opts ...request.Opt) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	p := &payload{
+		Query:         req.Query,
+		OperationName: req.OperationName,
+		Variables:     req.Variables,
+	}
+
+	var files []*uploadFile
+	if len(req.Variables) > 0 {
+		vars, _ := extractUploads(req.Variables, "variables", &files).(map[string]interface{})
+		if len(files) > 0 {
+			p.Variables = vars
+			body, contentType, err := multipartBody(p, files)
+			if err != nil {
+				return err
+			}
+			return c.send(ctx, body, contentType, result, opts)
+		}
+	}
+
+	if c.apq && atomic.LoadInt32(&c.apqDisabled) == 0 {
+		sum := sha256.Sum256([]byte(req.Query))
+		p.Query = ""
+		p.Extensions = map[string]interface{}{
+			"persistedQuery": map[string]interface{}{
+				"version":    1,
+				"sha256Hash": hex.EncodeToString(sum[:]),
+			},
+		}
+		err := c.send(ctx, p, restclient.MediaTypeJson, result, opts)
+		var errs Errors
+		if !errors.As(err, &errs) {
+			return err
+		}
+		switch {
+		case errs.has(ErrPersistedQueryNotFound, "PERSISTED_QUERY_NOT_FOUND"):
+			// 同时发送hash及完整查询，服务端缓存后之后的请求只需发送hash
+		case errs.has(ErrPersistedQueryNotSupported, "PERSISTED_QUERY_NOT_SUPPORTED"):
+			atomic.StoreInt32(&c.apqDisabled, 1)
+			p.Extensions = nil
+		default:
+			return err
+		}
+		p.Query = req.Query
+	}
+	return c.send(ctx, p, restclient.MediaTypeJson, result, opts)
+}
+
+func (c *Client) send(ctx context.Context, body interface{}, contentType string, result interface{}, opts []request.Opt) error {
+	var data []byte
+	ropts := make([]request.Opt, 0, len(c.opts)+len(opts)+6)
+	ropts = append(ropts, c.opts...)
+	ropts = append(ropts, opts...)
+	ropts = append(ropts,
+		request.MethodPost(),
+		request.WithRequestContext(ctx),
+		request.AddRequestHeader(restutil.HeaderContentType, contentType),
+		request.WithRequestBody(body),
+		request.WithResult(&data),
+		// 自动添加的Accept由结果类型决定，在filter中覆盖
+		request.AddFilter(acceptFilter))
+	err := c.client.Exchange(c.url, ropts...)
+	if len(data) == 0 {
+		if err != nil {
+			return err
+		}
+		return errors.New("graphql: empty response")
+	}
+	// 应答类型可能为application/graphql-response+json，使用JsonConverter直接解析body
+	resp := &response{Data: result}
+	_, derr := restclient.NewJsonConverter().CreateDecoder(bytes.NewReader(data)).Decode(resp)
+	// 应答状态码不是200时（如400）body中仍可能包含errors
+	if len(resp.Errors) > 0 {
+		return resp.Errors
+	}
+	if err != nil {
+		return err
+	}
+	if derr != nil && derr != io.EOF {
+		return derr
+	}
+	return nil
+}
+
+func acceptFilter(req *http.Request, fc filter.FilterChain) (*http.Response, error) {
+	req.Header.Set(restutil.HeaderAccept, MediaTypeGraphQLResponse+", "+restclient.MediaTypeJson)
+	return fc.Filter(req)
+}
@@ -0,0 +1,247 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package graphql
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/xfali/restclient/v2"
+	"github.com/xfali/restclient/v2/request"
+)
+
+type server struct {
+	*httptest.Server
+	lock       sync.Mutex
+	persisted  map[string]string
+	apq        bool
+	requests   int32
+	lastUpload map[string]string
+}
+
+func writeJson(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", MediaTypeGraphQLResponse)
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func newServer(t *testing.T, apq bool) *server {
+	s := &server{persisted: map[string]string{}, apq: apq}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&s.requests, 1)
+		if !strings.HasPrefix(r.Header.Get("Accept"), MediaTypeGraphQLResponse) {
+			t.Error("unexpected Accept ", r.Header.Get("Accept"))
+		}
+		p := payload{}
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+			if err := r.ParseMultipartForm(1 << 20); err != nil {
+				t.Error(err)
+				return
+			}
+			_ = json.Unmarshal([]byte(r.FormValue("operations")), &p)
+			m := map[string][]string{}
+			_ = json.Unmarshal([]byte(r.FormValue("map")), &m)
+			files := map[string]string{}
+			for k, paths := range m {
+				f, header, err := r.FormFile(k)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				data, _ := ioutil.ReadAll(f)
+				f.Close()
+				files[strings.Join(paths, ",")] = header.Filename + ":" + header.Header.Get("Content-Type") + ":" + string(data)
+			}
+			s.lock.Lock()
+			s.lastUpload = files
+			s.lock.Unlock()
+			vars, _ := json.Marshal(p.Variables)
+			writeJson(w, http.StatusOK, map[string]interface{}{"data": map[string]interface{}{"upload": string(vars)}})
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			writeJson(w, http.StatusBadRequest, map[string]interface{}{"errors": []map[string]string{{"message": err.Error()}}})
+			return
+		}
+		if pq, ok := p.Extensions["persistedQuery"].(map[string]interface{}); ok {
+			if !s.apq {
+				writeJson(w, http.StatusOK, map[string]interface{}{"errors": []map[string]string{{"message": ErrPersistedQueryNotSupported}}})
+				return
+			}
+			hash, _ := pq["sha256Hash"].(string)
+			s.lock.Lock()
+			if p.Query != "" {
+				sum := sha256.Sum256([]byte(p.Query))
+				if hex.EncodeToString(sum[:]) != hash {
+					t.Error("hash mismatch")
+				}
+				s.persisted[hash] = p.Query
+			}
+			p.Query = s.persisted[hash]
+			s.lock.Unlock()
+			if p.Query == "" {
+				writeJson(w, http.StatusOK, map[string]interface{}{"errors": []map[string]interface{}{{
+					"message": ErrPersistedQueryNotFound, "extensions": map[string]string{"code": "PERSISTED_QUERY_NOT_FOUND"}}}})
+				return
+			}
+		}
+		switch {
+		case strings.Contains(p.Query, "user"):
+			writeJson(w, http.StatusOK, map[string]interface{}{"data": map[string]interface{}{
+				"user": map[string]interface{}{"id": p.Variables["id"], "name": "user" + fmt.Sprint(p.Variables["id"]), "op": p.OperationName}}})
+		case strings.Contains(p.Query, "friends"):
+			writeJson(w, http.StatusOK, map[string]interface{}{
+				"data": map[string]interface{}{"friends": []interface{}{map[string]string{"name": "a"}, nil}},
+				"errors": []map[string]interface{}{{
+					"message":    "not allowed",
+					"locations":  []map[string]int{{"line": 1, "column": 3}},
+					"path":       []interface{}{"friends", 1, "name"},
+					"extensions": map[string]string{"code": "FORBIDDEN"},
+				}}})
+		default:
+			writeJson(w, http.StatusBadRequest, map[string]interface{}{"errors": []map[string]string{{"message": "syntax error"}}})
+		}
+	}))
+	return s
+}
+
+type user struct {
+	User struct {
+		Id   string `json:"id"`
+		Name string `json:"name"`
+		Op   string `json:"op"`
+	} `json:"user"`
+}
+
+func TestQuery(t *testing.T) {
+	s := newServer(t, false)
+	defer s.Close()
+	c := New(restclient.New(), s.URL, OptSetRequestOpts(request.AddRequestHeader("X-Test", "1")))
+
+	ret := user{}
+	err := c.Do(context.Background(), &Request{
+		Query:         `query GetUser($id: ID!) { user(id: $id) { id name } }`,
+		OperationName: "GetUser",
+		Variables:     map[string]interface{}{"id": "1"},
+	}, &ret)
+	if err != nil || ret.User.Name != "user1" || ret.User.Op != "GetUser" {
+		t.Fatal(err, ret)
+	}
+
+	t.Run("partial", func(t *testing.T) {
+		ret := struct {
+			Friends []*struct {
+				Name string `json:"name"`
+			} `json:"friends"`
+		}{}
+		err := c.Query(context.Background(), `{ friends { name } }`, nil, &ret)
+		var errs Errors
+		if !errors.As(err, &errs) || len(errs) != 1 {
+			t.Fatal(err)
+		}
+		e := errs[0]
+		if e.Code() != "FORBIDDEN" || e.PathString() != "friends[1].name" || e.Locations[0].Column != 3 ||
+			err.Error() != "graphql: not allowed (path: friends[1].name)" {
+			t.Fatal(e, err)
+		}
+		if len(ret.Friends) != 2 || ret.Friends[0].Name != "a" || ret.Friends[1] != nil {
+			t.Fatal(ret)
+		}
+	})
+
+	t.Run("bad request", func(t *testing.T) {
+		err := c.Mutate(context.Background(), `mutation {`, nil, nil)
+		var errs Errors
+		if !errors.As(err, &errs) || errs[0].Message != "syntax error" {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestPersistedQueries(t *testing.T) {
+	s := newServer(t, true)
+	defer s.Close()
+	c := New(restclient.New(), s.URL, OptSetPersistedQueries())
+	query := `query ($id: ID!) { user(id: $id) { id name } }`
+	for i, expect := range []int32{2, 1} {
+		atomic.StoreInt32(&s.requests, 0)
+		ret := user{}
+		err := c.Query(context.Background(), query, map[string]interface{}{"id": fmt.Sprint(i)}, &ret)
+		if err != nil || ret.User.Name != fmt.Sprintf("user%d", i) || atomic.LoadInt32(&s.requests) != expect {
+			t.Fatal(err, ret, s.requests)
+		}
+	}
+
+	// 服务端不支持时不再使用APQ
+	s2 := newServer(t, false)
+	defer s2.Close()
+	c = New(restclient.New(), s2.URL, OptSetPersistedQueries())
+	for _, expect := range []int32{2, 1} {
+		atomic.StoreInt32(&s2.requests, 0)
+		if err := c.Query(context.Background(), query, map[string]interface{}{"id": "1"}, &user{}); err != nil ||
+			atomic.LoadInt32(&s2.requests) != expect {
+			t.Fatal(err, s2.requests)
+		}
+	}
+}
+
+func TestUpload(t *testing.T) {
+	s := newServer(t, true)
+	defer s.Close()
+	c := New(restclient.New(), s.URL, OptSetPersistedQueries())
+
+	file := &Upload{Filename: `a"b.txt`, ContentType: "text/plain", Reader: strings.NewReader("hello")}
+	// Upload值的副本使用同一个Reader，只上传一次
+	dup := Upload{Filename: "d.txt", Reader: strings.NewReader("dup")}
+	vars := map[string]interface{}{
+		"file":  file,
+		"files": []interface{}{Upload{Filename: "c.bin", Reader: strings.NewReader("world")}, file},
+		"more":  []interface{}{dup, dup},
+		"name":  "test",
+	}
+	ret := struct {
+		Upload string `json:"upload"`
+	}{}
+	err := c.Mutate(context.Background(), `mutation ($file: Upload!, $files: [Upload!]!) { upload(file: $file, files: $files) }`, vars, &ret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ret.Upload != `{"file":null,"files":[null,null],"more":[null,null],"name":"test"}` {
+		t.Fatal(ret.Upload)
+	}
+	if _, ok := vars["file"].(*Upload); !ok {
+		t.Fatal("expect variables unchanged")
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if len(s.lastUpload) != 3 || s.lastUpload["variables.file,variables.files.1"] != `a"b.txt:text/plain:hello` ||
+		s.lastUpload["variables.files.0"] != "c.bin:application/octet-stream:world" ||
+		s.lastUpload["variables.more.0,variables.more.1"] != "d.txt:application/octet-stream:dup" {
+		t.Fatal(s.lastUpload)
+	}
+}
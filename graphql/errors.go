@@ -0,0 +1,105 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package graphql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// APQ错误：服务端未缓存该hash对应的查询
+	ErrPersistedQueryNotFound = "PersistedQueryNotFound"
+	// APQ错误：服务端不支持持久化查询
+	ErrPersistedQueryNotSupported = "PersistedQueryNotSupported"
+)
+
+// Location 错误在查询文本中的位置
+type Location struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// Error GraphQL应答errors中的一项
+type Error struct {
+	Message   string     `json:"message"`
+	Locations []Location `json:"locations,omitempty"`
+	// 出错字段在data中的路径，元素为字段名（string）或列表下标（float64）
+	Path       []interface{}          `json:"path,omitempty"`
+	Extensions map[string]interface{} `json:"extensions,omitempty"`
+}
+
+// Code 获得extensions中的code，如"UNAUTHENTICATED"，不存在时返回空字符串
+func (e *Error) Code() string {
+	if v, ok := e.Extensions["code"].(string); ok {
+		return v
+	}
+	return ""
+}
+
+// PathString 获得路径的字符串形式，如"user.friends[0].name"
+func (e *Error) PathString() string {
+	buf := strings.Builder{}
+	for _, v := range e.Path {
+		switch p := v.(type) {
+		case float64:
+			buf.WriteString("[" + strconv.FormatInt(int64(p), 10) + "]")
+		default:
+			if buf.Len() > 0 {
+				buf.WriteByte('.')
+			}
+			buf.WriteString(fmt.Sprint(p))
+		}
+	}
+	return buf.String()
+}
+
+func (e *Error) Error() string {
+	if len(e.Path) > 0 {
+		return fmt.Sprintf("graphql: %s (path: %s)", e.Message, e.PathString())
+	}
+	return "graphql: " + e.Message
+}
+
+// Errors 应答中的errors，部分字段出错时data中的其他字段仍会解析到结果中
+// 可以通过errors.As(err, &graphql.Errors{})获得
+type Errors []*Error
+
+func (e Errors) Error() string {
+	switch len(e) {
+	case 0:
+		return "graphql: no error"
+	case 1:
+		return e[0].Error()
+	}
+	msgs := make([]string, len(e))
+	for i, v := range e {
+		msgs[i] = v.Error()
+	}
+	return fmt.Sprintf("%d errors: %s", len(e), strings.Join(msgs, "; "))
+}
+
+// has 判断是否包含指定message或extensions code的错误
+func (e Errors) has(message, code string) bool {
+	for _, v := range e {
+		if v.Message == message || v.Code() == code {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,160 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package graphql
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/xfali/restclient/v2"
+	"io"
+	"mime/multipart"
+	"net/textproto"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Upload 上传的文件，作为variables中的值（可以位于嵌套的map[string]interface{}及[]interface{}中）
+// 包含Upload时按GraphQL multipart request规范（https://github.com/jaydenseric/graphql-multipart-request-spec）发送
+// 同一个*Upload或文件名、类型及Reader均相同的Upload值出现多次时只上传一次
+type Upload struct {
+	// 文件名
+	Filename string
+	// 文件类型，为空时为application/octet-stream
+	ContentType string
+	Reader      io.Reader
+}
+
+// same 判断是否为同一个文件，Reader不可比较时只有指针相同才视为同一个文件
+func (u *Upload) same(o *Upload) bool {
+	if u == o {
+		return true
+	}
+	if u.Filename != o.Filename || u.ContentType != o.ContentType {
+		return false
+	}
+	if u.Reader == nil || o.Reader == nil {
+		return u.Reader == o.Reader
+	}
+	t := reflect.TypeOf(u.Reader)
+	return t == reflect.TypeOf(o.Reader) && t.Comparable() && u.Reader == o.Reader
+}
+
+type uploadFile struct {
+	upload *Upload
+	paths  []string
+}
+
+// extractUploads 复制variables，将其中的Upload替换为nil并记录路径，map按key排序以保证文件的编号稳定
+// 同一个文件（*Upload相同，或文件名、类型及Reader均相同的Upload值）出现多次时只上传一次
+func extractUploads(v interface{}, path string, files *[]*uploadFile) interface{} {
+	switch x := v.(type) {
+	case *Upload:
+		if x == nil {
+			return nil
+		}
+		for _, f := range *files {
+			if f.upload.same(x) {
+				f.paths = append(f.paths, path)
+				return nil
+			}
+		}
+		*files = append(*files, &uploadFile{upload: x, paths: []string{path}})
+		return nil
+	case Upload:
+		return extractUploads(&x, path, files)
+	case []*Upload:
+		ret := make([]interface{}, len(x))
+		for i, u := range x {
+			ret[i] = extractUploads(u, path+"."+strconv.Itoa(i), files)
+		}
+		return ret
+	case []interface{}:
+		ret := make([]interface{}, len(x))
+		for i, e := range x {
+			ret[i] = extractUploads(e, path+"."+strconv.Itoa(i), files)
+		}
+		return ret
+	case map[string]interface{}:
+		keys := make([]string, 0, len(x))
+		for k := range x {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		ret := make(map[string]interface{}, len(x))
+		for _, k := range keys {
+			ret[k] = extractUploads(x[k], path+"."+k, files)
+		}
+		return ret
+	default:
+		return v
+	}
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+// multipartBody 生成multipart请求body，依次为operations、map及文件，返回body及Content-Type
+func multipartBody(operations interface{}, files []*uploadFile) ([]byte, string, error) {
+	buf := &bytes.Buffer{}
+	w := multipart.NewWriter(buf)
+	conv := restclient.NewJsonConverter()
+
+	part, err := w.CreateFormField("operations")
+	if err != nil {
+		return nil, "", err
+	}
+	if _, err := conv.CreateEncoder(part).Encode(operations); err != nil {
+		return nil, "", err
+	}
+
+	m := make(map[string][]string, len(files))
+	for i, f := range files {
+		m[strconv.Itoa(i)] = f.paths
+	}
+	part, err = w.CreateFormField("map")
+	if err != nil {
+		return nil, "", err
+	}
+	if _, err := conv.CreateEncoder(part).Encode(m); err != nil {
+		return nil, "", err
+	}
+
+	for i, f := range files {
+		contentType := f.upload.ContentType
+		if contentType == "" {
+			contentType = restclient.MediaTypeOctetStream
+		}
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%d"; filename="%s"`,
+			i, quoteEscaper.Replace(f.upload.Filename)))
+		header.Set("Content-Type", contentType)
+		part, err := w.CreatePart(header)
+		if err != nil {
+			return nil, "", err
+		}
+		if f.upload.Reader != nil {
+			if _, err := io.Copy(part, f.upload.Reader); err != nil {
+				return nil, "", err
+			}
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), w.FormDataContentType(), nil
+}
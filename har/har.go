@@ -0,0 +1,125 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package har
+
+import "time"
+
+// HAR 1.2格式定义，见http://www.softwareishard.com/blog/har-12-spec/
+
+const (
+	Version        = "1.2"
+	CreatorName    = "restclient"
+	CreatorVersion = "2"
+)
+
+type HAR struct {
+	Log Log `json:"log"`
+}
+
+type Log struct {
+	Version string   `json:"version"`
+	Creator Creator  `json:"creator"`
+	Entries []*Entry `json:"entries"`
+	Comment string   `json:"comment,omitempty"`
+}
+
+type Creator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type Entry struct {
+	StartedDateTime time.Time `json:"startedDateTime"`
+	// 总耗时（毫秒）
+	Time            float64  `json:"time"`
+	Request         Request  `json:"request"`
+	Response        Response `json:"response"`
+	Cache           Cache    `json:"cache"`
+	Timings         Timings  `json:"timings"`
+	ServerIPAddress string   `json:"serverIPAddress,omitempty"`
+	Comment         string   `json:"comment,omitempty"`
+}
+
+type Request struct {
+	Method      string      `json:"method"`
+	URL         string      `json:"url"`
+	HTTPVersion string      `json:"httpVersion"`
+	Cookies     []Cookie    `json:"cookies"`
+	Headers     []NameValue `json:"headers"`
+	QueryString []NameValue `json:"queryString"`
+	PostData    *PostData   `json:"postData,omitempty"`
+	HeadersSize int64       `json:"headersSize"`
+	BodySize    int64       `json:"bodySize"`
+}
+
+type Response struct {
+	Status      int         `json:"status"`
+	StatusText  string      `json:"statusText"`
+	HTTPVersion string      `json:"httpVersion"`
+	Cookies     []Cookie    `json:"cookies"`
+	Headers     []NameValue `json:"headers"`
+	Content     Content     `json:"content"`
+	RedirectURL string      `json:"redirectURL"`
+	HeadersSize int64       `json:"headersSize"`
+	BodySize    int64       `json:"bodySize"`
+	// 请求失败时的错误信息，浏览器开发者工具使用的扩展字段
+	Error string `json:"_error,omitempty"`
+}
+
+type Cookie struct {
+	Name     string     `json:"name"`
+	Value    string     `json:"value"`
+	Path     string     `json:"path,omitempty"`
+	Domain   string     `json:"domain,omitempty"`
+	Expires  *time.Time `json:"expires,omitempty"`
+	HTTPOnly bool       `json:"httpOnly,omitempty"`
+	Secure   bool       `json:"secure,omitempty"`
+}
+
+type NameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type PostData struct {
+	MimeType string      `json:"mimeType"`
+	Params   []NameValue `json:"params"`
+	Text     string      `json:"text"`
+	Comment  string      `json:"comment,omitempty"`
+}
+
+type Content struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	// 二进制内容为base64
+	Encoding string `json:"encoding,omitempty"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+type Cache struct{}
+
+// Timings 各阶段耗时（毫秒），不适用时为-1
+type Timings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+	SSL     float64 `json:"ssl"`
+}
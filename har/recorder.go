@@ -0,0 +1,311 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package har
+
+import (
+	"encoding/base64"
+	"github.com/xfali/restclient/v2/buffer"
+	"github.com/xfali/restclient/v2/filter"
+	"github.com/xfali/restclient/v2/restutil"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// 默认记录的body最大长度
+	DefaultMaxBodySize = 64 * 1024
+)
+
+// Recorder HAR记录filter，记录请求及应答的header、cookie、body（超过长度限制时截断）及各阶段耗时
+// 可以在client运行时通过Enable、Disable开启或关闭，关闭时不产生额外开销
+// 注意：HAR会完整记录Authorization、Cookie等敏感信息，仅用于调试
+type Recorder struct {
+	enabled     int32
+	maxBodySize int
+
+	lock sync.RWMutex
+	sink Sink
+}
+
+type Opt func(*Recorder)
+
+// NewRecorder 创建HAR记录filter，记录的entry写入sink，默认开启
+func NewRecorder(sink Sink, opts ...Opt) *Recorder {
+	ret := &Recorder{
+		enabled:     1,
+		maxBodySize: DefaultMaxBodySize,
+		sink:        sink,
+	}
+	for _, opt := range opts {
+		opt(ret)
+	}
+	return ret
+}
+
+// OptSetMaxBodySize 配置记录的body最大长度，超过部分截断，小于等于0时不记录body
+func OptSetMaxBodySize(size int) Opt {
+	return func(r *Recorder) {
+		r.maxBodySize = size
+	}
+}
+
+// OptSetEnabled 配置初始是否开启记录
+func OptSetEnabled(enabled bool) Opt {
+	return func(r *Recorder) {
+		if enabled {
+			r.enabled = 1
+		} else {
+			r.enabled = 0
+		}
+	}
+}
+
+// Enable 开启记录
+func (r *Recorder) Enable() {
+	atomic.StoreInt32(&r.enabled, 1)
+}
+
+// Disable 关闭记录，已开始的请求仍会完成记录
+func (r *Recorder) Disable() {
+	atomic.StoreInt32(&r.enabled, 0)
+}
+
+func (r *Recorder) Enabled() bool {
+	return atomic.LoadInt32(&r.enabled) == 1
+}
+
+// SetSink 替换sink，返回旧的sink，由调用者负责关闭
+func (r *Recorder) SetSink(sink Sink) Sink {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	old := r.sink
+	r.sink = sink
+	return old
+}
+
+func (r *Recorder) write(entry *Entry) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	if r.sink != nil {
+		_ = r.sink.Write(entry)
+	}
+}
+
+func (r *Recorder) Filter(request *http.Request, fc filter.FilterChain) (*http.Response, error) {
+	if !r.Enabled() {
+		return fc.Filter(request)
+	}
+
+	timings := restutil.GetTimings(request.Context())
+	if timings == nil {
+		timings = restutil.NewTimings()
+		request = request.WithContext(restutil.WithTimings(request.Context(), timings))
+	}
+	entry := &Entry{
+		StartedDateTime: time.Now(),
+		Request:         r.buildRequest(request),
+	}
+	reqCapture := buffer.CaptureRequest(request, r.maxBodySize)
+
+	resp, err := fc.Filter(request)
+	if reqCapture != nil {
+		entry.Request.PostData, entry.Request.BodySize = postData(reqCapture, request.Header)
+	}
+	if err != nil || resp == nil {
+		if err != nil {
+			entry.Response.Error = err.Error()
+		}
+		entry.Response.Cookies = []Cookie{}
+		entry.Response.Headers = []NameValue{}
+		r.finish(entry, timings)
+		return resp, err
+	}
+
+	entry.Response = Response{
+		Status:      resp.StatusCode,
+		StatusText:  http.StatusText(resp.StatusCode),
+		HTTPVersion: resp.Proto,
+		Cookies:     convertCookies(resp.Cookies()),
+		Headers:     convertHeader(resp.Header),
+		RedirectURL: resp.Header.Get("Location"),
+		HeadersSize: -1,
+		Content: Content{
+			MimeType: resp.Header.Get(restutil.HeaderContentType),
+		},
+	}
+	if resp.Body == nil {
+		r.finish(entry, timings)
+		return resp, err
+	}
+	capture := buffer.NewCapture(r.maxBodySize)
+	resp.Body = buffer.CaptureBody(resp.Body, capture, func(error) {
+		setContent(capture, &entry.Response.Content)
+		entry.Response.BodySize = entry.Response.Content.Size
+		r.finish(entry, timings)
+	})
+	return resp, err
+}
+
+func (r *Recorder) buildRequest(request *http.Request) Request {
+	query := request.URL.Query()
+	qs := make([]NameValue, 0, len(query))
+	for k, vs := range query {
+		for _, v := range vs {
+			qs = append(qs, NameValue{Name: k, Value: v})
+		}
+	}
+	sortNameValues(qs)
+	return Request{
+		Method:      request.Method,
+		URL:         request.URL.String(),
+		HTTPVersion: request.Proto,
+		Cookies:     convertCookies(request.Cookies()),
+		Headers:     convertHeader(request.Header),
+		QueryString: qs,
+		HeadersSize: -1,
+		BodySize:    0,
+	}
+}
+
+func (r *Recorder) finish(entry *Entry, timings *restutil.Timings) {
+	timings.Finish()
+	entry.Time = millis(timings.Total)
+	entry.Timings = convertTimings(timings)
+	if host, _, err := net.SplitHostPort(timings.RemoteAddr); err == nil {
+		entry.ServerIPAddress = host
+	}
+	r.write(entry)
+}
+
+func convertTimings(t *restutil.Timings) Timings {
+	ret := Timings{
+		Blocked: millis(t.GetConn),
+		DNS:     -1,
+		Connect: -1,
+		SSL:     -1,
+		Wait:    millis(t.ServerProcessing),
+		Receive: millis(t.Transfer),
+	}
+	if !t.ConnReused {
+		if t.DNS > 0 {
+			ret.DNS = millis(t.DNS)
+		}
+		if t.Connect > 0 || t.TLSHandshake > 0 {
+			// HAR中connect包含ssl
+			ret.Connect = millis(t.Connect + t.TLSHandshake)
+		}
+		if t.TLSHandshake > 0 {
+			ret.SSL = millis(t.TLSHandshake)
+		}
+		if blocked := t.GetConn - t.DNS - t.Connect - t.TLSHandshake; blocked > 0 {
+			ret.Blocked = millis(blocked)
+		} else {
+			ret.Blocked = 0
+		}
+	}
+	if send := t.TimeToFirstByte - t.GetConn - t.ServerProcessing; send > 0 {
+		ret.Send = millis(send)
+	}
+	return ret
+}
+
+func millis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func convertHeader(header http.Header) []NameValue {
+	ret := make([]NameValue, 0, len(header))
+	for k, vs := range header {
+		for _, v := range vs {
+			ret = append(ret, NameValue{Name: k, Value: v})
+		}
+	}
+	sortNameValues(ret)
+	return ret
+}
+
+func sortNameValues(nvs []NameValue) {
+	sort.SliceStable(nvs, func(i, j int) bool {
+		return nvs[i].Name < nvs[j].Name
+	})
+}
+
+func convertCookies(cookies []*http.Cookie) []Cookie {
+	ret := make([]Cookie, 0, len(cookies))
+	for _, c := range cookies {
+		v := Cookie{
+			Name:     c.Name,
+			Value:    c.Value,
+			Path:     c.Path,
+			Domain:   c.Domain,
+			HTTPOnly: c.HttpOnly,
+			Secure:   c.Secure,
+		}
+		if !c.Expires.IsZero() {
+			expires := c.Expires
+			v.Expires = &expires
+		}
+		ret = append(ret, v)
+	}
+	return ret
+}
+
+// bodyText 获得记录的body内容，非UTF-8内容使用base64编码
+func bodyText(data []byte, size int64) (text, encoding, comment string) {
+	if size > int64(len(data)) {
+		comment = "truncated"
+	}
+	if utf8.Valid(data) {
+		return string(data), "", comment
+	}
+	// 截断时末尾可能是不完整的UTF-8字符
+	if comment != "" {
+		for i := 1; i < utf8.UTFMax && i < len(data); i++ {
+			if utf8.Valid(data[:len(data)-i]) {
+				return string(data[:len(data)-i]), "", comment
+			}
+		}
+	}
+	return base64.StdEncoding.EncodeToString(data), "base64", comment
+}
+
+func setContent(capture *buffer.Capture, content *Content) {
+	var data []byte
+	data, content.Size = capture.Snapshot()
+	content.Text, content.Encoding, content.Comment = bodyText(data, content.Size)
+}
+
+func postData(capture *buffer.Capture, header http.Header) (*PostData, int64) {
+	data, size := capture.Snapshot()
+	text, encoding, comment := bodyText(data, size)
+	if encoding != "" {
+		// postData不支持encoding，二进制内容不记录
+		text = ""
+		comment = "binary content omitted"
+	}
+	return &PostData{
+		MimeType: header.Get(restutil.HeaderContentType),
+		Params:   []NameValue{},
+		Text:     text,
+		Comment:  comment,
+	}, size
+}
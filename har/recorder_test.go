@@ -0,0 +1,182 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package har
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/xfali/restclient/v2"
+	"github.com/xfali/restclient/v2/request"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		http.SetCookie(writer, &http.Cookie{Name: "session", Value: "abc", HttpOnly: true})
+		if request.URL.Path == "/binary" {
+			writer.Header().Set("Content-Type", "application/octet-stream")
+			_, _ = writer.Write([]byte{0xff, 0xfe, 0x00, 0x01})
+			return
+		}
+		body, _ := ioutil.ReadAll(request.Body)
+		writer.Header().Set("Content-Type", "application/json")
+		_, _ = writer.Write(body)
+	}))
+}
+
+func TestRecorder(t *testing.T) {
+	server := newServer()
+	defer server.Close()
+
+	buf := &bytes.Buffer{}
+	sink := NewWriterSink(buf)
+	recorder := NewRecorder(sink, OptSetMaxBodySize(16))
+	client := restclient.New(restclient.AddIFilter(recorder))
+
+	ret := map[string]interface{}{}
+	err := client.Exchange(server.URL+"/echo?a=1&b=2",
+		request.MethodPost(),
+		request.WithRequestBody(map[string]string{"name": "test"}),
+		request.AddRequestCookies(&http.Cookie{Name: "c", Value: "1"}),
+		request.WithResult(&ret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = client.Exchange(server.URL + "/binary")
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder.Disable()
+	_ = client.Exchange(server.URL + "/binary")
+	recorder.Enable()
+	_ = client.Exchange("http://127.0.0.1:1/none")
+	_ = sink.Close()
+
+	t.Log(buf.String())
+	har := &HAR{}
+	if err := json.Unmarshal(buf.Bytes(), har); err != nil {
+		t.Fatal(err)
+	}
+	if har.Log.Version != Version || len(har.Log.Entries) != 3 {
+		t.Fatal("expect 3 entries but get ", len(har.Log.Entries))
+	}
+
+	e := har.Log.Entries[0]
+	if e.Request.Method != http.MethodPost || len(e.Request.QueryString) != 2 || e.Request.QueryString[0].Name != "a" {
+		t.Fatal(e.Request)
+	}
+	if len(e.Request.Cookies) != 1 || e.Request.Cookies[0].Name != "c" {
+		t.Fatal(e.Request.Cookies)
+	}
+	if e.Request.PostData == nil || e.Request.PostData.Text != `{"name":"test"}`+"\n" {
+		t.Fatal(e.Request.PostData)
+	}
+	if e.Response.Status != http.StatusOK || len(e.Response.Cookies) != 1 || !e.Response.Cookies[0].HTTPOnly {
+		t.Fatal(e.Response)
+	}
+	if e.Response.Content.Size != 16 || e.Response.Content.MimeType != "application/json" {
+		t.Fatal(e.Response.Content)
+	}
+	if e.Time <= 0 || e.Timings.Wait <= 0 || e.Timings.Connect < 0 || e.ServerIPAddress != "127.0.0.1" {
+		t.Fatal(e.Time, e.Timings, e.ServerIPAddress)
+	}
+
+	e = har.Log.Entries[1]
+	if e.Response.Content.Encoding != "base64" || e.Response.Content.Text != "//4AAQ==" {
+		t.Fatal(e.Response.Content)
+	}
+	// 复用连接
+	if e.Timings.Connect != -1 {
+		t.Fatal(e.Timings)
+	}
+
+	e = har.Log.Entries[2]
+	if e.Response.Error == "" || e.Response.Status != 0 {
+		t.Fatal(e.Response)
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	server := newServer()
+	defer server.Close()
+
+	buf := &bytes.Buffer{}
+	sink := NewWriterSink(buf)
+	client := restclient.New(restclient.AddIFilter(NewRecorder(sink, OptSetMaxBodySize(8))))
+	ret := ""
+	_ = client.Exchange(server.URL, request.MethodPost(), request.WithRequestBody(strings.Repeat("你", 10)), request.WithResult(&ret))
+	_ = sink.Flush()
+
+	har := &HAR{}
+	if err := json.Unmarshal(buf.Bytes(), har); err != nil {
+		t.Fatal(err)
+	}
+	content := har.Log.Entries[0].Response.Content
+	if content.Size != 30 || content.Text != "你你" || content.Comment != "truncated" {
+		t.Fatal(content)
+	}
+}
+
+func TestFileSink(t *testing.T) {
+	server := newServer()
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "har")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "traffic.har")
+	sink, err := NewFileSink(path, OptSetMaxFileSize(2048), OptSetMaxBackups(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := restclient.New(restclient.AddIFilter(NewRecorder(sink)))
+	for i := 0; i < 6; i++ {
+		ret := ""
+		_ = client.Exchange(server.URL, request.MethodPost(), request.WithRequestBody(strings.Repeat("x", 500)), request.WithResult(&ret))
+
+		// 每次写入后都是完整的HAR文档
+		data, _ := ioutil.ReadFile(path)
+		har := &HAR{}
+		if err := json.Unmarshal(data, har); err != nil {
+			t.Fatal(err, string(data))
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+	_ = sink.Close()
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.har"))
+	if len(files) != 3 {
+		t.Fatal("expect 1 file and 2 backups but get ", files)
+	}
+	for _, f := range files {
+		data, _ := ioutil.ReadFile(f)
+		har := &HAR{}
+		if err := json.Unmarshal(data, har); err != nil || len(har.Log.Entries) == 0 {
+			t.Fatal(f, err)
+		}
+	}
+}
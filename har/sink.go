@@ -0,0 +1,275 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package har
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrSinkClosed = errors.New("har: sink closed")
+)
+
+// Sink 保存记录的entry
+type Sink interface {
+	Write(entry *Entry) error
+	Close() error
+}
+
+// NewHAR 使用entries创建HAR
+func NewHAR(entries []*Entry) *HAR {
+	if entries == nil {
+		entries = []*Entry{}
+	}
+	return &HAR{
+		Log: Log{
+			Version: Version,
+			Creator: Creator{
+				Name:    CreatorName,
+				Version: CreatorVersion,
+			},
+			Entries: entries,
+		},
+	}
+}
+
+// WriterSink 将entry缓存在内存中，调用Flush或Close时作为一个完整的HAR文档写入io.Writer
+type WriterSink struct {
+	w       io.Writer
+	lock    sync.Mutex
+	entries []*Entry
+	closed  bool
+}
+
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{
+		w: w,
+	}
+}
+
+func (s *WriterSink) Write(entry *Entry) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.closed {
+		return ErrSinkClosed
+	}
+	s.entries = append(s.entries, entry)
+	return nil
+}
+
+// Flush 将已缓存的entry作为一个HAR文档写入io.Writer并清空缓存
+func (s *WriterSink) Flush() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.flush()
+}
+
+func (s *WriterSink) flush() error {
+	if len(s.entries) == 0 {
+		return nil
+	}
+	entries := s.entries
+	s.entries = nil
+	return json.NewEncoder(s.w).Encode(NewHAR(entries))
+}
+
+func (s *WriterSink) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	return s.flush()
+}
+
+const (
+	// 默认单个文件的最大大小
+	DefaultMaxFileSize = 100 * 1024 * 1024
+	// 默认保留的历史文件数量
+	DefaultMaxBackups = 5
+
+	backupTimeFormat = "20060102T150405.000"
+)
+
+var (
+	fileHeader  []byte
+	fileTrailer = []byte("]}}\n")
+)
+
+func init() {
+	header, _ := json.Marshal(NewHAR(nil))
+	// 去掉"entries":[]后的]}}
+	fileHeader = header[:len(header)-len(fileTrailer)+1]
+}
+
+// FileSink 将entry写入文件，每次写入后文件都是一个完整的HAR文档
+// 文件超过大小限制时滚动：当前文件重命名为"文件名-时间.har"，并创建新文件
+type FileSink struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	lock   sync.Mutex
+	file   *os.File
+	size   int64
+	count  int
+	closed bool
+}
+
+type FileSinkOpt func(*FileSink)
+
+// NewFileSink 创建文件sink，文件已存在时先滚动为历史文件
+func NewFileSink(path string, opts ...FileSinkOpt) (*FileSink, error) {
+	ret := &FileSink{
+		path:       path,
+		maxSize:    DefaultMaxFileSize,
+		maxBackups: DefaultMaxBackups,
+	}
+	for _, opt := range opts {
+		opt(ret)
+	}
+	if err := ret.open(); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// OptSetMaxFileSize 配置单个文件的最大大小（字节），小于等于0时不滚动
+func OptSetMaxFileSize(size int64) FileSinkOpt {
+	return func(s *FileSink) {
+		s.maxSize = size
+	}
+}
+
+// OptSetMaxBackups 配置保留的历史文件数量，小于等于0时保留全部
+func OptSetMaxBackups(n int) FileSinkOpt {
+	return func(s *FileSink) {
+		s.maxBackups = n
+	}
+}
+
+func (s *FileSink) Write(entry *Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.closed {
+		return ErrSinkClosed
+	}
+	if s.maxSize > 0 && s.count > 0 && s.size+int64(len(data))+1 > s.maxSize {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	// 覆盖文件末尾的]}}，保证写入后仍是完整的HAR文档
+	buf := make([]byte, 0, len(data)+len(fileTrailer)+1)
+	if s.count > 0 {
+		buf = append(buf, ',')
+	}
+	buf = append(buf, data...)
+	buf = append(buf, fileTrailer...)
+	offset := s.size - int64(len(fileTrailer))
+	if _, err := s.file.WriteAt(buf, offset); err != nil {
+		return err
+	}
+	s.size = offset + int64(len(buf))
+	s.count++
+	return nil
+}
+
+func (s *FileSink) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	return s.file.Close()
+}
+
+func (s *FileSink) open() error {
+	if info, err := os.Stat(s.path); err == nil && info.Size() > 0 {
+		if err := s.backup(); err != nil {
+			return err
+		}
+	}
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	buf := append(append([]byte(nil), fileHeader...), fileTrailer...)
+	if _, err := f.Write(buf); err != nil {
+		_ = f.Close()
+		return err
+	}
+	s.file = f
+	s.size = int64(len(buf))
+	s.count = 0
+	return nil
+}
+
+func (s *FileSink) rotate() error {
+	if err := s.file.Close(); err != nil {
+		return err
+	}
+	return s.open()
+}
+
+func (s *FileSink) backup() error {
+	ext := filepath.Ext(s.path)
+	prefix := strings.TrimSuffix(s.path, ext) + "-"
+	name := prefix + time.Now().Format(backupTimeFormat) + ext
+	if err := os.Rename(s.path, name); err != nil {
+		return err
+	}
+	if s.maxBackups <= 0 {
+		return nil
+	}
+	// 时间格式保证按名称排序即按时间排序
+	dir, base := filepath.Split(prefix)
+	infos, err := ioutil.ReadDir(filepath.Clean(dir + "."))
+	if err != nil {
+		return err
+	}
+	var backups []string
+	for _, info := range infos {
+		n := info.Name()
+		if len(n) == len(base)+len(backupTimeFormat)+len(ext) && strings.HasPrefix(n, base) && strings.HasSuffix(n, ext) {
+			backups = append(backups, filepath.Join(dir, n))
+		}
+	}
+	sort.Strings(backups)
+	for len(backups) > s.maxBackups {
+		_ = os.Remove(backups[0])
+		backups = backups[1:]
+	}
+	return nil
+}
@@ -0,0 +1,603 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpcache
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/xfali/restclient/v2/buffer"
+	"github.com/xfali/restclient/v2/filter"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// 缓存状态header（RFC 9211 Cache-Status）
+	HeaderCacheStatus = "Cache-Status"
+	// Cache-Status中的缓存名称
+	CacheName = "restclient"
+
+	// 默认启发式新鲜期比例
+	DefaultHeuristicFraction = 0.1
+	// 默认启发式新鲜期上限
+	DefaultHeuristicMax = 24 * time.Hour
+	// 默认可缓存的body最大长度
+	DefaultMaxBodySize = 1024 * 1024
+	// 默认后台重新验证的超时时间
+	DefaultRevalidateTimeout = 30 * time.Second
+)
+
+// Cache 遵循RFC 9111的http缓存filter
+// 1、仅缓存GET请求，按新鲜期（max-age、s-maxage、Expires或启发式）判断是否可以直接使用缓存
+// 2、支持Vary，同一url按Vary指定的请求header保存多个变体
+// 3、遵循no-store、no-cache、private（共享缓存时）、must-revalidate等指令
+// 4、缓存过期后使用If-None-Match、If-Modified-Since重新验证，304时更新缓存并返回缓存的body
+// 5、支持stale-while-revalidate（返回过期缓存并在后台重新验证）及stale-if-error（请求失败或5xx时返回过期缓存）
+// 6、非安全方法（POST、PUT、DELETE等）成功后使对应url的缓存失效
+// 应答header中的Cache-Status标记缓存的使用情况
+type Cache struct {
+	storage           Storage
+	shared            bool
+	heuristicFraction float64
+	heuristicMax      time.Duration
+	maxBodySize       int64
+	revalidateTimeout time.Duration
+	now               func() time.Time
+
+	lock         sync.Mutex
+	revalidating map[string]bool
+	// 保存时按key加锁，避免并发保存不同变体时互相覆盖
+	keyLocks map[string]*keyLock
+}
+
+type keyLock struct {
+	sync.Mutex
+	refs int
+}
+
+type Opt func(*Cache)
+
+// New 创建缓存filter，默认为私有缓存
+func New(storage Storage, opts ...Opt) *Cache {
+	ret := &Cache{
+		storage:           storage,
+		heuristicFraction: DefaultHeuristicFraction,
+		heuristicMax:      DefaultHeuristicMax,
+		maxBodySize:       DefaultMaxBodySize,
+		revalidateTimeout: DefaultRevalidateTimeout,
+		now:               time.Now,
+		revalidating:      map[string]bool{},
+		keyLocks:          map[string]*keyLock{},
+	}
+	for _, opt := range opts {
+		opt(ret)
+	}
+	return ret
+}
+
+// OptSetShared 配置是否为共享缓存，共享缓存不保存private应答，使用s-maxage，且对带Authorization的请求有额外限制
+func OptSetShared(shared bool) Opt {
+	return func(c *Cache) {
+		c.shared = shared
+	}
+}
+
+// OptSetHeuristic 配置启发式新鲜期，即Last-Modified距应答时间的比例及上限
+func OptSetHeuristic(fraction float64, max time.Duration) Opt {
+	return func(c *Cache) {
+		c.heuristicFraction = fraction
+		c.heuristicMax = max
+	}
+}
+
+// OptSetMaxBodySize 配置可缓存的body最大长度，超过时不缓存
+func OptSetMaxBodySize(size int64) Opt {
+	return func(c *Cache) {
+		c.maxBodySize = size
+	}
+}
+
+// OptSetRevalidateTimeout 配置stale-while-revalidate后台重新验证的超时时间
+func OptSetRevalidateTimeout(timeout time.Duration) Opt {
+	return func(c *Cache) {
+		c.revalidateTimeout = timeout
+	}
+}
+
+// entry 缓存的应答
+type entry struct {
+	Status       int         `json:"status"`
+	Header       http.Header `json:"header"`
+	Body         []byte      `json:"body"`
+	RequestTime  time.Time   `json:"requestTime"`
+	ResponseTime time.Time   `json:"responseTime"`
+	// Vary指定的请求header的值
+	VaryHeader http.Header `json:"varyHeader,omitempty"`
+}
+
+func (c *Cache) Filter(request *http.Request, fc filter.FilterChain) (*http.Response, error) {
+	if request.Method != http.MethodGet {
+		resp, err := fc.Filter(request)
+		if err == nil && resp != nil && isUnsafe(request.Method) && resp.StatusCode < http.StatusBadRequest {
+			c.invalidate(request, resp)
+		}
+		return resp, err
+	}
+
+	key := cacheKey(request.URL)
+	reqCC := parseCacheControl(request.Header)
+	if reqCC.has("no-store") {
+		return fc.Filter(request)
+	}
+	entries := c.load(key)
+	index := matchVary(entries, request)
+	if index == -1 {
+		if reqCC.has("only-if-cached") {
+			return gatewayTimeout(request), nil
+		}
+		return c.forward(request, fc, key, nil)
+	}
+
+	e := entries[index]
+	cc := parseCacheControl(e.Header)
+	now := c.now()
+	age := currentAge(e, now)
+	lifetime := c.freshnessLifetime(e, cc)
+	if c.fresh(request, reqCC, cc, age, lifetime) {
+		return c.response(request, e, age, fmt.Sprintf("hit; ttl=%d", int64((lifetime-age)/time.Second))), nil
+	}
+	if reqCC.has("only-if-cached") {
+		return gatewayTimeout(request), nil
+	}
+
+	// 仅已过期的缓存可以按stale-while-revalidate、stale-if-error使用，
+	// 客户端要求不使用缓存（no-cache、max-age、min-fresh）或应答要求重新验证时不使用过期缓存
+	staleness := age - lifetime
+	noStale := staleness <= 0 || c.requestNoStale(request, reqCC, age) ||
+		cc.has("must-revalidate") || cc.has("no-cache") || (c.shared && cc.has("proxy-revalidate"))
+	if !noStale && hasValidator(e) {
+		if swr, ok := cc.seconds("stale-while-revalidate"); ok && staleness <= swr {
+			c.revalidateAsync(request, fc, key)
+			return c.response(request, e, age, "hit; fwd=stale; detail=stale-while-revalidate"), nil
+		}
+	}
+	if !hasValidator(e) {
+		resp, err := c.forward(request, fc, key, nil)
+		if !noStale && c.useStaleIfError(resp, err, reqCC, cc, staleness) {
+			discard(resp)
+			return c.response(request, e, age, "hit; fwd=stale; detail=stale-if-error"), nil
+		}
+		return resp, err
+	}
+
+	resp, err := c.forward(revalidateRequest(request, e), fc, key, e)
+	if !noStale && c.useStaleIfError(resp, err, reqCC, cc, staleness) {
+		discard(resp)
+		return c.response(request, e, age, "hit; fwd=stale; detail=stale-if-error"), nil
+	}
+	return resp, err
+}
+
+// fresh 判断缓存是否可以直接使用（RFC 9111 4.2、5.2.1）
+func (c *Cache) fresh(request *http.Request, reqCC, cc cacheControl, age, lifetime time.Duration) bool {
+	if cc.has("no-cache") || requestNoCache(request, reqCC) {
+		return false
+	}
+	if maxAge, ok := reqCC.seconds("max-age"); ok && age > maxAge {
+		return false
+	}
+	if minFresh, ok := reqCC.seconds("min-fresh"); ok && lifetime-age < minFresh {
+		return false
+	}
+	if age < lifetime {
+		return true
+	}
+	// 客户端允许使用过期缓存
+	if v, ok := reqCC["max-stale"]; ok && !cc.has("must-revalidate") {
+		if v == "" {
+			return true
+		}
+		if maxStale, _ := reqCC.seconds("max-stale"); age-lifetime <= maxStale {
+			return true
+		}
+	}
+	return false
+}
+
+// requestNoStale 判断请求是否拒绝使用过期缓存（RFC 9111 5.2.1）
+func (c *Cache) requestNoStale(request *http.Request, reqCC cacheControl, age time.Duration) bool {
+	if requestNoCache(request, reqCC) || reqCC.has("min-fresh") {
+		return true
+	}
+	maxAge, ok := reqCC.seconds("max-age")
+	return ok && age > maxAge
+}
+
+// requestNoCache 判断请求是否要求不使用缓存，没有Cache-Control时兼容Pragma: no-cache（RFC 9111 5.4）
+func requestNoCache(request *http.Request, reqCC cacheControl) bool {
+	return reqCC.has("no-cache") || (!reqCC.has(HeaderCacheControl) && request.Header.Get(HeaderPragma) == "no-cache")
+}
+
+func (c *Cache) useStaleIfError(resp *http.Response, err error, reqCC, cc cacheControl, staleness time.Duration) bool {
+	if err == nil && resp != nil && resp.StatusCode < http.StatusInternalServerError {
+		return false
+	}
+	if d, ok := reqCC.seconds("stale-if-error"); ok && staleness <= d {
+		return true
+	}
+	if d, ok := cc.seconds("stale-if-error"); ok && staleness <= d {
+		return true
+	}
+	return false
+}
+
+// forward 发送请求，validated不为nil时表示重新验证的请求
+func (c *Cache) forward(request *http.Request, fc filter.FilterChain, key string, validated *entry) (*http.Response, error) {
+	requestTime := c.now()
+	resp, err := fc.Filter(request)
+	if err != nil || resp == nil {
+		return resp, err
+	}
+	responseTime := c.now()
+
+	if validated != nil && resp.StatusCode == http.StatusNotModified {
+		discard(resp)
+		// 使用304应答的header更新缓存（RFC 9111 4.3.4）
+		for k, vs := range resp.Header {
+			if k == "Content-Length" {
+				continue
+			}
+			validated.Header[k] = vs
+		}
+		validated.RequestTime = requestTime
+		validated.ResponseTime = responseTime
+		c.store(key, validated)
+		return c.response(request, validated, currentAge(validated, c.now()), "hit; fwd=stale; fwd-status=304"), nil
+	}
+
+	resp.Header.Set(HeaderCacheStatus, CacheName+"; fwd=uri-miss")
+	if !c.storable(request, resp) {
+		return resp, err
+	}
+	e := &entry{
+		Status:       resp.StatusCode,
+		Header:       resp.Header.Clone(),
+		RequestTime:  requestTime,
+		ResponseTime: responseTime,
+		VaryHeader:   varyHeader(request, resp.Header),
+	}
+	e.Header.Del(HeaderCacheStatus)
+	if resp.Body == nil {
+		c.store(key, e)
+		return resp, err
+	}
+	// body读取完成后再保存，不影响调用者流式读取
+	resp.Body = &storeBody{
+		ReadCloser: resp.Body,
+		max:        c.maxBodySize,
+		done: func(body []byte) {
+			e.Body = body
+			c.store(key, e)
+		},
+	}
+	return resp, err
+}
+
+// storable 判断应答是否可以保存（RFC 9111 3）
+func (c *Cache) storable(request *http.Request, resp *http.Response) bool {
+	if resp.StatusCode == http.StatusPartialContent || resp.StatusCode < 200 {
+		return false
+	}
+	cc := parseCacheControl(resp.Header)
+	if cc.has("no-store") || parseCacheControl(request.Header).has("no-store") {
+		return false
+	}
+	if c.shared && cc.has("private") {
+		return false
+	}
+	if c.shared && request.Header.Get(HeaderAuthorization) != "" &&
+		!cc.has("public") && !cc.has("s-maxage") && !cc.has("must-revalidate") {
+		return false
+	}
+	if strings.TrimSpace(resp.Header.Get(HeaderVary)) == "*" {
+		return false
+	}
+	if resp.ContentLength > c.maxBodySize {
+		return false
+	}
+	return heuristicStatus[resp.StatusCode] ||
+		cc.has("max-age") || cc.has("public") || resp.Header.Get(HeaderExpires) != "" ||
+		(c.shared && cc.has("s-maxage"))
+}
+
+// revalidateAsync 在后台重新验证缓存，相同的key同时只有一个请求
+// 后台请求不使用原请求的context，避免原请求结束后被取消
+func (c *Cache) revalidateAsync(request *http.Request, fc filter.FilterChain, key string) {
+	c.lock.Lock()
+	if c.revalidating[key] {
+		c.lock.Unlock()
+		return
+	}
+	c.revalidating[key] = true
+	c.lock.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.revalidateTimeout)
+	bg := request.Clone(ctx)
+	go func() {
+		defer func() {
+			cancel()
+			c.lock.Lock()
+			delete(c.revalidating, key)
+			c.lock.Unlock()
+		}()
+		entries := c.load(key)
+		index := matchVary(entries, bg)
+		if index == -1 {
+			return
+		}
+		resp, err := c.forward(revalidateRequest(bg, entries[index]), fc, key, entries[index])
+		if err == nil {
+			discard(resp)
+		}
+	}()
+}
+
+func (c *Cache) invalidate(request *http.Request, resp *http.Response) {
+	c.storage.Delete(cacheKey(request.URL))
+	for _, h := range []string{"Location", "Content-Location"} {
+		if v := resp.Header.Get(h); v != "" {
+			if u, err := request.URL.Parse(v); err == nil && u.Host == request.URL.Host {
+				c.storage.Delete(cacheKey(u))
+			}
+		}
+	}
+}
+
+func (c *Cache) load(key string) []*entry {
+	data, ok := c.storage.Get(key)
+	if !ok {
+		return nil
+	}
+	var entries []*entry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		c.storage.Delete(key)
+		return nil
+	}
+	return entries
+}
+
+func (c *Cache) save(key string, entries []*entry) {
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return
+	}
+	c.storage.Set(key, data)
+}
+
+// store 保存变体，替换Vary匹配的旧变体
+// 加锁后重新加载已保存的变体再合并，避免覆盖其他请求在此期间保存的变体
+func (c *Cache) store(key string, e *entry) {
+	unlock := c.lockKey(key)
+	defer unlock()
+
+	entries := c.load(key)
+	ret := make([]*entry, 0, len(entries)+1)
+	ret = append(ret, e)
+	for _, v := range entries {
+		if !sameVary(v, e) {
+			ret = append(ret, v)
+		}
+	}
+	c.save(key, ret)
+}
+
+// lockKey 获得key的锁，返回解锁函数，没有使用者时删除锁
+func (c *Cache) lockKey(key string) func() {
+	c.lock.Lock()
+	l, ok := c.keyLocks[key]
+	if !ok {
+		l = &keyLock{}
+		c.keyLocks[key] = l
+	}
+	l.refs++
+	c.lock.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		c.lock.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(c.keyLocks, key)
+		}
+		c.lock.Unlock()
+	}
+}
+
+func (c *Cache) response(request *http.Request, e *entry, age time.Duration, status string) *http.Response {
+	header := e.Header.Clone()
+	header.Set(HeaderAge, strconv.FormatInt(int64(age/time.Second), 10))
+	header.Set(HeaderCacheStatus, CacheName+"; "+status)
+	body := e.Body
+	if body == nil {
+		body = []byte{}
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", e.Status, http.StatusText(e.Status)),
+		StatusCode:    e.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          buffer.NewReadCloser(body),
+		ContentLength: int64(len(body)),
+		Request:       request,
+	}
+}
+
+func cacheKey(u *url.URL) string {
+	v := *u
+	v.Fragment = ""
+	return v.String()
+}
+
+func isUnsafe(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return false
+	}
+	return true
+}
+
+func hasValidator(e *entry) bool {
+	return e.Header.Get(HeaderETag) != "" || e.Header.Get(HeaderLastModified) != ""
+}
+
+func revalidateRequest(request *http.Request, e *entry) *http.Request {
+	ret := request.Clone(request.Context())
+	if etag := e.Header.Get(HeaderETag); etag != "" {
+		ret.Header.Set(HeaderIfNoneMatch, etag)
+	}
+	if lm := e.Header.Get(HeaderLastModified); lm != "" {
+		ret.Header.Set(HeaderIfModifiedSince, lm)
+	}
+	return ret
+}
+
+func varyFields(header http.Header) []string {
+	var ret []string
+	for _, line := range header.Values(HeaderVary) {
+		for _, v := range strings.Split(line, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				ret = append(ret, http.CanonicalHeaderKey(v))
+			}
+		}
+	}
+	return ret
+}
+
+func varyHeader(request *http.Request, respHeader http.Header) http.Header {
+	fields := varyFields(respHeader)
+	if len(fields) == 0 {
+		return nil
+	}
+	ret := http.Header{}
+	for _, f := range fields {
+		ret[f] = request.Header.Values(f)
+	}
+	return ret
+}
+
+// matchVary 选择Vary指定的请求header与当前请求一致的变体（RFC 9111 4.1）
+func matchVary(entries []*entry, request *http.Request) int {
+	for i, e := range entries {
+		match := true
+		for _, f := range varyFields(e.Header) {
+			if normalize(e.VaryHeader[f]) != normalize(request.Header.Values(f)) {
+				match = false
+				break
+			}
+		}
+		if match {
+			return i
+		}
+	}
+	return -1
+}
+
+func sameVary(a, b *entry) bool {
+	fa, fb := varyFields(a.Header), varyFields(b.Header)
+	if len(fa) != len(fb) {
+		return false
+	}
+	for _, f := range fa {
+		if normalize(a.VaryHeader[f]) != normalize(b.VaryHeader[f]) {
+			return false
+		}
+	}
+	return true
+}
+
+func normalize(values []string) string {
+	parts := make([]string, 0, len(values))
+	for _, v := range values {
+		for _, p := range strings.Split(v, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				parts = append(parts, p)
+			}
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+func gatewayTimeout(request *http.Request) *http.Response {
+	header := http.Header{}
+	header.Set(HeaderCacheStatus, CacheName+"; fwd=miss; detail=only-if-cached")
+	return &http.Response{
+		Status:     fmt.Sprintf("%d %s", http.StatusGatewayTimeout, http.StatusText(http.StatusGatewayTimeout)),
+		StatusCode: http.StatusGatewayTimeout,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     header,
+		Body:       http.NoBody,
+		Request:    request,
+	}
+}
+
+func discard(resp *http.Response) {
+	if resp != nil && resp.Body != nil {
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}
+}
+
+// storeBody 读取body的同时保存数据，读取完成（EOF）时回调，未读取完成或超过长度限制时不保存
+type storeBody struct {
+	io.ReadCloser
+	max  int64
+	buf  bytes.Buffer
+	over bool
+	once sync.Once
+	done func(body []byte)
+}
+
+func (b *storeBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if !b.over {
+		if int64(b.buf.Len()+n) > b.max {
+			b.over = true
+			b.buf = bytes.Buffer{}
+		} else {
+			b.buf.Write(p[:n])
+		}
+	}
+	if err == io.EOF && !b.over {
+		b.once.Do(func() {
+			b.done(b.buf.Bytes())
+		})
+	}
+	return n, err
+}
@@ -0,0 +1,339 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpcache
+
+import (
+	"fmt"
+	"github.com/xfali/restclient/v2"
+	"github.com/xfali/restclient/v2/request"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type clock struct {
+	lock sync.Mutex
+	now  time.Time
+}
+
+func (c *clock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.now
+}
+
+func (c *clock) Add(d time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func newCache(storage Storage, opts ...Opt) (*Cache, *clock) {
+	clk := &clock{now: time.Now().Truncate(time.Second)}
+	c := New(storage, opts...)
+	c.now = clk.Now
+	return c, clk
+}
+
+func get(t *testing.T, client restclient.RestClient, url string, opts ...request.Opt) (int, *http.Response) {
+	ret := map[string]int{}
+	resp := &http.Response{}
+	opts = append(opts, request.WithResult(&ret), request.WithResponse(resp, false))
+	if err := client.Exchange(url, opts...); err != nil {
+		t.Fatal(err)
+	}
+	return ret["n"], resp
+}
+
+func TestCache(t *testing.T) {
+	var count int32
+	var clk *clock
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		n := atomic.AddInt32(&count, 1)
+		writer.Header().Set("Content-Type", "application/json")
+		writer.Header().Set(HeaderDate, clk.Now().UTC().Format(http.TimeFormat))
+		switch request.URL.Path {
+		case "/fresh":
+			writer.Header().Set(HeaderCacheControl, "max-age=60")
+		case "/etag":
+			writer.Header().Set(HeaderCacheControl, "no-cache")
+			writer.Header().Set(HeaderETag, `"v1"`)
+			if request.Header.Get(HeaderIfNoneMatch) == `"v1"` {
+				writer.WriteHeader(http.StatusNotModified)
+				return
+			}
+		case "/vary":
+			writer.Header().Set(HeaderCacheControl, "max-age=60")
+			writer.Header().Set(HeaderVary, "Accept-Language")
+		case "/nostore":
+			writer.Header().Set(HeaderCacheControl, "no-store")
+		}
+		_, _ = fmt.Fprintf(writer, `{"n":%d}`, n)
+	}))
+	defer server.Close()
+
+	var cache *Cache
+	cache, clk = newCache(NewMemoryStorage(0))
+	client := restclient.New(restclient.AddIFilter(cache))
+
+	t.Run("fresh", func(t *testing.T) {
+		n1, resp := get(t, client, server.URL+"/fresh")
+		if !strings.Contains(resp.Header.Get(HeaderCacheStatus), "fwd=uri-miss") {
+			t.Fatal(resp.Header)
+		}
+		clk.Add(30 * time.Second)
+		n2, resp := get(t, client, server.URL+"/fresh")
+		if n1 != n2 || resp.Header.Get(HeaderAge) != "30" || !strings.Contains(resp.Header.Get(HeaderCacheStatus), "hit") {
+			t.Fatal(n1, n2, resp.Header)
+		}
+		// 客户端要求不使用缓存
+		n3, _ := get(t, client, server.URL+"/fresh", request.AddRequestHeader(HeaderCacheControl, "no-cache"))
+		if n3 == n2 {
+			t.Fatal("expect request sent")
+		}
+		clk.Add(61 * time.Second)
+		n4, _ := get(t, client, server.URL+"/fresh")
+		if n4 == n3 {
+			t.Fatal("expect stale")
+		}
+	})
+
+	t.Run("etag", func(t *testing.T) {
+		n1, _ := get(t, client, server.URL+"/etag")
+		before := atomic.LoadInt32(&count)
+		n2, resp := get(t, client, server.URL+"/etag")
+		if n1 != n2 || atomic.LoadInt32(&count) != before+1 ||
+			!strings.Contains(resp.Header.Get(HeaderCacheStatus), "fwd-status=304") {
+			t.Fatal(n1, n2, resp.Header)
+		}
+	})
+
+	t.Run("vary", func(t *testing.T) {
+		zh, _ := get(t, client, server.URL+"/vary", request.AddRequestHeader("Accept-Language", "zh"))
+		en, _ := get(t, client, server.URL+"/vary", request.AddRequestHeader("Accept-Language", "en"))
+		zh2, _ := get(t, client, server.URL+"/vary", request.AddRequestHeader("Accept-Language", "zh"))
+		en2, _ := get(t, client, server.URL+"/vary", request.AddRequestHeader("Accept-Language", "en"))
+		if zh == en || zh != zh2 || en != en2 {
+			t.Fatal(zh, en, zh2, en2)
+		}
+	})
+
+	t.Run("no-store", func(t *testing.T) {
+		n1, _ := get(t, client, server.URL+"/nostore")
+		n2, _ := get(t, client, server.URL+"/nostore")
+		if n1 == n2 {
+			t.Fatal("expect not cached")
+		}
+		err := client.Exchange(server.URL+"/nostore", request.AddRequestHeader(HeaderCacheControl, "only-if-cached"))
+		if e, ok := err.(restclient.Error); !ok || e.StatusCode() != http.StatusGatewayTimeout {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("invalidate", func(t *testing.T) {
+		n1, _ := get(t, client, server.URL+"/fresh")
+		if err := client.Exchange(server.URL+"/fresh", request.MethodPost()); err != nil {
+			t.Fatal(err)
+		}
+		n2, _ := get(t, client, server.URL+"/fresh")
+		if n1 == n2 {
+			t.Fatal("expect invalidated")
+		}
+	})
+}
+
+func TestStale(t *testing.T) {
+	var count int32
+	var fail int32
+	var clk *clock
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if atomic.LoadInt32(&fail) == 1 {
+			writer.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		n := atomic.AddInt32(&count, 1)
+		writer.Header().Set("Content-Type", "application/json")
+		writer.Header().Set(HeaderDate, clk.Now().UTC().Format(http.TimeFormat))
+		writer.Header().Set(HeaderETag, fmt.Sprintf(`"%d"`, n))
+		writer.Header().Set(HeaderCacheControl, "max-age=10, stale-while-revalidate=30, stale-if-error=60")
+		_, _ = fmt.Fprintf(writer, `{"n":%d}`, n)
+	}))
+	defer server.Close()
+
+	var cache *Cache
+	cache, clk = newCache(NewMemoryStorage(0))
+	client := restclient.New(restclient.AddIFilter(cache))
+
+	n1, _ := get(t, client, server.URL)
+	clk.Add(20 * time.Second)
+	n2, resp := get(t, client, server.URL)
+	if n1 != n2 || !strings.Contains(resp.Header.Get(HeaderCacheStatus), "stale-while-revalidate") {
+		t.Fatal(n1, n2, resp.Header)
+	}
+	// 等待后台重新验证完成
+	for i := 0; i < 100 && atomic.LoadInt32(&count) < 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	for i := 0; i < 100; i++ {
+		cache.lock.Lock()
+		done := len(cache.revalidating) == 0
+		cache.lock.Unlock()
+		if done {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	n3, _ := get(t, client, server.URL)
+	if n3 != 2 {
+		t.Fatal("expect revalidated ", n3)
+	}
+
+	atomic.StoreInt32(&fail, 1)
+	clk.Add(50 * time.Second)
+	n4, resp := get(t, client, server.URL)
+	if n4 != n3 || !strings.Contains(resp.Header.Get(HeaderCacheStatus), "stale-if-error") {
+		t.Fatal(n4, resp.Header)
+	}
+}
+
+func TestStaleRequestNoCache(t *testing.T) {
+	var count int32
+	var fail int32
+	var clk *clock
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if atomic.LoadInt32(&fail) == 1 {
+			writer.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		n := atomic.AddInt32(&count, 1)
+		writer.Header().Set("Content-Type", "application/json")
+		writer.Header().Set(HeaderDate, clk.Now().UTC().Format(http.TimeFormat))
+		writer.Header().Set(HeaderETag, fmt.Sprintf(`"%d"`, n))
+		writer.Header().Set(HeaderCacheControl, "max-age=10, stale-while-revalidate=30, stale-if-error=60")
+		_, _ = fmt.Fprintf(writer, `{"n":%d}`, n)
+	}))
+	defer server.Close()
+
+	var cache *Cache
+	cache, clk = newCache(NewMemoryStorage(0))
+	client := restclient.New(restclient.AddIFilter(cache))
+
+	n1, _ := get(t, client, server.URL)
+	// 新鲜的缓存：客户端要求不使用缓存时必须发送请求，而不是按stale-while-revalidate返回
+	for _, h := range [][]string{{HeaderCacheControl, "no-cache"}, {HeaderCacheControl, "max-age=0"},
+		{HeaderCacheControl, "min-fresh=20"}, {HeaderPragma, "no-cache"}} {
+		clk.Add(time.Second)
+		before := atomic.LoadInt32(&count)
+		n, resp := get(t, client, server.URL, request.AddRequestHeader(h[0], h[1]))
+		if n == n1 || atomic.LoadInt32(&count) != before+1 || strings.Contains(resp.Header.Get(HeaderCacheStatus), "stale") {
+			t.Fatal(h, n, resp.Header)
+		}
+		n1 = n
+	}
+
+	// 过期的缓存：客户端要求不使用缓存时不返回过期缓存
+	clk.Add(20 * time.Second)
+	before := atomic.LoadInt32(&count)
+	n2, resp := get(t, client, server.URL, request.AddRequestHeader(HeaderCacheControl, "no-cache"))
+	if n2 == n1 || atomic.LoadInt32(&count) != before+1 || strings.Contains(resp.Header.Get(HeaderCacheStatus), "stale") {
+		t.Fatal(n2, resp.Header)
+	}
+	atomic.StoreInt32(&fail, 1)
+	clk.Add(20 * time.Second)
+	err := client.Exchange(server.URL, request.AddRequestHeader(HeaderCacheControl, "no-cache"))
+	if e, ok := err.(restclient.Error); !ok || e.StatusCode() != http.StatusServiceUnavailable {
+		t.Fatal("expect stale-if-error not used but get ", err)
+	}
+}
+
+func TestConcurrentVary(t *testing.T) {
+	const n = 8
+	var count int32
+	arrived := sync.WaitGroup{}
+	arrived.Add(n)
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		v := atomic.AddInt32(&count, 1)
+		if v <= n {
+			// 所有变体的请求都在保存之前发出
+			arrived.Done()
+			arrived.Wait()
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		writer.Header().Set(HeaderCacheControl, "max-age=60")
+		writer.Header().Set(HeaderVary, "X-Variant")
+		_, _ = fmt.Fprintf(writer, `{"n":%d}`, v)
+	}))
+	defer server.Close()
+
+	cache, _ := newCache(NewMemoryStorage(0))
+	client := restclient.New(restclient.AddIFilter(cache))
+	wg := sync.WaitGroup{}
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ret := map[string]int{}
+			_ = client.Exchange(server.URL, request.WithResult(&ret), request.AddRequestHeader("X-Variant", strconv.Itoa(i)))
+		}(i)
+	}
+	wg.Wait()
+	for i := 0; i < n; i++ {
+		_, resp := get(t, client, server.URL, request.AddRequestHeader("X-Variant", strconv.Itoa(i)))
+		if !strings.HasPrefix(resp.Header.Get(HeaderCacheStatus), CacheName+"; hit") {
+			t.Fatal("expect variant cached ", i, resp.Header)
+		}
+	}
+}
+
+func TestStorage(t *testing.T) {
+	memory := NewMemoryStorage(10)
+	memory.Set("a", []byte("12345"))
+	memory.Set("b", []byte("12345"))
+	memory.Get("a")
+	memory.Set("c", []byte("1"))
+	if _, ok := memory.Get("b"); ok {
+		t.Fatal("expect b evicted")
+	}
+	if _, ok := memory.Get("a"); !ok || memory.Size() != 6 {
+		t.Fatal("expect a exists ", memory.Size())
+	}
+
+	dir, err := ioutil.TempDir("", "httpcache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	disk, err := NewDiskStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	disk.Set("http://localhost/a?b=1", []byte("value"))
+	if v, ok := disk.Get("http://localhost/a?b=1"); !ok || string(v) != "value" {
+		t.Fatal(string(v))
+	}
+	disk.Delete("http://localhost/a?b=1")
+	if _, ok := disk.Get("http://localhost/a?b=1"); ok {
+		t.Fatal("expect deleted")
+	}
+}
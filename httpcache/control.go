@@ -0,0 +1,177 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpcache
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	HeaderCacheControl    = "Cache-Control"
+	HeaderPragma          = "Pragma"
+	HeaderAge             = "Age"
+	HeaderDate            = "Date"
+	HeaderExpires         = "Expires"
+	HeaderETag            = "ETag"
+	HeaderLastModified    = "Last-Modified"
+	HeaderVary            = "Vary"
+	HeaderIfNoneMatch     = "If-None-Match"
+	HeaderIfModifiedSince = "If-Modified-Since"
+	HeaderAuthorization   = "Authorization"
+)
+
+// cacheControl Cache-Control指令，key为小写的指令名
+type cacheControl map[string]string
+
+func parseCacheControl(header http.Header) cacheControl {
+	ret := cacheControl{}
+	for _, line := range header.Values(HeaderCacheControl) {
+		for _, part := range strings.Split(line, ",") {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+			name, value := part, ""
+			if i := strings.Index(part, "="); i != -1 {
+				name, value = strings.TrimSpace(part[:i]), strings.TrimSpace(part[i+1:])
+				value = strings.Trim(value, `"`)
+			}
+			name = strings.ToLower(name)
+			// 重复的指令以第一个为准
+			if _, ok := ret[name]; !ok {
+				ret[name] = value
+			}
+		}
+	}
+	return ret
+}
+
+func (cc cacheControl) has(name string) bool {
+	_, ok := cc[name]
+	return ok
+}
+
+// seconds 获得指令的秒数，不存在时返回false，无效值视为0
+func (cc cacheControl) seconds(name string) (time.Duration, bool) {
+	v, ok := cc[name]
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		// 无效值按RFC 9111视为0（过期）
+		return 0, true
+	}
+	return time.Duration(n) * time.Second, true
+}
+
+// heuristicStatus 允许启发式缓存的状态码（不包括206）
+var heuristicStatus = map[int]bool{
+	http.StatusOK:                   true,
+	http.StatusNonAuthoritativeInfo: true,
+	http.StatusNoContent:            true,
+	http.StatusMultipleChoices:      true,
+	http.StatusMovedPermanently:     true,
+	http.StatusPermanentRedirect:    true,
+	http.StatusNotFound:             true,
+	http.StatusMethodNotAllowed:     true,
+	http.StatusGone:                 true,
+	http.StatusRequestURITooLong:    true,
+	http.StatusNotImplemented:       true,
+}
+
+func parseHttpTime(header http.Header, name string) (time.Time, bool) {
+	v := header.Get(name)
+	if v == "" {
+		return time.Time{}, false
+	}
+	t, err := http.ParseTime(v)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// freshnessLifetime 计算应答的新鲜期（RFC 9111 4.2.1）
+func (c *Cache) freshnessLifetime(e *entry, cc cacheControl) time.Duration {
+	if c.shared {
+		if d, ok := cc.seconds("s-maxage"); ok {
+			return d
+		}
+	}
+	if d, ok := cc.seconds("max-age"); ok {
+		return d
+	}
+	if v := e.Header.Get(HeaderExpires); v != "" {
+		expires, err := http.ParseTime(v)
+		if err != nil {
+			// 无效的Expires视为已过期
+			return 0
+		}
+		date, ok := parseHttpTime(e.Header, HeaderDate)
+		if !ok {
+			date = e.ResponseTime
+		}
+		if d := expires.Sub(date); d > 0 {
+			return d
+		}
+		return 0
+	}
+	// 启发式新鲜期（RFC 9111 4.2.2）：Last-Modified距今时间的一定比例
+	if heuristicStatus[e.Status] || cc.has("public") {
+		if lm, ok := parseHttpTime(e.Header, HeaderLastModified); ok {
+			date, ok := parseHttpTime(e.Header, HeaderDate)
+			if !ok {
+				date = e.ResponseTime
+			}
+			if d := date.Sub(lm); d > 0 {
+				d = time.Duration(float64(d) * c.heuristicFraction)
+				if c.heuristicMax > 0 && d > c.heuristicMax {
+					d = c.heuristicMax
+				}
+				return d
+			}
+		}
+	}
+	return 0
+}
+
+// currentAge 计算应答的当前年龄（RFC 9111 4.2.3）
+func currentAge(e *entry, now time.Time) time.Duration {
+	var apparentAge time.Duration
+	if date, ok := parseHttpTime(e.Header, HeaderDate); ok {
+		if d := e.ResponseTime.Sub(date); d > 0 {
+			apparentAge = d
+		}
+	}
+	var ageValue time.Duration
+	if v := e.Header.Get(HeaderAge); v != "" {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil && n > 0 {
+			ageValue = time.Duration(n) * time.Second
+		}
+	}
+	responseDelay := e.ResponseTime.Sub(e.RequestTime)
+	correctedAge := ageValue + responseDelay
+	initialAge := apparentAge
+	if correctedAge > initialAge {
+		initialAge = correctedAge
+	}
+	return initialAge + now.Sub(e.ResponseTime)
+}
@@ -0,0 +1,176 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpcache
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Storage 缓存存储，value为序列化后的缓存数据
+type Storage interface {
+	// 获得缓存数据，不存在时返回false
+	Get(key string) ([]byte, bool)
+
+	// 保存缓存数据
+	Set(key string, value []byte)
+
+	// 删除缓存数据
+	Delete(key string)
+}
+
+const (
+	// 默认内存缓存的最大容量
+	DefaultMemoryStorageSize = 64 * 1024 * 1024
+)
+
+// MemoryStorage 基于LRU的内存存储，容量按数据大小计算
+type MemoryStorage struct {
+	maxSize int64
+
+	lock  sync.Mutex
+	size  int64
+	list  *list.List
+	items map[string]*list.Element
+}
+
+type memoryItem struct {
+	key   string
+	value []byte
+}
+
+// NewMemoryStorage 创建内存存储，maxSize为最大容量（字节），小于等于0时使用默认值
+func NewMemoryStorage(maxSize int64) *MemoryStorage {
+	if maxSize <= 0 {
+		maxSize = DefaultMemoryStorageSize
+	}
+	return &MemoryStorage{
+		maxSize: maxSize,
+		list:    list.New(),
+		items:   map[string]*list.Element{},
+	}
+}
+
+func (s *MemoryStorage) Get(key string) ([]byte, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if e, ok := s.items[key]; ok {
+		s.list.MoveToFront(e)
+		return e.Value.(*memoryItem).value, true
+	}
+	return nil, false
+}
+
+func (s *MemoryStorage) Set(key string, value []byte) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if int64(len(value)) > s.maxSize {
+		s.remove(key)
+		return
+	}
+	if e, ok := s.items[key]; ok {
+		item := e.Value.(*memoryItem)
+		s.size += int64(len(value) - len(item.value))
+		item.value = value
+		s.list.MoveToFront(e)
+	} else {
+		s.items[key] = s.list.PushFront(&memoryItem{key: key, value: value})
+		s.size += int64(len(value))
+	}
+	for s.size > s.maxSize {
+		if back := s.list.Back(); back != nil {
+			s.remove(back.Value.(*memoryItem).key)
+		}
+	}
+}
+
+func (s *MemoryStorage) Delete(key string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.remove(key)
+}
+
+func (s *MemoryStorage) remove(key string) {
+	if e, ok := s.items[key]; ok {
+		s.list.Remove(e)
+		delete(s.items, key)
+		s.size -= int64(len(e.Value.(*memoryItem).value))
+	}
+}
+
+// Size 获得已使用的容量（字节）
+func (s *MemoryStorage) Size() int64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.size
+}
+
+// DiskStorage 基于文件的存储，每个key对应目录下的一个文件，文件名为key的sha256
+type DiskStorage struct {
+	dir string
+}
+
+// NewDiskStorage 创建文件存储，目录不存在时自动创建
+func NewDiskStorage(dir string) (*DiskStorage, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &DiskStorage{
+		dir: dir,
+	}, nil
+}
+
+func (s *DiskStorage) Get(key string) ([]byte, bool) {
+	data, err := ioutil.ReadFile(s.path(key))
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+func (s *DiskStorage) Set(key string, value []byte) {
+	// 先写入临时文件再重命名，避免读取到不完整的数据
+	f, err := ioutil.TempFile(s.dir, ".tmp-*")
+	if err != nil {
+		return
+	}
+	_, err = f.Write(value)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return
+	}
+	if err := os.Rename(f.Name(), s.path(key)); err != nil {
+		_ = os.Remove(f.Name())
+	}
+}
+
+func (s *DiskStorage) Delete(key string) {
+	_ = os.Remove(s.path(key))
+}
+
+func (s *DiskStorage) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:]))
+}
@@ -23,10 +23,59 @@ import (
 	"time"
 )
 
-// SetTimeout 设置读写超时
+// SetTimeout 设置读写超时，即请求的默认总超时时间，可通过request.WithTimeout覆盖
+// 总超时覆盖一次Exchange的全部过程，包括filter中的重试，而不是每次发送
 func SetTimeout(timeout time.Duration) func(client *defaultRestClient) {
 	return func(client *defaultRestClient) {
-		client.timeout = timeout
+		client.timeouts.total = timeout
+	}
+}
+
+// SetConnectTimeout 设置获得连接的默认超时时间，可通过request.WithConnectTimeout覆盖
+func SetConnectTimeout(timeout time.Duration) func(client *defaultRestClient) {
+	return func(client *defaultRestClient) {
+		client.timeouts.connect = timeout
+	}
+}
+
+// SetFirstByteTimeout 设置等待应答第一个字节的默认超时时间，可通过request.WithFirstByteTimeout覆盖
+func SetFirstByteTimeout(timeout time.Duration) func(client *defaultRestClient) {
+	return func(client *defaultRestClient) {
+		client.timeouts.firstByte = timeout
+	}
+}
+
+// SetBodyReadTimeout 设置读取应答body的默认超时时间，可通过request.WithBodyReadTimeout覆盖
+func SetBodyReadTimeout(timeout time.Duration) func(client *defaultRestClient) {
+	return func(client *defaultRestClient) {
+		client.timeouts.bodyRead = timeout
+	}
+}
+
+// EnableTimings 开启请求耗时统计，为每个请求附加httptrace.ClientTrace记录DNS、建立连接、TLS握手、首字节及传输等耗时
+// 可通过restutil.GetTimings(request.Context())（filter中或response.Request）及GetTimings(err)获得
+func EnableTimings() func(client *defaultRestClient) {
+	return func(client *defaultRestClient) {
+		client.timings = true
+	}
+}
+
+// SetBaseUrl 配置基础地址，Exchange的url不包含scheme（如"/users/1"）时拼接到基础地址之后
+func SetBaseUrl(baseUrl string) func(client *defaultRestClient) {
+	return func(client *defaultRestClient) {
+		client.baseUrl = baseUrl
+	}
+}
+
+// SetDefaultHeader 配置所有请求的默认header，请求中已配置的header不会被覆盖
+func SetDefaultHeader(header http.Header) func(client *defaultRestClient) {
+	return func(client *defaultRestClient) {
+		client.header = make(http.Header, len(header))
+		for k, vs := range header {
+			for _, v := range vs {
+				client.header.Add(k, v)
+			}
+		}
 	}
 }
 
@@ -103,3 +152,25 @@ func AddIFilter(filters ...filter.IFilter) func(client *defaultRestClient) {
 		}
 	}
 }
+
+// AddNamedFilter 增加命名filter，可配置优先级及顺序约束，命名filter可在请求中通过request.DisableFilters禁用
+// 名称重复或顺序约束存在循环时panic
+func AddNamedFilter(name string, f filter.Filter, opts ...filter.FilterOpt) func(client *defaultRestClient) {
+	return func(client *defaultRestClient) {
+		if err := client.filterManager.AddNamed(name, f, opts...); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// AddNamedIFilter 增加命名filter，同AddNamedFilter
+func AddNamedIFilter(name string, f filter.IFilter, opts ...filter.FilterOpt) func(client *defaultRestClient) {
+	return AddNamedFilter(name, f.Filter, opts...)
+}
+
+// RemoveFilter 移除已添加的命名filter
+func RemoveFilter(name string) func(client *defaultRestClient) {
+	return func(client *defaultRestClient) {
+		client.filterManager.Remove(name)
+	}
+}
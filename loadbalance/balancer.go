@@ -0,0 +1,536 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package loadbalance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/xfali/restclient/v2/filter"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// 默认连续失败多少次后摘除endpoint
+	DefaultMaxFailures = 5
+	// 默认摘除时间
+	DefaultEjectDuration = 30 * time.Second
+	// 默认未发现服务的host的缓存时间
+	DefaultNegativeTTL = 30 * time.Second
+)
+
+var ErrNoEndpoint = errors.New("loadbalance: no endpoint available")
+
+// Target endpoint配置
+type Target struct {
+	// 地址，如：http://10.0.0.1:8080、10.0.0.1:8080、https://10.0.0.1/prefix
+	// 不带scheme时沿用请求的scheme
+	Address string `json:"address" yaml:"address"`
+	// 权重，仅Weighted策略使用，小于等于0时视为1
+	Weight int `json:"weight,omitempty" yaml:"weight,omitempty"`
+}
+
+// Targets 使用默认权重创建Target列表
+func Targets(addrs ...string) []Target {
+	ret := make([]Target, len(addrs))
+	for i, v := range addrs {
+		ret[i].Address = v
+	}
+	return ret
+}
+
+// Endpoint 服务实例及其运行状态
+type Endpoint struct {
+	address string
+	weight  int
+	url     *url.URL
+
+	inFlight int64
+	requests int64
+	failures int64
+
+	lock        sync.Mutex
+	consecutive int
+	ejectUntil  time.Time
+}
+
+func newEndpoint(target Target) (*Endpoint, error) {
+	addr := strings.TrimSpace(target.Address)
+	if addr == "" {
+		return nil, errors.New("loadbalance: endpoint address is empty")
+	}
+	raw := addr
+	if !strings.Contains(raw, "://") {
+		raw = "//" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("loadbalance: endpoint %s missing host", addr)
+	}
+	weight := target.Weight
+	if weight <= 0 {
+		weight = 1
+	}
+	return &Endpoint{
+		address: addr,
+		weight:  weight,
+		url:     u,
+	}, nil
+}
+
+// Address 获得endpoint地址
+func (ep *Endpoint) Address() string {
+	return ep.address
+}
+
+// Weight 获得endpoint权重
+func (ep *Endpoint) Weight() int {
+	return ep.weight
+}
+
+// InFlight 获得进行中的请求数
+func (ep *Endpoint) InFlight() int64 {
+	return atomic.LoadInt64(&ep.inFlight)
+}
+
+// Requests 获得请求总数
+func (ep *Endpoint) Requests() int64 {
+	return atomic.LoadInt64(&ep.requests)
+}
+
+// Failures 获得失败请求总数
+func (ep *Endpoint) Failures() int64 {
+	return atomic.LoadInt64(&ep.failures)
+}
+
+// Ejected 是否因连续失败被摘除
+func (ep *Endpoint) Ejected() bool {
+	ep.lock.Lock()
+	defer ep.lock.Unlock()
+	return time.Now().Before(ep.ejectUntil)
+}
+
+func (ep *Endpoint) rewrite(u *url.URL) {
+	if ep.url.Scheme != "" {
+		u.Scheme = ep.url.Scheme
+	}
+	u.Host = ep.url.Host
+	if prefix := strings.TrimSuffix(ep.url.Path, "/"); prefix != "" {
+		u.Path = prefix + u.Path
+		if u.RawPath != "" {
+			u.RawPath = strings.TrimSuffix(ep.url.EscapedPath(), "/") + u.RawPath
+		}
+	}
+}
+
+func (ep *Endpoint) done(failed bool, maxFailures int, ejectDuration time.Duration) {
+	atomic.AddInt64(&ep.inFlight, -1)
+	if failed {
+		atomic.AddInt64(&ep.failures, 1)
+	}
+
+	ep.lock.Lock()
+	defer ep.lock.Unlock()
+	if !failed {
+		ep.consecutive = 0
+		return
+	}
+	ep.consecutive++
+	if maxFailures > 0 && ep.consecutive >= maxFailures {
+		ep.ejectUntil = time.Now().Add(ejectDuration)
+		ep.consecutive = 0
+	}
+}
+
+type service struct {
+	policy    Policy
+	endpoints []*Endpoint
+}
+
+// PolicyFactory 为服务发现得到的逻辑服务创建负载均衡策略
+type PolicyFactory func(service string) Policy
+
+// FailureFunc 判断请求是否失败，用于被动健康检查
+type FailureFunc func(resp *http.Response, err error) bool
+
+// Balancer 客户端负载均衡器
+// 为逻辑服务名注册多个endpoint，请求http://服务名/...时根据策略选择endpoint并改写请求地址
+// endpoint连续失败达到阈值后会被摘除一段时间（被动健康检查）
+type Balancer struct {
+	maxFailures   int
+	ejectDuration time.Duration
+	isFailure     FailureFunc
+	resolver      Resolver
+	newPolicy     PolicyFactory
+
+	services map[string]*service
+	watches  map[string]func()
+	lock     sync.RWMutex
+
+	// 未发现服务的host缓存时间
+	negativeTTL time.Duration
+	// 保护discovering及notFound
+	discoverLock sync.Mutex
+	// 正在进行的自动发现，同一服务名只查询一次，其余请求等待结果
+	discovering map[string]*discoveryCall
+	// 未发现服务的host及缓存过期时间
+	notFound map[string]time.Time
+}
+
+type discoveryCall struct {
+	done chan struct{}
+	err  error
+}
+
+type Opt func(*Balancer)
+
+// New 创建负载均衡器，通过Filter方法注册到restclient
+func New(opts ...Opt) *Balancer {
+	ret := &Balancer{
+		maxFailures:   DefaultMaxFailures,
+		ejectDuration: DefaultEjectDuration,
+		isFailure:     DefaultFailure,
+		negativeTTL:   DefaultNegativeTTL,
+		services:      map[string]*service{},
+		watches:       map[string]func(){},
+		discovering:   map[string]*discoveryCall{},
+		notFound:      map[string]time.Time{},
+	}
+	for _, opt := range opts {
+		opt(ret)
+	}
+	return ret
+}
+
+// OptSetMaxFailures 配置连续失败多少次后摘除endpoint，小于等于0则不摘除
+func OptSetMaxFailures(n int) Opt {
+	return func(b *Balancer) {
+		b.maxFailures = n
+	}
+}
+
+// OptSetEjectDuration 配置endpoint摘除时间
+func OptSetEjectDuration(d time.Duration) Opt {
+	return func(b *Balancer) {
+		b.ejectDuration = d
+	}
+}
+
+// OptSetFailureFunc 配置请求失败的判断方法，默认为DefaultFailure
+func OptSetFailureFunc(f FailureFunc) Opt {
+	return func(b *Balancer) {
+		b.isFailure = f
+	}
+}
+
+// OptSetResolver 配置服务发现，请求未注册的host时查询resolver，查询到则自动注册并监听变化
+// resolver返回ErrServiceNotFound的host在OptSetNegativeTTL配置的时间内不再查询
+// newPolicy：为发现的服务创建负载均衡策略，为nil时使用RoundRobin
+func OptSetResolver(resolver Resolver, newPolicy PolicyFactory) Opt {
+	return func(b *Balancer) {
+		b.resolver = resolver
+		b.newPolicy = newPolicy
+	}
+}
+
+// OptSetNegativeTTL 配置resolver未发现服务（ErrServiceNotFound）的host的缓存时间，默认为DefaultNegativeTTL，
+// 小于等于0则不缓存
+func OptSetNegativeTTL(ttl time.Duration) Opt {
+	return func(b *Balancer) {
+		b.negativeTTL = ttl
+	}
+}
+
+// DefaultFailure 请求错误或http status 500及以上视为失败
+func DefaultFailure(resp *http.Response, err error) bool {
+	return err != nil || resp == nil || resp.StatusCode >= http.StatusInternalServerError
+}
+
+// Register 注册逻辑服务，已存在则替换
+// name：逻辑服务名，即请求url中的host
+// policy：负载均衡策略，为nil时使用RoundRobin
+func (b *Balancer) Register(name string, policy Policy, targets ...Target) error {
+	if policy == nil {
+		policy = RoundRobin()
+	}
+	svc := &service{
+		policy: policy,
+	}
+	name = strings.ToLower(name)
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	var old []*Endpoint
+	if v, ok := b.services[name]; ok {
+		old = v.endpoints
+	}
+	eps, err := mergeEndpoints(old, targets)
+	if err != nil {
+		return err
+	}
+	svc.endpoints = eps
+	b.services[name] = svc
+	return nil
+}
+
+// Update 更新逻辑服务的endpoint列表，地址相同的endpoint保留其运行状态
+func (b *Balancer) Update(name string, targets ...Target) error {
+	name = strings.ToLower(name)
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	svc, ok := b.services[name]
+	if !ok {
+		return fmt.Errorf("loadbalance: service %s not found", name)
+	}
+	eps, err := mergeEndpoints(svc.endpoints, targets)
+	if err != nil {
+		return err
+	}
+	// 替换而非修改，进行中的请求仍持有旧的service
+	b.services[name] = &service{
+		policy:    svc.policy,
+		endpoints: eps,
+	}
+	return nil
+}
+
+// Discover 注册逻辑服务，endpoint列表由resolver提供并随其变化自动更新
+func (b *Balancer) Discover(ctx context.Context, name string, policy Policy, resolver Resolver) error {
+	name = strings.ToLower(name)
+	targets, err := resolver.Resolve(ctx, name)
+	if err != nil {
+		return err
+	}
+	if err := b.Register(name, policy, targets...); err != nil {
+		return err
+	}
+	cancel, err := resolver.Watch(name, func(targets []Target) {
+		_ = b.Update(name, targets...)
+	})
+	if err != nil {
+		b.Deregister(name)
+		return err
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if old, ok := b.watches[name]; ok {
+		old()
+	}
+	b.watches[name] = cancel
+	return nil
+}
+
+// Deregister 注销逻辑服务，同时取消对服务变化的监听
+func (b *Balancer) Deregister(name string) {
+	name = strings.ToLower(name)
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	delete(b.services, name)
+	if cancel, ok := b.watches[name]; ok {
+		cancel()
+		delete(b.watches, name)
+	}
+}
+
+// Close 取消所有对服务变化的监听，不会关闭Resolver
+func (b *Balancer) Close() error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	for k, cancel := range b.watches {
+		cancel()
+		delete(b.watches, k)
+	}
+	return nil
+}
+
+// Endpoints 获得逻辑服务当前的endpoint列表
+func (b *Balancer) Endpoints(name string) []*Endpoint {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	if svc, ok := b.services[strings.ToLower(name)]; ok {
+		return append([]*Endpoint(nil), svc.endpoints...)
+	}
+	return nil
+}
+
+func mergeEndpoints(old []*Endpoint, targets []Target) ([]*Endpoint, error) {
+	exists := make(map[string]*Endpoint, len(old))
+	for _, v := range old {
+		exists[v.address] = v
+	}
+	ret := make([]*Endpoint, 0, len(targets))
+	for _, t := range targets {
+		ep, err := newEndpoint(t)
+		if err != nil {
+			return nil, err
+		}
+		if v, ok := exists[ep.address]; ok && v.weight == ep.weight {
+			ep = v
+		}
+		ret = append(ret, ep)
+	}
+	return ret, nil
+}
+
+func (b *Balancer) lookup(ctx context.Context, u *url.URL) (*service, bool, error) {
+	b.lock.RLock()
+	svc, ok := b.services[strings.ToLower(u.Host)]
+	if !ok {
+		svc, ok = b.services[strings.ToLower(u.Hostname())]
+	}
+	b.lock.RUnlock()
+	if ok || b.resolver == nil {
+		return svc, ok, nil
+	}
+
+	name := strings.ToLower(u.Hostname())
+	b.discoverLock.Lock()
+	if expire, ok := b.notFound[name]; ok {
+		if time.Now().Before(expire) {
+			b.discoverLock.Unlock()
+			return nil, false, nil
+		}
+		delete(b.notFound, name)
+	}
+	call, ok := b.discovering[name]
+	if !ok {
+		call = &discoveryCall{done: make(chan struct{})}
+		b.discovering[name] = call
+		b.discoverLock.Unlock()
+		call.err = b.discover(ctx, name)
+
+		b.discoverLock.Lock()
+		delete(b.discovering, name)
+		if errors.Is(call.err, ErrServiceNotFound) && b.negativeTTL > 0 {
+			b.notFound[name] = time.Now().Add(b.negativeTTL)
+		}
+		b.discoverLock.Unlock()
+		close(call.done)
+	} else {
+		b.discoverLock.Unlock()
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+			return nil, false, ctx.Err()
+		}
+	}
+
+	if call.err != nil {
+		if errors.Is(call.err, ErrServiceNotFound) {
+			return nil, false, nil
+		}
+		return nil, false, call.err
+	}
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	svc, ok = b.services[name]
+	return svc, ok, nil
+}
+
+// discover 自动发现并注册服务，已注册（如并发的其他查询已完成）时直接返回
+func (b *Balancer) discover(ctx context.Context, name string) error {
+	b.lock.RLock()
+	_, ok := b.services[name]
+	b.lock.RUnlock()
+	if ok {
+		return nil
+	}
+	var policy Policy
+	if b.newPolicy != nil {
+		policy = b.newPolicy(name)
+	}
+	return b.Discover(ctx, name, policy, b.resolver)
+}
+
+func (b *Balancer) choose(request *http.Request, svc *service) *Endpoint {
+	if len(svc.endpoints) == 0 {
+		return nil
+	}
+	available := make([]*Endpoint, 0, len(svc.endpoints))
+	for _, ep := range svc.endpoints {
+		if !ep.Ejected() {
+			available = append(available, ep)
+		}
+	}
+	// 全部被摘除时不再摘除，避免服务完全不可用
+	if len(available) == 0 {
+		available = svc.endpoints
+	}
+	return svc.policy.Select(request, available)
+}
+
+// Filter 改写逻辑服务的请求地址，未注册的host不做处理
+func (b *Balancer) Filter(request *http.Request, fc filter.FilterChain) (*http.Response, error) {
+	svc, ok, err := b.lookup(request.Context(), request.URL)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return fc.Filter(request)
+	}
+	ep := b.choose(request, svc)
+	if ep == nil {
+		return nil, ErrNoEndpoint
+	}
+
+	// 改写副本，外层filter（重试、对冲、记录等）仍使用逻辑服务地址，重试时可以重新选择endpoint
+	r := request.WithContext(request.Context())
+	u := *request.URL
+	r.URL = &u
+	ep.rewrite(r.URL)
+	r.Host = ""
+	atomic.AddInt64(&ep.inFlight, 1)
+	atomic.AddInt64(&ep.requests, 1)
+
+	resp, err := fc.Filter(r)
+	failed := b.isFailure(resp, err)
+	if resp != nil && resp.Body != nil {
+		// 读取完body后才视为请求结束
+		resp.Body = &trackedBody{
+			ReadCloser: resp.Body,
+			done: func() {
+				ep.done(failed, b.maxFailures, b.ejectDuration)
+			},
+		}
+	} else {
+		ep.done(failed, b.maxFailures, b.ejectDuration)
+	}
+	return resp, err
+}
+
+type trackedBody struct {
+	io.ReadCloser
+	once sync.Once
+	done func()
+}
+
+func (b *trackedBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.done)
+	return err
+}
@@ -0,0 +1,183 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package loadbalance
+
+import (
+	"context"
+	"github.com/xfali/restclient/v2"
+	"github.com/xfali/restclient/v2/filter"
+	"github.com/xfali/restclient/v2/request"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func startServers(t *testing.T, n int, status ...int) ([]string, func()) {
+	var addrs []string
+	var servers []*httptest.Server
+	for i := 0; i < n; i++ {
+		code := http.StatusOK
+		if i < len(status) {
+			code = status[i]
+		}
+		name := string(rune('a' + i))
+		s := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			writer.WriteHeader(code)
+			_, _ = writer.Write([]byte(name + request.URL.Path))
+		}))
+		servers = append(servers, s)
+		addrs = append(addrs, s.URL)
+	}
+	return addrs, func() {
+		for _, s := range servers {
+			s.Close()
+		}
+	}
+}
+
+func TestBalancer(t *testing.T) {
+	addrs, closeFn := startServers(t, 3)
+	defer closeFn()
+
+	t.Run("round robin", func(t *testing.T) {
+		lb := New()
+		if err := lb.Register("svc", RoundRobin(), Targets(addrs...)...); err != nil {
+			t.Fatal(err)
+		}
+		client := restclient.New(restclient.AddFilter(lb.Filter))
+		for i := 0; i < 6; i++ {
+			ret := ""
+			err := client.Exchange("http://svc/test", request.WithResult(&ret))
+			if err != nil {
+				t.Fatal(err)
+			}
+			expect := string(rune('a'+i%3)) + "/test"
+			if ret != expect {
+				t.Fatalf("expect %s but get %s", expect, ret)
+			}
+		}
+		for _, ep := range lb.Endpoints("svc") {
+			if ep.Requests() != 2 {
+				t.Fatal("expect 2 requests but get ", ep.Requests())
+			}
+			if ep.InFlight() != 0 {
+				t.Fatal("expect 0 in flight but get ", ep.InFlight())
+			}
+		}
+	})
+
+	t.Run("weighted", func(t *testing.T) {
+		lb := New()
+		err := lb.Register("svc", Weighted(),
+			Target{Address: addrs[0], Weight: 3},
+			Target{Address: addrs[1], Weight: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		client := restclient.New(restclient.AddFilter(lb.Filter))
+		for i := 0; i < 8; i++ {
+			if err := client.Exchange("http://svc/test"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		eps := lb.Endpoints("svc")
+		if eps[0].Requests() != 6 || eps[1].Requests() != 2 {
+			t.Fatal("expect 6:2 but get ", eps[0].Requests(), eps[1].Requests())
+		}
+	})
+
+	t.Run("consistent hash", func(t *testing.T) {
+		lb := New()
+		if err := lb.Register("svc", ConsistentHash(nil), Targets(addrs...)...); err != nil {
+			t.Fatal(err)
+		}
+		client := restclient.New(restclient.AddFilter(lb.Filter))
+		first := ""
+		for i := 0; i < 5; i++ {
+			ret := ""
+			err := client.Exchange("http://svc/test",
+				request.WithResult(&ret),
+				request.WithRequestContext(WithHashKey(context.Background(), "user-1")))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if first == "" {
+				first = ret
+			} else if first != ret {
+				t.Fatalf("expect %s but get %s", first, ret)
+			}
+		}
+	})
+}
+
+func TestBalancerEject(t *testing.T) {
+	addrs, closeFn := startServers(t, 2, http.StatusInternalServerError)
+	defer closeFn()
+
+	lb := New(OptSetMaxFailures(2), OptSetEjectDuration(200*time.Millisecond))
+	if err := lb.Register("svc", RoundRobin(), Targets(addrs...)...); err != nil {
+		t.Fatal(err)
+	}
+	client := restclient.New(restclient.AddFilter(lb.Filter))
+	for i := 0; i < 10; i++ {
+		_ = client.Exchange("http://svc/test")
+	}
+	eps := lb.Endpoints("svc")
+	if eps[0].Requests() != 2 {
+		t.Fatal("expect bad endpoint ejected after 2 requests but get ", eps[0].Requests())
+	}
+	if !eps[0].Ejected() {
+		t.Fatal("expect ejected")
+	}
+	time.Sleep(250 * time.Millisecond)
+	if eps[0].Ejected() {
+		t.Fatal("expect recovered")
+	}
+}
+
+func TestBalancerRetry(t *testing.T) {
+	addrs, closeFn := startServers(t, 2)
+	defer closeFn()
+	dead := httptest.NewServer(http.NotFoundHandler())
+	dead.Close()
+
+	lb := New()
+	if err := lb.Register("svc", RoundRobin(), Targets(dead.URL, addrs[1])...); err != nil {
+		t.Fatal(err)
+	}
+	// 重试filter位于负载均衡外层，每次重试重新选择endpoint
+	var urls []string
+	record := func(request *http.Request, fc filter.FilterChain) (*http.Response, error) {
+		urls = append(urls, request.URL.String())
+		return fc.Filter(request)
+	}
+	client := restclient.New(restclient.AddFilter(lb.Filter),
+		restclient.AddIFilter(filter.NewRetry(filter.OptSetRetryBackoff(time.Millisecond, time.Millisecond))),
+		restclient.AddFilter(record))
+	ret := ""
+	if err := client.Exchange("http://svc/test", request.WithResult(&ret)); err != nil {
+		t.Fatal(err)
+	}
+	eps := lb.Endpoints("svc")
+	if ret != "b/test" || eps[0].Requests() != 1 || eps[1].Requests() != 1 {
+		t.Fatal(ret, eps[0].Requests(), eps[1].Requests())
+	}
+	if len(urls) != 1 || urls[0] != "http://svc/test" {
+		t.Fatal(urls)
+	}
+}
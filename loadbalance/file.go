@@ -0,0 +1,182 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package loadbalance
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// 默认文件检查间隔
+	DefaultFileCheckInterval = 5 * time.Second
+)
+
+// FileResolver 基于endpoint文件的服务发现，文件变化后自动重新加载并通知监听者
+// 扩展名为.json的文件按json解析，其他按yaml解析，格式为：
+//
+//	services:
+//	  user-service:
+//	    - address: http://10.0.0.1:8080
+//	      weight: 2
+//	    - address: http://10.0.0.2:8080
+type FileResolver struct {
+	path     string
+	interval time.Duration
+
+	listeners listeners
+	data      []byte
+	db        map[string][]Target
+	lock      sync.RWMutex
+	stop      chan struct{}
+	errFunc   func(error)
+}
+
+type endpointFile struct {
+	Services map[string][]Target `json:"services" yaml:"services"`
+}
+
+type FileOpt func(*FileResolver)
+
+// NewFileResolver 加载endpoint文件并开始监听文件变化，不再使用时需调用Close
+func NewFileResolver(path string, opts ...FileOpt) (*FileResolver, error) {
+	ret := &FileResolver{
+		path:     path,
+		interval: DefaultFileCheckInterval,
+		stop:     make(chan struct{}),
+		errFunc:  func(error) {},
+	}
+	for _, opt := range opts {
+		opt(ret)
+	}
+	if _, err := ret.reload(); err != nil {
+		return nil, err
+	}
+	if ret.interval > 0 {
+		go ret.loop()
+	}
+	return ret, nil
+}
+
+// OptSetFileCheckInterval 配置文件变化检查间隔，<=0时不检查文件变化
+func OptSetFileCheckInterval(interval time.Duration) FileOpt {
+	return func(r *FileResolver) {
+		r.interval = interval
+	}
+}
+
+// OptSetFileErrorHandler 配置重新加载失败时的处理方法，失败时保留上次加载的内容
+func OptSetFileErrorHandler(f func(error)) FileOpt {
+	return func(r *FileResolver) {
+		r.errFunc = f
+	}
+}
+
+func (r *FileResolver) Resolve(ctx context.Context, service string) ([]Target, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	if v, ok := r.db[strings.ToLower(service)]; ok {
+		return append([]Target(nil), v...), nil
+	}
+	return nil, ErrServiceNotFound
+}
+
+func (r *FileResolver) Watch(service string, listener func([]Target)) (func(), error) {
+	cancel, _ := r.listeners.add(strings.ToLower(service), listener)
+	return cancel, nil
+}
+
+// Close 停止监听文件，只可调用一次
+func (r *FileResolver) Close() error {
+	close(r.stop)
+	return nil
+}
+
+func (r *FileResolver) loop() {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			old, err := r.reload()
+			if err != nil {
+				r.errFunc(err)
+				continue
+			}
+			if old != nil {
+				r.notifyChanged(old)
+			}
+		}
+	}
+}
+
+// reload 重新加载文件，文件未变化时返回nil
+func (r *FileResolver) reload() (map[string][]Target, error) {
+	data, err := ioutil.ReadFile(r.path)
+	if err != nil {
+		return nil, err
+	}
+	r.lock.RLock()
+	same := r.db != nil && bytes.Equal(data, r.data)
+	r.lock.RUnlock()
+	if same {
+		return nil, nil
+	}
+
+	file := endpointFile{}
+	if strings.ToLower(filepath.Ext(r.path)) == ".json" {
+		err = json.Unmarshal(data, &file)
+	} else {
+		err = yaml.Unmarshal(data, &file)
+	}
+	if err != nil {
+		return nil, err
+	}
+	db := make(map[string][]Target, len(file.Services))
+	for k, v := range file.Services {
+		db[strings.ToLower(k)] = v
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	old := r.db
+	r.db = db
+	r.data = data
+	if old == nil {
+		old = map[string][]Target{}
+	}
+	return old, nil
+}
+
+func (r *FileResolver) notifyChanged(old map[string][]Target) {
+	for _, service := range r.listeners.services() {
+		targets, _ := r.Resolve(context.Background(), service)
+		if !equalTargets(old[service], targets) {
+			r.listeners.notify(service, targets)
+		}
+	}
+}
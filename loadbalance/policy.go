@@ -0,0 +1,191 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package loadbalance
+
+import (
+	"context"
+	"hash/fnv"
+	"math/rand"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Policy 负载均衡策略
+type Policy interface {
+	// 从可用的endpoints中选择一个，endpoints不为空
+	Select(request *http.Request, endpoints []*Endpoint) *Endpoint
+}
+
+type roundRobin struct {
+	next uint64
+}
+
+// RoundRobin 轮询策略
+func RoundRobin() Policy {
+	return &roundRobin{}
+}
+
+func (p *roundRobin) Select(request *http.Request, endpoints []*Endpoint) *Endpoint {
+	n := atomic.AddUint64(&p.next, 1) - 1
+	return endpoints[n%uint64(len(endpoints))]
+}
+
+type random struct {
+	rand *rand.Rand
+	lock sync.Mutex
+}
+
+// Random 随机策略
+func Random() Policy {
+	return &random{
+		rand: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+func (p *random) Select(request *http.Request, endpoints []*Endpoint) *Endpoint {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return endpoints[p.rand.Intn(len(endpoints))]
+}
+
+type leastInFlight struct {
+	next uint64
+}
+
+// LeastInFlight 最少进行中请求策略，进行中请求数相同时轮询
+func LeastInFlight() Policy {
+	return &leastInFlight{}
+}
+
+func (p *leastInFlight) Select(request *http.Request, endpoints []*Endpoint) *Endpoint {
+	l := uint64(len(endpoints))
+	start := atomic.AddUint64(&p.next, 1) - 1
+	var ret *Endpoint
+	for i := uint64(0); i < l; i++ {
+		ep := endpoints[(start+i)%l]
+		if ret == nil || ep.InFlight() < ret.InFlight() {
+			ret = ep
+		}
+	}
+	return ret
+}
+
+type weighted struct {
+	current map[*Endpoint]int
+	lock    sync.Mutex
+}
+
+// Weighted 平滑加权轮询策略，权重见Target.Weight
+func Weighted() Policy {
+	return &weighted{
+		current: map[*Endpoint]int{},
+	}
+}
+
+func (p *weighted) Select(request *http.Request, endpoints []*Endpoint) *Endpoint {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	total := 0
+	var ret *Endpoint
+	for _, ep := range endpoints {
+		w := ep.Weight()
+		total += w
+		p.current[ep] += w
+		if ret == nil || p.current[ep] > p.current[ret] {
+			ret = ep
+		}
+	}
+	p.current[ret] -= total
+
+	// 清理已下线的endpoint
+	if len(p.current) > len(endpoints) {
+		alive := make(map[*Endpoint]int, len(endpoints))
+		for _, ep := range endpoints {
+			alive[ep] = p.current[ep]
+		}
+		p.current = alive
+	}
+	return ret
+}
+
+type hashKey struct{}
+
+// WithHashKey 设置一致性哈希策略使用的key，通过request.WithRequestContext传递
+func WithHashKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, hashKey{}, key)
+}
+
+// HashKey 获得context中的一致性哈希key
+func HashKey(ctx context.Context) (string, bool) {
+	v, ok := ctx.Value(hashKey{}).(string)
+	return v, ok
+}
+
+type consistentHash struct {
+	key func(request *http.Request) string
+}
+
+// ConsistentHash 一致性哈希策略（rendezvous hashing），endpoint变化时只影响少量key的映射
+// key：获得请求的哈希key，为nil时优先使用WithHashKey设置的key，否则使用请求的url
+func ConsistentHash(key func(request *http.Request) string) Policy {
+	if key == nil {
+		key = defaultHashKey
+	}
+	return &consistentHash{
+		key: key,
+	}
+}
+
+func defaultHashKey(request *http.Request) string {
+	if k, ok := HashKey(request.Context()); ok {
+		return k
+	}
+	return request.URL.String()
+}
+
+func (p *consistentHash) Select(request *http.Request, endpoints []*Endpoint) *Endpoint {
+	key := p.key(request)
+	var (
+		ret *Endpoint
+		max uint64
+	)
+	for _, ep := range endpoints {
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(key))
+		_, _ = h.Write([]byte{0})
+		_, _ = h.Write([]byte(ep.Address()))
+		score := mix(h.Sum64())
+		if ret == nil || score > max {
+			ret = ep
+			max = score
+		}
+	}
+	return ret
+}
+
+// fnv对相近输入的离散性较差，再做一次混淆
+func mix(x uint64) uint64 {
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
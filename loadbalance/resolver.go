@@ -0,0 +1,156 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package loadbalance
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+)
+
+// ErrServiceNotFound Resolver不负责解析该服务，请求将按原地址发送
+var ErrServiceNotFound = errors.New("loadbalance: service not found")
+
+// Resolver 服务发现，为逻辑服务名提供endpoint列表
+type Resolver interface {
+	// 获得逻辑服务当前的endpoint列表，不负责解析该服务时返回ErrServiceNotFound
+	Resolve(ctx context.Context, service string) ([]Target, error)
+
+	// 监听逻辑服务endpoint列表的变化，变化时以完整的新列表回调listener
+	// 返回取消监听的方法
+	Watch(service string, listener func([]Target)) (cancel func(), err error)
+}
+
+type listeners struct {
+	next int
+	db   map[string]map[int]func([]Target)
+	lock sync.Mutex
+}
+
+func (l *listeners) add(service string, listener func([]Target)) (cancel func(), first bool) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.db == nil {
+		l.db = map[string]map[int]func([]Target){}
+	}
+	m, ok := l.db[service]
+	if !ok {
+		m = map[int]func([]Target){}
+		l.db[service] = m
+	}
+	id := l.next
+	l.next++
+	m[id] = listener
+	return func() {
+		l.lock.Lock()
+		defer l.lock.Unlock()
+		if m, ok := l.db[service]; ok {
+			delete(m, id)
+			if len(m) == 0 {
+				delete(l.db, service)
+			}
+		}
+	}, !ok
+}
+
+func (l *listeners) services() []string {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	ret := make([]string, 0, len(l.db))
+	for k := range l.db {
+		ret = append(ret, k)
+	}
+	return ret
+}
+
+func (l *listeners) notify(service string, targets []Target) {
+	l.lock.Lock()
+	fs := make([]func([]Target), 0, len(l.db[service]))
+	for _, f := range l.db[service] {
+		fs = append(fs, f)
+	}
+	l.lock.Unlock()
+
+	for _, f := range fs {
+		f(append([]Target(nil), targets...))
+	}
+}
+
+func equalTargets(a, b []Target) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// StaticResolver 静态服务列表，可通过Set方法更新并通知监听者
+type StaticResolver struct {
+	listeners listeners
+
+	db   map[string][]Target
+	lock sync.RWMutex
+}
+
+// NewStaticResolver 创建静态服务列表
+func NewStaticResolver() *StaticResolver {
+	return &StaticResolver{
+		db: map[string][]Target{},
+	}
+}
+
+// Set 设置逻辑服务的endpoint列表
+func (r *StaticResolver) Set(service string, targets ...Target) {
+	service = strings.ToLower(service)
+	r.lock.Lock()
+	r.db[service] = append([]Target(nil), targets...)
+	r.lock.Unlock()
+
+	r.listeners.notify(service, targets)
+}
+
+// Delete 删除逻辑服务，监听者将收到空列表
+func (r *StaticResolver) Delete(service string) {
+	service = strings.ToLower(service)
+	r.lock.Lock()
+	delete(r.db, service)
+	r.lock.Unlock()
+
+	r.listeners.notify(service, nil)
+}
+
+func (r *StaticResolver) Resolve(ctx context.Context, service string) ([]Target, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	if v, ok := r.db[strings.ToLower(service)]; ok {
+		return append([]Target(nil), v...), nil
+	}
+	return nil, ErrServiceNotFound
+}
+
+func (r *StaticResolver) Watch(service string, listener func([]Target)) (func(), error) {
+	cancel, _ := r.listeners.add(strings.ToLower(service), listener)
+	return cancel, nil
+}
@@ -0,0 +1,253 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package loadbalance
+
+import (
+	"context"
+	"github.com/xfali/restclient/v2"
+	"github.com/xfali/restclient/v2/request"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestStaticResolver(t *testing.T) {
+	addrs, closeFn := startServers(t, 2)
+	defer closeFn()
+
+	r := NewStaticResolver()
+	r.Set("svc", Targets(addrs[0])...)
+	lb := New(OptSetResolver(r, nil))
+	defer lb.Close()
+	client := restclient.New(restclient.AddFilter(lb.Filter))
+
+	ret := ""
+	if err := client.Exchange("http://svc/test", request.WithResult(&ret)); err != nil {
+		t.Fatal(err)
+	}
+	if ret != "a/test" {
+		t.Fatal("expect a/test but get ", ret)
+	}
+
+	r.Set("svc", Targets(addrs[1])...)
+	if err := client.Exchange("http://svc/test", request.WithResult(&ret)); err != nil {
+		t.Fatal(err)
+	}
+	if ret != "b/test" {
+		t.Fatal("expect b/test but get ", ret)
+	}
+}
+
+// countingResolver 统计Resolve调用次数，并延迟返回以便并发请求等待同一查询
+type countingResolver struct {
+	Resolver
+	count int32
+	delay time.Duration
+}
+
+func (r *countingResolver) Resolve(ctx context.Context, service string) ([]Target, error) {
+	atomic.AddInt32(&r.count, 1)
+	time.Sleep(r.delay)
+	return r.Resolver.Resolve(ctx, service)
+}
+
+func TestResolverCache(t *testing.T) {
+	addrs, closeFn := startServers(t, 1)
+	defer closeFn()
+	u, _ := url.Parse(addrs[0])
+
+	static := NewStaticResolver()
+	static.Set("svc", Targets(addrs[0])...)
+	r := &countingResolver{Resolver: static, delay: 20 * time.Millisecond}
+	lb := New(OptSetResolver(r, nil), OptSetNegativeTTL(100*time.Millisecond))
+	defer lb.Close()
+	client := restclient.New(restclient.AddFilter(lb.Filter))
+
+	// 同一服务的并发请求只查询一次
+	wg := sync.WaitGroup{}
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := client.Exchange("http://svc/test"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := atomic.LoadInt32(&r.count); n != 1 {
+		t.Fatal("expect 1 resolve but get ", n)
+	}
+
+	// 未发现服务的host在缓存时间内不再查询
+	atomic.StoreInt32(&r.count, 0)
+	plain := "http://127.0.0.1:" + u.Port() + "/test"
+	for i := 0; i < 3; i++ {
+		if err := client.Exchange(plain); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := atomic.LoadInt32(&r.count); n != 1 {
+		t.Fatal("expect 1 resolve but get ", n)
+	}
+	time.Sleep(150 * time.Millisecond)
+	if err := client.Exchange(plain); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&r.count); n != 2 {
+		t.Fatal("expect resolve after ttl but get ", n)
+	}
+}
+
+type testSrvLookup struct {
+	srvs []*net.SRV
+}
+
+func (l *testSrvLookup) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	if name != "svc.example.com" {
+		return "", nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+	return "", l.srvs, nil
+}
+
+func TestSrvResolver(t *testing.T) {
+	lookup := &testSrvLookup{
+		srvs: []*net.SRV{
+			{Target: "b.example.com.", Port: 8080, Priority: 1, Weight: 10},
+			{Target: "a.example.com.", Port: 8080, Priority: 1, Weight: 20},
+			{Target: "c.example.com.", Port: 8080, Priority: 2, Weight: 10},
+		},
+	}
+	r := NewSrvResolver(OptSetSrvLookup(lookup), OptSetSrvDomain("example.com"),
+		OptSetSrvRefreshInterval(50*time.Millisecond))
+	defer r.Close()
+
+	targets, err := r.Resolve(context.Background(), "svc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(targets) != 2 || targets[0].Address != "http://a.example.com:8080" || targets[0].Weight != 20 {
+		t.Fatal(targets)
+	}
+	if _, err := r.Resolve(context.Background(), "other"); err != ErrServiceNotFound {
+		t.Fatal("expect ErrServiceNotFound but get ", err)
+	}
+	if _, err := r.Resolve(context.Background(), "www.example.com"); err != ErrServiceNotFound {
+		t.Fatal("expect ErrServiceNotFound but get ", err)
+	}
+
+	ch := make(chan []Target, 1)
+	cancel, _ := r.Watch("svc", func(targets []Target) {
+		select {
+		case ch <- targets:
+		default:
+		}
+	})
+	defer cancel()
+	select {
+	case targets := <-ch:
+		if len(targets) != 2 {
+			t.Fatal(targets)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expect notification")
+	}
+}
+
+func TestFileResolver(t *testing.T) {
+	dir, err := ioutil.TempDir("", "loadbalance")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "endpoints.yaml")
+	err = ioutil.WriteFile(path, []byte(`
+services:
+  svc:
+    - address: http://10.0.0.1:8080
+      weight: 2
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewFileResolver(path, OptSetFileCheckInterval(20*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	lb := New()
+	defer lb.Close()
+	if err := lb.Discover(context.Background(), "svc", nil, r); err != nil {
+		t.Fatal(err)
+	}
+	eps := lb.Endpoints("svc")
+	if len(eps) != 1 || eps[0].Weight() != 2 {
+		t.Fatal(eps)
+	}
+
+	err = ioutil.WriteFile(path, []byte(`{"services": {"svc": [{"address": "http://10.0.0.1:8080", "weight": 2}, {"address": "http://10.0.0.2:8080"}]}}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if len(lb.Endpoints("svc")) == 2 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	eps2 := lb.Endpoints("svc")
+	if len(eps2) != 2 {
+		t.Fatal("expect 2 endpoints but get ", len(eps2))
+	}
+	if eps2[0] != eps[0] {
+		t.Fatal("expect endpoint state kept")
+	}
+}
+
+func TestResolverZeroInterval(t *testing.T) {
+	r := NewSrvResolver(OptSetSrvLookup(&testSrvLookup{}), OptSetSrvRefreshInterval(0))
+	cancel, err := r.Watch("svc", func([]Target) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	_ = r.Close()
+
+	dir, err := ioutil.TempDir("", "loadbalance")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "endpoints.yaml")
+	if err := ioutil.WriteFile(path, []byte("services: {}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fr, err := NewFileResolver(path, OptSetFileCheckInterval(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = fr.Close()
+}
@@ -0,0 +1,202 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package loadbalance
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// 默认SRV记录刷新间隔
+	DefaultSrvRefreshInterval = 30 * time.Second
+)
+
+// SrvLookup SRV记录解析器，*net.Resolver实现了该接口
+type SrvLookup interface {
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+}
+
+// SrvResolver 基于DNS SRV记录的服务发现
+// 逻辑服务名name对应的查询为：_service._proto.name[.domain]
+// 仅使用priority最小的一组记录，weight作为endpoint权重
+type SrvResolver struct {
+	lookup   SrvLookup
+	service  string
+	proto    string
+	domain   string
+	scheme   string
+	interval time.Duration
+
+	listeners listeners
+	cache     map[string][]Target
+	lock      sync.Mutex
+	started   bool
+	stop      chan struct{}
+}
+
+type SrvOpt func(*SrvResolver)
+
+// NewSrvResolver 创建基于DNS SRV记录的服务发现
+func NewSrvResolver(opts ...SrvOpt) *SrvResolver {
+	ret := &SrvResolver{
+		lookup:   net.DefaultResolver,
+		service:  "http",
+		proto:    "tcp",
+		scheme:   "http",
+		interval: DefaultSrvRefreshInterval,
+		cache:    map[string][]Target{},
+		stop:     make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(ret)
+	}
+	return ret
+}
+
+// OptSetSrvLookup 配置SRV记录解析器
+func OptSetSrvLookup(lookup SrvLookup) SrvOpt {
+	return func(r *SrvResolver) {
+		r.lookup = lookup
+	}
+}
+
+// OptSetSrvService 配置SRV查询的service及proto，默认为http、tcp
+func OptSetSrvService(service, proto string) SrvOpt {
+	return func(r *SrvResolver) {
+		r.service = service
+		r.proto = proto
+	}
+}
+
+// OptSetSrvDomain 配置逻辑服务名的域名后缀，配置后仅解析不含"."的逻辑服务名
+func OptSetSrvDomain(domain string) SrvOpt {
+	return func(r *SrvResolver) {
+		r.domain = strings.Trim(domain, ".")
+	}
+}
+
+// OptSetSrvScheme 配置endpoint使用的scheme，默认为http
+func OptSetSrvScheme(scheme string) SrvOpt {
+	return func(r *SrvResolver) {
+		r.scheme = scheme
+	}
+}
+
+// OptSetSrvRefreshInterval 配置监听时的刷新间隔，<=0时不刷新
+func OptSetSrvRefreshInterval(interval time.Duration) SrvOpt {
+	return func(r *SrvResolver) {
+		r.interval = interval
+	}
+}
+
+func (r *SrvResolver) Resolve(ctx context.Context, service string) ([]Target, error) {
+	name := strings.ToLower(service)
+	if r.domain != "" {
+		if strings.Contains(name, ".") {
+			return nil, ErrServiceNotFound
+		}
+		name = name + "." + r.domain
+	}
+	_, srvs, err := r.lookup.LookupSRV(ctx, r.service, r.proto, name)
+	if err != nil {
+		if dnsErr, ok := err.(*net.DNSError); ok && dnsErr.IsNotFound {
+			return nil, ErrServiceNotFound
+		}
+		return nil, err
+	}
+	if len(srvs) == 0 {
+		return nil, ErrServiceNotFound
+	}
+	sort.Slice(srvs, func(i, j int) bool {
+		if srvs[i].Priority != srvs[j].Priority {
+			return srvs[i].Priority < srvs[j].Priority
+		}
+		return srvs[i].Target+strconv.Itoa(int(srvs[i].Port)) < srvs[j].Target+strconv.Itoa(int(srvs[j].Port))
+	})
+	ret := make([]Target, 0, len(srvs))
+	for _, v := range srvs {
+		if v.Priority != srvs[0].Priority {
+			break
+		}
+		host := strings.TrimSuffix(v.Target, ".")
+		ret = append(ret, Target{
+			Address: r.scheme + "://" + net.JoinHostPort(host, strconv.Itoa(int(v.Port))),
+			Weight:  int(v.Weight),
+		})
+	}
+	return ret, nil
+}
+
+// Watch 监听逻辑服务，按刷新间隔重新查询SRV记录，记录变化时通知
+func (r *SrvResolver) Watch(service string, listener func([]Target)) (func(), error) {
+	service = strings.ToLower(service)
+	cancel, _ := r.listeners.add(service, listener)
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if !r.started && r.interval > 0 {
+		r.started = true
+		go r.loop()
+	}
+	return cancel, nil
+}
+
+// Close 停止刷新，只可调用一次
+func (r *SrvResolver) Close() error {
+	close(r.stop)
+	return nil
+}
+
+func (r *SrvResolver) loop() {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			r.refresh()
+		}
+	}
+}
+
+func (r *SrvResolver) refresh() {
+	for _, service := range r.listeners.services() {
+		ctx, cancel := context.WithTimeout(context.Background(), r.interval)
+		targets, err := r.Resolve(ctx, service)
+		cancel()
+		if err != nil && !errors.Is(err, ErrServiceNotFound) {
+			// 临时错误保留上次的结果
+			continue
+		}
+
+		r.lock.Lock()
+		old, ok := r.cache[service]
+		r.cache[service] = targets
+		r.lock.Unlock()
+		if !ok || !equalTargets(old, targets) {
+			r.listeners.notify(service, targets)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metrics
+
+import (
+	"context"
+	"errors"
+	"github.com/xfali/restclient/v2/buffer"
+	"github.com/xfali/restclient/v2/filter"
+	"github.com/xfali/restclient/v2/restutil"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultNamespace = "restclient"
+
+	// 未设置路由模板时route标签的值
+	RouteNone = "none"
+	// 请求失败未获得应答时status标签的值，错误类型见request_errors_total的kind标签
+	StatusError = "error"
+
+	ErrorKindTimeout    = "timeout"
+	ErrorKindCanceled   = "canceled"
+	ErrorKindDns        = "dns"
+	ErrorKindConnection = "connection"
+	ErrorKindOther      = "other"
+)
+
+// Collector 指标采集filter，记录请求数、延迟、进行中请求数、请求及应答大小和错误类型
+// 标签包括method、host、route（路由模板，见request.WithRoute）及status（状态码分类，如2xx，未获得应答时为StatusError）
+// requests_total统计所有请求（包括传输错误及超时），错误率可由status="error"或request_errors_total除以requests_total计算
+// 为控制标签基数，route仅使用路由模板，未设置时为RouteNone
+type Collector struct {
+	namespace       string
+	durationBuckets []float64
+	sizeBuckets     []float64
+
+	requests     CounterVec
+	duration     HistogramVec
+	inFlight     GaugeVec
+	requestSize  HistogramVec
+	responseSize HistogramVec
+	errors       CounterVec
+}
+
+type Opt func(*Collector)
+
+// NewCollector 创建指标采集filter，指标注册到registry中
+func NewCollector(registry Registry, opts ...Opt) *Collector {
+	ret := &Collector{
+		namespace:       DefaultNamespace,
+		durationBuckets: DefaultDurationBuckets,
+		sizeBuckets:     DefaultSizeBuckets,
+	}
+	for _, opt := range opts {
+		opt(ret)
+	}
+	name := func(s string) string {
+		if ret.namespace == "" {
+			return s
+		}
+		return ret.namespace + "_" + s
+	}
+	ret.requests = registry.Counter(name("requests_total"),
+		"Total number of requests, including failed ones with status \"error\".", "method", "host", "route", "status")
+	ret.duration = registry.Histogram(name("request_duration_seconds"),
+		"Request latency in seconds, including reading the response body.", ret.durationBuckets,
+		"method", "host", "route", "status")
+	ret.inFlight = registry.Gauge(name("requests_in_flight"),
+		"Number of requests in flight.", "method", "host")
+	ret.requestSize = registry.Histogram(name("request_size_bytes"),
+		"Request body size in bytes.", ret.sizeBuckets, "method", "host", "route")
+	ret.responseSize = registry.Histogram(name("response_size_bytes"),
+		"Response body size in bytes.", ret.sizeBuckets, "method", "host", "route", "status")
+	ret.errors = registry.Counter(name("request_errors_total"),
+		"Total number of requests failed without response.", "method", "host", "route", "kind")
+	return ret
+}
+
+// OptSetNamespace 配置指标名前缀，默认为restclient
+func OptSetNamespace(namespace string) Opt {
+	return func(c *Collector) {
+		c.namespace = namespace
+	}
+}
+
+// OptSetDurationBuckets 配置延迟分布（秒）
+func OptSetDurationBuckets(buckets []float64) Opt {
+	return func(c *Collector) {
+		c.durationBuckets = buckets
+	}
+}
+
+// OptSetSizeBuckets 配置请求及应答大小分布（字节）
+func OptSetSizeBuckets(buckets []float64) Opt {
+	return func(c *Collector) {
+		c.sizeBuckets = buckets
+	}
+}
+
+func (c *Collector) Filter(request *http.Request, fc filter.FilterChain) (*http.Response, error) {
+	method := request.Method
+	host := request.URL.Host
+	route := restutil.GetRoute(request.Context())
+	if route == "" {
+		route = RouteNone
+	}
+
+	c.requestSize.With(method, host, route).Observe(float64(requestSize(request)))
+	inFlight := c.inFlight.With(method, host)
+	inFlight.Inc()
+	now := time.Now()
+
+	resp, err := fc.Filter(request)
+	if err != nil || resp == nil {
+		inFlight.Dec()
+		c.requests.With(method, host, route, StatusError).Inc()
+		c.duration.With(method, host, route, StatusError).Observe(time.Since(now).Seconds())
+		c.errors.With(method, host, route, ErrorKind(err)).Inc()
+		return resp, err
+	}
+
+	status := StatusClass(resp.StatusCode)
+	done := func(size int64) {
+		inFlight.Dec()
+		c.requests.With(method, host, route, status).Inc()
+		c.duration.With(method, host, route, status).Observe(time.Since(now).Seconds())
+		c.responseSize.With(method, host, route, status).Observe(float64(size))
+	}
+	if resp.Body == nil {
+		done(0)
+	} else {
+		resp.Body = &countBody{ReadCloser: resp.Body, done: done}
+	}
+	return resp, err
+}
+
+func requestSize(request *http.Request) int64 {
+	if request.ContentLength > 0 {
+		return request.ContentLength
+	}
+	if cl, ok := request.Body.(buffer.ContentLength); ok {
+		return cl.ContentLength()
+	}
+	return 0
+}
+
+// StatusClass 获得状态码分类，如200返回2xx
+func StatusClass(status int) string {
+	if status < 100 || status > 599 {
+		return "unknown"
+	}
+	return string(rune('0'+status/100)) + "xx"
+}
+
+// ErrorKind 获得请求错误的分类
+func ErrorKind(err error) string {
+	if err == nil {
+		return ErrorKindOther
+	}
+	if errors.Is(err, context.Canceled) {
+		return ErrorKindCanceled
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ErrorKindTimeout
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return ErrorKindTimeout
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return ErrorKindDns
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return ErrorKindConnection
+	}
+	if strings.Contains(err.Error(), "connection") {
+		return ErrorKindConnection
+	}
+	return ErrorKindOther
+}
+
+type countBody struct {
+	io.ReadCloser
+	size int64
+	once sync.Once
+	done func(size int64)
+}
+
+func (b *countBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.size += int64(n)
+	return n, err
+}
+
+func (b *countBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() {
+		b.done(b.size)
+	})
+	return err
+}
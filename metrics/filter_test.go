@@ -0,0 +1,84 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metrics
+
+import (
+	"bytes"
+	"github.com/xfali/restclient/v2"
+	"github.com/xfali/restclient/v2/request"
+	"github.com/xfali/restclient/v2/restutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestCollector(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if strings.HasPrefix(request.URL.Path, "/users/2") {
+			writer.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = writer.Write([]byte("hello"))
+	}))
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+
+	registry := NewRegistry()
+	client := restclient.New(restclient.AddIFilter(NewCollector(registry)))
+	for _, id := range []int{1, 1, 2} {
+		b := restutil.NewUrlBuilder(server.URL+"/users/:id").PathVariable("id", id)
+		ret := ""
+		_ = client.Exchange(b.Build(), request.WithRoute(b.Route()), request.WithResult(&ret))
+	}
+	_ = client.Exchange("http://127.0.0.1:1/none")
+
+	buf := bytes.Buffer{}
+	if err := registry.WritePrometheus(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	t.Log(out)
+	expects := []string{
+		"# TYPE restclient_requests_total counter",
+		`restclient_requests_total{method="GET",host="` + u.Host + `",route="/users/:id",status="2xx"} 2`,
+		`restclient_requests_total{method="GET",host="` + u.Host + `",route="/users/:id",status="4xx"} 1`,
+		`restclient_response_size_bytes_sum{method="GET",host="` + u.Host + `",route="/users/:id",status="2xx"} 10`,
+		`restclient_request_duration_seconds_count{method="GET",host="` + u.Host + `",route="/users/:id",status="2xx"} 2`,
+		`restclient_requests_in_flight{method="GET",host="` + u.Host + `"} 0`,
+		`restclient_request_errors_total{method="GET",host="127.0.0.1:1",route="none",kind="connection"} 1`,
+		`restclient_requests_total{method="GET",host="127.0.0.1:1",route="none",status="error"} 1`,
+		`restclient_request_duration_seconds_count{method="GET",host="127.0.0.1:1",route="none",status="error"} 1`,
+	}
+	for _, v := range expects {
+		if !strings.Contains(out, v) {
+			t.Fatal("expect ", v)
+		}
+	}
+}
+
+func TestEscape(t *testing.T) {
+	registry := NewRegistry()
+	registry.Counter("test_total", "help\nline", "label").With("a\"b\\c").Add(1.5)
+	buf := bytes.Buffer{}
+	_ = registry.WritePrometheus(&buf)
+	expect := "# HELP test_total help\\nline\n# TYPE test_total counter\ntest_total{label=\"a\\\"b\\\\c\"} 1.5\n"
+	if buf.String() != expect {
+		t.Fatal(buf.String())
+	}
+}
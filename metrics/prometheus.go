@@ -0,0 +1,137 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	// Prometheus文本格式的Content-Type
+	PrometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+// WritePrometheus 将所有指标以Prometheus文本格式（0.0.4）写入w
+func (r *DefaultRegistry) WritePrometheus(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, f := range r.sortedFamilies() {
+		bw.WriteString("# HELP ")
+		bw.WriteString(f.name)
+		bw.WriteString(" ")
+		bw.WriteString(escapeHelp(f.help))
+		bw.WriteString("\n# TYPE ")
+		bw.WriteString(f.name)
+		bw.WriteString(" ")
+		bw.WriteString(f.typ)
+		bw.WriteString("\n")
+
+		for _, s := range f.sortedSeries() {
+			s.lock.Lock()
+			value := s.value
+			count := s.count
+			buckets := append([]uint64(nil), s.buckets...)
+			s.lock.Unlock()
+
+			labels := formatLabels(f.labelNames, s.labelValues, "", "")
+			if f.typ != typeHistogram {
+				writeSample(bw, f.name, labels, formatFloat(value))
+				continue
+			}
+			for i, upper := range f.buckets {
+				le := formatLabels(f.labelNames, s.labelValues, "le", formatFloat(upper))
+				writeSample(bw, f.name+"_bucket", le, strconv.FormatUint(buckets[i], 10))
+			}
+			inf := formatLabels(f.labelNames, s.labelValues, "le", "+Inf")
+			writeSample(bw, f.name+"_bucket", inf, strconv.FormatUint(count, 10))
+			writeSample(bw, f.name+"_sum", labels, formatFloat(value))
+			writeSample(bw, f.name+"_count", labels, strconv.FormatUint(count, 10))
+		}
+	}
+	return bw.Flush()
+}
+
+// ServeHTTP 以Prometheus文本格式输出所有指标，可直接注册为/metrics接口
+func (r *DefaultRegistry) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	writer.Header().Set("Content-Type", PrometheusContentType)
+	_ = r.WritePrometheus(writer)
+}
+
+func writeSample(w *bufio.Writer, name, labels, value string) {
+	w.WriteString(name)
+	w.WriteString(labels)
+	w.WriteString(" ")
+	w.WriteString(value)
+	w.WriteString("\n")
+}
+
+func formatLabels(names, values []string, extraName, extraValue string) string {
+	if len(names) == 0 && extraName == "" {
+		return ""
+	}
+	buf := strings.Builder{}
+	buf.WriteString("{")
+	for i, name := range names {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+		buf.WriteString(name)
+		buf.WriteString(`="`)
+		buf.WriteString(escapeLabelValue(values[i]))
+		buf.WriteString(`"`)
+	}
+	if extraName != "" {
+		if len(names) > 0 {
+			buf.WriteString(",")
+		}
+		buf.WriteString(extraName)
+		buf.WriteString(`="`)
+		buf.WriteString(extraValue)
+		buf.WriteString(`"`)
+	}
+	buf.WriteString("}")
+	return buf.String()
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpReplacer  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpReplacer.Replace(s)
+}
+
+func escapeLabelValue(s string) string {
+	return labelReplacer.Replace(s)
+}
@@ -0,0 +1,260 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metrics
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+var (
+	// 默认延迟分布（秒）
+	DefaultDurationBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+	// 默认大小分布（字节）
+	DefaultSizeBuckets = []float64{64, 256, 1024, 4096, 16384, 65536, 262144, 1048576, 4194304}
+)
+
+type Counter interface {
+	Inc()
+	Add(v float64)
+}
+
+type Gauge interface {
+	Inc()
+	Dec()
+	Add(v float64)
+	Set(v float64)
+}
+
+type Histogram interface {
+	Observe(v float64)
+}
+
+type CounterVec interface {
+	// 根据标签值获得Counter，标签值的顺序与注册时标签名的顺序一致
+	With(labelValues ...string) Counter
+}
+
+type GaugeVec interface {
+	With(labelValues ...string) Gauge
+}
+
+type HistogramVec interface {
+	With(labelValues ...string) Histogram
+}
+
+// Registry 指标注册接口，可以对接其他监控系统的实现
+// 相同名称重复注册时返回已注册的指标
+type Registry interface {
+	Counter(name, help string, labelNames ...string) CounterVec
+	Gauge(name, help string, labelNames ...string) GaugeVec
+	Histogram(name, help string, buckets []float64, labelNames ...string) HistogramVec
+}
+
+const (
+	typeCounter   = "counter"
+	typeGauge     = "gauge"
+	typeHistogram = "histogram"
+)
+
+type series struct {
+	labelValues []string
+
+	lock    sync.Mutex
+	value   float64
+	buckets []uint64
+	count   uint64
+}
+
+type family struct {
+	name       string
+	help       string
+	typ        string
+	labelNames []string
+	buckets    []float64
+
+	lock   sync.RWMutex
+	series map[string]*series
+}
+
+func (f *family) with(labelValues []string) *series {
+	// 标签值数量不匹配时补齐或截断，避免panic
+	values := make([]string, len(f.labelNames))
+	copy(values, labelValues)
+	key := strings.Join(values, "\xff")
+
+	f.lock.RLock()
+	s, ok := f.series[key]
+	f.lock.RUnlock()
+	if ok {
+		return s
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if s, ok = f.series[key]; ok {
+		return s
+	}
+	s = &series{labelValues: values}
+	if f.typ == typeHistogram {
+		s.buckets = make([]uint64, len(f.buckets))
+	}
+	f.series[key] = s
+	return s
+}
+
+func (f *family) sortedSeries() []*series {
+	f.lock.RLock()
+	ret := make([]*series, 0, len(f.series))
+	for _, s := range f.series {
+		ret = append(ret, s)
+	}
+	f.lock.RUnlock()
+	sort.Slice(ret, func(i, j int) bool {
+		return strings.Join(ret[i].labelValues, "\xff") < strings.Join(ret[j].labelValues, "\xff")
+	})
+	return ret
+}
+
+func (s *series) Inc() {
+	s.Add(1)
+}
+
+func (s *series) Dec() {
+	s.Add(-1)
+}
+
+func (s *series) Add(v float64) {
+	s.lock.Lock()
+	s.value += v
+	s.lock.Unlock()
+}
+
+func (s *series) Set(v float64) {
+	s.lock.Lock()
+	s.value = v
+	s.lock.Unlock()
+}
+
+type counterVec struct {
+	f *family
+}
+
+func (v counterVec) With(labelValues ...string) Counter {
+	return v.f.with(labelValues)
+}
+
+type gaugeVec struct {
+	f *family
+}
+
+func (v gaugeVec) With(labelValues ...string) Gauge {
+	return v.f.with(labelValues)
+}
+
+type histogramVec struct {
+	f *family
+}
+
+func (v histogramVec) With(labelValues ...string) Histogram {
+	return &histogram{
+		s:       v.f.with(labelValues),
+		buckets: v.f.buckets,
+	}
+}
+
+type histogram struct {
+	s       *series
+	buckets []float64
+}
+
+func (h *histogram) Observe(v float64) {
+	h.s.lock.Lock()
+	defer h.s.lock.Unlock()
+	for i, upper := range h.buckets {
+		if v <= upper {
+			h.s.buckets[i]++
+		}
+	}
+	h.s.count++
+	h.s.value += v
+}
+
+// DefaultRegistry 内存指标注册表，可通过WritePrometheus导出为Prometheus文本格式
+type DefaultRegistry struct {
+	lock     sync.Mutex
+	families map[string]*family
+}
+
+// NewRegistry 创建内存指标注册表
+func NewRegistry() *DefaultRegistry {
+	return &DefaultRegistry{
+		families: map[string]*family{},
+	}
+}
+
+func (r *DefaultRegistry) register(name, help, typ string, buckets []float64, labelNames []string) *family {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if f, ok := r.families[name]; ok {
+		return f
+	}
+	if typ == typeHistogram {
+		buckets = append([]float64(nil), buckets...)
+		sort.Float64s(buckets)
+	}
+	f := &family{
+		name:       name,
+		help:       help,
+		typ:        typ,
+		labelNames: append([]string(nil), labelNames...),
+		buckets:    buckets,
+		series:     map[string]*series{},
+	}
+	r.families[name] = f
+	return f
+}
+
+func (r *DefaultRegistry) Counter(name, help string, labelNames ...string) CounterVec {
+	return counterVec{r.register(name, help, typeCounter, nil, labelNames)}
+}
+
+func (r *DefaultRegistry) Gauge(name, help string, labelNames ...string) GaugeVec {
+	return gaugeVec{r.register(name, help, typeGauge, nil, labelNames)}
+}
+
+func (r *DefaultRegistry) Histogram(name, help string, buckets []float64, labelNames ...string) HistogramVec {
+	if len(buckets) == 0 {
+		buckets = DefaultDurationBuckets
+	}
+	return histogramVec{r.register(name, help, typeHistogram, buckets, labelNames)}
+}
+
+func (r *DefaultRegistry) sortedFamilies() []*family {
+	r.lock.Lock()
+	ret := make([]*family, 0, len(r.families))
+	for _, f := range r.families {
+		ret = append(ret, f)
+	}
+	r.lock.Unlock()
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].name < ret[j].name
+	})
+	return ret
+}
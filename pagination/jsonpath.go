@@ -0,0 +1,105 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pagination
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// lookup 按路径获得json中的值，路径使用.分隔，数组下标使用[n]，如data.items、meta.cursors[0]
+// 空路径或$表示根，值不存在时返回false
+func lookup(data []byte, path string) (json.RawMessage, bool, error) {
+	cur := json.RawMessage(bytes.TrimSpace(data))
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	if path == "" {
+		return cur, len(cur) > 0, nil
+	}
+	for _, seg := range strings.Split(path, ".") {
+		name := seg
+		var indexes []int
+		if i := strings.IndexByte(seg, '['); i >= 0 {
+			name = seg[:i]
+			for rest := seg[i:]; rest != ""; {
+				end := strings.IndexByte(rest, ']')
+				if rest[0] != '[' || end < 0 {
+					return nil, false, fmt.Errorf("invalid json path %q", path)
+				}
+				n, err := strconv.Atoi(rest[1:end])
+				if err != nil || n < 0 {
+					return nil, false, fmt.Errorf("invalid json path %q", path)
+				}
+				indexes = append(indexes, n)
+				rest = rest[end+1:]
+			}
+		}
+		if name != "" {
+			m := map[string]json.RawMessage{}
+			if isNull(cur) {
+				return nil, false, nil
+			}
+			if err := json.Unmarshal(cur, &m); err != nil {
+				return nil, false, fmt.Errorf("json path %q: %v", path, err)
+			}
+			v, ok := m[name]
+			if !ok {
+				return nil, false, nil
+			}
+			cur = v
+		}
+		for _, n := range indexes {
+			var list []json.RawMessage
+			if isNull(cur) {
+				return nil, false, nil
+			}
+			if err := json.Unmarshal(cur, &list); err != nil {
+				return nil, false, fmt.Errorf("json path %q: %v", path, err)
+			}
+			if n >= len(list) {
+				return nil, false, nil
+			}
+			cur = list[n]
+		}
+	}
+	return cur, true, nil
+}
+
+func isNull(v json.RawMessage) bool {
+	return len(v) == 0 || string(v) == "null"
+}
+
+// lookupString 获得路径对应的字符串或数值，不存在或为null时返回空字符串
+func lookupString(data []byte, path string) (string, error) {
+	v, ok, err := lookup(data, path)
+	if err != nil || !ok || isNull(v) {
+		return "", err
+	}
+	if v[0] == '"' {
+		s := ""
+		if err := json.Unmarshal(v, &s); err != nil {
+			return "", err
+		}
+		return s, nil
+	}
+	if v[0] == '{' || v[0] == '[' {
+		return "", fmt.Errorf("json path %q is not a string or number", path)
+	}
+	return string(v), nil
+}
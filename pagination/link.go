@@ -0,0 +1,120 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pagination
+
+import (
+	"strings"
+)
+
+// Link RFC 8288 Link header中的一个链接
+type Link struct {
+	Url string
+	// 关系类型，如next、prev、last，统一为小写
+	Rel []string
+	// 其他参数，参数名为小写
+	Params map[string]string
+}
+
+// HasRel 是否包含指定的关系类型
+func (l Link) HasRel(rel string) bool {
+	for _, v := range l.Rel {
+		if strings.EqualFold(v, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseLinks 解析Link header，如：<https://api.example.com/users?page=2>; rel="next", <...>; rel="last"
+// 格式错误的链接会被忽略
+func ParseLinks(values ...string) []Link {
+	var ret []Link
+	for _, v := range values {
+		s := v
+		for {
+			s = strings.TrimLeft(s, " \t,")
+			if !strings.HasPrefix(s, "<") {
+				break
+			}
+			end := strings.IndexByte(s, '>')
+			if end < 0 {
+				break
+			}
+			link := Link{Url: strings.TrimSpace(s[1:end]), Params: map[string]string{}}
+			s = s[end+1:]
+			// 参数，以;开始，直到下一个未被引号包含的,
+			for {
+				s = strings.TrimLeft(s, " \t")
+				if !strings.HasPrefix(s, ";") {
+					break
+				}
+				s = strings.TrimLeft(s[1:], " \t")
+				name, value := "", ""
+				i := strings.IndexAny(s, "=;,")
+				if i < 0 {
+					name, s = s, ""
+				} else {
+					name = s[:i]
+					if s[i] == '=' {
+						value, s = paramValue(strings.TrimLeft(s[i+1:], " \t"))
+					} else {
+						s = s[i:]
+					}
+				}
+				name = strings.ToLower(strings.TrimSpace(name))
+				if name == "" {
+					continue
+				}
+				if _, ok := link.Params[name]; !ok {
+					link.Params[name] = value
+				}
+			}
+			if rel, ok := link.Params["rel"]; ok {
+				link.Rel = strings.Fields(strings.ToLower(rel))
+				delete(link.Params, "rel")
+			}
+			ret = append(ret, link)
+		}
+	}
+	return ret
+}
+
+// paramValue 读取参数值，支持引号及转义，返回值及剩余字符串
+func paramValue(s string) (string, string) {
+	if !strings.HasPrefix(s, `"`) {
+		i := strings.IndexAny(s, ";,")
+		if i < 0 {
+			return strings.TrimSpace(s), ""
+		}
+		return strings.TrimSpace(s[:i]), s[i:]
+	}
+	buf := strings.Builder{}
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 < len(s) {
+				i++
+				buf.WriteByte(s[i])
+			}
+		case '"':
+			return buf.String(), s[i+1:]
+		default:
+			buf.WriteByte(s[i])
+		}
+	}
+	return buf.String(), ""
+}
@@ -0,0 +1,283 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pagination
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/xfali/restclient/v2"
+	"github.com/xfali/restclient/v2/request"
+	"net/http"
+	"reflect"
+)
+
+// ErrPageLoop 下一页地址与当前页相同
+var ErrPageLoop = errors.New("pagination: next page is the same as current page")
+
+// Page 一页应答
+type Page struct {
+	// 页序号，从0开始
+	Index      int
+	Url        string
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	// 按OptSetItemsPath解析出的数据列表，未配置路径时仅在body为json数组时解析，否则为nil
+	Items []json.RawMessage
+}
+
+// Decode 将body以json解析到v
+func (p *Page) Decode(v interface{}) error {
+	return json.Unmarshal(p.Body, v)
+}
+
+// Pager 分页迭代器，按翻页策略依次请求每一页，可以逐页（NextPage）或逐条（Next）读取：
+//
+//	p := pagination.New(client, "http://localhost:8080/users", pagination.LinkHeader(),
+//		pagination.OptSetItemsPath("data"), pagination.OptSetMaxItems(100))
+//	for p.Next(ctx) {
+//		user := User{}
+//		if err := p.Scan(&user); err != nil {
+//			return err
+//		}
+//	}
+//	return p.Err()
+type Pager struct {
+	client    restclient.RestClient
+	url       string
+	strategy  Strategy
+	opts      []request.Opt
+	itemsPath string
+	maxPages  int
+	maxItems  int
+
+	started bool
+	done    bool
+	next    string
+	page    *Page
+	pages   int
+	items   int
+	index   int
+	item    json.RawMessage
+	err     error
+}
+
+type Opt func(*Pager)
+
+// New 创建分页迭代器，u为第一页的地址
+func New(client restclient.RestClient, u string, strategy Strategy, opts ...Opt) *Pager {
+	ret := &Pager{
+		client:   client,
+		url:      u,
+		strategy: strategy,
+	}
+	for _, opt := range opts {
+		opt(ret)
+	}
+	return ret
+}
+
+// OptSetRequestOpts 配置每一页请求的参数，如方法、header等
+func OptSetRequestOpts(opts ...request.Opt) Opt {
+	return func(p *Pager) {
+		p.opts = append(p.opts, opts...)
+	}
+}
+
+// OptSetItemsPath 配置数据列表在应答body中的json路径，如data.items，为空时body本身应为json数组
+func OptSetItemsPath(path string) Opt {
+	return func(p *Pager) {
+		p.itemsPath = path
+	}
+}
+
+// OptSetMaxPages 配置最多请求的页数，0表示不限制
+func OptSetMaxPages(n int) Opt {
+	return func(p *Pager) {
+		p.maxPages = n
+	}
+}
+
+// OptSetMaxItems 配置最多读取的数据条数，0表示不限制
+func OptSetMaxItems(n int) Opt {
+	return func(p *Pager) {
+		p.maxItems = n
+	}
+}
+
+// NextPage 请求下一页，没有下一页、达到限制或出错时返回false，出错原因见Err
+// 调用NextPage后当前页中未通过Next读取的数据将被跳过
+func (p *Pager) NextPage(ctx context.Context) bool {
+	if p.done {
+		return false
+	}
+	if err := ctx.Err(); err != nil {
+		p.fail(err)
+		return false
+	}
+	if !p.started {
+		p.started = true
+		u, err := p.strategy.First(p.url)
+		if err != nil {
+			p.fail(err)
+			return false
+		}
+		p.next = u
+	}
+	if p.next == "" || (p.maxPages > 0 && p.pages >= p.maxPages) || (p.maxItems > 0 && p.items >= p.maxItems) {
+		p.done = true
+		return false
+	}
+
+	var body []byte
+	resp := &http.Response{}
+	opts := make([]request.Opt, 0, len(p.opts)+3)
+	opts = append(opts, p.opts...)
+	opts = append(opts, request.WithRequestContext(ctx), request.WithResult(&body), request.WithResponse(resp, false))
+	if err := p.client.Exchange(p.next, opts...); err != nil {
+		p.fail(err)
+		return false
+	}
+	page := &Page{
+		Index:      p.pages,
+		Url:        p.next,
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+		Body:       body,
+	}
+	items, err := p.parseItems(body)
+	if err != nil {
+		p.fail(err)
+		return false
+	}
+	page.Items = items
+	next, err := p.strategy.Next(page)
+	if err != nil {
+		p.fail(err)
+		return false
+	}
+	if next != "" && next == page.Url {
+		p.fail(ErrPageLoop)
+		return false
+	}
+	if p.maxItems > 0 && p.items+len(page.Items) > p.maxItems {
+		page.Items = page.Items[:p.maxItems-p.items]
+	}
+	p.pages++
+	p.items += len(page.Items)
+	p.next = next
+	p.page = page
+	p.index = 0
+	p.item = nil
+	return true
+}
+
+func (p *Pager) parseItems(body []byte) ([]json.RawMessage, error) {
+	v, ok, err := lookup(body, p.itemsPath)
+	if err != nil {
+		return nil, err
+	}
+	if !ok || isNull(v) {
+		if p.itemsPath != "" {
+			return []json.RawMessage{}, nil
+		}
+		return nil, nil
+	}
+	if v[0] != '[' {
+		if p.itemsPath != "" {
+			return nil, fmt.Errorf("pagination: %q is not a json array", p.itemsPath)
+		}
+		return nil, nil
+	}
+	items := []json.RawMessage{}
+	if err := json.Unmarshal(v, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// Next 读取下一条数据，当前页读取完后自动请求下一页，没有更多数据或出错时返回false，出错原因见Err
+func (p *Pager) Next(ctx context.Context) bool {
+	for {
+		if p.done {
+			return false
+		}
+		if err := ctx.Err(); err != nil {
+			p.fail(err)
+			return false
+		}
+		if p.page != nil && p.index < len(p.page.Items) {
+			p.item = p.page.Items[p.index]
+			p.index++
+			return true
+		}
+		if !p.NextPage(ctx) {
+			return false
+		}
+		if p.page.Items == nil {
+			p.fail(ErrNoItems)
+			return false
+		}
+	}
+}
+
+// Page 获得当前页
+func (p *Pager) Page() *Page {
+	return p.page
+}
+
+// Item 获得当前数据的原始json
+func (p *Pager) Item() json.RawMessage {
+	return p.item
+}
+
+// Scan 将当前数据以json解析到v
+func (p *Pager) Scan(v interface{}) error {
+	if p.item == nil {
+		return errors.New("pagination: Scan called without a successful Next")
+	}
+	return json.Unmarshal(p.item, v)
+}
+
+// Err 获得迭代过程中的错误，正常结束时返回nil
+func (p *Pager) Err() error {
+	return p.err
+}
+
+func (p *Pager) fail(err error) {
+	p.err = err
+	p.done = true
+}
+
+// Collect 读取所有数据并追加到result中，result必须为slice的指针
+func (p *Pager) Collect(ctx context.Context, result interface{}) error {
+	v := reflect.ValueOf(result)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Slice {
+		return errors.New("pagination: result must be a pointer to slice")
+	}
+	slice := v.Elem()
+	for p.Next(ctx) {
+		item := reflect.New(slice.Type().Elem())
+		if err := p.Scan(item.Interface()); err != nil {
+			return err
+		}
+		slice.Set(reflect.Append(slice, item.Elem()))
+	}
+	return p.Err()
+}
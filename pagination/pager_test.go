@@ -0,0 +1,253 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pagination
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/xfali/restclient/v2"
+	"github.com/xfali/restclient/v2/request"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+)
+
+type user struct {
+	Id int `json:"id"`
+}
+
+const total = 7
+
+func users(from, to int) []user {
+	var ret []user
+	for i := from; i < to && i < total; i++ {
+		ret = append(ret, user{Id: i})
+	}
+	if ret == nil {
+		ret = []user{}
+	}
+	return ret
+}
+
+func newServer(count *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(count, 1)
+		q := req.URL.Query()
+		writer.Header().Set("Content-Type", "application/json")
+		switch req.URL.Path {
+		case "/link":
+			page, _ := strconv.Atoi(q.Get("page"))
+			if (page+1)*3 < total {
+				writer.Header().Add("Link", fmt.Sprintf(`</link?page=%d>; rel="next", </link?page=0>; rel="first"`, page+1))
+			}
+			_ = json.NewEncoder(writer).Encode(users(page*3, page*3+3))
+		case "/cursor":
+			start, _ := strconv.Atoi(q.Get("cursor"))
+			next := interface{}(nil)
+			if start+3 < total {
+				next = strconv.Itoa(start + 3)
+			}
+			_ = json.NewEncoder(writer).Encode(map[string]interface{}{
+				"data": users(start, start+3),
+				"meta": map[string]interface{}{"next": next},
+			})
+		case "/page":
+			page, _ := strconv.Atoi(q.Get("page"))
+			size, _ := strconv.Atoi(q.Get("size"))
+			_ = json.NewEncoder(writer).Encode(map[string]interface{}{"items": users((page-1)*size, page*size)})
+		case "/offset":
+			offset, _ := strconv.Atoi(q.Get("offset"))
+			limit, _ := strconv.Atoi(q.Get("limit"))
+			_ = json.NewEncoder(writer).Encode(users(offset, offset+limit))
+		case "/loop":
+			writer.Header().Add("Link", `</loop>; rel="next"`)
+			_, _ = writer.Write([]byte(`[]`))
+		default:
+			writer.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func ids(t *testing.T, p *Pager) []int {
+	var ret []user
+	if err := p.Collect(context.Background(), &ret); err != nil {
+		t.Fatal(err)
+	}
+	var list []int
+	for _, v := range ret {
+		list = append(list, v.Id)
+	}
+	return list
+}
+
+func expectIds(t *testing.T, list []int, n int) {
+	if len(list) != n {
+		t.Fatal("expect ", n, " items but get ", list)
+	}
+	for i, v := range list {
+		if v != i {
+			t.Fatal(list)
+		}
+	}
+}
+
+func TestStrategies(t *testing.T) {
+	var count int32
+	server := newServer(&count)
+	defer server.Close()
+	client := restclient.New()
+
+	cases := map[string]*Pager{
+		"link":   New(client, server.URL+"/link", LinkHeader()),
+		"cursor": New(client, server.URL+"/cursor", Cursor("meta.next", "cursor"), OptSetItemsPath("data")),
+		"page":   New(client, server.URL+"/page", PageNumber("page", 1, "size", 3), OptSetItemsPath("items")),
+		"offset": New(client, server.URL+"/offset", Offset("offset", "limit", 3)),
+		"func": New(client, server.URL+"/offset?offset=0&limit=3", StrategyFunc(func(page *Page) (string, error) {
+			if len(page.Items) < 3 {
+				return "", nil
+			}
+			return fmt.Sprintf("%s/offset?offset=%d&limit=3", server.URL, (page.Index+1)*3), nil
+		})),
+	}
+	for name, p := range cases {
+		t.Run(name, func(t *testing.T) {
+			atomic.StoreInt32(&count, 0)
+			expectIds(t, ids(t, p), total)
+			if c := atomic.LoadInt32(&count); c != 3 {
+				t.Fatal("expect 3 pages but get ", c)
+			}
+		})
+	}
+}
+
+func TestPages(t *testing.T) {
+	var count int32
+	server := newServer(&count)
+	defer server.Close()
+	client := restclient.New()
+	ctx := context.Background()
+
+	p := New(client, server.URL+"/cursor", Cursor("meta.next", "cursor"), OptSetItemsPath("data"),
+		OptSetRequestOpts(request.AddRequestHeader("X-Test", "1")))
+	var sizes []int
+	for p.NextPage(ctx) {
+		page := p.Page()
+		sizes = append(sizes, len(page.Items))
+		if page.Index != len(sizes)-1 || page.StatusCode != http.StatusOK {
+			t.Fatal(page.Index, page.StatusCode)
+		}
+		ret := map[string]interface{}{}
+		if err := page.Decode(&ret); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if p.Err() != nil || fmt.Sprint(sizes) != "[3 3 1]" {
+		t.Fatal(p.Err(), sizes)
+	}
+
+	t.Run("max pages", func(t *testing.T) {
+		atomic.StoreInt32(&count, 0)
+		expectIds(t, ids(t, New(client, server.URL+"/link", LinkHeader(), OptSetMaxPages(2))), 6)
+		if atomic.LoadInt32(&count) != 2 {
+			t.Fatal(count)
+		}
+	})
+
+	t.Run("max items", func(t *testing.T) {
+		atomic.StoreInt32(&count, 0)
+		expectIds(t, ids(t, New(client, server.URL+"/link", LinkHeader(), OptSetMaxItems(4))), 4)
+		if atomic.LoadInt32(&count) != 2 {
+			t.Fatal(count)
+		}
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		p := New(client, server.URL+"/link", LinkHeader())
+		n := 0
+		for p.Next(ctx) {
+			n++
+			if n == 2 {
+				cancel()
+			}
+		}
+		if n != 2 || p.Err() != context.Canceled {
+			t.Fatal(n, p.Err())
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		p := New(client, server.URL+"/none", LinkHeader())
+		if p.Next(ctx) {
+			t.Fatal("expect failed")
+		}
+		if e, ok := p.Err().(restclient.Error); !ok || e.StatusCode() != http.StatusNotFound {
+			t.Fatal(p.Err())
+		}
+
+		p = New(client, server.URL+"/loop", LinkHeader())
+		if p.NextPage(ctx) || p.Err() != ErrPageLoop {
+			t.Fatal(p.Err())
+		}
+
+		p = New(client, server.URL+"/cursor", Cursor("meta.next", "cursor"))
+		if p.Next(ctx) || p.Err() != ErrNoItems {
+			t.Fatal(p.Err())
+		}
+	})
+}
+
+func TestParseLinks(t *testing.T) {
+	links := ParseLinks(`<https://a.com/x?a=1,2>; rel="next prev"; title="a;b, c", <https://a.com/last>;rel=last`,
+		`<https://a.com/y>; rel=start`)
+	if len(links) != 3 {
+		t.Fatal(links)
+	}
+	if links[0].Url != "https://a.com/x?a=1,2" || !links[0].HasRel("next") || !links[0].HasRel("PREV") ||
+		links[0].Params["title"] != "a;b, c" {
+		t.Fatal(links[0])
+	}
+	if links[1].Url != "https://a.com/last" || !links[1].HasRel("last") || links[2].Rel[0] != "start" {
+		t.Fatal(links[1:])
+	}
+}
+
+func TestLookup(t *testing.T) {
+	data := []byte(`{"a":{"b":[{"c":"x"},{"c":2}]},"n":null}`)
+	cases := map[string]string{
+		"a.b[0].c":   "x",
+		"$.a.b[1].c": "2",
+		"a.b[2].c":   "",
+		"n.x":        "",
+		"none":       "",
+	}
+	for path, expect := range cases {
+		if v, err := lookupString(data, path); err != nil || v != expect {
+			t.Fatal(path, v, err)
+		}
+	}
+	if _, err := lookupString(data, "a.b"); err == nil {
+		t.Fatal("expect not string")
+	}
+	if _, _, err := lookup(data, "a.b[x]"); err == nil {
+		t.Fatal("expect invalid path")
+	}
+}
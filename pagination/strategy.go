@@ -0,0 +1,178 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pagination
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+)
+
+// ErrNoItems 按数量翻页的策略需要从应答中解析出数据列表，见OptSetItemsPath
+var ErrNoItems = errors.New("pagination: items not found, set items path by OptSetItemsPath")
+
+// Strategy 翻页策略
+type Strategy interface {
+	// First 获得第一页的请求地址
+	First(u string) (string, error)
+
+	// Next 根据当前页获得下一页的请求地址，返回空字符串表示没有下一页
+	Next(page *Page) (string, error)
+}
+
+// StrategyFunc 自定义翻页策略，第一页使用原始地址
+type StrategyFunc func(page *Page) (string, error)
+
+func (f StrategyFunc) First(u string) (string, error) {
+	return u, nil
+}
+
+func (f StrategyFunc) Next(page *Page) (string, error) {
+	return f(page)
+}
+
+type linkStrategy struct{}
+
+// LinkHeader 使用RFC 8288 Link header中rel="next"的链接作为下一页，相对地址基于当前页地址解析
+func LinkHeader() Strategy {
+	return linkStrategy{}
+}
+
+func (s linkStrategy) First(u string) (string, error) {
+	return u, nil
+}
+
+func (s linkStrategy) Next(page *Page) (string, error) {
+	for _, link := range ParseLinks(page.Header.Values("Link")...) {
+		if link.HasRel("next") {
+			return resolve(page.Url, link.Url)
+		}
+	}
+	return "", nil
+}
+
+type cursorStrategy struct {
+	path  string
+	param string
+}
+
+// Cursor 从应答body的json路径（如meta.next_cursor）读取游标，作为下一页请求的query参数param
+// 游标不存在、为null或空字符串时结束
+func Cursor(path, param string) Strategy {
+	return &cursorStrategy{path: path, param: param}
+}
+
+func (s *cursorStrategy) First(u string) (string, error) {
+	return u, nil
+}
+
+func (s *cursorStrategy) Next(page *Page) (string, error) {
+	cursor, err := lookupString(page.Body, s.path)
+	if err != nil || cursor == "" {
+		return "", err
+	}
+	return setQuery(page.Url, s.param, cursor)
+}
+
+type pageStrategy struct {
+	param     string
+	first     int
+	sizeParam string
+	size      int
+}
+
+// PageNumber 使用页码翻页，页码为query参数param，从first开始
+// sizeParam不为空时每页请求size条数据，返回的数据为空或少于size时结束
+func PageNumber(param string, first int, sizeParam string, size int) Strategy {
+	return &pageStrategy{param: param, first: first, sizeParam: sizeParam, size: size}
+}
+
+func (s *pageStrategy) First(u string) (string, error) {
+	u, err := setQuery(u, s.param, strconv.Itoa(s.first))
+	if err != nil || s.sizeParam == "" {
+		return u, err
+	}
+	return setQuery(u, s.sizeParam, strconv.Itoa(s.size))
+}
+
+func (s *pageStrategy) Next(page *Page) (string, error) {
+	if page.Items == nil {
+		return "", ErrNoItems
+	}
+	if len(page.Items) == 0 || (s.size > 0 && len(page.Items) < s.size) {
+		return "", nil
+	}
+	return setQuery(page.Url, s.param, strconv.Itoa(s.first+page.Index+1))
+}
+
+type offsetStrategy struct {
+	offsetParam string
+	limitParam  string
+	limit       int
+}
+
+// Offset 使用偏移量翻页，query参数offsetParam为已读取的数据条数，limitParam为每页数量
+// 返回的数据为空或少于limit时结束
+func Offset(offsetParam, limitParam string, limit int) Strategy {
+	return &offsetStrategy{offsetParam: offsetParam, limitParam: limitParam, limit: limit}
+}
+
+func (s *offsetStrategy) First(u string) (string, error) {
+	u, err := setQuery(u, s.offsetParam, "0")
+	if err != nil {
+		return u, err
+	}
+	return setQuery(u, s.limitParam, strconv.Itoa(s.limit))
+}
+
+func (s *offsetStrategy) Next(page *Page) (string, error) {
+	if page.Items == nil {
+		return "", ErrNoItems
+	}
+	if len(page.Items) == 0 || len(page.Items) < s.limit {
+		return "", nil
+	}
+	u, err := url.Parse(page.Url)
+	if err != nil {
+		return "", err
+	}
+	offset, _ := strconv.Atoi(u.Query().Get(s.offsetParam))
+	return setQuery(page.Url, s.offsetParam, strconv.Itoa(offset+len(page.Items)))
+}
+
+func setQuery(u, key, value string) (string, error) {
+	ret, err := url.Parse(u)
+	if err != nil {
+		return "", err
+	}
+	q := ret.Query()
+	q.Set(key, value)
+	ret.RawQuery = q.Encode()
+	return ret.String(), nil
+}
+
+func resolve(base, ref string) (string, error) {
+	b, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+	r, err := url.Parse(ref)
+	if err != nil {
+		return "", err
+	}
+	return b.ResolveReference(r).String(), nil
+}
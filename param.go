@@ -22,13 +22,20 @@ import (
 	"github.com/xfali/restclient/v2/request"
 	"github.com/xfali/restclient/v2/restutil"
 	"net/http"
+	"time"
 )
 
 type defaultParam struct {
 	ctx           context.Context
 	method        string
 	header        http.Header
-	filterManager filter.FilterManager
+	filterManager filter.NamedFilterManager
+	disabled      []string
+	timeouts      timeouts
+	route         string
+	timings       *restutil.Timings
+	// 配置请求时的错误，由Exchange返回
+	err error
 
 	reqBody  interface{}
 	result   interface{}
@@ -50,6 +57,14 @@ func (p *defaultParam) Set(key string, value interface{}) {
 		p.method = value.(string)
 	case request.KeyAddFilter:
 		p.filterManager.Add(value.([]filter.Filter)...)
+	case request.KeyAddNamedFilter:
+		v := value.(request.NamedFilter)
+		p.filterManager.Remove(v.Name)
+		if err := p.filterManager.AddNamed(v.Name, v.Filter, v.Opts...); err != nil && p.err == nil {
+			p.err = err
+		}
+	case request.KeyDisableFilters:
+		p.disabled = append(p.disabled, value.([]string)...)
 	case request.KeyRequestContext:
 		p.ctx = value.(context.Context)
 	case request.KeyRequestHeader:
@@ -67,6 +82,18 @@ func (p *defaultParam) Set(key string, value interface{}) {
 		rs := value.([]interface{})
 		p.response = rs[0].(*http.Response)
 		p.respFlag = rs[1].(bool)
+	case request.KeyRoute:
+		p.route = value.(string)
+	case request.KeyTimings:
+		p.timings = value.(*restutil.Timings)
+	case request.KeyTimeout:
+		p.timeouts.total = requestTimeout(value.(time.Duration))
+	case request.KeyConnectTimeout:
+		p.timeouts.connect = requestTimeout(value.(time.Duration))
+	case request.KeyFirstByteTimeout:
+		p.timeouts.firstByte = requestTimeout(value.(time.Duration))
+	case request.KeyBodyReadTimeout:
+		p.timeouts.bodyRead = requestTimeout(value.(time.Duration))
 	}
 }
 
@@ -195,6 +222,42 @@ func (p *defaultParam) Response(response *http.Response, withResponseBody bool)
 	return p
 }
 
+// 设置请求的路由模板
+func (p *defaultParam) Route(route string) *defaultParam {
+	p.route = route
+	return p
+}
+
+// 记录请求各阶段的耗时
+func (p *defaultParam) Timings(timings *restutil.Timings) *defaultParam {
+	p.timings = timings
+	return p
+}
+
+// 设置请求的总超时时间
+func (p *defaultParam) Timeout(timeout time.Duration) *defaultParam {
+	p.timeouts.total = requestTimeout(timeout)
+	return p
+}
+
+// 设置获得连接的超时时间
+func (p *defaultParam) ConnectTimeout(timeout time.Duration) *defaultParam {
+	p.timeouts.connect = requestTimeout(timeout)
+	return p
+}
+
+// 设置等待应答第一个字节的超时时间
+func (p *defaultParam) FirstByteTimeout(timeout time.Duration) *defaultParam {
+	p.timeouts.firstByte = requestTimeout(timeout)
+	return p
+}
+
+// 设置读取应答body的超时时间
+func (p *defaultParam) BodyReadTimeout(timeout time.Duration) *defaultParam {
+	p.timeouts.bodyRead = requestTimeout(timeout)
+	return p
+}
+
 func (p *defaultParam) Filters(filters ...filter.Filter) *defaultParam {
 	p.filterManager.Add(filters...)
 	return p
@@ -19,7 +19,9 @@ package request
 import (
 	"context"
 	"github.com/xfali/restclient/v2/filter"
+	"github.com/xfali/restclient/v2/restutil"
 	"net/http"
+	"time"
 )
 
 const (
@@ -33,6 +35,14 @@ const (
 	KeyRequestBody      = "self.request.body.set"
 	KeyResult           = "self.result.set"
 	KeyResponse         = "self.response.set"
+	KeyTimeout          = "self.timeout.total.set"
+	KeyConnectTimeout   = "self.timeout.connect.set"
+	KeyFirstByteTimeout = "self.timeout.firstbyte.set"
+	KeyBodyReadTimeout  = "self.timeout.bodyread.set"
+	KeyRoute            = "self.route.set"
+	KeyTimings          = "self.timings.set"
+	KeyAddNamedFilter   = "self.filter.named.add"
+	KeyDisableFilters   = "self.filter.disable"
 )
 
 // 设置请求方法，请使用http包中的常量配置，如http.MethodPost
@@ -101,9 +111,9 @@ func AddRequestHeader(key, value string) Opt {
 func AddIFilter(filters ...filter.IFilter) Opt {
 	return func(setter Setter) {
 		fs := make([]filter.Filter, 0, len(filters))
-		for i, v := range filters {
+		for _, v := range filters {
 			if v != nil {
-				fs[i] = v.Filter
+				fs = append(fs, v.Filter)
 			}
 		}
 		setter.Set(KeyAddFilter, fs)
@@ -116,6 +126,81 @@ func AddFilter(filters ...filter.Filter) Opt {
 	}
 }
 
+// NamedFilter 命名filter
+type NamedFilter struct {
+	Name   string
+	Filter filter.Filter
+	Opts   []filter.FilterOpt
+}
+
+// 添加命名filter，与client的filter同名时替换client的filter，opts配置优先级及顺序约束
+// 顺序约束存在循环时Exchange返回错误，Origin为filter.ErrCycle
+func AddNamedFilter(name string, f filter.Filter, opts ...filter.FilterOpt) Opt {
+	return func(setter Setter) {
+		setter.Set(KeyAddNamedFilter, NamedFilter{Name: name, Filter: f, Opts: opts})
+	}
+}
+
+// 在该请求中禁用指定名称的client filter，如公开接口跳过认证：
+// request.DisableFilters("auth")
+func DisableFilters(names ...string) Opt {
+	return func(setter Setter) {
+		setter.Set(KeyDisableFilters, names[:])
+	}
+}
+
+// 设置请求的路由模板，如/users/:id，通常使用restutil.UrlBuilder.Route()获得
+// filter可以通过restutil.GetRoute(request.Context())获取，用于指标、日志等避免使用完整的url
+func WithRoute(route string) Opt {
+	return func(setter Setter) {
+		setter.Set(KeyRoute, route)
+	}
+}
+
+// 记录请求各阶段的耗时，请求完成后会自动填充timings，即使client未开启耗时统计
+// filter可以通过restutil.GetTimings(request.Context())获取
+func WithTimings(timings *restutil.Timings) Opt {
+	return func(setter Setter) {
+		setter.Set(KeyTimings, timings)
+	}
+}
+
+// NoTimeout 在单个请求中禁用超时，覆盖client的默认配置，如WithTimeout(NoTimeout)，传入0效果相同
+const NoTimeout time.Duration = -1
+
+// 设置请求的总超时时间，包括建立连接、发送请求及读取应答body，覆盖client的默认配置
+// 总超时从Exchange开始计时，覆盖filter中的所有重试（Retry、认证等），而不是每次发送
+// 需要限制每次发送时使用WithConnectTimeout及WithFirstByteTimeout，它们在每次发送时重新计时，超时时只取消本次发送
+// timeout为0或NoTimeout时禁用client配置的默认总超时
+func WithTimeout(timeout time.Duration) Opt {
+	return func(setter Setter) {
+		setter.Set(KeyTimeout, timeout)
+	}
+}
+
+// 设置获得连接的超时时间，包括域名解析、建立连接及TLS握手，覆盖client的默认配置，0或NoTimeout表示禁用
+// 与WithFirstByteTimeout相同，在每次发送时重新计时，超时时只取消本次发送
+func WithConnectTimeout(timeout time.Duration) Opt {
+	return func(setter Setter) {
+		setter.Set(KeyConnectTimeout, timeout)
+	}
+}
+
+// 设置请求发送完成到收到应答第一个字节的超时时间，覆盖client的默认配置，0或NoTimeout表示禁用
+// 在每次发送（包括重试及对冲请求）时重新计时，超时时只取消本次发送并返回TimeoutError，外层的Retry可以重试
+func WithFirstByteTimeout(timeout time.Duration) Opt {
+	return func(setter Setter) {
+		setter.Set(KeyFirstByteTimeout, timeout)
+	}
+}
+
+// 设置收到应答header后读取应答body的超时时间，覆盖client的默认配置，0或NoTimeout表示禁用
+func WithBodyReadTimeout(timeout time.Duration) Opt {
+	return func(setter Setter) {
+		setter.Set(KeyBodyReadTimeout, timeout)
+	}
+}
+
 // 设置请求方法为GET
 func MethodGet() Opt {
 	return WithMethod(http.MethodGet)
@@ -0,0 +1,260 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package restclienttest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/xfali/restclient/v2/buffer"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Responder 动态生成应答
+type Responder func(request *http.Request) (*http.Response, error)
+
+// Expectation 对请求的预期及对应的应答，通过链式调用配置：
+// mock.Expect(http.MethodPost, "/users").WithJSON(user).Times(2).ReplyJSON(http.StatusCreated, ret)
+type Expectation struct {
+	method   string
+	path     string
+	desc     []string
+	matchers []func(request *http.Request, body []byte) bool
+
+	min, max int
+	calls    int
+
+	status    int
+	header    http.Header
+	body      []byte
+	responder Responder
+	err       error
+	delay     time.Duration
+}
+
+func newExpectation(method, path string) *Expectation {
+	return &Expectation{
+		method: method,
+		path:   path,
+		min:    1,
+		max:    1,
+		status: http.StatusOK,
+		header: http.Header{},
+	}
+}
+
+// WithMatcher 添加自定义的请求匹配
+func (e *Expectation) WithMatcher(desc string, matcher func(request *http.Request, body []byte) bool) *Expectation {
+	e.desc = append(e.desc, desc)
+	e.matchers = append(e.matchers, matcher)
+	return e
+}
+
+// WithHeader 匹配请求header
+func (e *Expectation) WithHeader(key, value string) *Expectation {
+	return e.WithMatcher(fmt.Sprintf("header %s=%s", key, value), func(request *http.Request, body []byte) bool {
+		for _, v := range request.Header.Values(key) {
+			if v == value {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// WithQuery 匹配url query参数
+func (e *Expectation) WithQuery(key, value string) *Expectation {
+	return e.WithMatcher(fmt.Sprintf("query %s=%s", key, value), func(request *http.Request, body []byte) bool {
+		for _, v := range request.URL.Query()[key] {
+			if v == value {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// WithBody 匹配请求body
+func (e *Expectation) WithBody(body string) *Expectation {
+	return e.WithMatcher(fmt.Sprintf("body %s", body), func(request *http.Request, data []byte) bool {
+		return string(data) == body
+	})
+}
+
+// WithJSON 按json语义匹配请求body，v可以为struct、map或json字符串
+func (e *Expectation) WithJSON(v interface{}) *Expectation {
+	var expect []byte
+	switch b := v.(type) {
+	case string:
+		expect = []byte(b)
+	case []byte:
+		expect = b
+	default:
+		var err error
+		expect, err = json.Marshal(v)
+		if err != nil {
+			panic(fmt.Errorf("restclienttest: marshal expected json failed: %v", err))
+		}
+	}
+	return e.WithMatcher(fmt.Sprintf("json %s", expect), func(request *http.Request, data []byte) bool {
+		var ev, av interface{}
+		if json.Unmarshal(expect, &ev) != nil || json.Unmarshal(data, &av) != nil {
+			return bytes.Equal(expect, data)
+		}
+		return reflect.DeepEqual(ev, av)
+	})
+}
+
+// Times 预期请求的次数，默认为1次
+func (e *Expectation) Times(n int) *Expectation {
+	e.min, e.max = n, n
+	return e
+}
+
+// Once 预期请求1次
+func (e *Expectation) Once() *Expectation {
+	return e.Times(1)
+}
+
+// AnyTimes 请求任意次数（包括0次）
+func (e *Expectation) AnyTimes() *Expectation {
+	e.min, e.max = 0, -1
+	return e
+}
+
+// Reply 配置应答的状态码
+func (e *Expectation) Reply(status int) *Expectation {
+	e.status = status
+	return e
+}
+
+// ReplyHeader 添加应答header
+func (e *Expectation) ReplyHeader(key, value string) *Expectation {
+	e.header.Add(key, value)
+	return e
+}
+
+// ReplyBody 配置应答的状态码及body
+func (e *Expectation) ReplyBody(status int, body string) *Expectation {
+	e.status = status
+	e.body = []byte(body)
+	return e
+}
+
+// ReplyJSON 配置应答的状态码及json body，同时设置Content-Type
+func (e *Expectation) ReplyJSON(status int, v interface{}) *Expectation {
+	data, err := json.Marshal(v)
+	if err != nil {
+		panic(fmt.Errorf("restclienttest: marshal reply json failed: %v", err))
+	}
+	e.status = status
+	e.body = data
+	e.header.Set("Content-Type", "application/json")
+	return e
+}
+
+// ReplyFunc 配置动态生成应答的Responder，优先于其他应答配置
+func (e *Expectation) ReplyFunc(responder Responder) *Expectation {
+	e.responder = responder
+	return e
+}
+
+// ReplyError 配置请求返回错误，用于模拟网络错误
+func (e *Expectation) ReplyError(err error) *Expectation {
+	e.err = err
+	return e
+}
+
+// Delay 配置返回应答前的延迟，用于模拟慢请求及超时，请求context取消时立即返回
+func (e *Expectation) Delay(d time.Duration) *Expectation {
+	e.delay = d
+	return e
+}
+
+func (e *Expectation) String() string {
+	ret := e.method + " " + e.path
+	if len(e.desc) > 0 {
+		ret += " [" + strings.Join(e.desc, ", ") + "]"
+	}
+	return ret
+}
+
+func (e *Expectation) match(request *http.Request, body []byte) bool {
+	if e.method != "" && !strings.EqualFold(e.method, request.Method) {
+		return false
+	}
+	if e.path != "" && e.path != request.URL.Path {
+		return false
+	}
+	for _, m := range e.matchers {
+		if !m(request, body) {
+			return false
+		}
+	}
+	return true
+}
+
+func (e *Expectation) full() bool {
+	return e.max >= 0 && e.calls >= e.max
+}
+
+func (e *Expectation) satisfied() bool {
+	return e.calls >= e.min
+}
+
+func (e *Expectation) respond(request *http.Request) (*http.Response, error) {
+	if e.delay > 0 {
+		timer := time.NewTimer(e.delay)
+		select {
+		case <-timer.C:
+		case <-request.Context().Done():
+			timer.Stop()
+			return nil, request.Context().Err()
+		}
+	}
+	if e.err != nil {
+		return nil, e.err
+	}
+	if e.responder != nil {
+		return e.responder(request)
+	}
+	return NewResponse(request, e.status, e.header, e.body), nil
+}
+
+// NewResponse 创建应答，可用于Responder
+func NewResponse(request *http.Request, status int, header http.Header, body []byte) *http.Response {
+	if header == nil {
+		header = http.Header{}
+	}
+	if body == nil {
+		body = []byte{}
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header.Clone(),
+		Body:          buffer.NewReadCloser(body),
+		ContentLength: int64(len(body)),
+		Request:       request,
+	}
+}
@@ -0,0 +1,152 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package restclienttest
+
+import (
+	"errors"
+	"fmt"
+	"github.com/xfali/restclient/v2/buffer"
+	"io/ioutil"
+	"net/http"
+	"sync"
+)
+
+var (
+	// 请求没有匹配的预期
+	ErrUnexpectedRequest = errors.New("restclienttest: unexpected request")
+)
+
+// TestingT *testing.T实现了该接口
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
+// Mock 模拟请求的http.RoundTripper，用于单元测试：
+// mock := restclienttest.NewMock()
+// mock.Expect(http.MethodGet, "/users/1").ReplyJSON(http.StatusOK, user)
+// client := restclient.New(restclient.SetRoundTripper(mock))
+// ...
+// mock.AssertExpectations(t)
+type Mock struct {
+	ordered      bool
+	expectations []*Expectation
+	unexpected   []string
+	lock         sync.Mutex
+}
+
+type Opt func(*Mock)
+
+// NewMock 创建Mock，默认预期与请求顺序无关
+func NewMock(opts ...Opt) *Mock {
+	ret := &Mock{}
+	for _, opt := range opts {
+		opt(ret)
+	}
+	return ret
+}
+
+// OptSetOrdered 配置请求是否必须按预期添加的顺序发送
+func OptSetOrdered(ordered bool) Opt {
+	return func(m *Mock) {
+		m.ordered = ordered
+	}
+}
+
+// Expect 添加预期，method为空时匹配任意方法，path为空时匹配任意路径
+func (m *Mock) Expect(method, path string) *Expectation {
+	e := newExpectation(method, path)
+	m.lock.Lock()
+	m.expectations = append(m.expectations, e)
+	m.lock.Unlock()
+	return e
+}
+
+// Calls 获得预期已匹配的请求次数
+func (m *Mock) Calls(e *Expectation) int {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return e.calls
+}
+
+// Reset 清除所有预期及请求记录
+func (m *Mock) Reset() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.expectations = nil
+	m.unexpected = nil
+}
+
+func (m *Mock) RoundTrip(request *http.Request) (*http.Response, error) {
+	var body []byte
+	if request.Body != nil && request.Body != http.NoBody {
+		var err error
+		body, err = ioutil.ReadAll(request.Body)
+		_ = request.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		request.Body = buffer.NewReadCloser(body)
+	}
+
+	m.lock.Lock()
+	e := m.find(request, body)
+	if e == nil {
+		desc := fmt.Sprintf("%s %s", request.Method, request.URL)
+		m.unexpected = append(m.unexpected, desc)
+		m.lock.Unlock()
+		return nil, fmt.Errorf("%w: %s", ErrUnexpectedRequest, desc)
+	}
+	e.calls++
+	m.lock.Unlock()
+	return e.respond(request)
+}
+
+func (m *Mock) find(request *http.Request, body []byte) *Expectation {
+	for _, e := range m.expectations {
+		if e.full() {
+			continue
+		}
+		if e.match(request, body) {
+			return e
+		}
+		// 顺序模式下，前面的预期未满足时不能跳过
+		if m.ordered && !e.satisfied() {
+			return nil
+		}
+	}
+	return nil
+}
+
+// AssertExpectations 检查所有预期是否满足，并报告未匹配的请求
+func (m *Mock) AssertExpectations(t TestingT) bool {
+	t.Helper()
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	ret := true
+	for _, e := range m.expectations {
+		if !e.satisfied() {
+			t.Errorf("restclienttest: expectation %s not met: expect %d call(s), but get %d", e, e.min, e.calls)
+			ret = false
+		}
+	}
+	for _, v := range m.unexpected {
+		t.Errorf("restclienttest: unexpected request %s", v)
+		ret = false
+	}
+	return ret
+}
@@ -0,0 +1,138 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package restclienttest
+
+import (
+	"errors"
+	"fmt"
+	"github.com/xfali/restclient/v2"
+	"github.com/xfali/restclient/v2/request"
+	"net/http"
+	"testing"
+	"time"
+)
+
+type user struct {
+	Name string `json:"name"`
+	Age  int    `json:"age"`
+}
+
+type recordT struct {
+	errs []string
+}
+
+func (t *recordT) Helper() {}
+
+func (t *recordT) Errorf(format string, args ...interface{}) {
+	t.errs = append(t.errs, fmt.Sprintf(format, args...))
+}
+
+func TestMock(t *testing.T) {
+	mock := NewMock()
+	mock.Expect(http.MethodPost, "/users").
+		WithJSON(user{Name: "test", Age: 18}).
+		WithHeader("X-Trace", "1").
+		ReplyHeader("Location", "/users/1").
+		ReplyJSON(http.StatusCreated, map[string]int{"id": 1})
+	get := mock.Expect(http.MethodGet, "/users/1").Times(2).ReplyJSON(http.StatusOK, user{Name: "test"})
+	mock.Expect(http.MethodGet, "/users").WithQuery("page", "2").
+		ReplyFunc(func(request *http.Request) (*http.Response, error) {
+			return NewResponse(request, http.StatusOK, http.Header{"Content-Type": {"application/json"}},
+				[]byte(`{"name":"`+request.URL.Query().Get("page")+`"}`)), nil
+		})
+	client := restclient.New(restclient.SetRoundTripper(mock))
+
+	ret := map[string]int{}
+	resp := &http.Response{}
+	err := client.Exchange("http://localhost/users",
+		request.MethodPost(),
+		request.AddRequestHeader("X-Trace", "1"),
+		request.WithRequestBody(map[string]interface{}{"age": 18, "name": "test"}),
+		request.WithResult(&ret),
+		request.WithResponse(resp, false))
+	if err != nil || ret["id"] != 1 || resp.StatusCode != http.StatusCreated || resp.Header.Get("Location") != "/users/1" {
+		t.Fatal(err, ret, resp.StatusCode)
+	}
+	for i := 0; i < 2; i++ {
+		u := user{}
+		if err := client.Exchange("http://localhost/users/1", request.WithResult(&u)); err != nil || u.Name != "test" {
+			t.Fatal(err, u)
+		}
+	}
+	if mock.Calls(get) != 2 {
+		t.Fatal(mock.Calls(get))
+	}
+	u := user{}
+	if err := client.Exchange("http://localhost/users?page=2", request.WithResult(&u)); err != nil || u.Name != "2" {
+		t.Fatal(err, u)
+	}
+	if !mock.AssertExpectations(t) {
+		t.Fatal("expect all met")
+	}
+
+	// 超过次数的请求
+	err = client.Exchange("http://localhost/users/1")
+	if e, ok := err.(restclient.Error); !ok || !errors.Is(e.Origin(), ErrUnexpectedRequest) {
+		t.Fatal(err)
+	}
+	rt := &recordT{}
+	mock.Expect(http.MethodDelete, "/users/1")
+	if mock.AssertExpectations(rt) || len(rt.errs) != 2 {
+		t.Fatal(rt.errs)
+	}
+	t.Log(rt.errs)
+}
+
+func TestMockOrdered(t *testing.T) {
+	mock := NewMock(OptSetOrdered(true))
+	mock.Expect(http.MethodGet, "/a")
+	mock.Expect(http.MethodGet, "/b").AnyTimes()
+	mock.Expect(http.MethodGet, "/c")
+	client := restclient.New(restclient.SetRoundTripper(mock))
+
+	if err := client.Exchange("http://localhost/b"); err == nil {
+		t.Fatal("expect out of order")
+	}
+	for _, p := range []string{"/a", "/b", "/b", "/c"} {
+		if err := client.Exchange("http://localhost" + p); err != nil {
+			t.Fatal(p, err)
+		}
+	}
+	rt := &recordT{}
+	if mock.AssertExpectations(rt) || len(rt.errs) != 1 {
+		t.Fatal(rt.errs)
+	}
+}
+
+func TestMockErrorAndDelay(t *testing.T) {
+	mock := NewMock()
+	mock.Expect("", "/error").ReplyError(errors.New("connection reset"))
+	mock.Expect("", "/slow").Delay(time.Second)
+	client := restclient.New(restclient.SetRoundTripper(mock))
+
+	if err := client.Exchange("http://localhost/error"); err == nil {
+		t.Fatal("expect error")
+	}
+	now := time.Now()
+	if err := client.Exchange("http://localhost/slow", request.WithTimeout(50*time.Millisecond)); err == nil {
+		t.Fatal("expect timeout")
+	}
+	if time.Since(now) > 500*time.Millisecond {
+		t.Fatal("expect canceled")
+	}
+	mock.AssertExpectations(t)
+}
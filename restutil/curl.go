@@ -0,0 +1,265 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package restutil
+
+import (
+	"bytes"
+	"github.com/xfali/restclient/v2/buffer"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// 默认内联到命令中的body最大长度，超过时写入临时文件
+	DefaultCurlMaxInlineBody = 64 * 1024
+	// 脱敏后的值
+	CurlRedacted = "[REDACTED]"
+)
+
+var (
+	// 常见的敏感header，默认脱敏
+	CurlSensitiveHeaders = []string{
+		HeaderAuthorization,
+		"Proxy-Authorization",
+		"Cookie",
+		"X-Api-Key",
+	}
+)
+
+type curlOpts struct {
+	redact         map[string]bool
+	maxInlineBody  int
+	bodyDir        string
+	redactUserInfo bool
+}
+
+type CurlOpt func(*curlOpts)
+
+// OptSetCurlRedactHeaders 在CurlSensitiveHeaders之外增加需要脱敏的header，不区分大小写，同时会脱敏url中的密码
+func OptSetCurlRedactHeaders(headers ...string) CurlOpt {
+	return func(o *curlOpts) {
+		for _, v := range headers {
+			o.redact[http.CanonicalHeaderKey(v)] = true
+		}
+		o.redactUserInfo = true
+	}
+}
+
+// OptSetCurlNoRedact 关闭默认的脱敏，命令中将包含Authorization、Cookie及url中的密码等敏感信息
+// 之后的OptSetCurlRedactHeaders仍然生效，可用于只脱敏指定的header
+func OptSetCurlNoRedact() CurlOpt {
+	return func(o *curlOpts) {
+		o.redact = map[string]bool{}
+		o.redactUserInfo = false
+	}
+}
+
+// OptSetCurlMaxInlineBody 配置内联到命令中的body最大长度，超过该长度或body不是文本时写入临时文件
+func OptSetCurlMaxInlineBody(size int) CurlOpt {
+	return func(o *curlOpts) {
+		o.maxInlineBody = size
+	}
+}
+
+// OptSetCurlBodyDir 配置body临时文件的目录，默认为系统临时目录
+func OptSetCurlBodyDir(dir string) CurlOpt {
+	return func(o *curlOpts) {
+		o.bodyDir = dir
+	}
+}
+
+// CurlCommand 请求的快照，可以转换为等价的curl命令
+type CurlCommand struct {
+	Method string
+	URL    string
+	// 与url中的host不同时不为空
+	Host   string
+	Header http.Header
+	Body   []byte
+
+	opts curlOpts
+}
+
+// NewCurlCommand 获得请求的快照，读取请求body时不会影响请求的发送
+// 应在所有filter（包括认证）执行后调用，才能获得最终发送的请求
+// 默认脱敏CurlSensitiveHeaders及url中的密码，可通过OptSetCurlNoRedact关闭
+func NewCurlCommand(request *http.Request, opts ...CurlOpt) (*CurlCommand, error) {
+	ret := &CurlCommand{
+		Method: request.Method,
+		Host:   request.Host,
+		Header: request.Header.Clone(),
+		opts: curlOpts{
+			redact:         map[string]bool{},
+			maxInlineBody:  DefaultCurlMaxInlineBody,
+			redactUserInfo: true,
+		},
+	}
+	for _, v := range CurlSensitiveHeaders {
+		ret.opts.redact[http.CanonicalHeaderKey(v)] = true
+	}
+	for _, opt := range opts {
+		opt(&ret.opts)
+	}
+	// 与url中的host不同时才需要单独设置Host header
+	if ret.Host == request.URL.Host {
+		ret.Host = ""
+	}
+	ret.URL = request.URL.String()
+	if _, ok := request.URL.User.Password(); ok && ret.opts.redactUserInfo {
+		u := *request.URL
+		u.User = nil
+		// 直接拼接，避免脱敏标记被转义
+		ret.URL = strings.Replace(u.String(), "://", "://"+url.PathEscape(request.URL.User.Username())+":"+CurlRedacted+"@", 1)
+	}
+
+	body, err := snapshotBody(request)
+	if err != nil {
+		return nil, err
+	}
+	ret.Body = body
+	return ret, nil
+}
+
+// Curl 将请求转换为等价的curl命令
+func Curl(request *http.Request, opts ...CurlOpt) (string, error) {
+	cmd, err := NewCurlCommand(request, opts...)
+	if err != nil {
+		return "", err
+	}
+	return cmd.Render()
+}
+
+// Render 生成curl命令，body需要写入临时文件时返回的命令通过@文件名引用
+func (c *CurlCommand) Render() (string, error) {
+	buf := strings.Builder{}
+	buf.WriteString("curl")
+	if c.Method == http.MethodHead {
+		// -X HEAD会使curl等待应答body
+		buf.WriteString(" --head")
+	} else if c.Method != http.MethodGet || c.Body != nil {
+		buf.WriteString(" -X ")
+		buf.WriteString(ShellQuote(c.Method))
+	}
+	buf.WriteString(" ")
+	buf.WriteString(ShellQuote(c.URL))
+
+	keys := make([]string, 0, len(c.Header))
+	for k := range c.Header {
+		// curl根据body自动计算
+		if http.CanonicalHeaderKey(k) != "Content-Length" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	if c.Host != "" {
+		buf.WriteString(" -H ")
+		buf.WriteString(ShellQuote("Host: " + c.Host))
+	}
+	for _, k := range keys {
+		for _, v := range c.Header[k] {
+			if c.opts.redact[http.CanonicalHeaderKey(k)] {
+				v = CurlRedacted
+			}
+			buf.WriteString(" -H ")
+			buf.WriteString(ShellQuote(k + ": " + v))
+		}
+	}
+
+	if c.Body != nil {
+		buf.WriteString(" --data-binary ")
+		if len(c.Body) <= c.opts.maxInlineBody && isPrintable(c.Body) {
+			buf.WriteString(ShellQuote(string(c.Body)))
+		} else {
+			name, err := c.writeBodyFile()
+			if err != nil {
+				return "", err
+			}
+			buf.WriteString(ShellQuote("@" + name))
+		}
+	}
+	return buf.String(), nil
+}
+
+func (c *CurlCommand) writeBodyFile() (string, error) {
+	f, err := ioutil.TempFile(c.opts.bodyDir, "restclient-curl-*.body")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err := f.Write(c.Body); err != nil {
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// ShellQuote 使用POSIX shell单引号转义字符串
+func ShellQuote(s string) string {
+	if s == "" {
+		return "''"
+	}
+	safe := true
+	for _, r := range s {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_./:@%+=,", r)) {
+			safe = false
+			break
+		}
+	}
+	if safe {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func isPrintable(data []byte) bool {
+	return utf8.Valid(data) && bytes.IndexByte(data, 0) == -1
+}
+
+// snapshotBody 读取请求body，优先使用GetBody或Bytes方法，否则读取后替换为可重复读取的body
+func snapshotBody(request *http.Request) ([]byte, error) {
+	if request.Body == nil || request.Body == http.NoBody {
+		return nil, nil
+	}
+	if request.GetBody != nil {
+		rc, err := request.GetBody()
+		if err == nil {
+			defer rc.Close()
+			return ioutil.ReadAll(rc)
+		}
+	}
+	if b, ok := request.Body.(interface{ Bytes() []byte }); ok {
+		return append([]byte{}, b.Bytes()...), nil
+	}
+	data, err := ioutil.ReadAll(request.Body)
+	_ = request.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		request.Body = http.NoBody
+		return data, nil
+	}
+	request.Body = buffer.NewReadCloser(data)
+	request.GetBody = func() (io.ReadCloser, error) {
+		return buffer.NewReadCloser(data), nil
+	}
+	return data, nil
+}
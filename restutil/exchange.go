@@ -0,0 +1,67 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package restutil
+
+import (
+	"context"
+	"sync"
+)
+
+type exchangeKey struct{}
+
+type exchangeHooks struct {
+	lock  sync.Mutex
+	hooks []func(err error)
+	done  bool
+}
+
+// WithExchange 在context中保存请求结束的回调列表，返回的done应在请求处理完成（包括解析应答）后调用，
+// err为请求最终返回的错误
+func WithExchange(ctx context.Context) (context.Context, func(err error)) {
+	h := &exchangeHooks{}
+	return context.WithValue(ctx, exchangeKey{}, h), h.run
+}
+
+// OnExchangeDone 注册请求处理完成时的回调，filter可以据此获得解析应答等发生在filter之外的错误
+// context中没有回调列表或请求已经结束时返回false，回调不会被执行
+func OnExchangeDone(ctx context.Context, hook func(err error)) bool {
+	if ctx == nil {
+		return false
+	}
+	h, ok := ctx.Value(exchangeKey{}).(*exchangeHooks)
+	if !ok {
+		return false
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.done {
+		return false
+	}
+	h.hooks = append(h.hooks, hook)
+	return true
+}
+
+func (h *exchangeHooks) run(err error) {
+	h.lock.Lock()
+	hooks := h.hooks
+	h.hooks = nil
+	h.done = true
+	h.lock.Unlock()
+	for _, hook := range hooks {
+		hook(err)
+	}
+}
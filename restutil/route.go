@@ -0,0 +1,56 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package restutil
+
+import (
+	"context"
+	"strings"
+)
+
+type routeKey struct{}
+
+// WithRoute 在context中保存请求的路由模板，如/users/:id，filter可通过GetRoute获得
+func WithRoute(ctx context.Context, route string) context.Context {
+	return context.WithValue(ctx, routeKey{}, route)
+}
+
+// GetRoute 获得context中保存的路由模板，未设置时返回空字符串
+func GetRoute(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	if v, ok := ctx.Value(routeKey{}).(string); ok {
+		return v
+	}
+	return ""
+}
+
+// RouteTemplate 获得url模板的路由部分，即去除scheme、host及query后的path模板
+func RouteTemplate(url string) string {
+	if i := strings.Index(url, "?"); i != -1 {
+		url = url[:i]
+	}
+	if i := strings.Index(url, "://"); i != -1 {
+		url = url[i+3:]
+		if j := strings.Index(url, "/"); j != -1 {
+			url = url[j:]
+		} else {
+			url = "/"
+		}
+	}
+	return url
+}
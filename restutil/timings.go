@@ -0,0 +1,288 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package restutil
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// Timings 请求各阶段的耗时，由httptrace.ClientTrace采集
+// Transport内部重试时，连接相关的耗时为最后一次获得连接的数据
+// 并发发送多次请求（如对冲请求）时，每次发送使用Attempt创建的Timings，只记录被采用的一次
+// 应在应答body关闭后读取
+type Timings struct {
+	// 请求开始时间
+	Start time.Time
+
+	// DNS解析耗时
+	DNS time.Duration
+	// TCP建立连接耗时
+	Connect time.Duration
+	// TLS握手耗时
+	TLSHandshake time.Duration
+	// 获得连接的总耗时，包括DNS、建立连接、TLS握手或等待空闲连接
+	GetConn time.Duration
+	// 从请求发送完成到收到应答第一个字节，近似为服务端处理时间
+	ServerProcessing time.Duration
+	// 从请求开始到收到应答第一个字节
+	TimeToFirstByte time.Duration
+	// 从收到应答第一个字节到应答body读取完成
+	Transfer time.Duration
+	// 请求总耗时
+	Total time.Duration
+
+	// 是否复用连接
+	ConnReused bool
+	// 复用的连接是否来自空闲连接池
+	ConnWasIdle bool
+	// 复用的连接空闲时间
+	ConnIdleTime time.Duration
+	// 服务端地址
+	RemoteAddr string
+	// 获得连接的次数，大于1表示发生了重试
+	Attempts int
+
+	lock         sync.Mutex
+	getConnStart time.Time
+	dnsStart     time.Time
+	connectStart time.Time
+	tlsStart     time.Time
+	wroteRequest time.Time
+	firstByte    time.Time
+	finished     bool
+	// 已创建Attempt，不再记录httptrace事件
+	split bool
+	// Attempt创建的Timings所属的Timings，被采用后结束时同时结束parent
+	parent  *Timings
+	adopted bool
+}
+
+type timingsKey struct{}
+
+// NewTimings 创建Timings，开始时间为当前时间
+func NewTimings() *Timings {
+	return &Timings{
+		Start: time.Now(),
+	}
+}
+
+// WithTimings 在context中保存timings并附加httptrace.ClientTrace，使用该context的请求耗时会记录到timings中
+// filter可通过GetTimings获得
+func WithTimings(ctx context.Context, timings *Timings) context.Context {
+	ctx = context.WithValue(ctx, timingsKey{}, timings)
+	return httptrace.WithClientTrace(ctx, timings.clientTrace())
+}
+
+// GetTimings 获得context中保存的Timings，未开启时返回nil
+func GetTimings(ctx context.Context) *Timings {
+	if ctx == nil {
+		return nil
+	}
+	if v, ok := ctx.Value(timingsKey{}).(*Timings); ok {
+		return v
+	}
+	return nil
+}
+
+// Reset 清空已记录的数据并将开始时间设置为当前时间，以便重复使用
+func (t *Timings) Reset() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.Start = time.Now()
+	t.DNS, t.Connect, t.TLSHandshake, t.GetConn = 0, 0, 0, 0
+	t.ServerProcessing, t.TimeToFirstByte, t.Transfer, t.Total = 0, 0, 0, 0
+	t.ConnReused, t.ConnWasIdle, t.ConnIdleTime = false, false, 0
+	t.RemoteAddr = ""
+	t.Attempts = 0
+	t.getConnStart, t.dnsStart, t.connectStart, t.tlsStart = time.Time{}, time.Time{}, time.Time{}, time.Time{}
+	t.wroteRequest, t.firstByte = time.Time{}, time.Time{}
+	t.finished = false
+	t.split = false
+}
+
+// Attempt 为并发的一次发送创建独立的Timings，开始时间与t相同
+// 调用后t不再记录httptrace事件，应使用WithTimings将返回值附加到该次发送的context，
+// 并在选定结果后调用Adopt将其数据复制到t中
+func (t *Timings) Attempt() *Timings {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.split = true
+	return &Timings{
+		Start:  t.Start,
+		parent: t,
+	}
+}
+
+// Adopt 采用attempt的记录，将其复制到t中，attempt结束时t同时结束
+func (t *Timings) Adopt(attempt *Timings) {
+	attempt.lock.Lock()
+	defer attempt.lock.Unlock()
+	attempt.adopted = true
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.DNS, t.Connect, t.TLSHandshake, t.GetConn = attempt.DNS, attempt.Connect, attempt.TLSHandshake, attempt.GetConn
+	t.ServerProcessing, t.TimeToFirstByte = attempt.ServerProcessing, attempt.TimeToFirstByte
+	t.ConnReused, t.ConnWasIdle, t.ConnIdleTime = attempt.ConnReused, attempt.ConnWasIdle, attempt.ConnIdleTime
+	t.RemoteAddr = attempt.RemoteAddr
+	t.Attempts = attempt.Attempts
+	t.wroteRequest, t.firstByte = attempt.wroteRequest, attempt.firstByte
+	// attempt已结束（如请求失败）时直接使用其结果
+	if attempt.finished {
+		t.Transfer, t.Total = attempt.Transfer, attempt.Total
+		t.finished = true
+	}
+}
+
+// Finish 标记请求结束（应答body读取完成或请求失败），计算传输耗时及总耗时，仅第一次调用生效
+func (t *Timings) Finish() {
+	t.lock.Lock()
+	if t.finished {
+		t.lock.Unlock()
+		return
+	}
+	t.finished = true
+	now := time.Now()
+	if !t.firstByte.IsZero() {
+		t.Transfer = now.Sub(t.firstByte)
+	}
+	t.Total = now.Sub(t.Start)
+	parent := t.parent
+	if !t.adopted {
+		parent = nil
+	}
+	t.lock.Unlock()
+
+	if parent != nil {
+		parent.Finish()
+	}
+}
+
+func (t *Timings) String() string {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return fmt.Sprintf("dns=%s connect=%s tls=%s get_conn=%s server=%s ttfb=%s transfer=%s total=%s reused=%t",
+		t.DNS, t.Connect, t.TLSHandshake, t.GetConn, t.ServerProcessing, t.TimeToFirstByte, t.Transfer, t.Total, t.ConnReused)
+}
+
+func (t *Timings) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		GetConn: func(hostPort string) {
+			t.lock.Lock()
+			defer t.lock.Unlock()
+			if t.split {
+				return
+			}
+			t.getConnStart = time.Now()
+			t.Attempts++
+			t.DNS, t.Connect, t.TLSHandshake = 0, 0, 0
+			t.connectStart = time.Time{}
+		},
+		DNSStart: func(info httptrace.DNSStartInfo) {
+			t.lock.Lock()
+			defer t.lock.Unlock()
+			if t.split {
+				return
+			}
+			t.dnsStart = time.Now()
+		},
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			t.lock.Lock()
+			defer t.lock.Unlock()
+			if t.split {
+				return
+			}
+			t.DNS = time.Since(t.dnsStart)
+		},
+		ConnectStart: func(network, addr string) {
+			t.lock.Lock()
+			defer t.lock.Unlock()
+			if t.split {
+				return
+			}
+			// 同时尝试多个地址时记录第一次开始的时间
+			if t.connectStart.IsZero() {
+				t.connectStart = time.Now()
+			}
+		},
+		ConnectDone: func(network, addr string, err error) {
+			t.lock.Lock()
+			defer t.lock.Unlock()
+			if t.split {
+				return
+			}
+			if err == nil {
+				t.Connect = time.Since(t.connectStart)
+			}
+		},
+		TLSHandshakeStart: func() {
+			t.lock.Lock()
+			defer t.lock.Unlock()
+			if t.split {
+				return
+			}
+			t.tlsStart = time.Now()
+		},
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+			t.lock.Lock()
+			defer t.lock.Unlock()
+			if t.split {
+				return
+			}
+			t.TLSHandshake = time.Since(t.tlsStart)
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.lock.Lock()
+			defer t.lock.Unlock()
+			if t.split {
+				return
+			}
+			t.GetConn = time.Since(t.getConnStart)
+			t.ConnReused = info.Reused
+			t.ConnWasIdle = info.WasIdle
+			t.ConnIdleTime = info.IdleTime
+			if info.Conn != nil {
+				t.RemoteAddr = info.Conn.RemoteAddr().String()
+			}
+		},
+		WroteRequest: func(info httptrace.WroteRequestInfo) {
+			t.lock.Lock()
+			defer t.lock.Unlock()
+			if t.split {
+				return
+			}
+			t.wroteRequest = time.Now()
+		},
+		GotFirstResponseByte: func() {
+			t.lock.Lock()
+			defer t.lock.Unlock()
+			if t.split {
+				return
+			}
+			t.firstByte = time.Now()
+			if !t.wroteRequest.IsZero() {
+				t.ServerProcessing = t.firstByte.Sub(t.wroteRequest)
+			}
+			t.TimeToFirstByte = t.firstByte.Sub(t.Start)
+		},
+	}
+}
@@ -223,3 +223,20 @@ func TestUrlBuilder(t *testing.T) {
 		t.Log(url)
 	})
 }
+
+func TestRouteTemplate(t *testing.T) {
+	cases := map[string]string{
+		"http://localhost:8080/users/:id?a=1": "/users/:id",
+		"http://localhost:8080":               "/",
+		"/users/:id/books":                    "/users/:id/books",
+	}
+	for k, v := range cases {
+		if r := RouteTemplate(k); r != v {
+			t.Fatalf("expect %s but get %s", v, r)
+		}
+	}
+	b := NewUrlBuilder("http://localhost:8080/users/:id").PathVariable("id", 1)
+	if b.Route() != "/users/:id" {
+		t.Fatal(b.Route())
+	}
+}
@@ -171,6 +171,11 @@ func (b *UrlBuilder) Build() string {
 	return buf.String()
 }
 
+// Route 获得路由模板，即未替换path参数的路径，如/users/:id，用于request.WithRoute
+func (b *UrlBuilder) Route() string {
+	return RouteTemplate(b.url)
+}
+
 func (b *UrlBuilder) String() string {
 	return b.Build()
 }
@@ -0,0 +1,207 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package test
+
+import (
+	"bytes"
+	"errors"
+	"github.com/xfali/restclient/v2"
+	"github.com/xfali/restclient/v2/request"
+	"github.com/xfali/xlog"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func writeConfig(t *testing.T, dir, name, content string) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestFromConfig(t *testing.T) {
+	var count int32
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		if atomic.AddInt32(&count, 1) == 1 {
+			writer.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		user, password, _ := req.BasicAuth()
+		writer.Header().Set("Content-Type", "application/yaml")
+		_, _ = writer.Write([]byte("path: " + req.URL.Path + "\napp: " + req.Header.Get("X-App") +
+			"\nenv: " + req.Header.Get("X-Env") + "\nuser: " + user + "\npassword: " + password + "\n"))
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := writeConfig(t, dir, "client.yaml", `
+baseUrl: `+server.URL+`/api
+timeout: 5s
+headers:
+  X-App: demo
+auth:
+  type: basic
+  username: admin
+  password: secret
+retry:
+  maxAttempts: 2
+  backoff: 1ms
+converters: [string, json, yaml]
+filters: [contentLength]
+`)
+	os.Setenv("RESTCLIENT_AUTH_PASSWORD", "fromenv")
+	os.Setenv("RESTCLIENT_HEADERS", "X-App=demo,X-Env=test")
+	defer os.Unsetenv("RESTCLIENT_AUTH_PASSWORD")
+	defer os.Unsetenv("RESTCLIENT_HEADERS")
+
+	client, err := restclient.FromConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ret := map[string]string{}
+	if err := client.Exchange("/users", request.WithResult(&ret)); err != nil {
+		t.Fatal(err)
+	}
+	if ret["path"] != "/api/users" || ret["app"] != "demo" || ret["env"] != "test" ||
+		ret["user"] != "admin" || ret["password"] != "fromenv" || atomic.LoadInt32(&count) != 2 {
+		t.Fatal(ret, count)
+	}
+
+	// 请求中的header优先
+	if err := client.Exchange("users", request.WithResult(&ret), request.AddRequestHeader("X-App", "other")); err != nil {
+		t.Fatal(err)
+	}
+	if ret["app"] != "other" {
+		t.Fatal(ret)
+	}
+}
+
+func TestConfigCurl(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := writeConfig(t, dir, "client.yaml", "filters: [curl]\n")
+	client, err := restclient.FromConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := &bytes.Buffer{}
+	xlog.SetOutputBySeverity(xlog.WARN, buf)
+	defer xlog.SetOutputBySeverity(xlog.WARN, os.Stdout)
+	_ = client.Exchange(server.URL, request.AddRequestHeader("Authorization", "Bearer token"))
+	out := buf.String()
+	if !strings.Contains(out, "Authorization: [REDACTED]") || strings.Contains(out, "token") {
+		t.Fatal(out)
+	}
+}
+
+func TestConfigJson(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		_, _ = writer.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := writeConfig(t, dir, "client.json", `{
+  "transport": {"maxIdleConnsPerHost": 10, "dialTimeout": "3s", "dnsCacheTtl": "1m"},
+  "tls": {"insecureSkipVerify": true, "minVersion": "1.2"},
+  "proxy": "none"
+}`)
+	c, err := restclient.LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Transport.MaxIdleConnsPerHost != 10 || !c.Tls.InsecureSkipVerify {
+		t.Fatal(c.Transport, c.Tls)
+	}
+	client, err := restclient.FromConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ret := ""
+	if err := client.Exchange(server.URL, request.WithResult(&ret)); err != nil || ret != "ok" {
+		t.Fatal(err, ret)
+	}
+}
+
+func TestConfigError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cases := map[string]string{
+		"transport.maxIdle":         "transport:\n  maxIdle: 1\n",
+		"timeout":                   "timeout: 10\n",
+		"transport.maxIdleConns":    "transport:\n  maxIdleConns: -1\n",
+		"auth.username":             "auth:\n  type: basic\n",
+		"auth.type":                 "auth:\n  type: oauth\n",
+		"retry.statusCodes[1]":      "retry:\n  statusCodes: [503, 1000]\n",
+		"filters[0]":                "filters: [unknown]\n",
+		"converters[1]":             "converters: [json, protobuf]\n",
+		"baseUrl":                   "baseUrl: /api\n",
+		"tls.certFile":              "tls:\n  certFile: a.pem\n",
+		"tls.caFile":                "tls:\n  caFile: " + filepath.Join(dir, "none.pem") + "\n",
+		"headers":                   "headers: [a]\n",
+		"transport.idleConnTimeout": "transport:\n  idleConnTimeout: 1x\n",
+	}
+	for key, content := range cases {
+		t.Run(key, func(t *testing.T) {
+			_, err := restclient.FromConfig(writeConfig(t, dir, "client.yaml", content))
+			e := &restclient.ConfigError{}
+			if !errors.As(err, &e) || e.Key != key {
+				t.Fatal(err)
+			}
+			t.Log(err)
+		})
+	}
+
+	t.Run("env", func(t *testing.T) {
+		os.Setenv("RESTCLIENT_TRANSPORT_MAX_IDLE_CONNS", "abc")
+		defer os.Unsetenv("RESTCLIENT_TRANSPORT_MAX_IDLE_CONNS")
+		_, err := restclient.LoadConfig(writeConfig(t, dir, "client.yaml", "timeout: 1s\n"))
+		e := &restclient.ConfigError{}
+		if !errors.As(err, &e) || e.Key != "transport.maxIdleConns" || e.Source != "env RESTCLIENT_TRANSPORT_MAX_IDLE_CONNS" {
+			t.Fatal(err)
+		}
+		if !strings.Contains(err.Error(), "RESTCLIENT_TRANSPORT_MAX_IDLE_CONNS") {
+			t.Fatal(err)
+		}
+	})
+}
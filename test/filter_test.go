@@ -0,0 +1,140 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package test
+
+import (
+	"bytes"
+	"errors"
+	"github.com/xfali/restclient/v2"
+	"github.com/xfali/restclient/v2/buffer"
+	"github.com/xfali/restclient/v2/filter"
+	"github.com/xfali/restclient/v2/request"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestNamedFilter(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/public" && req.Header.Get("Authorization") == "" {
+			writer.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = writer.Write([]byte(req.Header.Get("Authorization")))
+	}))
+	defer server.Close()
+
+	auth := func(token string) filter.Filter {
+		return func(request *http.Request, fc filter.FilterChain) (*http.Response, error) {
+			request.Header.Set("Authorization", token)
+			return fc.Filter(request)
+		}
+	}
+	client := restclient.New(restclient.AddNamedFilter("auth", auth("Bearer client")))
+
+	ret := ""
+	if err := client.Exchange(server.URL+"/private", request.WithResult(&ret)); err != nil || ret != "Bearer client" {
+		t.Fatal(err, ret)
+	}
+	ret = ""
+	if err := client.Exchange(server.URL+"/public", request.WithResult(&ret), request.DisableFilters("auth")); err != nil || ret != "" {
+		t.Fatal(err, ret)
+	}
+	if err := client.Exchange(server.URL+"/private", request.DisableFilters("auth")); err == nil {
+		t.Fatal("expect unauthorized")
+	}
+	if err := client.Exchange(server.URL+"/private", request.WithResult(&ret),
+		request.AddNamedFilter("auth", auth("Bearer request"))); err != nil || ret != "Bearer request" {
+		t.Fatal(err, ret)
+	}
+	err := client.Exchange(server.URL+"/private",
+		request.AddNamedFilter("a", auth("Bearer a"), filter.WithBefore("b")),
+		request.AddNamedFilter("b", auth("Bearer b"), filter.WithBefore("a")))
+	if err == nil || !errors.Is(err.Origin(), filter.ErrCycle) {
+		t.Fatal("expect cycle error but get ", err)
+	}
+}
+
+type countingPool struct {
+	buffer.Pool
+	gets, puts int32
+}
+
+func (p *countingPool) Get() *bytes.Buffer {
+	atomic.AddInt32(&p.gets, 1)
+	return p.Pool.Get()
+}
+
+func (p *countingPool) Put(buf *bytes.Buffer) {
+	atomic.AddInt32(&p.puts, 1)
+	p.Pool.Put(buf)
+}
+
+func TestTransferFilters(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		if req.ContentLength <= 0 {
+			t.Error("expect Content-Length ", req.TransferEncoding)
+		}
+		body, _ := ioutil.ReadAll(req.Body)
+		writer.Header().Set("Content-Type", "application/json")
+		writer.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		_, _ = writer.Write(body)
+	}))
+	defer server.Close()
+
+	var (
+		lock sync.Mutex
+		last = map[filter.Direction]filter.TransferProgress{}
+	)
+	progress := filter.NewProgress(func(request *http.Request, p filter.TransferProgress) {
+		lock.Lock()
+		defer lock.Unlock()
+		last[p.Direction] = p
+	})
+	pool := &countingPool{Pool: buffer.NewPool()}
+	client := restclient.New(restclient.SetBufferPool(pool),
+		restclient.AddFilter(filter.ContentLengthFilter), restclient.AddIFilter(progress))
+
+	body := map[string]string{"data": strings.Repeat("x", 64*1024)}
+	ret := map[string]string{}
+	now := time.Now()
+	err := client.Exchange(server.URL, request.MethodPost(), request.WithRequestBody(body), request.WithResult(&ret),
+		request.AddIFilter(filter.NewThrottle(filter.OptSetThrottleSendRate(256*1024))))
+	if err != nil || ret["data"] != body["data"] {
+		t.Fatal(err, len(ret["data"]))
+	}
+	// 突发25KB后剩余约40KB
+	if time.Since(now) < 100*time.Millisecond {
+		t.Fatal("expect throttled ", time.Since(now))
+	}
+	lock.Lock()
+	send, receive := last[filter.DirectionSend], last[filter.DirectionReceive]
+	lock.Unlock()
+	if !send.Done || send.Total <= 64*1024 || send.Transferred != send.Total ||
+		!receive.Done || receive.Total != send.Total || receive.Transferred != receive.Total {
+		t.Fatal(send, receive)
+	}
+	if gets, puts := atomic.LoadInt32(&pool.gets), atomic.LoadInt32(&pool.puts); gets == 0 || gets != puts {
+		t.Fatal("expect pooled buffers returned once ", gets, puts)
+	}
+}
@@ -0,0 +1,130 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package test
+
+import (
+	"github.com/xfali/restclient/v2"
+	"github.com/xfali/restclient/v2/filter"
+	"github.com/xfali/restclient/v2/request"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/slow_header":
+			time.Sleep(300 * time.Millisecond)
+			_, _ = writer.Write([]byte("hello"))
+		case "/slow_body":
+			_, _ = writer.Write([]byte("hello"))
+			writer.(http.Flusher).Flush()
+			time.Sleep(300 * time.Millisecond)
+			_, _ = writer.Write([]byte(" world"))
+		}
+	}))
+	defer server.Close()
+
+	t.Run("first byte", func(t *testing.T) {
+		client := restclient.New()
+		ret := ""
+		err := client.Exchange(server.URL+"/slow_header",
+			request.WithResult(&ret),
+			request.WithFirstByteTimeout(100*time.Millisecond))
+		if kind, ok := restclient.IsTimeout(err); !ok || kind != restclient.TimeoutFirstByte {
+			t.Fatal("expect first byte timeout but get ", err)
+		}
+		t.Log(err)
+	})
+
+	t.Run("body read", func(t *testing.T) {
+		client := restclient.New(restclient.SetBodyReadTimeout(100 * time.Millisecond))
+		ret := ""
+		err := client.Exchange(server.URL+"/slow_body", request.WithResult(&ret))
+		if kind, ok := restclient.IsTimeout(err); !ok || kind != restclient.TimeoutBodyRead {
+			t.Fatal("expect body read timeout but get ", err)
+		}
+		t.Log(err)
+	})
+
+	t.Run("total", func(t *testing.T) {
+		client := restclient.New(restclient.SetTimeout(100 * time.Millisecond))
+		ret := ""
+		err := client.Exchange(server.URL+"/slow_body", request.WithResult(&ret))
+		if kind, ok := restclient.IsTimeout(err); !ok || kind != restclient.TimeoutTotal {
+			t.Fatal("expect total timeout but get ", err)
+		}
+		t.Log(err)
+	})
+
+	t.Run("override", func(t *testing.T) {
+		client := restclient.New(restclient.SetTimeout(100 * time.Millisecond))
+		ret := ""
+		err := client.Exchange(server.URL+"/slow_body",
+			request.WithResult(&ret),
+			request.WithTimeout(time.Second))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ret != "hello world" {
+			t.Fatal("expect hello world but get ", ret)
+		}
+	})
+
+	t.Run("disable", func(t *testing.T) {
+		client := restclient.New(restclient.SetTimeout(100*time.Millisecond),
+			restclient.SetFirstByteTimeout(100*time.Millisecond))
+		for _, v := range []time.Duration{0, request.NoTimeout} {
+			ret := ""
+			err := client.Exchange(server.URL+"/slow_header",
+				request.WithResult(&ret),
+				request.WithTimeout(v),
+				request.WithFirstByteTimeout(v))
+			if err != nil || ret != "hello" {
+				t.Fatal(err, ret)
+			}
+		}
+	})
+
+	t.Run("retry", func(t *testing.T) {
+		var count int32
+		stall := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+			if atomic.AddInt32(&count, 1) == 1 {
+				select {
+				case <-req.Context().Done():
+					return
+				case <-time.After(time.Second):
+				}
+			}
+			_, _ = writer.Write([]byte("hello"))
+		}))
+		defer stall.Close()
+
+		// 等待第一个字节超时只取消本次发送，外层的Retry可以重试
+		client := restclient.New(restclient.AddIFilter(filter.NewRetry(filter.OptSetRetryBackoff(time.Millisecond, time.Millisecond))))
+		ret := ""
+		err := client.Exchange(stall.URL,
+			request.WithResult(&ret),
+			request.WithFirstByteTimeout(100*time.Millisecond))
+		if err != nil || ret != "hello" || atomic.LoadInt32(&count) != 2 {
+			t.Fatal(err, ret, count)
+		}
+	})
+}
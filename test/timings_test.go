@@ -0,0 +1,130 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package test
+
+import (
+	"github.com/xfali/restclient/v2"
+	"github.com/xfali/restclient/v2/filter"
+	"github.com/xfali/restclient/v2/request"
+	"github.com/xfali/restclient/v2/restutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTimings(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		if req.URL.Path == "/notfound" {
+			writer.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = writer.Write([]byte("hello"))
+		writer.(http.Flusher).Flush()
+		time.Sleep(50 * time.Millisecond)
+		_, _ = writer.Write([]byte(" world"))
+	}))
+	defer server.Close()
+
+	t.Run("request", func(t *testing.T) {
+		client := restclient.New()
+		timings := restutil.NewTimings()
+		ret := ""
+		err := client.Exchange(server.URL, request.WithResult(&ret), request.WithTimings(timings))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Log(timings)
+		if timings.Attempts != 1 || timings.ConnReused || timings.RemoteAddr == "" {
+			t.Fatal(timings.Attempts, timings.ConnReused, timings.RemoteAddr)
+		}
+		if timings.ServerProcessing < 50*time.Millisecond || timings.Transfer < 50*time.Millisecond ||
+			timings.Total < timings.TimeToFirstByte+timings.Transfer-time.Millisecond {
+			t.Fatal(timings)
+		}
+
+		err = client.Exchange(server.URL, request.WithResult(&ret), request.WithTimings(timings))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !timings.ConnReused || timings.Connect != 0 {
+			t.Fatal("expect reused connection ", timings)
+		}
+	})
+
+	t.Run("filter and error", func(t *testing.T) {
+		var fromFilter *restutil.Timings
+		client := restclient.New(restclient.EnableTimings(),
+			restclient.AddFilter(func(request *http.Request, fc filter.FilterChain) (*http.Response, error) {
+				fromFilter = restutil.GetTimings(request.Context())
+				return fc.Filter(request)
+			}))
+		err := client.Exchange(server.URL + "/notfound")
+		if err == nil {
+			t.Fatal("expect error")
+		}
+		timings := restclient.GetTimings(err)
+		if timings == nil || timings != fromFilter {
+			t.Fatal("expect timings in error and filter")
+		}
+		if timings.Total == 0 || timings.TimeToFirstByte == 0 {
+			t.Fatal(timings)
+		}
+	})
+
+	t.Run("response", func(t *testing.T) {
+		client := restclient.New(restclient.EnableTimings())
+		resp := &http.Response{}
+		err := client.Exchange(server.URL, request.WithResponse(resp, false))
+		if err != nil {
+			t.Fatal(err)
+		}
+		timings := restutil.GetTimings(resp.Request.Context())
+		if timings == nil || timings.Total == 0 {
+			t.Fatal("expect timings in response")
+		}
+	})
+	t.Run("hedging", func(t *testing.T) {
+		var count int32
+		slow := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+			if atomic.AddInt32(&count, 1) == 1 {
+				select {
+				case <-req.Context().Done():
+					return
+				case <-time.After(time.Second):
+				}
+			}
+			_, _ = writer.Write([]byte("hello"))
+		}))
+		defer slow.Close()
+
+		client := restclient.New(restclient.AddIFilter(filter.NewHedging(filter.OptSetHedgingDelay(50 * time.Millisecond))))
+		timings := restutil.NewTimings()
+		ret := ""
+		err := client.Exchange(slow.URL, request.WithResult(&ret), request.WithTimings(timings))
+		if err != nil || ret != "hello" {
+			t.Fatal(err, ret)
+		}
+		// 只记录先返回的对冲请求
+		if timings.Attempts != 1 || timings.ServerProcessing > 500*time.Millisecond ||
+			timings.Total == 0 || timings.Total > 500*time.Millisecond {
+			t.Fatal(timings.Attempts, timings)
+		}
+	})
+}
@@ -0,0 +1,312 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package restclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/xfali/restclient/v2/request"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+type TimeoutKind int
+
+const (
+	// 请求总超时
+	TimeoutTotal TimeoutKind = iota + 1
+	// 获得连接超时，包括域名解析、建立连接及TLS握手
+	TimeoutConnect
+	// 等待应答第一个字节超时
+	TimeoutFirstByte
+	// 读取应答body超时
+	TimeoutBodyRead
+)
+
+func (k TimeoutKind) String() string {
+	switch k {
+	case TimeoutTotal:
+		return "total"
+	case TimeoutConnect:
+		return "connect"
+	case TimeoutFirstByte:
+		return "first byte"
+	case TimeoutBodyRead:
+		return "body read"
+	}
+	return "unknown"
+}
+
+// TimeoutError 请求超时错误，可通过Error.Origin()获得，或使用IsTimeout判断
+type TimeoutError struct {
+	Kind     TimeoutKind
+	Duration time.Duration
+	Err      error
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("restclient: %s timeout after %s", e.Kind, e.Duration)
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// Timeout 实现net.Error
+func (e *TimeoutError) Timeout() bool {
+	return true
+}
+
+// Temporary 实现net.Error
+func (e *TimeoutError) Temporary() bool {
+	return true
+}
+
+// IsTimeout 判断错误是否为超时错误，并返回超时类型
+func IsTimeout(err error) (TimeoutKind, bool) {
+	if e, ok := err.(Error); ok {
+		err = e.Origin()
+	}
+	var te *TimeoutError
+	if errors.As(err, &te) {
+		return te.Kind, true
+	}
+	return 0, false
+}
+
+type timeouts struct {
+	total     time.Duration
+	connect   time.Duration
+	firstByte time.Duration
+	bodyRead  time.Duration
+}
+
+// requestTimeout 请求中显式配置的超时，0及负数（如request.NoTimeout）表示禁用，以区别于未配置
+func requestTimeout(d time.Duration) time.Duration {
+	if d <= 0 {
+		return request.NoTimeout
+	}
+	return d
+}
+
+// merge 使用o中配置的值覆盖默认值，o中的负数表示禁用该超时
+func (t timeouts) merge(o timeouts) timeouts {
+	if o.total != 0 {
+		t.total = o.total
+	}
+	if o.connect != 0 {
+		t.connect = o.connect
+	}
+	if o.firstByte != 0 {
+		t.firstByte = o.firstByte
+	}
+	if o.bodyRead != 0 {
+		t.bodyRead = o.bodyRead
+	}
+	return t
+}
+
+// duration 获得超时类型对应的超时时间
+func (t timeouts) duration(kind TimeoutKind) time.Duration {
+	switch kind {
+	case TimeoutConnect:
+		return t.connect
+	case TimeoutFirstByte:
+		return t.firstByte
+	case TimeoutBodyRead:
+		return t.bodyRead
+	}
+	return t.total
+}
+
+// timers 超时计时器，超时时记录第一个超时的类型并取消context
+type timers struct {
+	cancel context.CancelFunc
+
+	lock sync.Mutex
+	kind TimeoutKind
+}
+
+func (t *timers) start(kind TimeoutKind, d time.Duration) *time.Timer {
+	return time.AfterFunc(d, func() {
+		t.lock.Lock()
+		if t.kind == 0 {
+			t.kind = kind
+		}
+		t.lock.Unlock()
+		t.cancel()
+	})
+}
+
+// restart 重新开始计时
+func (t *timers) restart(timer **time.Timer, kind TimeoutKind, d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if *timer != nil {
+		(*timer).Stop()
+	}
+	*timer = t.start(kind, d)
+}
+
+func (t *timers) stop(timer **time.Timer) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if *timer != nil {
+		(*timer).Stop()
+	}
+}
+
+// expired 获得超时类型，未超时时返回0
+func (t *timers) expired() TimeoutKind {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.kind
+}
+
+// timeoutControl 一次Exchange的超时控制（总超时、读取应答body超时），超时时取消整个Exchange
+type timeoutControl struct {
+	timers
+	timeouts timeouts
+	total    *time.Timer
+	bodyRead *time.Timer
+}
+
+type sendTimeoutsKey struct{}
+
+// newTimeoutControl 根据配置启动总超时计时器，获得连接及等待第一个字节的超时保存在context中，
+// 由发送请求的filter在每次发送时使用
+func newTimeoutControl(ctx context.Context, t timeouts) (context.Context, *timeoutControl) {
+	ctx, cancel := context.WithCancel(ctx)
+	tc := &timeoutControl{
+		timers:   timers{cancel: cancel},
+		timeouts: t,
+	}
+	if t.total > 0 {
+		tc.total = tc.start(TimeoutTotal, t.total)
+	}
+	if t.connect > 0 || t.firstByte > 0 {
+		ctx = context.WithValue(ctx, sendTimeoutsKey{}, t)
+	}
+	return ctx, tc
+}
+
+// startBodyRead 收到应答header后开始读取body计时
+func (tc *timeoutControl) startBodyRead() {
+	tc.restart(&tc.bodyRead, TimeoutBodyRead, tc.timeouts.bodyRead)
+}
+
+// wrap 如果已经超时，则将err转换为TimeoutError
+func (tc *timeoutControl) wrap(err error) error {
+	kind := tc.expired()
+	if kind == 0 {
+		return err
+	}
+	return &TimeoutError{
+		Kind:     kind,
+		Duration: tc.timeouts.duration(kind),
+		Err:      err,
+	}
+}
+
+// close 停止所有计时器并释放context
+func (tc *timeoutControl) close() {
+	tc.stop(&tc.total)
+	tc.stop(&tc.bodyRead)
+	tc.cancel()
+}
+
+// sendTimeout 一次发送的超时控制（获得连接、等待应答第一个字节）
+// 每次发送（包括重试、认证重发及对冲请求）使用独立的context及计时器，超时时只取消本次发送
+type sendTimeout struct {
+	timers
+	timeouts  timeouts
+	connect   *time.Timer
+	firstByte *time.Timer
+}
+
+// newSendTimeout 创建本次发送的超时控制，未配置获得连接及等待第一个字节的超时时返回nil
+func newSendTimeout(ctx context.Context) (context.Context, *sendTimeout) {
+	t, ok := ctx.Value(sendTimeoutsKey{}).(timeouts)
+	if !ok {
+		return ctx, nil
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	st := &sendTimeout{
+		timers:   timers{cancel: cancel},
+		timeouts: t,
+	}
+	ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GetConn: func(hostPort string) {
+			st.restart(&st.connect, TimeoutConnect, t.connect)
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			st.stop(&st.connect)
+		},
+		WroteRequest: func(info httptrace.WroteRequestInfo) {
+			st.restart(&st.firstByte, TimeoutFirstByte, t.firstByte)
+		},
+		GotFirstResponseByte: func() {
+			st.stop(&st.firstByte)
+		},
+	})
+	return ctx, st
+}
+
+// done 停止计时器，本次发送超时时返回TimeoutError，否则在应答body关闭时释放context
+func (st *sendTimeout) done(resp *http.Response, err error) (*http.Response, error) {
+	st.stop(&st.connect)
+	st.stop(&st.firstByte)
+	if kind := st.expired(); kind != 0 {
+		if resp != nil && resp.Body != nil {
+			resp.Body.Close()
+		}
+		st.cancel()
+		if err == nil {
+			err = context.Canceled
+		}
+		return nil, &TimeoutError{
+			Kind:     kind,
+			Duration: st.timeouts.duration(kind),
+			Err:      err,
+		}
+	}
+	if err != nil || resp == nil || resp.Body == nil {
+		st.cancel()
+		return resp, err
+	}
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: st.cancel}
+	return resp, nil
+}
+
+// cancelBody 应答body关闭时释放本次发送的context
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
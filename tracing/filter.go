@@ -0,0 +1,228 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tracing
+
+import (
+	"errors"
+	"fmt"
+	"github.com/xfali/restclient/v2/filter"
+	"github.com/xfali/restclient/v2/restutil"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// OpenTelemetry HTTP客户端语义约定属性名
+const (
+	AttrHttpMethod       = "http.request.method"
+	AttrHttpStatusCode   = "http.response.status_code"
+	AttrHttpResendCount  = "http.request.resend_count"
+	AttrHttpRoute        = "http.route"
+	AttrUrlFull          = "url.full"
+	AttrUrlScheme        = "url.scheme"
+	AttrServerAddress    = "server.address"
+	AttrServerPort       = "server.port"
+	AttrErrorType        = "error.type"
+	AttrResponseBodySize = "http.response.body.size"
+)
+
+// Filter 分布式跟踪filter，每次请求创建一个client span，并将SpanContext注入请求header
+// span在应答body关闭时结束，因此包含读取body的时间；通过restclient发送时在Exchange返回后结束，
+// 并记录解析应答失败等发生在filter之外的错误
+// 与filter.Retry同时使用时应位于Retry内层（先于Retry添加），每次发送创建独立的span，
+// 重试的span记录http.request.resend_count
+type Filter struct {
+	tracer     Tracer
+	propagator Propagator
+	spanName   func(request *http.Request) string
+}
+
+type Opt func(*Filter)
+
+// NewFilter 创建跟踪filter，默认使用W3C Trace Context传递
+func NewFilter(tracer Tracer, opts ...Opt) *Filter {
+	ret := &Filter{
+		tracer:     tracer,
+		propagator: W3C(),
+		spanName:   SpanName,
+	}
+	for _, opt := range opts {
+		opt(ret)
+	}
+	return ret
+}
+
+// OptSetPropagator 配置header传递格式，如同时使用W3C及B3：
+// OptSetPropagator(Composite(W3C(), B3(true)))
+func OptSetPropagator(propagator Propagator) Opt {
+	return func(f *Filter) {
+		f.propagator = propagator
+	}
+}
+
+// OptSetSpanName 配置span名称生成方法，默认为SpanName
+func OptSetSpanName(spanName func(request *http.Request) string) Opt {
+	return func(f *Filter) {
+		f.spanName = spanName
+	}
+}
+
+// SpanName 默认span名称，设置路由模板时为"{method} {route}"，否则为"{method}"
+func SpanName(request *http.Request) string {
+	if route := restutil.GetRoute(request.Context()); route != "" {
+		return request.Method + " " + route
+	}
+	return request.Method
+}
+
+func (f *Filter) Filter(request *http.Request, fc filter.FilterChain) (*http.Response, error) {
+	ctx, span := f.tracer.Start(request.Context(), f.spanName(request), SpanKindClient)
+	setRequestAttributes(span, request)
+	if n := filter.ResendCount(ctx); n > 0 {
+		span.SetAttribute(AttrHttpResendCount, n)
+	}
+
+	request = request.WithContext(ctx)
+	request.Header = request.Header.Clone()
+	if request.Header == nil {
+		request.Header = http.Header{}
+	}
+	f.propagator.Inject(span.SpanContext(), request.Header)
+
+	resp, err := fc.Filter(request)
+	if err != nil || resp == nil {
+		if err == nil {
+			err = errors.New("restclient: nil response")
+		}
+		RecordError(span, err)
+		span.End()
+		return resp, err
+	}
+
+	span.SetAttribute(AttrHttpStatusCode, resp.StatusCode)
+	if resp.StatusCode >= http.StatusBadRequest {
+		span.SetAttribute(AttrErrorType, strconv.Itoa(resp.StatusCode))
+		span.SetStatus(StatusError, fmt.Sprintf("restclient status: [%d] %s", resp.StatusCode, http.StatusText(resp.StatusCode)))
+	}
+	end := &spanEnd{span: span, pending: 1}
+	if restutil.OnExchangeDone(ctx, func(err error) {
+		// 状态码错误已根据应答记录
+		if err != nil && resp.StatusCode < http.StatusBadRequest {
+			RecordError(span, err)
+		}
+		end.release()
+	}) {
+		end.pending++
+	}
+	if resp.Body == nil {
+		end.release()
+	} else {
+		resp.Body = &spanBody{ReadCloser: resp.Body, end: end}
+	}
+	return resp, nil
+}
+
+// RecordError 记录错误并将span状态设置为Error，error.type为错误的类型，
+// restclient.Error等包含原始错误（Origin() error）时为原始错误的类型
+// 应答状态码错误由Filter根据应答直接记录
+func RecordError(span Span, err error) {
+	if err == nil {
+		return
+	}
+	span.RecordError(err)
+	errType := err
+	if e, ok := err.(interface{ Origin() error }); ok && e.Origin() != nil {
+		errType = e.Origin()
+	}
+	span.SetAttribute(AttrErrorType, fmt.Sprintf("%T", errType))
+	span.SetStatus(StatusError, err.Error())
+}
+
+func setRequestAttributes(span Span, request *http.Request) {
+	u := request.URL
+	span.SetAttribute(AttrHttpMethod, request.Method)
+	span.SetAttribute(AttrUrlScheme, u.Scheme)
+	span.SetAttribute(AttrServerAddress, u.Hostname())
+	port := u.Port()
+	if port == "" {
+		switch u.Scheme {
+		case "http":
+			port = "80"
+		case "https":
+			port = "443"
+		}
+	}
+	if p, err := strconv.Atoi(port); err == nil {
+		span.SetAttribute(AttrServerPort, p)
+	}
+	// 不记录url中的用户名密码
+	full := *u
+	if full.User != nil {
+		full.User = nil
+	}
+	span.SetAttribute(AttrUrlFull, full.String())
+	if route := restutil.GetRoute(request.Context()); route != "" {
+		span.SetAttribute(AttrHttpRoute, route)
+	}
+}
+
+// spanEnd 应答body关闭且Exchange返回后结束span
+type spanEnd struct {
+	span    Span
+	lock    sync.Mutex
+	pending int
+	size    int64
+}
+
+func (e *spanEnd) release() {
+	e.lock.Lock()
+	e.pending--
+	end := e.pending == 0
+	e.lock.Unlock()
+	if end {
+		e.span.SetAttribute(AttrResponseBodySize, e.size)
+		e.span.End()
+	}
+}
+
+type spanBody struct {
+	io.ReadCloser
+	end  *spanEnd
+	size int64
+	once sync.Once
+}
+
+func (b *spanBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.size += int64(n)
+	if err != nil && err != io.EOF {
+		RecordError(b.end.span, err)
+	}
+	return n, err
+}
+
+func (b *spanBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() {
+		b.end.lock.Lock()
+		b.end.size = b.size
+		b.end.lock.Unlock()
+		b.end.release()
+	})
+	return err
+}
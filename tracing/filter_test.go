@@ -0,0 +1,221 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"github.com/xfali/restclient/v2"
+	"github.com/xfali/restclient/v2/filter"
+	"github.com/xfali/restclient/v2/request"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestFilter(t *testing.T) {
+	var received http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		received = request.Header.Clone()
+		if request.URL.Path == "/notfound" {
+			writer.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if request.URL.Path == "/invalid" {
+			writer.Header().Set("Content-Type", "application/json")
+			_, _ = writer.Write([]byte("{invalid"))
+			return
+		}
+		_, _ = writer.Write([]byte("hello"))
+	}))
+	defer server.Close()
+
+	exporter := NewInMemoryExporter()
+	tracer := NewTracer(exporter)
+	client := restclient.New(restclient.AddIFilter(NewFilter(tracer,
+		OptSetPropagator(Composite(W3C(), B3(true))))))
+
+	t.Run("propagation", func(t *testing.T) {
+		exporter.Reset()
+		ctx, parent := tracer.Start(context.Background(), "parent", SpanKindInternal)
+		ret := ""
+		err := client.Exchange(server.URL+"/users/1",
+			request.WithRequestContext(ctx),
+			request.WithRoute("/users/:id"),
+			request.WithResult(&ret))
+		parent.End()
+		if err != nil {
+			t.Fatal(err)
+		}
+		spans := exporter.Spans()
+		if len(spans) != 2 {
+			t.Fatal("expect 2 spans but get ", len(spans))
+		}
+		span := spans[0]
+		if span.Name != "GET /users/:id" || span.Kind != SpanKindClient {
+			t.Fatal(span.Name, span.Kind)
+		}
+		if span.SpanContext.TraceID != parent.SpanContext().TraceID || span.Parent.SpanID != parent.SpanContext().SpanID {
+			t.Fatal("not child of parent span")
+		}
+		sc, ok := W3C().Extract(received)
+		if !ok || sc.TraceID != span.SpanContext.TraceID || sc.SpanID != span.SpanContext.SpanID || !sc.IsSampled() {
+			t.Fatal("traceparent not match: ", received.Get(HeaderTraceParent))
+		}
+		sc, ok = B3(true).Extract(received)
+		if !ok || sc.SpanID != span.SpanContext.SpanID {
+			t.Fatal("b3 not match: ", received.Get(HeaderB3))
+		}
+		if span.Attributes[AttrHttpStatusCode] != http.StatusOK ||
+			span.Attributes[AttrHttpMethod] != http.MethodGet ||
+			span.Attributes[AttrUrlFull] != server.URL+"/users/1" ||
+			span.Attributes[AttrHttpRoute] != "/users/:id" ||
+			span.Attributes[AttrResponseBodySize] != int64(5) {
+			t.Fatal(span.Attributes)
+		}
+		if span.Status != StatusUnset {
+			t.Fatal("expect status unset but get ", span.Status)
+		}
+	})
+
+	t.Run("status error", func(t *testing.T) {
+		exporter.Reset()
+		err := client.Exchange(server.URL + "/notfound")
+		if err == nil {
+			t.Fatal("expect error")
+		}
+		spans := exporter.Spans()
+		if len(spans) != 1 {
+			t.Fatal("expect 1 span but get ", len(spans))
+		}
+		if spans[0].Status != StatusError || spans[0].Attributes[AttrErrorType] != "404" {
+			t.Fatal(spans[0].Status, spans[0].Attributes)
+		}
+	})
+
+	t.Run("decode error", func(t *testing.T) {
+		exporter.Reset()
+		ret := struct {
+			Name string `json:"name"`
+		}{}
+		err := client.Exchange(server.URL+"/invalid", request.WithResult(&ret))
+		if err == nil {
+			t.Fatal("expect error")
+		}
+		spans := exporter.Spans()
+		if len(spans) != 1 {
+			t.Fatal("expect 1 span but get ", len(spans))
+		}
+		if spans[0].Status != StatusError || len(spans[0].Errors) != 1 ||
+			spans[0].Attributes[AttrHttpStatusCode] != http.StatusOK {
+			t.Fatal(spans[0].Status, spans[0].Errors, spans[0].Attributes)
+		}
+		if v := spans[0].Attributes[AttrErrorType]; v != fmt.Sprintf("%T", err.Origin()) {
+			t.Fatal(v)
+		}
+	})
+
+	t.Run("connection error", func(t *testing.T) {
+		exporter.Reset()
+		err := client.Exchange("http://127.0.0.1:1/none")
+		if err == nil {
+			t.Fatal("expect error")
+		}
+		spans := exporter.Spans()
+		if len(spans) != 1 {
+			t.Fatal("expect 1 span but get ", len(spans))
+		}
+		if spans[0].Status != StatusError || len(spans[0].Errors) != 1 {
+			t.Fatal(spans[0].Status, spans[0].Errors)
+		}
+		if _, ok := spans[0].Attributes[AttrHttpStatusCode]; ok {
+			t.Fatal("expect no status code")
+		}
+	})
+}
+
+func TestFilterRetry(t *testing.T) {
+	count := 0
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		count++
+		if count < 3 {
+			writer.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = writer.Write([]byte("hello"))
+	}))
+	defer server.Close()
+
+	exporter := NewInMemoryExporter()
+	// 跟踪filter位于重试内层，每次发送一个span
+	client := restclient.New(restclient.AddIFilter(NewFilter(NewTracer(exporter))),
+		restclient.AddIFilter(filter.NewRetry(filter.OptSetRetryBackoff(time.Millisecond, time.Millisecond))))
+	ret := ""
+	if err := client.Exchange(server.URL, request.WithResult(&ret)); err != nil {
+		t.Fatal(err)
+	}
+	spans := exporter.Spans()
+	if len(spans) != 3 {
+		t.Fatal("expect 3 spans but get ", len(spans))
+	}
+	for i, span := range spans {
+		n, ok := span.Attributes[AttrHttpResendCount]
+		if i == 0 && ok || i > 0 && n != i {
+			t.Fatal(i, span.Attributes)
+		}
+	}
+	if spans[0].Status != StatusError || spans[2].Status != StatusUnset {
+		t.Fatal(spans[0].Status, spans[2].Status)
+	}
+}
+
+func TestPropagator(t *testing.T) {
+	header := http.Header{}
+	header.Set(HeaderTraceParent, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	header.Set(HeaderTraceState, "congo=t61rcWkgMzE")
+	sc, ok := W3C().Extract(header)
+	if !ok || sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" ||
+		sc.SpanID.String() != "00f067aa0ba902b7" || !sc.IsSampled() || sc.TraceState != "congo=t61rcWkgMzE" {
+		t.Fatal(sc)
+	}
+
+	out := http.Header{}
+	W3C().Inject(sc, out)
+	if out.Get(HeaderTraceParent) != header.Get(HeaderTraceParent) || out.Get(HeaderTraceState) != "congo=t61rcWkgMzE" {
+		t.Fatal(out)
+	}
+
+	B3(false).Inject(sc, out)
+	sc2, ok := B3(false).Extract(out)
+	if !ok || sc2.TraceID != sc.TraceID || sc2.SpanID != sc.SpanID || !sc2.IsSampled() {
+		t.Fatal(sc2)
+	}
+
+	for _, v := range []string{
+		"",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+	} {
+		header.Set(HeaderTraceParent, v)
+		if _, ok := W3C().Extract(header); ok {
+			t.Fatal("expect invalid: ", v)
+		}
+	}
+}
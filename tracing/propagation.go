@@ -0,0 +1,170 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tracing
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const (
+	HeaderTraceParent = "traceparent"
+	HeaderTraceState  = "tracestate"
+
+	HeaderB3           = "b3"
+	HeaderB3TraceId    = "X-B3-TraceId"
+	HeaderB3SpanId     = "X-B3-SpanId"
+	HeaderB3ParentId   = "X-B3-ParentSpanId"
+	HeaderB3Sampled    = "X-B3-Sampled"
+	HeaderB3DebugFlags = "X-B3-Flags"
+)
+
+// Propagator 在http header中传递SpanContext
+type Propagator interface {
+	Inject(sc SpanContext, header http.Header)
+	Extract(header http.Header) (SpanContext, bool)
+}
+
+type w3c struct{}
+
+// W3C W3C Trace Context格式（traceparent、tracestate）
+func W3C() Propagator {
+	return w3c{}
+}
+
+func (w3c) Inject(sc SpanContext, header http.Header) {
+	if !sc.IsValid() {
+		return
+	}
+	header.Set(HeaderTraceParent, fmt.Sprintf("00-%s-%s-%02x", sc.TraceID, sc.SpanID, sc.Flags))
+	if sc.TraceState != "" {
+		header.Set(HeaderTraceState, sc.TraceState)
+	} else {
+		header.Del(HeaderTraceState)
+	}
+}
+
+func (w3c) Extract(header http.Header) (SpanContext, bool) {
+	parts := strings.Split(strings.TrimSpace(header.Get(HeaderTraceParent)), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return SpanContext{}, false
+	}
+	// version 00只有4个字段，更高版本允许追加字段
+	if parts[0] == "00" && len(parts) != 4 {
+		return SpanContext{}, false
+	}
+	sc := SpanContext{Remote: true}
+	if !decodeHex(parts[1], sc.TraceID[:]) || !decodeHex(parts[2], sc.SpanID[:]) {
+		return SpanContext{}, false
+	}
+	var flags [1]byte
+	if !decodeHex(parts[3], flags[:]) {
+		return SpanContext{}, false
+	}
+	sc.Flags = flags[0]
+	sc.TraceState = strings.Join(header.Values(HeaderTraceState), ",")
+	return sc, sc.IsValid()
+}
+
+type b3 struct {
+	single bool
+}
+
+// B3 Zipkin B3格式
+// single：true使用单个b3 header，false使用X-B3-*多个header
+func B3(single bool) Propagator {
+	return b3{single: single}
+}
+
+func (p b3) Inject(sc SpanContext, header http.Header) {
+	if !sc.IsValid() {
+		return
+	}
+	sampled := "0"
+	if sc.IsSampled() {
+		sampled = "1"
+	}
+	if p.single {
+		header.Set(HeaderB3, fmt.Sprintf("%s-%s-%s", sc.TraceID, sc.SpanID, sampled))
+		return
+	}
+	header.Set(HeaderB3TraceId, sc.TraceID.String())
+	header.Set(HeaderB3SpanId, sc.SpanID.String())
+	header.Set(HeaderB3Sampled, sampled)
+}
+
+func (p b3) Extract(header http.Header) (SpanContext, bool) {
+	sc := SpanContext{Remote: true}
+	if v := header.Get(HeaderB3); v != "" {
+		parts := strings.Split(v, "-")
+		if len(parts) < 2 || !decodeB3TraceID(parts[0], &sc.TraceID) || !decodeHex(parts[1], sc.SpanID[:]) {
+			return SpanContext{}, false
+		}
+		if len(parts) > 2 && (parts[2] == "1" || parts[2] == "d") {
+			sc.Flags = FlagSampled
+		}
+		return sc, sc.IsValid()
+	}
+	if !decodeB3TraceID(header.Get(HeaderB3TraceId), &sc.TraceID) ||
+		!decodeHex(header.Get(HeaderB3SpanId), sc.SpanID[:]) {
+		return SpanContext{}, false
+	}
+	if header.Get(HeaderB3Sampled) == "1" || header.Get(HeaderB3DebugFlags) == "1" {
+		sc.Flags = FlagSampled
+	}
+	return sc, sc.IsValid()
+}
+
+type composite []Propagator
+
+// Composite 组合多个Propagator，注入时全部注入，提取时使用第一个成功的结果
+func Composite(propagators ...Propagator) Propagator {
+	return composite(propagators)
+}
+
+func (c composite) Inject(sc SpanContext, header http.Header) {
+	for _, p := range c {
+		p.Inject(sc, header)
+	}
+}
+
+func (c composite) Extract(header http.Header) (SpanContext, bool) {
+	for _, p := range c {
+		if sc, ok := p.Extract(header); ok {
+			return sc, true
+		}
+	}
+	return SpanContext{}, false
+}
+
+// decodeB3TraceID B3允许64位的trace id，高位补0
+func decodeB3TraceID(s string, id *TraceID) bool {
+	if len(s) == 16 {
+		s = "0000000000000000" + s
+	}
+	return decodeHex(s, id[:])
+}
+
+func decodeHex(s string, dst []byte) bool {
+	if len(s) != hex.EncodedLen(len(dst)) || strings.ToLower(s) != s {
+		return false
+	}
+	_, err := hex.Decode(dst, []byte(s))
+	return err == nil
+}
@@ -0,0 +1,158 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+)
+
+type TraceID [16]byte
+type SpanID [8]byte
+
+func (t TraceID) IsValid() bool {
+	return t != TraceID{}
+}
+
+func (t TraceID) String() string {
+	return hex.EncodeToString(t[:])
+}
+
+func (s SpanID) IsValid() bool {
+	return s != SpanID{}
+}
+
+func (s SpanID) String() string {
+	return hex.EncodeToString(s[:])
+}
+
+// NewTraceID 生成随机的TraceID
+func NewTraceID() TraceID {
+	var ret TraceID
+	for !ret.IsValid() {
+		_, _ = rand.Read(ret[:])
+	}
+	return ret
+}
+
+// NewSpanID 生成随机的SpanID
+func NewSpanID() SpanID {
+	var ret SpanID
+	for !ret.IsValid() {
+		_, _ = rand.Read(ret[:])
+	}
+	return ret
+}
+
+const (
+	// 采样标志
+	FlagSampled byte = 0x01
+)
+
+// SpanContext 跨进程传递的span信息
+type SpanContext struct {
+	TraceID    TraceID
+	SpanID     SpanID
+	Flags      byte
+	TraceState string
+	// 是否从上游传递而来
+	Remote bool
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+func (sc SpanContext) IsSampled() bool {
+	return sc.Flags&FlagSampled != 0
+}
+
+type SpanKind int
+
+const (
+	SpanKindInternal SpanKind = iota
+	SpanKindServer
+	SpanKindClient
+	SpanKindProducer
+	SpanKindConsumer
+)
+
+type StatusCode int
+
+const (
+	StatusUnset StatusCode = iota
+	StatusOk
+	StatusError
+)
+
+// Span 单个操作的跟踪记录
+type Span interface {
+	SpanContext() SpanContext
+
+	// 设置属性，key建议使用OpenTelemetry语义约定的名称
+	SetAttribute(key string, value interface{})
+
+	// 设置状态
+	SetStatus(code StatusCode, description string)
+
+	// 记录错误
+	RecordError(err error)
+
+	// 结束span，只应调用一次
+	End()
+}
+
+// Tracer 创建span，可以对接OpenTelemetry等实现
+type Tracer interface {
+	// 创建span，ctx中存在span或远端SpanContext时作为父span，返回包含新span的context
+	Start(ctx context.Context, name string, kind SpanKind) (context.Context, Span)
+}
+
+type spanKey struct{}
+type remoteKey struct{}
+
+// ContextWithSpan 将span保存到context中
+func ContextWithSpan(ctx context.Context, span Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// SpanFromContext 获得context中的span，不存在时返回nil
+func SpanFromContext(ctx context.Context) Span {
+	if span, ok := ctx.Value(spanKey{}).(Span); ok {
+		return span
+	}
+	return nil
+}
+
+// ContextWithRemoteSpanContext 保存从上游传递的SpanContext，如服务端通过Propagator.Extract获得
+func ContextWithRemoteSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	sc.Remote = true
+	return context.WithValue(ctx, remoteKey{}, sc)
+}
+
+// ParentSpanContext 获得context中的父SpanContext，优先使用本地span
+func ParentSpanContext(ctx context.Context) (SpanContext, bool) {
+	if span := SpanFromContext(ctx); span != nil {
+		sc := span.SpanContext()
+		return sc, sc.IsValid()
+	}
+	if sc, ok := ctx.Value(remoteKey{}).(SpanContext); ok {
+		return sc, sc.IsValid()
+	}
+	return SpanContext{}, false
+}
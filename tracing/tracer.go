@@ -0,0 +1,169 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tracing
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// SpanData 已结束span的数据
+type SpanData struct {
+	Name              string
+	Kind              SpanKind
+	SpanContext       SpanContext
+	Parent            SpanContext
+	StartTime         time.Time
+	EndTime           time.Time
+	Attributes        map[string]interface{}
+	Status            StatusCode
+	StatusDescription string
+	Errors            []error
+}
+
+// Exporter 导出已结束的span
+type Exporter interface {
+	ExportSpan(data *SpanData)
+}
+
+// DefaultTracer 简单的Tracer实现，span结束时交给Exporter导出
+// 未接入OpenTelemetry时可直接使用，也可以配合InMemoryExporter用于测试
+type DefaultTracer struct {
+	exporter Exporter
+}
+
+// NewTracer 创建Tracer，span结束时调用exporter导出
+func NewTracer(exporter Exporter) *DefaultTracer {
+	return &DefaultTracer{
+		exporter: exporter,
+	}
+}
+
+func (t *DefaultTracer) Start(ctx context.Context, name string, kind SpanKind) (context.Context, Span) {
+	span := &defaultSpan{
+		exporter: t.exporter,
+		data: SpanData{
+			Name:       name,
+			Kind:       kind,
+			StartTime:  time.Now(),
+			Attributes: map[string]interface{}{},
+		},
+	}
+	if parent, ok := ParentSpanContext(ctx); ok {
+		span.data.Parent = parent
+		span.data.SpanContext = SpanContext{
+			TraceID:    parent.TraceID,
+			SpanID:     NewSpanID(),
+			Flags:      parent.Flags,
+			TraceState: parent.TraceState,
+		}
+	} else {
+		span.data.SpanContext = SpanContext{
+			TraceID: NewTraceID(),
+			SpanID:  NewSpanID(),
+			Flags:   FlagSampled,
+		}
+	}
+	return ContextWithSpan(ctx, span), span
+}
+
+type defaultSpan struct {
+	exporter Exporter
+	lock     sync.Mutex
+	data     SpanData
+	ended    bool
+}
+
+func (s *defaultSpan) SpanContext() SpanContext {
+	return s.data.SpanContext
+}
+
+func (s *defaultSpan) SetAttribute(key string, value interface{}) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if !s.ended {
+		s.data.Attributes[key] = value
+	}
+}
+
+func (s *defaultSpan) SetStatus(code StatusCode, description string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	// 按OpenTelemetry约定，Ok状态不会被覆盖
+	if !s.ended && s.data.Status != StatusOk {
+		s.data.Status = code
+		s.data.StatusDescription = description
+	}
+}
+
+func (s *defaultSpan) RecordError(err error) {
+	if err == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if !s.ended {
+		s.data.Errors = append(s.data.Errors, err)
+	}
+}
+
+func (s *defaultSpan) End() {
+	s.lock.Lock()
+	if s.ended {
+		s.lock.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.EndTime = time.Now()
+	data := s.data
+	s.lock.Unlock()
+
+	if s.exporter != nil && data.SpanContext.IsSampled() {
+		s.exporter.ExportSpan(&data)
+	}
+}
+
+// InMemoryExporter 将span保存在内存中，主要用于测试
+type InMemoryExporter struct {
+	lock  sync.Mutex
+	spans []*SpanData
+}
+
+func NewInMemoryExporter() *InMemoryExporter {
+	return &InMemoryExporter{}
+}
+
+func (e *InMemoryExporter) ExportSpan(data *SpanData) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.spans = append(e.spans, data)
+}
+
+// Spans 获得已导出的span
+func (e *InMemoryExporter) Spans() []*SpanData {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return append([]*SpanData(nil), e.spans...)
+}
+
+// Reset 清空已导出的span
+func (e *InMemoryExporter) Reset() {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.spans = nil
+}
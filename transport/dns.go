@@ -0,0 +1,252 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package transport
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// 默认DNS缓存有效时间
+	DefaultDnsTTL = 60 * time.Second
+	// 默认DNS解析失败缓存时间
+	DefaultDnsNegativeTTL = 5 * time.Second
+)
+
+// HostLookup 域名解析器，*net.Resolver实现了该接口
+type HostLookup interface {
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+type dnsEntry struct {
+	addrs  []string
+	err    error
+	expire time.Time
+	next   int
+
+	// 解析中的请求在done关闭前等待，避免并发重复解析
+	done chan struct{}
+}
+
+// DnsCache 带缓存的域名解析器
+// 1、解析成功的结果缓存ttl时间，解析失败的结果缓存negativeTTL时间
+// 2、支持静态域名映射（类似/etc/hosts），静态映射永不过期
+// 3、每次获取时对返回的地址做轮询（round-robin）
+type DnsCache struct {
+	lookup      HostLookup
+	ttl         time.Duration
+	negativeTTL time.Duration
+	hosts       map[string]*dnsEntry
+
+	entries map[string]*dnsEntry
+	lock    sync.Mutex
+}
+
+type DnsCacheOpt func(*DnsCache)
+
+// NewDnsCache 创建带缓存的域名解析器，默认使用net.DefaultResolver解析
+func NewDnsCache(opts ...DnsCacheOpt) *DnsCache {
+	ret := &DnsCache{
+		lookup:      net.DefaultResolver,
+		ttl:         DefaultDnsTTL,
+		negativeTTL: DefaultDnsNegativeTTL,
+		hosts:       map[string]*dnsEntry{},
+		entries:     map[string]*dnsEntry{},
+	}
+	for _, opt := range opts {
+		opt(ret)
+	}
+	return ret
+}
+
+// OptSetDnsTTL 配置解析成功结果的缓存时间，小于等于0则不缓存
+func OptSetDnsTTL(ttl time.Duration) DnsCacheOpt {
+	return func(cache *DnsCache) {
+		cache.ttl = ttl
+	}
+}
+
+// OptSetDnsNegativeTTL 配置解析失败结果的缓存时间，小于等于0则不缓存
+func OptSetDnsNegativeTTL(ttl time.Duration) DnsCacheOpt {
+	return func(cache *DnsCache) {
+		cache.negativeTTL = ttl
+	}
+}
+
+// OptAddDnsHost 添加静态域名映射，优先于实际解析
+func OptAddDnsHost(host string, addrs ...string) DnsCacheOpt {
+	return func(cache *DnsCache) {
+		host = normalizeHost(host)
+		entry, ok := cache.hosts[host]
+		if !ok {
+			entry = &dnsEntry{}
+			cache.hosts[host] = entry
+		}
+		entry.addrs = append(entry.addrs, addrs...)
+	}
+}
+
+// OptSetDnsLookup 配置实际的域名解析器，如自定义DNS服务器的*net.Resolver
+func OptSetDnsLookup(lookup HostLookup) DnsCacheOpt {
+	return func(cache *DnsCache) {
+		cache.lookup = lookup
+	}
+}
+
+// LookupHost 解析域名，返回的地址列表按轮询顺序排列
+func (c *DnsCache) LookupHost(ctx context.Context, host string) ([]string, error) {
+	host = normalizeHost(host)
+	if ip := net.ParseIP(host); ip != nil {
+		return []string{host}, nil
+	}
+
+	c.lock.Lock()
+	if entry, ok := c.hosts[host]; ok {
+		ret := entry.rotate()
+		c.lock.Unlock()
+		return ret, nil
+	}
+	for {
+		entry, ok := c.entries[host]
+		if !ok {
+			break
+		}
+		if entry.done != nil {
+			// 已有协程在解析，等待结果
+			done := entry.done
+			c.lock.Unlock()
+			select {
+			case <-done:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+			c.lock.Lock()
+			continue
+		}
+		if time.Now().Before(entry.expire) {
+			if entry.err != nil {
+				c.lock.Unlock()
+				return nil, entry.err
+			}
+			ret := entry.rotate()
+			c.lock.Unlock()
+			return ret, nil
+		}
+		break
+	}
+	entry := &dnsEntry{done: make(chan struct{})}
+	c.entries[host] = entry
+	c.lock.Unlock()
+
+	addrs, err := c.lookup.LookupHost(ctx, host)
+	if err == nil && len(addrs) == 0 {
+		err = &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	close(entry.done)
+	entry.done = nil
+	entry.addrs = addrs
+	entry.err = err
+
+	ttl := c.ttl
+	if err != nil {
+		ttl = c.negativeTTL
+		// 调用方取消导致的失败不缓存
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			ttl = 0
+		}
+	}
+	if ttl > 0 {
+		entry.expire = time.Now().Add(ttl)
+	} else {
+		delete(c.entries, host)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return entry.rotate(), nil
+}
+
+// Clear 清除所有缓存的解析结果，静态映射不受影响
+func (c *DnsCache) Clear() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for k, v := range c.entries {
+		if v.done == nil {
+			delete(c.entries, k)
+		}
+	}
+}
+
+// DialContext 使用缓存的解析结果建立连接，按轮询顺序依次尝试解析到的地址
+// dialer为nil时使用默认配置的net.Dialer
+func (c *DnsCache) DialContext(dialer *net.Dialer) func(ctx context.Context, network, address string) (net.Conn, error) {
+	if dialer == nil {
+		dialer = &net.Dialer{
+			Timeout:   ConnectTimeout,
+			KeepAlive: KeepaliveTime,
+		}
+	}
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, err
+		}
+		addrs, err := c.LookupHost(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		var lastErr error
+		for _, addr := range addrs {
+			conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(addr, port))
+			if err == nil {
+				return conn, nil
+			}
+			lastErr = err
+			if ctx.Err() != nil {
+				break
+			}
+		}
+		return nil, lastErr
+	}
+}
+
+func (e *dnsEntry) rotate() []string {
+	l := len(e.addrs)
+	if l == 0 {
+		return nil
+	}
+	ret := make([]string, l)
+	for i := 0; i < l; i++ {
+		ret[i] = e.addrs[(e.next+i)%l]
+	}
+	e.next = (e.next + 1) % l
+	return ret
+}
+
+func normalizeHost(host string) string {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	return strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+}
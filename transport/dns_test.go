@@ -0,0 +1,133 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package transport
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testLookup struct {
+	addrs []string
+	err   error
+	count int
+	lock  sync.Mutex
+}
+
+func (l *testLookup) LookupHost(ctx context.Context, host string) ([]string, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.count++
+	return l.addrs, l.err
+}
+
+func TestDnsCache(t *testing.T) {
+	t.Run("ttl", func(t *testing.T) {
+		lookup := &testLookup{addrs: []string{"10.0.0.1", "10.0.0.2"}}
+		cache := NewDnsCache(OptSetDnsLookup(lookup), OptSetDnsTTL(100*time.Millisecond))
+		for i := 0; i < 3; i++ {
+			_, err := cache.LookupHost(context.Background(), "svc.local")
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if lookup.count != 1 {
+			t.Fatal("expect 1 lookup but get ", lookup.count)
+		}
+		time.Sleep(150 * time.Millisecond)
+		_, _ = cache.LookupHost(context.Background(), "svc.local")
+		if lookup.count != 2 {
+			t.Fatal("expect 2 lookup but get ", lookup.count)
+		}
+	})
+
+	t.Run("negative", func(t *testing.T) {
+		lookup := &testLookup{err: errors.New("lookup failed")}
+		cache := NewDnsCache(OptSetDnsLookup(lookup), OptSetDnsNegativeTTL(time.Second))
+		for i := 0; i < 3; i++ {
+			_, err := cache.LookupHost(context.Background(), "svc.local")
+			if err == nil {
+				t.Fatal("expect error")
+			}
+		}
+		if lookup.count != 1 {
+			t.Fatal("expect 1 lookup but get ", lookup.count)
+		}
+		cache.Clear()
+		_, _ = cache.LookupHost(context.Background(), "svc.local")
+		if lookup.count != 2 {
+			t.Fatal("expect 2 lookup but get ", lookup.count)
+		}
+	})
+
+	t.Run("round robin", func(t *testing.T) {
+		lookup := &testLookup{addrs: []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"}}
+		cache := NewDnsCache(OptSetDnsLookup(lookup))
+		for i := 0; i < 6; i++ {
+			addrs, err := cache.LookupHost(context.Background(), "svc.local")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if addrs[0] != lookup.addrs[i%3] {
+				t.Fatalf("expect %s but get %s", lookup.addrs[i%3], addrs[0])
+			}
+		}
+	})
+
+	t.Run("static host", func(t *testing.T) {
+		lookup := &testLookup{addrs: []string{"10.0.0.1"}}
+		cache := NewDnsCache(OptSetDnsLookup(lookup), OptAddDnsHost("My.Host", "127.0.0.1"))
+		addrs, err := cache.LookupHost(context.Background(), "my.host")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(addrs) != 1 || addrs[0] != "127.0.0.1" {
+			t.Fatal(addrs)
+		}
+		if lookup.count != 0 {
+			t.Fatal("static host must not lookup")
+		}
+	})
+}
+
+func TestDnsCacheDial(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	cache := NewDnsCache(OptSetDnsLookup(&testLookup{err: errors.New("must not lookup")}),
+		OptAddDnsHost("restclient.test", "127.0.0.1"))
+	client := &http.Client{
+		Transport: New(SetDialContext(time.Second, KeepaliveTime, cache)),
+	}
+	resp, err := client.Get("http://restclient.test:" + port + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatal("not 200")
+	}
+}
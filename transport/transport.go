@@ -17,8 +17,10 @@
 package transport
 
 import (
+	"crypto/tls"
 	"net"
 	"net/http"
+	"net/url"
 	"time"
 )
 
@@ -54,13 +56,20 @@ func New(opts ...Opt) *http.Transport {
 	return ret
 }
 
-func SetDialContext(connTimeout, keepAlive time.Duration) Opt {
+// SetDialContext 配置连接超时及keepalive时间
+// dnsCache：可选，配置后使用带缓存的域名解析器解析地址，见NewDnsCache
+func SetDialContext(connTimeout, keepAlive time.Duration, dnsCache ...*DnsCache) Opt {
 	return func(transport *http.Transport) {
-		transport.DialContext = (&net.Dialer{
+		dialer := &net.Dialer{
 			Timeout:   connTimeout,
 			KeepAlive: keepAlive,
 			DualStack: true,
-		}).DialContext
+		}
+		if len(dnsCache) > 0 && dnsCache[0] != nil {
+			transport.DialContext = dnsCache[0].DialContext(dialer)
+		} else {
+			transport.DialContext = dialer.DialContext
+		}
 	}
 }
 
@@ -93,3 +102,24 @@ func SetExpectContinueTimeout(time time.Duration) Opt {
 		transport.ExpectContinueTimeout = time
 	}
 }
+
+// SetMaxConnectsPerHost 配置每个host的最大连接数（包括使用中及空闲的连接），0表示不限制
+func SetMaxConnectsPerHost(size int) Opt {
+	return func(transport *http.Transport) {
+		transport.MaxConnsPerHost = size
+	}
+}
+
+// SetTlsConfig 配置TLS客户端参数，如根证书、客户端证书、最低版本等
+func SetTlsConfig(config *tls.Config) Opt {
+	return func(transport *http.Transport) {
+		transport.TLSClientConfig = config
+	}
+}
+
+// SetProxy 配置代理，默认使用环境变量（HTTP_PROXY、HTTPS_PROXY、NO_PROXY）中的代理，nil表示不使用代理
+func SetProxy(proxy func(*http.Request) (*url.URL, error)) Opt {
+	return func(transport *http.Transport) {
+		transport.Proxy = proxy
+	}
+}
@@ -0,0 +1,133 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package vcr
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// cassette格式版本
+	CassetteVersion = 1
+	// body编码：base64，用于非文本的body
+	EncodingBase64 = "base64"
+)
+
+// Cassette 录制的请求、应答记录
+// 扩展名为.json的文件按json读写，其他按yaml读写
+type Cassette struct {
+	Version      int            `json:"version" yaml:"version"`
+	Interactions []*Interaction `json:"interactions" yaml:"interactions"`
+}
+
+// Interaction 一次请求及其应答，请求失败时Error不为空
+type Interaction struct {
+	Request  Request   `json:"request" yaml:"request"`
+	Response *Response `json:"response,omitempty" yaml:"response,omitempty"`
+	Error    string    `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+type Request struct {
+	Method       string      `json:"method" yaml:"method"`
+	URL          string      `json:"url" yaml:"url"`
+	Header       http.Header `json:"header,omitempty" yaml:"header,omitempty"`
+	Body         string      `json:"body,omitempty" yaml:"body,omitempty"`
+	BodyEncoding string      `json:"bodyEncoding,omitempty" yaml:"bodyEncoding,omitempty"`
+}
+
+type Response struct {
+	Status       string      `json:"status" yaml:"status"`
+	StatusCode   int         `json:"statusCode" yaml:"statusCode"`
+	Proto        string      `json:"proto" yaml:"proto"`
+	Header       http.Header `json:"header,omitempty" yaml:"header,omitempty"`
+	Body         string      `json:"body,omitempty" yaml:"body,omitempty"`
+	BodyEncoding string      `json:"bodyEncoding,omitempty" yaml:"bodyEncoding,omitempty"`
+}
+
+// LoadCassette 从文件读取cassette
+func LoadCassette(path string) (*Cassette, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	ret := &Cassette{}
+	if isJson(path) {
+		err = json.Unmarshal(data, ret)
+	} else {
+		err = yaml.Unmarshal(data, ret)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// Save 将cassette写入文件，目录不存在时自动创建
+func (c *Cassette) Save(path string) error {
+	var (
+		data []byte
+		err  error
+	)
+	if isJson(path) {
+		data, err = json.MarshalIndent(c, "", "  ")
+	} else {
+		data, err = yaml.Marshal(c)
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+func isJson(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".json")
+}
+
+func encodeBody(data []byte) (string, string) {
+	if utf8.Valid(data) {
+		return string(data), ""
+	}
+	return base64.StdEncoding.EncodeToString(data), EncodingBase64
+}
+
+func decodeBody(body, encoding string) ([]byte, error) {
+	if encoding == EncodingBase64 {
+		return base64.StdEncoding.DecodeString(body)
+	}
+	return []byte(body), nil
+}
+
+// BodyBytes 获得请求body的原始数据
+func (r *Request) BodyBytes() ([]byte, error) {
+	return decodeBody(r.Body, r.BodyEncoding)
+}
+
+// BodyBytes 获得应答body的原始数据
+func (r *Response) BodyBytes() ([]byte, error) {
+	return decodeBody(r.Body, r.BodyEncoding)
+}
@@ -0,0 +1,121 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package vcr
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"reflect"
+)
+
+// Matcher 判断实际的请求与录制的请求是否匹配
+// 录制时已脱敏（值为Redacted）的header及query参数匹配任意值
+type Matcher func(actual, recorded *Request) bool
+
+// DefaultMatchers 默认匹配方法及url
+var DefaultMatchers = []Matcher{MatchMethod, MatchURL}
+
+// MatchMethod 匹配请求方法
+func MatchMethod(actual, recorded *Request) bool {
+	return actual.Method == recorded.Method
+}
+
+// MatchURL 匹配url，query参数与顺序无关
+func MatchURL(actual, recorded *Request) bool {
+	a, err := url.Parse(actual.URL)
+	if err != nil {
+		return false
+	}
+	r, err := url.Parse(recorded.URL)
+	if err != nil {
+		return false
+	}
+	if a.Scheme != r.Scheme || a.Host != r.Host || a.Path != r.Path {
+		return false
+	}
+	return matchValues(a.Query(), r.Query())
+}
+
+// MatchPath 仅匹配url的path，用于测试服务地址每次不同的情况（如httptest.Server）
+func MatchPath(actual, recorded *Request) bool {
+	a, err := url.Parse(actual.URL)
+	if err != nil {
+		return false
+	}
+	r, err := url.Parse(recorded.URL)
+	if err != nil {
+		return false
+	}
+	return a.Path == r.Path && matchValues(a.Query(), r.Query())
+}
+
+// MatchBody 匹配请求body，两者均为json时按json语义比较
+func MatchBody(actual, recorded *Request) bool {
+	a, err := actual.BodyBytes()
+	if err != nil {
+		return false
+	}
+	r, err := recorded.BodyBytes()
+	if err != nil {
+		return false
+	}
+	if bytes.Equal(a, r) {
+		return true
+	}
+	var av, rv interface{}
+	if json.Unmarshal(a, &av) == nil && json.Unmarshal(r, &rv) == nil {
+		return reflect.DeepEqual(av, rv)
+	}
+	return false
+}
+
+// MatchHeaders 匹配指定的请求header
+func MatchHeaders(names ...string) Matcher {
+	return func(actual, recorded *Request) bool {
+		a, r := http.Header{}, http.Header{}
+		for _, name := range names {
+			name = http.CanonicalHeaderKey(name)
+			if v, ok := actual.Header[name]; ok {
+				a[name] = v
+			}
+			if v, ok := recorded.Header[name]; ok {
+				r[name] = v
+			}
+		}
+		return matchValues(url.Values(a), url.Values(r))
+	}
+}
+
+func matchValues(actual, recorded url.Values) bool {
+	if len(actual) != len(recorded) {
+		return false
+	}
+	for k, rv := range recorded {
+		av, ok := actual[k]
+		if !ok || len(av) != len(rv) {
+			return false
+		}
+		for i := range rv {
+			if rv[i] != Redacted && rv[i] != av[i] {
+				return false
+			}
+		}
+	}
+	return true
+}
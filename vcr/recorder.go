@@ -0,0 +1,376 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package vcr
+
+import (
+	"errors"
+	"fmt"
+	"github.com/xfali/restclient/v2/buffer"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+)
+
+type Mode int
+
+const (
+	// 回放模式：仅使用cassette中的记录，未匹配的请求返回ErrNoMatch
+	ModeReplay Mode = iota
+	// 录制模式：发送真实请求并记录，Save时覆盖cassette
+	ModeRecord
+	// 自动模式：cassette文件存在时回放，否则录制
+	ModeAuto
+)
+
+const (
+	// 脱敏后的值
+	Redacted = "[REDACTED]"
+)
+
+var (
+	// 默认脱敏的header
+	DefaultRedactHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key"}
+
+	// 回放时没有匹配的记录
+	ErrNoMatch = errors.New("vcr: no recorded interaction matched")
+)
+
+// Recorder 录制、回放请求的http.RoundTripper，用于不依赖真实服务的测试：
+// restclient.New(restclient.SetRoundTripper(recorder))
+// 1、录制模式下发送真实请求，记录请求及应答，调用Save写入cassette文件，保存时对header、query参数脱敏
+// 2、回放模式为严格模式，每条记录按顺序最多使用一次，没有匹配的记录时返回ErrNoMatch
+type Recorder struct {
+	path         string
+	mode         Mode
+	transport    http.RoundTripper
+	matchers     []Matcher
+	redactHeader []string
+	redactQuery  []string
+	redactFunc   func(*Interaction)
+	repeat       bool
+
+	cassette *Cassette
+	played   []bool
+	lock     sync.Mutex
+}
+
+type Opt func(*Recorder)
+
+// NewRecorder 创建recorder，回放模式下cassette文件不存在时返回错误
+func NewRecorder(path string, mode Mode, opts ...Opt) (*Recorder, error) {
+	ret := &Recorder{
+		path:         path,
+		mode:         mode,
+		transport:    http.DefaultTransport,
+		matchers:     DefaultMatchers,
+		redactHeader: DefaultRedactHeaders,
+	}
+	for _, opt := range opts {
+		opt(ret)
+	}
+	if ret.mode == ModeAuto {
+		if _, err := os.Stat(path); err == nil {
+			ret.mode = ModeReplay
+		} else {
+			ret.mode = ModeRecord
+		}
+	}
+	if ret.mode == ModeReplay {
+		cassette, err := LoadCassette(path)
+		if err != nil {
+			return nil, err
+		}
+		ret.cassette = cassette
+	} else {
+		ret.cassette = &Cassette{Version: CassetteVersion}
+	}
+	ret.played = make([]bool, len(ret.cassette.Interactions))
+	return ret, nil
+}
+
+// OptSetTransport 配置录制时发送真实请求的RoundTripper，默认为http.DefaultTransport
+func OptSetTransport(transport http.RoundTripper) Opt {
+	return func(r *Recorder) {
+		r.transport = transport
+	}
+}
+
+// OptSetMatchers 配置请求匹配器，所有匹配器均匹配时才认为匹配，默认为DefaultMatchers
+func OptSetMatchers(matchers ...Matcher) Opt {
+	return func(r *Recorder) {
+		r.matchers = matchers
+	}
+}
+
+// OptSetRedactHeaders 配置保存时脱敏的header（同时作用于请求及应答），默认为DefaultRedactHeaders
+func OptSetRedactHeaders(names ...string) Opt {
+	return func(r *Recorder) {
+		r.redactHeader = names
+	}
+}
+
+// OptSetRedactQuery 配置保存时脱敏的url query参数
+func OptSetRedactQuery(names ...string) Opt {
+	return func(r *Recorder) {
+		r.redactQuery = names
+	}
+}
+
+// OptSetRedactFunc 配置保存时自定义的脱敏处理，如替换body中的敏感字段，在header、query参数脱敏后执行
+func OptSetRedactFunc(f func(*Interaction)) Opt {
+	return func(r *Recorder) {
+		r.redactFunc = f
+	}
+}
+
+// OptSetAllowRepeat 配置回放时是否允许重复使用已回放的记录，默认不允许
+func OptSetAllowRepeat(v bool) Opt {
+	return func(r *Recorder) {
+		r.repeat = v
+	}
+}
+
+// Mode 获得实际的工作模式（ModeAuto会被解析为ModeReplay或ModeRecord）
+func (r *Recorder) Mode() Mode {
+	return r.mode
+}
+
+func (r *Recorder) RoundTrip(request *http.Request) (*http.Response, error) {
+	actual, err := newRequest(request)
+	if err != nil {
+		return nil, err
+	}
+	if r.mode == ModeReplay {
+		// 回放时不发送请求，按照RoundTripper的约定，包括出错在内都需要关闭请求body
+		if request.Body != nil {
+			defer request.Body.Close()
+		}
+		return r.replay(request, actual)
+	}
+	return r.record(request, actual)
+}
+
+func (r *Recorder) replay(request *http.Request, actual *Request) (*http.Response, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	found := -1
+	for i, v := range r.cassette.Interactions {
+		if r.match(actual, &v.Request) {
+			if !r.played[i] {
+				found = i
+				break
+			}
+			if r.repeat && found == -1 {
+				found = i
+			}
+		}
+	}
+	if found == -1 {
+		return nil, fmt.Errorf("%w: %s %s", ErrNoMatch, actual.Method, actual.URL)
+	}
+	r.played[found] = true
+	v := r.cassette.Interactions[found]
+	if v.Error != "" {
+		return nil, errors.New(v.Error)
+	}
+	return newResponse(request, v.Response)
+}
+
+func (r *Recorder) match(actual, recorded *Request) bool {
+	for _, m := range r.matchers {
+		if !m(actual, recorded) {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *Recorder) record(request *http.Request, actual *Request) (*http.Response, error) {
+	v := &Interaction{Request: *actual}
+	resp, err := r.transport.RoundTrip(request)
+	if err != nil {
+		v.Error = err.Error()
+	} else {
+		data, rerr := ioutil.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if rerr != nil {
+			return nil, rerr
+		}
+		resp.Body = buffer.NewReadCloser(data)
+		v.Response = &Response{
+			Status:     resp.Status,
+			StatusCode: resp.StatusCode,
+			Proto:      resp.Proto,
+			Header:     resp.Header.Clone(),
+		}
+		v.Response.Body, v.Response.BodyEncoding = encodeBody(data)
+	}
+	r.lock.Lock()
+	r.cassette.Interactions = append(r.cassette.Interactions, v)
+	r.played = append(r.played, true)
+	r.lock.Unlock()
+	return resp, err
+}
+
+// Save 脱敏后将录制的记录写入cassette文件，回放模式下不做任何处理
+func (r *Recorder) Save() error {
+	if r.mode == ModeReplay {
+		return nil
+	}
+	r.lock.Lock()
+	cassette := &Cassette{Version: r.cassette.Version}
+	for _, v := range r.cassette.Interactions {
+		cassette.Interactions = append(cassette.Interactions, r.redact(v))
+	}
+	r.lock.Unlock()
+	return cassette.Save(r.path)
+}
+
+// Unplayed 获得回放模式下未使用的记录，可用于检查测试是否发送了所有预期的请求
+func (r *Recorder) Unplayed() []*Interaction {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	var ret []*Interaction
+	for i, v := range r.cassette.Interactions {
+		if !r.played[i] {
+			ret = append(ret, v)
+		}
+	}
+	return ret
+}
+
+func (r *Recorder) redact(v *Interaction) *Interaction {
+	ret := *v
+	ret.Request.Header = redactHeader(v.Request.Header, r.redactHeader)
+	ret.Request.URL = redactURL(v.Request.URL, r.redactQuery)
+	if v.Response != nil {
+		resp := *v.Response
+		resp.Header = redactHeader(v.Response.Header, r.redactHeader)
+		ret.Response = &resp
+	}
+	if r.redactFunc != nil {
+		r.redactFunc(&ret)
+	}
+	return &ret
+}
+
+func redactHeader(header http.Header, names []string) http.Header {
+	ret := header.Clone()
+	for _, name := range names {
+		if vs := ret.Values(name); len(vs) > 0 {
+			redacted := make([]string, len(vs))
+			for i := range redacted {
+				redacted[i] = Redacted
+			}
+			ret[http.CanonicalHeaderKey(name)] = redacted
+		}
+	}
+	return ret
+}
+
+func redactURL(s string, names []string) string {
+	u, err := url.Parse(s)
+	if err != nil {
+		return s
+	}
+	if u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), Redacted)
+		}
+	}
+	if len(names) > 0 {
+		query := u.Query()
+		changed := false
+		for _, name := range names {
+			if vs, ok := query[name]; ok {
+				for i := range vs {
+					vs[i] = Redacted
+				}
+				changed = true
+			}
+		}
+		if changed {
+			u.RawQuery = query.Encode()
+		}
+	}
+	return u.String()
+}
+
+func newRequest(request *http.Request) (*Request, error) {
+	ret := &Request{
+		Method: request.Method,
+		URL:    request.URL.String(),
+		Header: request.Header.Clone(),
+	}
+	if ret.Header == nil {
+		ret.Header = http.Header{}
+	}
+	if request.Host != "" && request.Host != request.URL.Host {
+		ret.Header.Set("Host", request.Host)
+	}
+	if request.Body == nil || request.Body == http.NoBody {
+		return ret, nil
+	}
+	// 不改变请求body的状态：实现了Bytes方法（如buffer.ReadWriteCloser）时直接读取，
+	// 否则读取后替换为内容相同的body，body由发送请求的Transport或回放时的RoundTrip关闭
+	var data []byte
+	if b, ok := request.Body.(interface{ Bytes() []byte }); ok {
+		data = b.Bytes()
+	} else {
+		var err error
+		data, err = ioutil.ReadAll(request.Body)
+		_ = request.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		request.Body = buffer.NewReadCloser(data)
+	}
+	ret.Body, ret.BodyEncoding = encodeBody(data)
+	return ret, nil
+}
+
+func newResponse(request *http.Request, v *Response) (*http.Response, error) {
+	if v == nil {
+		return nil, fmt.Errorf("%w: %s %s without response", ErrNoMatch, request.Method, request.URL)
+	}
+	data, err := v.BodyBytes()
+	if err != nil {
+		return nil, err
+	}
+	proto := v.Proto
+	if proto == "" {
+		proto = "HTTP/1.1"
+	}
+	major, minor, ok := http.ParseHTTPVersion(proto)
+	if !ok {
+		major, minor = 1, 1
+	}
+	return &http.Response{
+		Status:        v.Status,
+		StatusCode:    v.StatusCode,
+		Proto:         proto,
+		ProtoMajor:    major,
+		ProtoMinor:    minor,
+		Header:        v.Header.Clone(),
+		Body:          buffer.NewReadCloser(data),
+		ContentLength: int64(len(data)),
+		Request:       request,
+	}, nil
+}
@@ -0,0 +1,170 @@
+/*
+ * Copyright 2022 Xiongfa Li.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package vcr
+
+import (
+	"bytes"
+	"errors"
+	"github.com/xfali/restclient/v2"
+	"github.com/xfali/restclient/v2/request"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecorder(t *testing.T) {
+	for _, name := range []string{"cassette.yaml", "cassette.json"} {
+		t.Run(name, func(t *testing.T) {
+			testRecorder(t, name)
+		})
+	}
+}
+
+func testRecorder(t *testing.T, name string) {
+	dir, err := ioutil.TempDir("", "vcr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, name)
+
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		body, _ := ioutil.ReadAll(request.Body)
+		writer.Header().Set("Content-Type", "application/json")
+		writer.Header().Set("Set-Cookie", "session=secret")
+		_, _ = writer.Write(body)
+	}))
+
+	recorder, err := NewRecorder(path, ModeAuto,
+		OptSetMatchers(MatchMethod, MatchURL, MatchBody),
+		OptSetRedactQuery("token"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recorder.Mode() != ModeRecord {
+		t.Fatal("expect record mode")
+	}
+	exchange := func(client restclient.RestClient, name string) (map[string]string, error) {
+		ret := map[string]string{}
+		err := client.Exchange(server.URL+"/echo?token=abc&a=1",
+			request.MethodPost(),
+			request.AddRequestHeader("Authorization", "Bearer secret"),
+			request.WithRequestBody(map[string]string{"name": name}),
+			request.WithResult(&ret))
+		return ret, err
+	}
+	client := restclient.New(restclient.SetRoundTripper(recorder))
+	for _, v := range []string{"a", "b"} {
+		ret, err := exchange(client, v)
+		if err != nil || ret["name"] != v {
+			t.Fatal(ret, err)
+		}
+	}
+	if err := recorder.Save(); err != nil {
+		t.Fatal(err)
+	}
+	server.Close()
+
+	data, _ := ioutil.ReadFile(path)
+	t.Log(string(data))
+	if strings.Contains(string(data), "secret") || strings.Contains(string(data), "abc") {
+		t.Fatal("expect redacted")
+	}
+
+	recorder, err = NewRecorder(path, ModeAuto, OptSetMatchers(MatchMethod, MatchURL, MatchBody))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recorder.Mode() != ModeReplay {
+		t.Fatal("expect replay mode")
+	}
+	client = restclient.New(restclient.SetRoundTripper(recorder))
+	ret, err := exchange(client, "b")
+	if err != nil || ret["name"] != "b" {
+		t.Fatal(ret, err)
+	}
+	if len(recorder.Unplayed()) != 1 {
+		t.Fatal("expect 1 unplayed")
+	}
+	// 每条记录仅回放一次
+	_, err = exchange(client, "b")
+	if !isNoMatch(err) {
+		t.Fatal("expect no match, but get: ", err)
+	}
+	_, err = exchange(client, "c")
+	if !isNoMatch(err) {
+		t.Fatal("expect no match, but get: ", err)
+	}
+}
+
+type closeBody struct {
+	*bytes.Buffer
+	closed bool
+}
+
+func (b *closeBody) Close() error {
+	b.closed = true
+	return nil
+}
+
+func TestReplayCloseBody(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vcr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "cassette.yaml")
+	content := `interactions:
+- request:
+    method: POST
+    url: http://localhost/echo
+  response:
+    statusCode: 200
+`
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	recorder, err := NewRecorder(path, ModeReplay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, u := range []string{"http://localhost/echo", "http://localhost/none"} {
+		body := &closeBody{Buffer: bytes.NewBufferString("hello")}
+		req, _ := http.NewRequest(http.MethodPost, u, body)
+		resp, err := recorder.RoundTrip(req)
+		if resp != nil {
+			resp.Body.Close()
+		}
+		if (err == nil) != (u == "http://localhost/echo") {
+			t.Fatal(u, err)
+		}
+		if !body.closed {
+			t.Fatal("expect request body closed ", u)
+		}
+	}
+}
+
+func isNoMatch(err error) bool {
+	if e, ok := err.(restclient.Error); ok {
+		err = e.Origin()
+	}
+	return errors.Is(err, ErrNoMatch)
+}